@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// maxAPIBodySize is the maximum size in bytes of the body of an API request.
+const maxAPIBodySize = 1 << 20
+
+// envelope wraps the data in an API response in a JSON object so that the
+// response describes what it contains, e.g. {"dive": {...}}.
+type envelope map[string]any
+
+// apiError is the body of an API error response. The field errors are keyed by
+// the name of the field in the request body.
+type apiError struct {
+	Message        string            `json:"message"`
+	FieldErrors    map[string]string `json:"field_errors,omitempty"`
+	NonFieldErrors []string          `json:"non_field_errors,omitempty"`
+}
+
+// writeJSON encodes data as JSON and writes it to the response with the given
+// status code.
+func (app *app) writeJSON(w http.ResponseWriter, status int, data envelope) error {
+	js, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(js)))
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// readJSON decodes the JSON body of an API request into dst. Fields that are
+// not in the body keep their existing values in dst, so that an update only
+// needs to include the fields that are being changed.
+//
+// As the API can be used with the session cookie of a logged in user, the body
+// must be sent with the application/json content type. Browsers will not send
+// that cross-origin without a successful CORS preflight, which protects the API
+// from cross-site request forgery without needing a CSRF token.
+func (app *app) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return errors.New("body must have the application/json content type")
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodySize)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown field %s", fieldName)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		case errors.As(err, &invalidUnmarshalError):
+			panic(err)
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// apiErrorResponse writes an API error response with the given status code
+// and message.
+func (app *app) apiErrorResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
+	err := app.writeJSON(w, status, envelope{"error": apiError{Message: message}})
+	if err != nil {
+		app.log.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// apiServerError logs err and writes a generic 500 Internal Server Error API
+// response so that the details of the error are not leaked to the client.
+func (app *app) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.log.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+
+	msg := "the server encountered a problem and could not process your request"
+	app.apiErrorResponse(w, r, http.StatusInternalServerError, msg)
+}
+
+func (app *app) apiBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	app.apiErrorResponse(w, r, http.StatusBadRequest, err.Error())
+}
+
+func (app *app) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	msg := "the requested resource could not be found"
+	app.apiErrorResponse(w, r, http.StatusNotFound, msg)
+}
+
+func (app *app) apiEditConflict(w http.ResponseWriter, r *http.Request) {
+	msg := "unable to update the record due to an edit conflict, please fetch it and try again"
+	app.apiErrorResponse(w, r, http.StatusConflict, msg)
+}
+
+// apiFailedValidation writes the field and non-field errors from v as a 422
+// Unprocessable Entity API response.
+func (app *app) apiFailedValidation(w http.ResponseWriter, r *http.Request, v validator.Validator) {
+	body := apiError{
+		Message:        "the request contains invalid values",
+		FieldErrors:    v.FieldErrors,
+		NonFieldErrors: v.NonFieldErrors,
+	}
+
+	err := app.writeJSON(w, http.StatusUnprocessableEntity, envelope{"error": body})
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// apiInvalidSort writes an API response for a sort query string value that
+// contains a key that is not in options.
+func apiInvalidSort[T any](app *app, w http.ResponseWriter, r *http.Request, options map[string]T) {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	v := validator.Validator{}
+	v.AddFieldError("sort", "This field must be a comma-separated list of: "+strings.Join(keys, ", "))
+	app.apiFailedValidation(w, r, v)
+}
+
+// readIDParam returns the positive integer ID from the "id" path value of r.
+// The returned bool is false if it is missing or invalid.
+func readIDParam(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// apiInvalidToken writes a 401 Unauthorized API response for a request with an
+// API token that is malformed, unknown or has expired.
+func (app *app) apiInvalidToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	msg := "invalid or expired API token"
+	app.apiErrorResponse(w, r, http.StatusUnauthorized, msg)
+}
+
+// requireAPIAuthentication works in the same way as requireAuthentication, but
+// responds with a 401 Unauthorized API error instead of redirecting to the log
+// in page.
+func (app *app) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Cache-Control", "no-store")
+
+		if !app.isAuthenticated(r) {
+			msg := "you must be authenticated to access this resource"
+			app.apiErrorResponse(w, r, http.StatusUnauthorized, msg)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
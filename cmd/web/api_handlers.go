@@ -0,0 +1,1268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+const apiDefaultPageSize = 20
+
+// The sort options for each type of record that can be listed, keyed by the
+// name used in the "sort" query string value.
+var (
+	buddySortOptions = map[string][2]models.SortBuddy{
+		"id":              {models.SortBuddyIDAsc, models.SortBuddyIDDesc},
+		"name":            {models.SortBuddyNameAsc, models.SortBuddyNameDesc},
+		"dives_with":      {models.SortBuddyDivesWithAsc, models.SortBuddyDivesWithDesc},
+		"first_dive_with": {models.SortBuddyFirstDiveWithAsc, models.SortBuddyFirstDiveWithDesc},
+	}
+
+	certSortOptions = map[string][2]models.SortCert{
+		"id":         {models.SortCertIDAsc, models.SortCertIDDesc},
+		"agency":     {models.SortCertAgencyAsc, models.SortCertAgencyDesc},
+		"name":       {models.SortCertNameAsc, models.SortCertNameDesc},
+		"start_date": {models.SortCertStartDateAsc, models.SortCertStartDateDesc},
+	}
+
+	diveSortOptions = map[string][2]models.SortDive{
+		"id":          {models.SortDiveIDAsc, models.SortDiveIDDesc},
+		"date":        {models.SortDiveDateAsc, models.SortDiveDateDesc},
+		"number":      {models.SortDiveNumberAsc, models.SortDiveNumberDesc},
+		"max_depth":   {models.SortDiveMaxDepthAsc, models.SortDiveMaxDepthDesc},
+		"bottom_time": {models.SortDiveBottomTimeAsc, models.SortDiveBottomTimeDesc},
+		"rating":      {models.SortDiveRatingAsc, models.SortDiveRatingDesc},
+		"dive_site":   {models.SortDiveSiteAsc, models.SortDiveSiteDesc},
+	}
+
+	divePlanSortOptions = map[string][2]models.SortDivePlan{
+		"id":           {models.SortDivePlanIDAsc, models.SortDivePlanIDDesc},
+		"created":      {models.SortDivePlanCreatedAsc, models.SortDivePlanCreatedDesc},
+		"is_solo_dive": {models.SortDivePlanIsSoloDiveAsc, models.SortDivePlanIsSoloDiveDesc},
+		"name":         {models.SortDivePlanNameAsc, models.SortDivePlanNameDesc},
+	}
+
+	diveSiteSortOptions = map[string][2]models.SortDiveSite{
+		"id":       {models.SortDiveSiteIDAsc, models.SortDiveSiteIDDesc},
+		"country":  {models.SortDiveSiteCountryAsc, models.SortDiveSiteCountryDesc},
+		"location": {models.SortDiveSiteLocationAsc, models.SortDiveSiteLocationDesc},
+		"name":     {models.SortDiveSiteNameAsc, models.SortDiveSiteNameDesc},
+		"region":   {models.SortDiveSiteRegionAsc, models.SortDiveSiteRegionDesc},
+	}
+
+	operatorSortOptions = map[string][2]models.SortOperator{
+		"id":       {models.SortOperatorIDAsc, models.SortOperatorIDDesc},
+		"name":     {models.SortOperatorNameAsc, models.SortOperatorNameDesc},
+		"type":     {models.SortOperatorTypeAsc, models.SortOperatorTypeDesc},
+		"street":   {models.SortOperatorStreetAsc, models.SortOperatorStreetDesc},
+		"suburb":   {models.SortOperatorSuburbAsc, models.SortOperatorSuburbDesc},
+		"state":    {models.SortOperatorStateAsc, models.SortOperatorStateDesc},
+		"postcode": {models.SortOperatorPostcodeAsc, models.SortOperatorPostcodeDesc},
+		"country":  {models.SortOperatorCountryAsc, models.SortOperatorCountryDesc},
+	}
+
+	tripSortOptions = map[string][2]models.SortTrip{
+		"id":         {models.SortTripIDAsc, models.SortTripIDDesc},
+		"name":       {models.SortTripNameAsc, models.SortTripNameDesc},
+		"start_date": {models.SortTripStartDateAsc, models.SortTripStartDateDesc},
+	}
+)
+
+// readAPIPager builds a Pager from the "page" and "page_size" query string
+// values of an API list request.
+func (app *app) readAPIPager(qs url.Values) models.Pager {
+	page := app.readInt(qs, "page", 1)
+	pageSize := app.readInt(qs, "page_size", apiDefaultPageSize)
+
+	return models.NewPager(page, pageSize, apiDefaultPageSize)
+}
+
+// apiModelError writes the API response for an error returned by one of the
+// models when getting or updating a single record.
+func (app *app) apiModelError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		app.apiNotFound(w, r)
+	case errors.Is(err, models.ErrUpdateConflict):
+		app.apiEditConflict(w, r)
+	default:
+		app.apiServerError(w, r, err)
+	}
+}
+
+// apiCreated writes the 201 Created API response for a new record, with its
+// URL in the Location header.
+func (app *app) apiCreated(w http.ResponseWriter, r *http.Request, location string, data envelope) {
+	w.Header().Set("Location", location)
+
+	err := app.writeJSON(w, http.StatusCreated, data)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// apiOK writes a 200 OK API response.
+func (app *app) apiOK(w http.ResponseWriter, r *http.Request, data envelope) {
+	err := app.writeJSON(w, http.StatusOK, data)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// The API representations of each type of record embed the form used to create
+// and update them, so that a record that has been fetched can be changed and
+// sent back as it is. The read only values are added alongside the form.
+
+type apiDive struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	diveForm
+	HasProfile bool `json:"has_profile"`
+}
+
+func apiDiveFromDive(dive models.Dive) apiDive {
+	return apiDive{
+		ID:         dive.ID,
+		Created:    dive.Created,
+		Updated:    dive.Updated,
+		diveForm:   diveFormFromDive(dive),
+		HasProfile: dive.HasProfile,
+	}
+}
+
+type apiDiveSite struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	diveSiteForm
+	DivesAt     int        `json:"dives_at"`
+	FirstDiveAt *time.Time `json:"first_dive_at"`
+	LastDiveAt  *time.Time `json:"last_dive_at"`
+}
+
+func apiDiveSiteFromDiveSite(diveSite models.DiveSite) apiDiveSite {
+	return apiDiveSite{
+		ID:           diveSite.ID,
+		Created:      diveSite.Created,
+		Updated:      diveSite.Updated,
+		diveSiteForm: diveSiteFormFromDiveSite(diveSite),
+		DivesAt:      diveSite.DivesAt,
+		FirstDiveAt:  diveSite.FirstDiveAt,
+		LastDiveAt:   diveSite.LastDiveAt,
+	}
+}
+
+type apiBuddy struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	buddyForm
+	DivesWith     int        `json:"dives_with"`
+	FirstDiveWith *time.Time `json:"first_dive_with"`
+	LastDiveWith  *time.Time `json:"last_dive_with"`
+}
+
+func apiBuddyFromBuddy(buddy models.Buddy) apiBuddy {
+	return apiBuddy{
+		ID:            buddy.ID,
+		Created:       buddy.Created,
+		Updated:       buddy.Updated,
+		buddyForm:     buddyFormFromBuddy(buddy),
+		DivesWith:     buddy.DivesWith,
+		FirstDiveWith: buddy.FirstDiveWith,
+		LastDiveWith:  buddy.LastDiveWith,
+	}
+}
+
+type apiOperator struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	operatorForm
+	Dives     int        `json:"dives"`
+	FirstDive *time.Time `json:"first_dive"`
+	LastDive  *time.Time `json:"last_dive"`
+}
+
+func apiOperatorFromOperator(operator models.Operator) apiOperator {
+	return apiOperator{
+		ID:           operator.ID,
+		Created:      operator.Created,
+		Updated:      operator.Updated,
+		operatorForm: operatorFormFromOperator(operator),
+		Dives:        operator.Dives,
+		FirstDive:    operator.FirstDive,
+		LastDive:     operator.LastDive,
+	}
+}
+
+type apiTrip struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	tripForm
+	Dives     int        `json:"dives"`
+	FirstDive *time.Time `json:"first_dive"`
+	LastDive  *time.Time `json:"last_dive"`
+}
+
+func apiTripFromTrip(trip models.Trip) apiTrip {
+	return apiTrip{
+		ID:        trip.ID,
+		Created:   trip.Created,
+		Updated:   trip.Updated,
+		tripForm:  tripFormFromTrip(trip),
+		Dives:     trip.Dives,
+		FirstDive: trip.FirstDive,
+		LastDive:  trip.LastDive,
+	}
+}
+
+type apiCertification struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	certificationForm
+	Dives     int        `json:"dives"`
+	FirstDive *time.Time `json:"first_dive"`
+	LastDive  *time.Time `json:"last_dive"`
+}
+
+func apiCertificationFromCertification(cert models.Certification) apiCertification {
+	return apiCertification{
+		ID:                cert.ID,
+		Created:           cert.Created,
+		Updated:           cert.Updated,
+		certificationForm: certificationFormFromCertification(cert),
+		Dives:             cert.Dives,
+		FirstDive:         cert.FirstDive,
+		LastDive:          cert.LastDive,
+	}
+}
+
+type apiDivePlan struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	divePlanForm
+}
+
+func apiDivePlanFromDivePlan(divePlan models.DivePlan) apiDivePlan {
+	return apiDivePlan{
+		ID:           divePlan.ID,
+		Created:      divePlan.Created,
+		Updated:      divePlan.Updated,
+		divePlanForm: divePlanFormFromDivePlan(divePlan),
+	}
+}
+
+func (app *app) apiDiveList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sort, ok := readSort(qs, diveSortOptions, models.SortDiveDefault)
+	if !ok {
+		apiInvalidSort(app, w, r, diveSortOptions)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+	filter := app.readDiveFilter(qs)
+
+	dives, pageData, err := app.dives.List(userID, app.readAPIPager(qs), filter, sort)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	records := make([]apiDive, 0, len(dives))
+	for _, dive := range dives {
+		records = append(records, apiDiveFromDive(dive))
+	}
+
+	app.apiOK(w, r, envelope{"dives": records, "metadata": pageData})
+}
+
+func (app *app) apiDiveGET(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	dive, err := app.dives.GetOneByID(app.contextGetUser(r).ID, id)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"dive": apiDiveFromDive(dive)})
+}
+
+func (app *app) apiDiveCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &diveForm{}
+	err := app.readJSON(w, r, form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	err = app.validateDiveForm(form, app.contextGetUser(r).ID)
+	if err != nil {
+		app.apiServerError(w, r, fmt.Errorf("failed to validate dive form: %w", err))
+		return
+	}
+
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	id, err := app.insertDiveForm(userID, form)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateDiveNumber) {
+			form.AddFieldError("number", "A dive has already been logged with this number")
+			app.apiFailedValidation(w, r, form.Validator)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	dive, err := app.dives.GetOneByID(userID, id)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	location := fmt.Sprintf("/api/v1/dives/%d", id)
+	app.apiCreated(w, r, location, envelope{"dive": apiDiveFromDive(dive)})
+}
+
+func (app *app) apiDiveUpdatePATCH(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	dive, err := app.dives.GetOneByID(userID, id)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	form := diveFormFromDive(dive)
+	err = app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	err = app.validateDiveForm(&form, userID)
+	if err != nil {
+		app.apiServerError(w, r, fmt.Errorf("failed to validate dive form: %w", err))
+		return
+	}
+
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	err = app.updateDiveForm(id, userID, &form)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateDiveNumber) {
+			form.AddFieldError("number", "A dive has already been logged with this number")
+			app.apiFailedValidation(w, r, form.Validator)
+		} else {
+			app.apiModelError(w, r, err)
+		}
+		return
+	}
+
+	dive, err = app.dives.GetOneByID(userID, id)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"dive": apiDiveFromDive(dive)})
+}
+
+func (app *app) apiDiveSiteList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sort, ok := readSort(qs, diveSiteSortOptions, models.SortDiveSiteDefault)
+	if !ok {
+		apiInvalidSort(app, w, r, diveSiteSortOptions)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	diveSites, pageData, err := app.diveSites.List(userID, app.readAPIPager(qs), sort)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	records := make([]apiDiveSite, 0, len(diveSites))
+	for _, diveSite := range diveSites {
+		records = append(records, apiDiveSiteFromDiveSite(diveSite))
+	}
+
+	app.apiOK(w, r, envelope{"dive_sites": records, "metadata": pageData})
+}
+
+func (app *app) apiDiveSiteGET(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	diveSite, err := app.diveSites.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"dive_site": apiDiveSiteFromDiveSite(diveSite)})
+}
+
+func (app *app) apiDiveSiteCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &diveSiteForm{}
+	err := app.readJSON(w, r, form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	id, err := app.diveSites.Insert(
+		userID,
+		form.Name,
+		form.AltName,
+		form.Location,
+		form.Region,
+		form.CountryID,
+		form.TimeZone,
+		form.Latitude,
+		form.Longitude,
+		form.WaterBodyID,
+		form.WaterTypeID,
+		form.Altitude,
+		form.MaxDepth,
+		form.Notes,
+		form.Rating,
+	)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	diveSite, err := app.diveSites.GetOneByID(id, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	location := fmt.Sprintf("/api/v1/dive-sites/%d", id)
+	app.apiCreated(w, r, location, envelope{"dive_site": apiDiveSiteFromDiveSite(diveSite)})
+}
+
+// apiDiveSiteUpdatePATCH updates a dive site. If the body includes the version
+// of the dive site that the change was based on, then the update is rejected
+// with an edit conflict if it has since been changed by someone else.
+func (app *app) apiDiveSiteUpdatePATCH(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	diveSite, err := app.diveSites.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	form := diveSiteFormFromDiveSite(diveSite)
+	err = app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	err = app.diveSites.Update(
+		id,
+		form.Version,
+		form.Name,
+		form.AltName,
+		form.Location,
+		form.Region,
+		form.CountryID,
+		form.TimeZone,
+		form.Latitude,
+		form.Longitude,
+		form.WaterBodyID,
+		form.WaterTypeID,
+		form.Altitude,
+		form.MaxDepth,
+		form.Notes,
+		form.Rating,
+	)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	diveSite, err = app.diveSites.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"dive_site": apiDiveSiteFromDiveSite(diveSite)})
+}
+
+func (app *app) apiBuddyList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sort, ok := readSort(qs, buddySortOptions, models.SortBuddyDefault)
+	if !ok {
+		apiInvalidSort(app, w, r, buddySortOptions)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	buddies, pageData, err := app.buddies.List(userID, app.readAPIPager(qs), sort)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	records := make([]apiBuddy, 0, len(buddies))
+	for _, buddy := range buddies {
+		records = append(records, apiBuddyFromBuddy(buddy))
+	}
+
+	app.apiOK(w, r, envelope{"buddies": records, "metadata": pageData})
+}
+
+func (app *app) apiBuddyGET(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	buddy, err := app.buddies.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"buddy": apiBuddyFromBuddy(buddy)})
+}
+
+func (app *app) apiBuddyCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &buddyForm{}
+	err := app.readJSON(w, r, form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	id, err := app.buddies.Insert(
+		userID,
+		form.Name,
+		form.EmailAddress,
+		form.PhoneNumber,
+		form.AgencyID,
+		form.AgencyMemberNum,
+		form.Notes,
+	)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	buddy, err := app.buddies.GetOneByID(id, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	location := fmt.Sprintf("/api/v1/buddies/%d", id)
+	app.apiCreated(w, r, location, envelope{"buddy": apiBuddyFromBuddy(buddy)})
+}
+
+func (app *app) apiBuddyUpdatePATCH(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	buddy, err := app.buddies.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	form := buddyFormFromBuddy(buddy)
+	err = app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	err = app.buddies.Update(
+		id,
+		userID,
+		form.Version,
+		form.Name,
+		form.EmailAddress,
+		form.PhoneNumber,
+		form.AgencyID,
+		form.AgencyMemberNum,
+		form.Notes,
+	)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	buddy, err = app.buddies.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"buddy": apiBuddyFromBuddy(buddy)})
+}
+
+func (app *app) apiOperatorList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sort, ok := readSort(qs, operatorSortOptions, models.SortOperatorDefault)
+	if !ok {
+		apiInvalidSort(app, w, r, operatorSortOptions)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	operators, pageData, err := app.operators.List(userID, app.readAPIPager(qs), sort)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	records := make([]apiOperator, 0, len(operators))
+	for _, operator := range operators {
+		records = append(records, apiOperatorFromOperator(operator))
+	}
+
+	app.apiOK(w, r, envelope{"operators": records, "metadata": pageData})
+}
+
+func (app *app) apiOperatorGET(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	operator, err := app.operators.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"operator": apiOperatorFromOperator(operator)})
+}
+
+func (app *app) apiOperatorCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &operatorForm{}
+	err := app.readJSON(w, r, form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	id, err := app.operators.Insert(
+		userID,
+		form.OperatorTypeID,
+		form.Name,
+		form.Street,
+		form.Suburb,
+		form.State,
+		form.Postcode,
+		form.CountryID,
+		form.WebsiteURL,
+		form.EmailAddress,
+		form.PhoneNumber,
+		form.Comments,
+	)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email_address", "This operator already exists")
+			app.apiFailedValidation(w, r, form.Validator)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	operator, err := app.operators.GetOneByID(id, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	location := fmt.Sprintf("/api/v1/operators/%d", id)
+	app.apiCreated(w, r, location, envelope{"operator": apiOperatorFromOperator(operator)})
+}
+
+// apiOperatorUpdatePATCH updates an operator. Although all operators can be
+// read, only the user that added an operator can change it.
+func (app *app) apiOperatorUpdatePATCH(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	operator, err := app.operators.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	form := operatorFormFromOperator(operator)
+	err = app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	err = app.operators.Update(
+		id,
+		userID,
+		form.OperatorTypeID,
+		form.Name,
+		form.Street,
+		form.Suburb,
+		form.State,
+		form.Postcode,
+		form.CountryID,
+		form.WebsiteURL,
+		form.EmailAddress,
+		form.PhoneNumber,
+		form.Comments,
+	)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	operator, err = app.operators.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"operator": apiOperatorFromOperator(operator)})
+}
+
+func (app *app) apiTripList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sort, ok := readSort(qs, tripSortOptions, models.SortTripDefault)
+	if !ok {
+		apiInvalidSort(app, w, r, tripSortOptions)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	trips, pageData, err := app.trips.List(userID, app.readAPIPager(qs), sort)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	records := make([]apiTrip, 0, len(trips))
+	for _, trip := range trips {
+		records = append(records, apiTripFromTrip(trip))
+	}
+
+	app.apiOK(w, r, envelope{"trips": records, "metadata": pageData})
+}
+
+func (app *app) apiTripGET(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	trip, err := app.trips.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"trip": apiTripFromTrip(trip)})
+}
+
+func (app *app) apiTripCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &tripForm{}
+	err := app.readJSON(w, r, form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	id, err := app.trips.Insert(
+		userID,
+		form.Name,
+		form.StartDate,
+		form.EndDate,
+		form.Description,
+		form.Rating,
+		form.OperatorID,
+		form.PriceAmount,
+		form.CurrencyID,
+		form.Notes,
+	)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	trip, err := app.trips.GetOneByID(id, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	location := fmt.Sprintf("/api/v1/trips/%d", id)
+	app.apiCreated(w, r, location, envelope{"trip": apiTripFromTrip(trip)})
+}
+
+func (app *app) apiTripUpdatePATCH(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	trip, err := app.trips.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	form := tripFormFromTrip(trip)
+	err = app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	err = app.trips.Update(
+		id,
+		userID,
+		form.Name,
+		form.StartDate,
+		form.EndDate,
+		form.Description,
+		form.Rating,
+		form.OperatorID,
+		form.PriceAmount,
+		form.CurrencyID,
+		form.Notes,
+	)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	trip, err = app.trips.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"trip": apiTripFromTrip(trip)})
+}
+
+func (app *app) apiCertificationList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sort, ok := readSort(qs, certSortOptions, models.SortCertDefault)
+	if !ok {
+		apiInvalidSort(app, w, r, certSortOptions)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	certs, pageData, err := app.certifications.List(userID, app.readAPIPager(qs), sort)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	records := make([]apiCertification, 0, len(certs))
+	for _, cert := range certs {
+		records = append(records, apiCertificationFromCertification(cert))
+	}
+
+	app.apiOK(w, r, envelope{"certifications": records, "metadata": pageData})
+}
+
+func (app *app) apiCertificationGET(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	cert, err := app.certifications.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"certification": apiCertificationFromCertification(cert)})
+}
+
+func (app *app) apiCertificationCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &certificationForm{}
+	err := app.readJSON(w, r, form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	id, err := app.certifications.Insert(
+		userID,
+		form.CourseID,
+		form.StartDate,
+		form.EndDate,
+		form.OperatorID,
+		form.InstructorID,
+		form.PriceAmount,
+		form.CurrencyID,
+		form.Rating,
+		form.Notes,
+	)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	cert, err := app.certifications.GetOneByID(id, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	location := fmt.Sprintf("/api/v1/certifications/%d", id)
+	app.apiCreated(
+		w,
+		r,
+		location,
+		envelope{"certification": apiCertificationFromCertification(cert)},
+	)
+}
+
+func (app *app) apiCertificationUpdatePATCH(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	cert, err := app.certifications.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	form := certificationFormFromCertification(cert)
+	err = app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	err = app.certifications.Update(
+		id,
+		userID,
+		form.CourseID,
+		form.StartDate,
+		form.EndDate,
+		form.OperatorID,
+		form.InstructorID,
+		form.PriceAmount,
+		form.CurrencyID,
+		form.Rating,
+		form.Notes,
+	)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	cert, err = app.certifications.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"certification": apiCertificationFromCertification(cert)})
+}
+
+func (app *app) apiDivePlanList(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	sort, ok := readSort(qs, divePlanSortOptions, models.SortDivePlanDefault)
+	if !ok {
+		apiInvalidSort(app, w, r, divePlanSortOptions)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	divePlans, pageData, err := app.divePlans.List(userID, app.readAPIPager(qs), sort)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	records := make([]apiDivePlan, 0, len(divePlans))
+	for _, divePlan := range divePlans {
+		records = append(records, apiDivePlanFromDivePlan(divePlan))
+	}
+
+	app.apiOK(w, r, envelope{"dive_plans": records, "metadata": pageData})
+}
+
+func (app *app) apiDivePlanGET(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	divePlan, err := app.divePlans.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"dive_plan": apiDivePlanFromDivePlan(divePlan)})
+}
+
+func (app *app) apiDivePlanCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &divePlanForm{}
+	err := app.readJSON(w, r, form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	id, err := app.divePlans.Insert(
+		userID,
+		form.Name,
+		form.Notes,
+		form.IsSoloDive,
+		form.DescentRate,
+		form.AscentRate,
+		form.SACRate,
+		form.TankCount,
+		form.TankVolume,
+		form.WorkingPressure,
+		form.DiveFactor,
+		form.FN2,
+		form.FHe,
+		form.MaxPPO2,
+		form.stopInputs(),
+	)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	divePlan, err := app.divePlans.GetOneByID(id, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	location := fmt.Sprintf("/api/v1/dive-plans/%d", id)
+	app.apiCreated(w, r, location, envelope{"dive_plan": apiDivePlanFromDivePlan(divePlan)})
+}
+
+func (app *app) apiDivePlanUpdatePATCH(w http.ResponseWriter, r *http.Request) {
+	id, ok := readIDParam(r)
+	if !ok {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	divePlan, err := app.divePlans.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	form := divePlanFormFromDivePlan(divePlan)
+	err = app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.Validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.Validator)
+		return
+	}
+
+	err = app.divePlans.Update(
+		id,
+		userID,
+		form.Version,
+		form.Name,
+		form.Notes,
+		form.IsSoloDive,
+		form.DescentRate,
+		form.AscentRate,
+		form.SACRate,
+		form.TankCount,
+		form.TankVolume,
+		form.WorkingPressure,
+		form.DiveFactor,
+		form.FN2,
+		form.FHe,
+		form.MaxPPO2,
+		form.stopInputs(),
+	)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	divePlan, err = app.divePlans.GetOneByID(id, userID)
+	if err != nil {
+		app.apiModelError(w, r, err)
+		return
+	}
+
+	app.apiOK(w, r, envelope{"dive_plan": apiDivePlanFromDivePlan(divePlan)})
+}
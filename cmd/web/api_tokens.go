@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// apiTokenExpiryDays are the number of days that a new API token can be valid
+// for, with zero meaning that it never expires.
+var apiTokenExpiryDays = []int{7, 30, 90, 365, 0}
+
+type apiTokenForm struct {
+	Name                string               `form:"token_name"`
+	Scope               models.APITokenScope `form:"scope"`
+	ExpiresInDays       int                  `form:"expires_in_days"`
+	validator.Validator `form:"-"`
+}
+
+func (tf *apiTokenForm) Validate() {
+	tf.CheckField(validator.NotBlank(tf.Name), "token_name", "This field cannot be blank")
+	tf.CheckField(
+		validator.MaxChars(tf.Name, 256),
+		"token_name",
+		"This field cannot be more than 256 characters long",
+	)
+
+	tf.CheckField(
+		validator.PermittedValue(
+			tf.Scope,
+			models.APITokenScopeRead,
+			models.APITokenScopeReadWrite,
+		),
+		"scope",
+		"This field must be selected",
+	)
+
+	tf.CheckField(
+		validator.PermittedValue(tf.ExpiresInDays, apiTokenExpiryDays...),
+		"expires_in_days",
+		"This field must be selected",
+	)
+}
+
+// addAPITokensToTemplateData adds the user's API tokens, along with any newly
+// created token that is waiting to be shown to them, to data for the profile
+// page.
+func (app *app) addAPITokensToTemplateData(r *http.Request, data *templateData) error {
+	apiTokens, err := app.apiTokens.ListAll(app.contextGetUser(r).ID)
+	if err != nil {
+		return err
+	}
+
+	data.APITokens = apiTokens
+	data.APITokenExpiryDays = apiTokenExpiryDays
+	data.NewAPIToken = app.sessionManager.PopString(r.Context(), "newAPIToken")
+
+	if data.APITokenForm.Scope == "" {
+		data.APITokenForm = apiTokenForm{Scope: models.APITokenScopeRead, ExpiresInDays: 90}
+	}
+
+	return nil
+}
+
+// userAPITokenCreatePOST creates a new API token for the user and shows it once
+// on the profile page.
+func (app *app) userAPITokenCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := apiTokenForm{}
+	err := app.decodePOSTForm(r, &form)
+	if err != nil {
+		app.log.Error("Error whilst decoding API token form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	form.Validate()
+	if !form.Valid() {
+		data, err := app.newTemplateData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Form = userProfileFormFromUser(user)
+		data.APITokenForm = form
+		err = app.addAPITokensToTemplateData(r, &data)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.render(w, r, http.StatusUnprocessableEntity, "user/profile_form.tmpl", data)
+		return
+	}
+
+	var expires *time.Time
+	if form.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, form.ExpiresInDays)
+		expires = &t
+	}
+
+	token, err := app.apiTokens.Insert(user.ID, form.Name, form.Scope, expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "newAPIToken", token)
+	app.sessionManager.Put(
+		r.Context(),
+		"flashSuccess",
+		fmt.Sprintf("Your API token %s has been created.", form.Name),
+	)
+	http.Redirect(w, r, "/user/profile/edit", http.StatusSeeOther)
+}
+
+// userAPITokenRevokePOST deletes one of the user's API tokens so that it can no
+// longer be used.
+func (app *app) userAPITokenRevokePOST(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.apiTokens.Delete(app.contextGetUser(r).ID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flashSuccess", "Your API token has been revoked.")
+	http.Redirect(w, r, "/user/profile/edit", http.StatusSeeOther)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/m5lapp/divesite-monolith/internal/ical"
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+// calendarProdID identifies DiveSite as the creator of calendar feeds.
+const calendarProdID = "-//DiveSite//Log Book//EN"
+
+// calendarUID returns the stable UID of the calendar event for the given kind
+// of record, so that calendar applications replace their copy of an event when
+// the record is updated.
+func calendarUID(kind string, id int) string {
+	return fmt.Sprintf("%s-%d@divesite", kind, id)
+}
+
+// calendarURL returns the absolute URL of the calendar feed for token.
+func calendarURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s/calendar/%s.ics", scheme, r.Host, token)
+}
+
+func tripEvent(trip models.Trip) ical.Event {
+	var description []string
+	if trip.Operator != nil {
+		description = append(description, "Operator: "+trip.Operator.Name)
+	}
+	if trip.Description != "" {
+		description = append(description, trip.Description)
+	}
+
+	return ical.Event{
+		UID:         calendarUID("trip", trip.ID),
+		Summary:     trip.Name,
+		Description: strings.Join(description, "\n\n"),
+		Start:       trip.StartDate,
+		End:         trip.EndDate,
+		AllDay:      true,
+		Modified:    trip.Updated,
+	}
+}
+
+func certificationEvent(cert models.Certification) ical.Event {
+	description := []string{"Operator: " + cert.Operator.Name}
+	if cert.Instructor.Name != "" {
+		description = append(description, "Instructor: "+cert.Instructor.Name)
+	}
+
+	return ical.Event{
+		UID:         calendarUID("certification", cert.ID),
+		Summary:     cert.Course.String(),
+		Description: strings.Join(description, "\n"),
+		Start:       cert.StartDate,
+		End:         cert.EndDate,
+		AllDay:      true,
+		Modified:    cert.Updated,
+	}
+}
+
+func diveEvent(dive models.Dive) ical.Event {
+	description := []string{
+		fmt.Sprintf("Maximum depth: %.1f metres", dive.MaxDepth),
+		fmt.Sprintf("Bottom time: %d minutes", int(dive.BottomTime.Minutes())),
+	}
+	if dive.Buddy != nil {
+		description = append(description, "Buddy: "+dive.Buddy.Name)
+	}
+	if dive.Operator != nil {
+		description = append(description, "Operator: "+dive.Operator.Name)
+	}
+	if dive.Notes != "" {
+		description = append(description, "", dive.Notes)
+	}
+
+	return ical.Event{
+		UID:         calendarUID("dive", dive.ID),
+		Summary:     fmt.Sprintf("Dive #%d: %s", dive.Number, dive.DiveSite.Name),
+		Description: strings.Join(description, "\n"),
+		Location:    dive.DiveSite.String(),
+		Latitude:    dive.DiveSite.Latitude,
+		Longitude:   dive.DiveSite.Longitude,
+		Start:       dive.DateTimeIn,
+		End:         dive.DateTimeOut(),
+		Modified:    dive.Updated,
+	}
+}
+
+// calendarFeed publishes the trips, certifications and dives of the user whose
+// secret calendar token is in the URL as an iCalendar feed. It is public so
+// that calendar applications can subscribe to it without logging in.
+func (app *app) calendarFeed(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutSuffix(r.PathValue("file"), ".ics")
+	if !ok || token == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := app.users.GetByCalendarToken(token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	trips, err := app.trips.ListAll(user.ID, models.SortTripDefault)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	certifications, err := app.certifications.ListAll(user.ID, models.SortCertDefault)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sort := []models.SortDive{models.SortDiveDateAsc, models.SortDiveIDAsc}
+	dives, err := app.dives.ListAll(user.ID, models.DiveFilter{}, sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	cal := ical.Calendar{
+		ProdID: calendarProdID,
+		Name:   fmt.Sprintf("%s (%s)", user.Name, exportGenerator),
+		Events: make([]ical.Event, 0, len(trips)+len(certifications)+len(dives)),
+	}
+
+	for _, trip := range trips {
+		cal.Events = append(cal.Events, tripEvent(trip))
+	}
+	for _, cert := range certifications {
+		cal.Events = append(cal.Events, certificationEvent(cert))
+	}
+	for _, dive := range dives {
+		cal.Events = append(cal.Events, diveEvent(dive))
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = cal.WriteTo(buf)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to write calendar feed: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
+
+// userCalendarTokenPOST generates a new calendar feed token for the user,
+// replacing any existing one, and shows the new feed URL once on the profile
+// page.
+func (app *app) userCalendarTokenPOST(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	token, err := app.users.NewCalendarToken(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "calendarURL", calendarURL(r, token))
+	app.sessionManager.Put(
+		r.Context(),
+		"flashSuccess",
+		"Your calendar feed URL has been created, any previous URL will no longer work.",
+	)
+	http.Redirect(w, r, "/user/profile/edit", http.StatusSeeOther)
+}
+
+// userCalendarRevokePOST revokes the user's calendar feed token so that the
+// feed can no longer be fetched.
+func (app *app) userCalendarRevokePOST(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.users.RevokeCalendarToken(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flashSuccess", "Your calendar feed URL has been revoked.")
+	http.Redirect(w, r, "/user/profile/edit", http.StatusSeeOther)
+}
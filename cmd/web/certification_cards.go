@@ -0,0 +1,362 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/storage"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// maxCardSize is the maximum size in bytes of an image of a certification card
+// that can be uploaded.
+const maxCardSize = 8 << 20
+
+// cardExtensions maps the content types of the images that can be uploaded for
+// certification cards to the file extensions that they are downloaded with.
+var cardExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// certificationCardForm is the upload of an image of one side of a
+// certification card. Any errors are keyed by the side of the card.
+type certificationCardForm struct {
+	validator.Validator `form:"-"`
+}
+
+// certificationCardSlot is one side of a certification card on the
+// certification page, along with its image if one has been uploaded.
+type certificationCardSlot struct {
+	Side  models.CardSide
+	Card  *models.CertificationCard
+	Error string
+}
+
+// certificationCardKey returns the key that the image of one side of a user's
+// certification card is kept under in the file store.
+func certificationCardKey(ownerID, id int, side models.CardSide) string {
+	return fmt.Sprintf("certifications/%d/%d/%s", ownerID, id, side)
+}
+
+// readCardSide returns the side of a certification card in the "side" path
+// value of r. The returned bool is false if it is invalid.
+func readCardSide(r *http.Request) (models.CardSide, bool) {
+	side := models.CardSide(r.PathValue("side"))
+	return side, side.IsValid()
+}
+
+// findCertificationCard returns the image of the given side of a certification
+// card from cards, or false if there is not one.
+func findCertificationCard(
+	cards []models.CertificationCard,
+	side models.CardSide,
+) (models.CertificationCard, bool) {
+	for _, card := range cards {
+		if card.Side == side {
+			return card, true
+		}
+	}
+
+	return models.CertificationCard{}, false
+}
+
+// renderCertification renders the page that shows the certification along with
+// its training dives and the images of its card.
+func (app *app) renderCertification(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	cert models.Certification,
+	form certificationCardForm,
+) {
+	userID := app.contextGetUser(r).ID
+
+	filter := models.DiveFilter{CertificationID: cert.ID}
+	sort := []models.SortDive{models.SortDiveDateAsc, models.SortDiveIDAsc}
+	dives, err := app.dives.ListAll(userID, filter, sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	cards, err := app.certifications.ListCards(cert.ID, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var slots []certificationCardSlot
+	for _, side := range models.CardSides {
+		slot := certificationCardSlot{Side: side, Error: form.FieldErrors[string(side)]}
+		if card, ok := findCertificationCard(cards, side); ok {
+			slot.Card = &card
+		}
+		slots = append(slots, slot)
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
+	data.Certification = cert
+	data.CertificationCards = slots
+	data.Dives = dives
+
+	app.render(w, r, status, "certification/view.tmpl", data)
+}
+
+// certificationCardPOST uploads an image of one side of a certification card,
+// replacing any that was uploaded before.
+func (app *app) certificationCardPOST(w http.ResponseWriter, r *http.Request) {
+	side, ok := readCardSide(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	cert, ok := app.readCertification(w, r)
+	if !ok {
+		return
+	}
+
+	form := certificationCardForm{}
+	err := app.decodeMultipartForm(w, r, &form, maxCardSize)
+	if err != nil {
+		app.log.Error("Error whilst decoding certification card form input", "error", err.Error())
+		app.clientError(w, multipartFormErrorStatus(err))
+		return
+	}
+
+	file, fh, err := r.FormFile("file")
+	if err != nil {
+		form.AddFieldError(string(side), "Select an image of the card to upload")
+		app.renderCertification(w, r, http.StatusUnprocessableEntity, cert, form)
+		return
+	}
+	defer file.Close()
+
+	// Only the first 512 bytes are needed to detect the type of the image.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		form.AddFieldError(string(side), fmt.Sprintf("The file %s could not be read", fh.Filename))
+		app.renderCertification(w, r, http.StatusUnprocessableEntity, cert, form)
+		return
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	_, permitted := cardExtensions[contentType]
+	form.CheckField(
+		permitted,
+		string(side),
+		fmt.Sprintf("The file %s is not a JPEG, PNG or WebP image", fh.Filename),
+	)
+	form.CheckField(
+		fh.Size <= maxCardSize,
+		string(side),
+		fmt.Sprintf("The image cannot be larger than %d MB", maxCardSize>>20),
+	)
+
+	if !form.Valid() {
+		app.renderCertification(w, r, http.StatusUnprocessableEntity, cert, form)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+	key := certificationCardKey(userID, cert.ID, side)
+
+	err = app.files.Put(key, io.MultiReader(bytes.NewReader(head), file))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.certifications.SetCard(cert.ID, userID, side, key, contentType)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	msg := fmt.Sprintf("The image of the %s of the certification card has been uploaded.", side)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+
+	nextUrl := fmt.Sprintf("/certification/view/%d", cert.ID)
+	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+}
+
+// certificationCardGET sends the image of one side of a certification card.
+func (app *app) certificationCardGET(w http.ResponseWriter, r *http.Request) {
+	side, ok := readCardSide(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	cert, ok := app.readCertification(w, r)
+	if !ok {
+		return
+	}
+
+	cards, err := app.certifications.ListCards(cert.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	card, ok := findCertificationCard(cards, side)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := app.files.Get(card.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", card.ContentType)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	io.Copy(w, file)
+}
+
+func (app *app) certificationCardDeletePOST(w http.ResponseWriter, r *http.Request) {
+	side, ok := readCardSide(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	cert, ok := app.readCertification(w, r)
+	if !ok {
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	cards, err := app.certifications.ListCards(cert.ID, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	card, ok := findCertificationCard(cards, side)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.certifications.DeleteCard(cert.ID, userID, side)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The image is no longer referred to, so failing to delete it only leaves
+	// an orphaned file behind.
+	err = app.files.Delete(card.StorageKey)
+	if err != nil {
+		app.log.Error("Failed to delete certification card image", "key", card.StorageKey, "error", err.Error())
+	}
+
+	msg := fmt.Sprintf("The image of the %s of the certification card has been deleted.", side)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+
+	nextUrl := fmt.Sprintf("/certification/view/%d", cert.ID)
+	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+}
+
+// certificationCardsDownload sends the images of both sides of a certification
+// card bundled together in a single zip file, ready to be shown at a dive
+// centre.
+func (app *app) certificationCardsDownload(w http.ResponseWriter, r *http.Request) {
+	cert, ok := app.readCertification(w, r)
+	if !ok {
+		return
+	}
+
+	cards, err := app.certifications.ListCards(cert.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	nextUrl := fmt.Sprintf("/certification/view/%d", cert.ID)
+
+	if len(cards) == 0 {
+		msg := "No images of the certification card have been uploaded yet."
+		app.sessionManager.Put(r.Context(), "flashError", msg)
+		http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for _, card := range cards {
+		err := app.addCardToZip(zw, card)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to write certification card bundle: %w", err))
+		return
+	}
+
+	filename := fmt.Sprintf("certification-%d-cards.zip", cert.ID)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
+
+// addCardToZip copies the image of a certification card from the file store
+// into zw, named after the side of the card that it shows.
+func (app *app) addCardToZip(zw *zip.Writer, card models.CertificationCard) error {
+	file, err := app.files.Get(card.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to open certification card image %s: %w", card.StorageKey, err)
+	}
+	defer file.Close()
+
+	fw, err := zw.Create(string(card.Side) + cardExtensions[card.ContentType])
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, file)
+	if err != nil {
+		return fmt.Errorf("failed to copy certification card image %s: %w", card.StorageKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fieldConflict is a field of a form that has a different value to the one in
+// the stored record, which was changed by someone else after the form was
+// loaded.
+type fieldConflict struct {
+	Field  string
+	Label  string
+	Yours  string
+	Stored string
+}
+
+// conflictFieldLabels overrides the labels generated from the form tags of
+// fields when showing an edit conflict.
+var conflictFieldLabels = map[string]string{
+	"fhe":      "Helium (FHe)",
+	"fn2":      "Nitrogen (FN2)",
+	"fo2":      "Oxygen (FO2)",
+	"max_ppo2": "Max PPO2",
+	"sac_rate": "SAC rate",
+}
+
+// conflictSkipFields are the form tags of fields that are not edited by the
+// user, so a difference in them cannot be resolved on the form and is not a
+// conflict.
+var conflictSkipFields = map[string]bool{
+	"id":          true,
+	"version":     true,
+	"has_profile": true,
+}
+
+// conflictOptions maps the form tag of a field that holds the ID of another
+// record, or a slice of them, to the names of the records by ID, so that the
+// names can be shown instead of the IDs.
+type conflictOptions map[string]map[int]string
+
+// optionNames returns the names of items keyed by their ID, as returned by
+// option.
+func optionNames[T any](items []T, option func(T) (int, string)) map[int]string {
+	names := make(map[int]string, len(items))
+	for _, item := range items {
+		id, name := option(item)
+		names[id] = name
+	}
+
+	return names
+}
+
+// formConflicts compares the fields of yours, a form submitted by the user, with
+// stored, the same type of form populated from the current version of the
+// record, and returns the fields that differ in the order that they are
+// declared. Fields without a form tag, and those in conflictSkipFields, are not
+// compared.
+func formConflicts(yours, stored any, options conflictOptions) []fieldConflict {
+	yoursValue := reflect.Indirect(reflect.ValueOf(yours))
+	storedValue := reflect.Indirect(reflect.ValueOf(stored))
+	formType := yoursValue.Type()
+
+	if storedValue.Type() != formType {
+		panic(fmt.Sprintf("cannot compare a %s to a %s", formType, storedValue.Type()))
+	}
+
+	var conflicts []fieldConflict
+	for i := range formType.NumField() {
+		tag := formType.Field(i).Tag.Get("form")
+		if tag == "" || tag == "-" || conflictSkipFields[tag] {
+			continue
+		}
+
+		yoursField := formatConflictValue(yoursValue.Field(i), options[tag])
+		storedField := formatConflictValue(storedValue.Field(i), options[tag])
+		if yoursField == storedField {
+			continue
+		}
+
+		conflicts = append(conflicts, fieldConflict{
+			Field:  tag,
+			Label:  conflictFieldLabel(tag),
+			Yours:  yoursField,
+			Stored: storedField,
+		})
+	}
+
+	return conflicts
+}
+
+// conflictFieldLabel returns a human-readable label for the form field tag, e.g.
+// "Dive site" for "dive_site_id".
+func conflictFieldLabel(tag string) string {
+	if label, ok := conflictFieldLabels[tag]; ok {
+		return label
+	}
+
+	label := strings.TrimSuffix(strings.TrimSuffix(tag, "_ids"), "_id")
+	label = strings.ReplaceAll(label, "_", " ")
+
+	r, size := utf8.DecodeRuneInString(label)
+	return string(unicode.ToUpper(r)) + label[size:]
+}
+
+// formatConflictValue formats a field of a form so that it can be shown to the
+// user and compared. IDs are replaced with their names from names, if present.
+func formatConflictValue(v reflect.Value, names map[int]string) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02 15:04")
+	}
+
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return "Yes"
+		}
+		return "No"
+	case reflect.Int:
+		id := int(v.Int())
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return strconv.Itoa(id)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Slice:
+		items := make([]string, 0, v.Len())
+		for i := range v.Len() {
+			items = append(items, formatConflictValue(v.Index(i), names))
+		}
+		// The order of selected IDs depends on how they were loaded or posted,
+		// so sort them to avoid reporting a conflict when there is none.
+		if v.Type().Elem().Kind() == reflect.Int {
+			slices.Sort(items)
+		}
+		return strings.Join(items, ", ")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestFormConflicts(t *testing.T) {
+	rating := 4
+	yours := diveForm{
+		Version:      1,
+		Number:       12,
+		DiveSiteID:   1,
+		EquipmentIDs: []int{2, 1},
+		Rating:       &rating,
+		Notes:        "Manta ray",
+	}
+
+	// The profile was uploaded after the form was loaded, which the user cannot
+	// change on the form.
+	stored := diveForm{
+		Version:      2,
+		HasProfile:   true,
+		Number:       12,
+		DiveSiteID:   2,
+		EquipmentIDs: []int{1, 2},
+		Notes:        "Manta ray",
+	}
+	options := conflictOptions{
+		"dive_site_id": {1: "Sail Rock", 2: "Chumphon Pinnacle"},
+	}
+
+	conflicts := formConflicts(&yours, stored, options)
+	assert.Equal(t, len(conflicts), 2)
+
+	assert.Equal(t, conflicts[0], fieldConflict{
+		Field:  "dive_site_id",
+		Label:  "Dive site",
+		Yours:  "Sail Rock",
+		Stored: "Chumphon Pinnacle",
+	})
+
+	assert.Equal(t, conflicts[1], fieldConflict{
+		Field:  "rating",
+		Label:  "Rating",
+		Yours:  "4",
+		Stored: "",
+	})
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// diveBulkEditForm holds the changes to make to each of the selected dives in a
+// bulk edit. Only the fields whose Set flag is true are changed, so leaving the
+// trip empty with SetTrip checked takes the dives off their trips.
+type diveBulkEditForm struct {
+	Dives               []diveBulkEditRow `form:"dives"`
+	SetTrip             bool              `form:"set_trip"`
+	TripID              *int              `form:"trip_id"`
+	SetOperator         bool              `form:"set_operator"`
+	OperatorID          *int              `form:"operator_id"`
+	SetBuddy            bool              `form:"set_buddy"`
+	BuddyID             *int              `form:"buddy_id"`
+	BuddyRoleID         *int              `form:"buddy_role_id"`
+	SetEquipment        bool              `form:"set_equipment"`
+	EquipmentIDs        []int             `form:"equipment_ids"`
+	SetProperties       bool              `form:"set_properties"`
+	PropertyIDs         []int             `form:"property_ids"`
+	AllOrNothing        bool              `form:"all_or_nothing"`
+	validator.Validator `form:"-"`
+}
+
+// diveBulkEditRow is a single dive in a bulk edit. ID is zero if the dive has
+// been deselected on the bulk edit page.
+type diveBulkEditRow struct {
+	ID      int `form:"id"`
+	Version int `form:"version"`
+}
+
+// diveBulkEditItem is a dive as it is shown on the bulk edit page, along with
+// the outcome of the last attempt to update it if there was one. Version is the
+// version of the dive that the changes will be made to if it is Selected.
+type diveBulkEditItem struct {
+	Dive     models.Dive
+	Version  int
+	Selected bool
+	Status   string
+	Failed   bool
+}
+
+// changes returns the changes in the form as they are passed to the model.
+func (f *diveBulkEditForm) changes() models.DiveBulkChanges {
+	return models.DiveBulkChanges{
+		SetTrip:       f.SetTrip,
+		TripID:        f.TripID,
+		SetOperator:   f.SetOperator,
+		OperatorID:    f.OperatorID,
+		SetBuddy:      f.SetBuddy,
+		BuddyID:       f.BuddyID,
+		BuddyRoleID:   f.BuddyRoleID,
+		SetEquipment:  f.SetEquipment,
+		EquipmentIDs:  f.EquipmentIDs,
+		SetProperties: f.SetProperties,
+		PropertyIDs:   f.PropertyIDs,
+	}
+}
+
+// selectedDives returns the dives that are still selected in the form.
+func (f *diveBulkEditForm) selectedDives() []models.DiveVersion {
+	var dives []models.DiveVersion
+	for _, row := range f.Dives {
+		if row.ID > 0 {
+			dives = append(dives, models.DiveVersion{ID: row.ID, Version: row.Version})
+		}
+	}
+
+	return dives
+}
+
+func (app *app) validateDiveBulkEditForm(f *diveBulkEditForm, ownerID int) error {
+	if len(f.selectedDives()) == 0 {
+		f.AddNonFieldError("Select at least one dive to edit")
+	}
+
+	if f.changes().IsEmpty() {
+		f.AddNonFieldError("Choose at least one field to change")
+	}
+
+	if f.SetTrip && f.TripID != nil {
+		exists, err := app.trips.ExistsActive(*f.TripID, ownerID)
+		if err != nil {
+			return err
+		}
+		f.CheckField(exists, "trip_id", "Invalid dive trip selected")
+	}
+
+	if f.SetOperator && f.OperatorID != nil {
+		exists, err := app.operators.ExistsActive(*f.OperatorID)
+		if err != nil {
+			return err
+		}
+		f.CheckField(exists, "operator_id", "Invalid operator selected")
+	}
+
+	if f.SetBuddy {
+		if f.BuddyID != nil {
+			exists, err := app.buddies.ExistsActive(*f.BuddyID, ownerID)
+			if err != nil {
+				return err
+			}
+			f.CheckField(exists, "buddy_id", "Invalid dive buddy selected")
+		}
+
+		if f.BuddyRoleID != nil {
+			exists, err := app.buddyRoles.Exists(*f.BuddyRoleID)
+			if err != nil {
+				return err
+			}
+			f.CheckField(exists, "buddy_role_id", "Invalid buddy role selected")
+
+			f.CheckField(
+				f.BuddyID != nil,
+				"buddy_role_id",
+				"A buddy must be selected when this field is selected",
+			)
+		}
+	}
+
+	if f.SetEquipment {
+		allExist, err := app.equipment.AllExist(f.EquipmentIDs)
+		if err != nil {
+			return err
+		}
+		f.CheckField(allExist, "equipment_ids", "Invalid equipment item(s) selected")
+	}
+
+	if f.SetProperties {
+		allExist, err := app.diveProperties.AllExist(f.PropertyIDs)
+		if err != nil {
+			return err
+		}
+		f.CheckField(allExist, "property_ids", "Invalid dive properties selected")
+	}
+
+	return nil
+}
+
+// loadDiveBulkEditItems fetches each of the dives for the bulk edit page. Dives
+// that no longer exist are still returned, but with only their ID set and
+// marked as failed so that the user can see what happened to them.
+func (app *app) loadDiveBulkEditItems(
+	r *http.Request,
+	dives []models.DiveVersion,
+) ([]diveBulkEditItem, error) {
+	userID := app.contextGetUser(r).ID
+
+	items := make([]diveBulkEditItem, 0, len(dives))
+	for _, dv := range dives {
+		dive, err := app.dives.GetOneByID(userID, dv.ID)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				return nil, err
+			}
+
+			items = append(items, diveBulkEditItem{
+				Dive:   models.Dive{ID: dv.ID},
+				Status: "This dive no longer exists",
+				Failed: true,
+			})
+			continue
+		}
+
+		items = append(items, diveBulkEditItem{
+			Dive:     dive,
+			Version:  dv.Version,
+			Selected: true,
+		})
+	}
+
+	return items, nil
+}
+
+func (app *app) renderDiveBulkEdit(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	form diveBulkEditForm,
+	items []diveBulkEditItem,
+) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.addStaticdataToDiveForm(r, &data)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to load dive form static data: %w", err))
+		return
+	}
+
+	data.Form = form
+	data.DiveBulkEditItems = items
+
+	app.render(w, r, status, "dive/bulk_edit.tmpl", data)
+}
+
+// diveBulkEditGET shows the bulk edit page for the dives selected on the dive
+// list, which are given in the "dive_id" query string parameters.
+func (app *app) diveBulkEditGET(w http.ResponseWriter, r *http.Request) {
+	var dives []models.DiveVersion
+	for _, value := range r.URL.Query()["dive_id"] {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		dives = append(dives, models.DiveVersion{ID: id})
+	}
+
+	if len(dives) == 0 {
+		app.sessionManager.Put(r.Context(), "flashError", "Select at least one dive to edit.")
+		http.Redirect(w, r, "/log-book/dive/", http.StatusSeeOther)
+		return
+	}
+
+	items, err := app.loadDiveBulkEditItems(r, dives)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for i := range items {
+		items[i].Version = items[i].Dive.Version
+	}
+
+	app.renderDiveBulkEdit(w, r, http.StatusOK, diveBulkEditForm{}, items)
+}
+
+func (app *app) diveBulkEditPOST(w http.ResponseWriter, r *http.Request) {
+	form := diveBulkEditForm{}
+	err := app.decodePOSTForm(r, &form)
+	if err != nil {
+		app.log.Error("Error whilst decoding dive bulk edit form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.validateDiveBulkEditForm(&form, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to validate dive bulk edit form: %w", err))
+		return
+	}
+
+	dives := form.selectedDives()
+
+	if !form.Valid() {
+		items, err := app.loadDiveBulkEditItems(r, dives)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.renderDiveBulkEdit(w, r, http.StatusUnprocessableEntity, form, items)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	results, err := app.dives.BulkUpdate(userID, dives, form.changes(), form.AllOrNothing)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	failures := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failures++
+		}
+	}
+
+	if failures == 0 {
+		msg := fmt.Sprintf("%d dive(s) have been updated.", len(results))
+		app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+		http.Redirect(w, r, "/log-book/dive/", http.StatusSeeOther)
+		return
+	}
+
+	items, err := app.loadDiveBulkEditItems(r, dives)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The dives are shown as they are now, so resubmitting the form applies the
+	// changes on top of their latest versions.
+	for i, result := range results {
+		item := &items[i]
+		if item.Selected {
+			item.Version = item.Dive.Version
+		}
+
+		switch {
+		case result.Err == nil && form.AllOrNothing:
+			item.Status = "Not updated as the changes to the other dives were rolled back"
+		case result.Err == nil:
+			item.Status = "Updated"
+			item.Selected = false
+		case errors.Is(result.Err, models.ErrUpdateConflict):
+			item.Status = "This dive was changed by someone else after it was selected, " +
+				"check it and submit the changes again to overwrite theirs"
+			item.Failed = true
+		case errors.Is(result.Err, models.ErrNoRecord):
+			item.Status = "This dive no longer exists"
+			item.Failed = true
+			item.Selected = false
+		default:
+			app.log.Error("Failed to bulk update dive", "id", result.ID, "error", result.Err.Error())
+			item.Status = "This dive could not be updated"
+			item.Failed = true
+		}
+	}
+
+	if form.AllOrNothing {
+		form.AddNonFieldError(fmt.Sprintf(
+			"None of the dives have been updated as %d of them could not be",
+			failures,
+		))
+	} else {
+		form.AddNonFieldError(fmt.Sprintf(
+			"%d of %d dives have been updated, but %d could not be",
+			len(results)-failures,
+			len(results),
+			failures,
+		))
+	}
+
+	app.renderDiveBulkEdit(w, r, http.StatusConflict, form, items)
+}
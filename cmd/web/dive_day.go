@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// suggestedSurfaceInterval is the time between surfacing from one dive and
+// descending on the next that is suggested when logging repetitive dives.
+const suggestedSurfaceInterval = time.Hour
+
+// maxDiveDayDives is the most dives that can be logged together on the page for
+// a day of repetitive dives.
+const maxDiveDayDives = 8
+
+// nextDiveForm returns a diveForm for a new dive that follows on from prev. The
+// site, operator, trip, buddy, equipment, tank and gas are the same as prev, but
+// anything that is particular to prev, such as its notes and rating, is left
+// empty. The dive is suggested to start a surface interval after prev ended.
+func nextDiveForm(prev models.Dive, number int) diveForm {
+	form := diveFormFromDive(prev)
+
+	form.ID = 0
+	form.Version = 0
+	form.Number = number
+	form.DateTimeIn = prev.DateTimeOut().Add(suggestedSurfaceInterval)
+	form.AvgDepth = nil
+	form.PressureOut = nil
+	form.Rating = nil
+	form.Notes = ""
+	form.HasProfile = false
+
+	return form
+}
+
+// readPreviousDive returns the dive whose ID is in the "from" query string
+// parameter of r. If there is not one, then false is returned and a response
+// has already been sent.
+func (app *app) readPreviousDive(w http.ResponseWriter, r *http.Request) (models.Dive, bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Dive{}, false
+	}
+
+	dive, err := app.dives.GetOneByID(app.contextGetUser(r).ID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Dive{}, false
+	}
+
+	return dive, true
+}
+
+// diveDayForm holds a day of repetitive dives that all follow on from the dive
+// From. Errors for the individual dives are keyed by the names of their inputs,
+// for example "dives[0].max_depth".
+type diveDayForm struct {
+	From                int          `form:"from"`
+	Dives               []diveDayRow `form:"dives"`
+	validator.Validator `form:"-"`
+}
+
+// diveDayRow holds the details of a single dive on a day of repetitive dives.
+// Everything else about the dive is copied from the dive that the day follows
+// on from.
+type diveDayRow struct {
+	Include        bool      `form:"include"`
+	Number         int       `form:"number"`
+	DateTimeIn     time.Time `form:"date_time_in"`
+	MaxDepth       float64   `form:"max_depth"`
+	BottomTimeMins int       `form:"bottom_time"`
+	Notes          string    `form:"notes"`
+}
+
+// newDiveDayForm returns a diveDayForm for count dives following on from prev,
+// numbered from number onwards and each starting a surface interval after the
+// one before it is suggested to end.
+func newDiveDayForm(prev models.Dive, number, count int) diveDayForm {
+	form := diveDayForm{From: prev.ID}
+
+	start := prev.DateTimeOut().Add(suggestedSurfaceInterval)
+	for i := range count {
+		form.Dives = append(form.Dives, diveDayRow{
+			Include:        true,
+			Number:         number + i,
+			DateTimeIn:     start,
+			MaxDepth:       prev.MaxDepth,
+			BottomTimeMins: int(prev.BottomTime.Minutes()),
+		})
+		start = start.Add(prev.BottomTime + suggestedSurfaceInterval)
+	}
+
+	return form
+}
+
+// validateDiveDayForm validates each of the included dives as they will be
+// logged, returning them ready to be inserted. Errors with the details that are
+// copied from prev cannot be corrected on the page, so they are added as
+// non-field errors.
+func (app *app) validateDiveDayForm(
+	f *diveDayForm,
+	prev models.Dive,
+	userID int,
+) ([]models.DiveFields, error) {
+	// These are the fields of a diveForm that are entered for each dive.
+	rowFields := []string{"number", "date_time_in", "max_depth", "bottom_time", "notes"}
+
+	var dives []models.DiveFields
+	numbers := map[int]bool{}
+	lastOut := prev.DateTimeOut()
+
+	for i, row := range f.Dives {
+		if !row.Include {
+			continue
+		}
+
+		form := nextDiveForm(prev, row.Number)
+		form.DateTimeIn = row.DateTimeIn
+		form.MaxDepth = row.MaxDepth
+		form.BottomTimeMins = row.BottomTimeMins
+		form.Notes = row.Notes
+
+		err := app.validateDiveForm(&form, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		key := func(field string) string {
+			return fmt.Sprintf("dives[%d].%s", i, field)
+		}
+
+		for _, field := range rowFields {
+			if msg, ok := form.FieldErrors[field]; ok {
+				f.AddFieldError(key(field), msg)
+				delete(form.FieldErrors, field)
+			}
+		}
+		for _, field := range slices.Sorted(maps.Keys(form.FieldErrors)) {
+			msg := form.FieldErrors[field]
+			f.AddNonFieldError(fmt.Sprintf("Dive #%d, %s: %s", row.Number, field, msg))
+		}
+		for _, msg := range form.NonFieldErrors {
+			f.AddNonFieldError(fmt.Sprintf("Dive #%d: %s", row.Number, msg))
+		}
+
+		exists, err := app.dives.NumberExists(userID, row.Number)
+		if err != nil {
+			return nil, err
+		}
+		f.CheckField(!exists, key("number"), "A dive has already been logged with this number")
+		f.CheckField(!numbers[row.Number], key("number"), "This number is used by another dive above")
+		numbers[row.Number] = true
+
+		f.CheckField(
+			!row.DateTimeIn.Before(lastOut),
+			key("date_time_in"),
+			"This dive cannot start before the previous dive has finished",
+		)
+		lastOut = row.DateTimeIn.Add(time.Duration(row.BottomTimeMins) * time.Minute)
+
+		dives = append(dives, form.diveFields())
+	}
+
+	if len(dives) == 0 {
+		f.AddNonFieldError("Select at least one dive to log")
+	}
+
+	return dives, nil
+}
+
+func (app *app) renderDiveDay(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	prev models.Dive,
+	form diveDayForm,
+) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Dive = prev
+	data.Form = form
+
+	app.render(w, r, status, "dive/day.tmpl", data)
+}
+
+// diveDayGET shows the page for logging a day of repetitive dives that follow
+// on from the dive given in the "from" query string parameter. The number of
+// dives on the page is given by the "count" parameter.
+func (app *app) diveDayGET(w http.ResponseWriter, r *http.Request) {
+	prev, ok := app.readPreviousDive(w, r)
+	if !ok {
+		return
+	}
+
+	count := app.readInt(r.URL.Query(), "count", 3)
+	count = max(1, min(count, maxDiveDayDives))
+
+	number := app.contextGetUser(r).NextDiveNumber()
+	form := newDiveDayForm(prev, number, count)
+
+	app.renderDiveDay(w, r, http.StatusOK, prev, form)
+}
+
+func (app *app) diveDayPOST(w http.ResponseWriter, r *http.Request) {
+	form := diveDayForm{}
+	err := app.decodePOSTForm(r, &form)
+	if err != nil {
+		app.log.Error("Error whilst decoding dive day form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if len(form.Dives) > maxDiveDayDives {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	prev, err := app.dives.GetOneByID(userID, form.From)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	dives, err := app.validateDiveDayForm(&form, prev, userID)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to validate dive day form: %w", err))
+		return
+	}
+
+	if !form.Valid() {
+		app.renderDiveDay(w, r, http.StatusUnprocessableEntity, prev, form)
+		return
+	}
+
+	_, err = app.dives.InsertMany(userID, dives)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateDiveNumber) {
+			form.AddNonFieldError("One of the dive numbers has just been logged, please check them and try again")
+			app.renderDiveDay(w, r, http.StatusUnprocessableEntity, prev, form)
+			return
+		}
+
+		app.serverError(w, r, err)
+		return
+	}
+
+	msg := fmt.Sprintf("%d dive(s) have been logged.", len(dives))
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+	http.Redirect(w, r, "/log-book/dive/", http.StatusSeeOther)
+}
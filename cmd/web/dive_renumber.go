@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+// diveRenumberForm holds the changes to the dive numbers that the user saw on
+// the preview, so that they are only made if they are still the same.
+type diveRenumberForm struct {
+	Changes []diveRenumberRow `form:"changes"`
+}
+
+// diveRenumberRow is the number that a single dive will be given.
+type diveRenumberRow struct {
+	ID     int `form:"id"`
+	Number int `form:"number"`
+}
+
+// diveRenumberGET shows the problems with the numbering of the user's dives
+// and previews the changes that renumbering them would make.
+func (app *app) diveRenumberGET(w http.ResponseWriter, r *http.Request) {
+	report, err := app.dives.NumberingReport(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.DiveNumbering = report
+
+	app.render(w, r, http.StatusOK, "dive/renumber.tmpl", data)
+}
+
+func (app *app) diveRenumberPOST(w http.ResponseWriter, r *http.Request) {
+	form := diveRenumberForm{}
+	err := app.decodePOSTForm(r, &form)
+	if err != nil {
+		app.log.Error("Error whilst decoding dive renumber form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var expected []models.DiveNumbering
+	for _, row := range form.Changes {
+		expected = append(expected, models.DiveNumbering{ID: row.ID, NewNumber: row.Number})
+	}
+
+	changed, err := app.dives.Renumber(app.contextGetUser(r).ID, expected)
+	if err != nil {
+		if errors.Is(err, models.ErrUpdateConflict) {
+			msg := "Your dives have changed since the preview was shown, please check the " +
+				"new preview and try again."
+			app.sessionManager.Put(r.Context(), "flashError", msg)
+			http.Redirect(w, r, "/log-book/dive/renumber", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	msg := fmt.Sprintf("%d dive(s) have been renumbered.", changed)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+	http.Redirect(w, r, "/log-book/dive/", http.StatusSeeOther)
+}
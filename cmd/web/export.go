@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/logbook"
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// exportGenerator is the application name written into exported log books.
+const exportGenerator = "DiveSite"
+
+// logbookSite converts a dive site into the format-agnostic logbook.Site used
+// by the log book and dive site exporters.
+func logbookSite(ds models.DiveSite) *logbook.Site {
+	site := &logbook.Site{
+		Name:        ds.Name,
+		AltName:     ds.AltName,
+		Location:    ds.Location,
+		Region:      ds.Region,
+		Country:     ds.Country.Name,
+		CountryCode: ds.Country.ISO2Code,
+		TimeZone:    ds.TimeZone.String(),
+		Latitude:    ds.Latitude,
+		Longitude:   ds.Longitude,
+		Altitude:    ref(ds.Altitude),
+		MaxDepth:    ds.MaxDepth,
+		WaterBody:   ds.WaterBody.Name,
+		WaterType:   ds.WaterType.Name,
+		Rating:      ds.Rating,
+		Notes:       ds.Notes,
+		Dives:       ds.DivesAt,
+	}
+
+	// Show the first and last dive dates as they were at the dive site.
+	if ds.FirstDiveAt != nil {
+		site.FirstDive = ref(ds.FirstDiveAt.In(&ds.TimeZone.Location))
+	}
+	if ds.LastDiveAt != nil {
+		site.LastDive = ref(ds.LastDiveAt.In(&ds.TimeZone.Location))
+	}
+
+	return site
+}
+
+// logbookDive converts a logged dive into the format-agnostic logbook.Dive used
+// by the log book exporters.
+func logbookDive(dive models.Dive) logbook.Dive {
+	site := logbookSite(dive.DiveSite)
+
+	cylinder := logbook.Cylinder{
+		Mix:         dive.GasMix.Name,
+		Description: dive.GasMixNotes,
+		Volume:      ref(dive.TankVolume),
+		O2:          dive.FO2,
+	}
+	if dive.PressureIn != nil {
+		cylinder.StartPressure = ref(float64(*dive.PressureIn))
+	}
+	if dive.PressureOut != nil {
+		cylinder.EndPressure = ref(float64(*dive.PressureOut))
+	}
+
+	d := logbook.Dive{
+		Number:            dive.Number,
+		Activity:          dive.Activity,
+		DateTimeIn:        dive.DateTimeIn,
+		SurfaceInterval:   dive.SurfaceInterval,
+		Duration:          dive.BottomTime,
+		SafetyStop:        dive.SafetyStop,
+		MaxDepth:          dive.MaxDepth,
+		AvgDepth:          dive.AvgDepth,
+		Visibility:        dive.Visibility,
+		Rating:            dive.Rating,
+		Site:              site,
+		Cylinders:         []logbook.Cylinder{cylinder},
+		TankConfiguration: dive.TankConfiguration.Name,
+		TankMaterial:      dive.TankMaterial.Name,
+		GasMixNotes:       dive.GasMixNotes,
+		Weight:            dive.Weight,
+		WeightNotes:       dive.WeightNotes,
+		EquipmentNotes:    dive.EquipmentNotes,
+		EntryPoint:        dive.EntryPoint.Name,
+		Notes:             dive.Notes,
+	}
+
+	if dive.WaterTemp != nil {
+		d.WaterTemp = ref(float64(*dive.WaterTemp))
+	}
+	if dive.AirTemp != nil {
+		d.AirTemp = ref(float64(*dive.AirTemp))
+	}
+	if dive.Current != nil {
+		d.Current = dive.Current.Name
+	}
+	if dive.Waves != nil {
+		d.Waves = dive.Waves.Name
+	}
+	if dive.Operator != nil {
+		d.Operator = dive.Operator.Name
+	}
+	if dive.Certification != nil {
+		d.Certification = dive.Certification.Course.Name
+	}
+	if dive.Price != nil {
+		d.Price = &dive.Price.Amount
+		d.Currency = dive.Price.Currency.ISOAlpha
+	}
+	if dive.Buddy != nil {
+		d.Buddies = []string{dive.Buddy.Name}
+	}
+	if dive.BuddyRole != nil {
+		d.BuddyRole = dive.BuddyRole.Name
+	}
+	if dive.Trip != nil {
+		d.Trip = &logbook.Trip{
+			Name:        dive.Trip.Name,
+			StartDate:   dive.Trip.StartDate,
+			EndDate:     dive.Trip.EndDate,
+			Description: dive.Trip.Description,
+			Rating:      dive.Trip.Rating,
+			Notes:       dive.Trip.Notes,
+		}
+	}
+
+	for _, eq := range dive.Equipment {
+		d.Equipment = append(d.Equipment, eq.Name)
+	}
+	for _, prop := range dive.Properties {
+		d.Properties = append(d.Properties, prop.Name)
+	}
+	for _, s := range dive.Profile {
+		d.Samples = append(d.Samples, logbook.Sample{
+			Time:        s.Elapsed,
+			Depth:       s.Depth,
+			Temperature: s.Temperature,
+			Pressure:    s.Pressure,
+			PPO2:        s.PPO2,
+			CNS:         s.CNS,
+			StopDepth:   s.StopDepth,
+			StopTime:    s.StopTime,
+			Events:      s.Events,
+		})
+	}
+
+	return d
+}
+
+// exportFilename returns the name of the file that an export of the given kind
+// of data in the given format should be downloaded as.
+func exportFilename(user *models.User, kind, ext string) string {
+	return fmt.Sprintf(
+		"%s-%d-%s.%s",
+		kind,
+		user.ID,
+		time.Now().Format("20060102"),
+		ext,
+	)
+}
+
+// diveExportUDDF downloads the user's dives that match the DiveFilter given in
+// the query string as a UDDF log book, in the order given by its sort value.
+func (app *app) diveExportUDDF(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	qs := r.URL.Query()
+	filter := app.readDiveFilter(qs)
+
+	sort, _ := readListSort(qs, diveSortOptions, []models.SortDive{models.SortDiveDateAsc})
+
+	dives, err := app.dives.ListAll(user.ID, filter, sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Profiles are not loaded with the list of dives, so fetch the ones that
+	// have been recorded all at once.
+	var profileIDs []int
+	for _, dive := range dives {
+		if dive.HasProfile {
+			profileIDs = append(profileIDs, dive.ID)
+		}
+	}
+
+	profiles := map[int]models.DiveProfile{}
+	if len(profileIDs) > 0 {
+		profiles, err = app.dives.GetProfiles(user.ID, profileIDs)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	exported := make([]logbook.Dive, 0, len(dives))
+	for _, dive := range dives {
+		dive.Profile = profiles[dive.ID]
+		exported = append(exported, logbookDive(dive))
+	}
+
+	buf := new(bytes.Buffer)
+	err = logbook.WriteUDDF(buf, exportGenerator, exported)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to write uddf export: %w", err))
+		return
+	}
+
+	disposition := fmt.Sprintf("attachment; filename=%q", exportFilename(user, "log-book", "uddf"))
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
+
+// diveExportPDF downloads a printable PDF log book of the user's dives that
+// match the DiveFilter given in the query string, which may include a range of
+// dive numbers, in the order given by its sort value. The layout query string
+// parameter chooses between a full or a half page per dive.
+func (app *app) diveExportPDF(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	qs := r.URL.Query()
+	filter := app.readDiveFilter(qs)
+
+	layout := cmp.Or(qs.Get("layout"), logbook.PDFLayoutFull)
+	if !validator.PermittedValue(layout, logbook.PDFLayoutFull, logbook.PDFLayoutHalf) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	defaultSort := []models.SortDive{models.SortDiveDateAsc, models.SortDiveIDAsc}
+	sort, _ := readListSort(qs, diveSortOptions, defaultSort)
+
+	dives, err := app.dives.ListAll(user.ID, filter, sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	exported := make([]logbook.Dive, 0, len(dives))
+	for _, dive := range dives {
+		exported = append(exported, logbookDive(dive))
+	}
+
+	cover := logbook.PDFCover{
+		Name:        user.Name,
+		TotalDives:  user.TotalDives,
+		DivingSince: user.DivingSince,
+	}
+
+	buf := new(bytes.Buffer)
+	err = logbook.WritePDF(buf, exportGenerator, cover, exported, layout)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to write pdf export: %w", err))
+		return
+	}
+
+	disposition := fmt.Sprintf("attachment; filename=%q", exportFilename(user, "log-book", "pdf"))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
+
+// diveCSVHeader holds the column names of a CSV export of dives, in the same
+// order as the values returned by diveCSVRecord.
+var diveCSVHeader = []string{
+	"id", "version", "created", "updated", "number", "activity",
+	"date_time_in", "date_time_out", "timezone", "surface_interval_mins",
+	"dive_site_id", "dive_site", "dive_site_alt_name", "dive_site_location",
+	"dive_site_region", "dive_site_country", "dive_site_latitude",
+	"dive_site_longitude", "dive_site_altitude", "water_body", "water_type",
+	"operator", "price", "price_currency", "trip", "certification",
+	"max_depth", "avg_depth", "bottom_time_mins", "safety_stop_mins",
+	"water_temp", "air_temp", "visibility", "current", "waves", "buddy",
+	"buddy_role", "weight", "weight_notes", "equipment", "equipment_notes",
+	"tank_configuration", "tank_count", "tank_material", "tank_volume",
+	"gas_mix", "fo2", "pressure_in", "pressure_out", "gas_used", "sac_rate",
+	"gas_mix_notes", "entry_point", "properties", "rating", "notes",
+}
+
+// csvFloat formats a float for a CSV export using the fewest digits needed.
+func csvFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// csvPtr formats an optional value for a CSV export using the given format
+// function, or returns the empty string if it is nil.
+func csvPtr[T any](v *T, format func(T) string) string {
+	if v == nil {
+		return ""
+	}
+
+	return format(*v)
+}
+
+// csvMins formats a duration as a number of minutes for a CSV export.
+func csvMins(d time.Duration) string {
+	return csvFloat(d.Minutes())
+}
+
+// diveCSVRecord returns the values of a single row of a CSV export of dives.
+// Dates and times are given in the time zone of the dive site.
+func diveCSVRecord(dive models.Dive) []string {
+	ds := dive.DiveSite
+
+	var equipment, properties []string
+	for _, eq := range dive.Equipment {
+		equipment = append(equipment, eq.Name)
+	}
+	for _, prop := range dive.Properties {
+		properties = append(properties, prop.Name)
+	}
+
+	var sacRate string
+	if sac := dive.SACRate(); sac != 0 {
+		sacRate = strconv.FormatFloat(sac, 'f', 2, 64)
+	}
+
+	var gasUsed string
+	if used := dive.GasUsed(); used != 0 {
+		gasUsed = csvFloat(used)
+	}
+
+	return []string{
+		strconv.Itoa(dive.ID),
+		strconv.Itoa(dive.Version),
+		dive.Created.Format(time.RFC3339),
+		dive.Updated.Format(time.RFC3339),
+		strconv.Itoa(dive.Number),
+		dive.Activity,
+		dive.DateTimeIn.Format(time.RFC3339),
+		dive.DateTimeOut().Format(time.RFC3339),
+		ds.TimeZone.String(),
+		csvPtr(dive.SurfaceInterval, csvMins),
+		strconv.Itoa(ds.ID),
+		ds.Name,
+		ds.AltName,
+		ds.Location,
+		ds.Region,
+		ds.Country.Name,
+		csvPtr(ds.Latitude, csvFloat),
+		csvPtr(ds.Longitude, csvFloat),
+		strconv.Itoa(ds.Altitude),
+		ds.WaterBody.Name,
+		ds.WaterType.Name,
+		csvPtr(dive.Operator, func(o models.Operator) string { return o.Name }),
+		csvPtr(dive.Price, func(p models.Price) string { return csvFloat(p.Amount) }),
+		csvPtr(dive.Price, func(p models.Price) string { return p.Currency.ISOAlpha }),
+		csvPtr(dive.Trip, func(t models.Trip) string { return t.Name }),
+		csvPtr(dive.Certification, func(c models.Certification) string { return c.Course.Name }),
+		csvFloat(dive.MaxDepth),
+		csvPtr(dive.AvgDepth, csvFloat),
+		csvMins(dive.BottomTime),
+		csvPtr(dive.SafetyStop, csvMins),
+		csvPtr(dive.WaterTemp, strconv.Itoa),
+		csvPtr(dive.AirTemp, strconv.Itoa),
+		csvPtr(dive.Visibility, csvFloat),
+		csvPtr(dive.Current, func(c models.Current) string { return c.Name }),
+		csvPtr(dive.Waves, func(w models.Waves) string { return w.Name }),
+		csvPtr(dive.Buddy, func(b models.Buddy) string { return b.Name }),
+		csvPtr(dive.BuddyRole, func(b models.BuddyRole) string { return b.Name }),
+		csvPtr(dive.Weight, csvFloat),
+		dive.WeightNotes,
+		strings.Join(equipment, "; "),
+		dive.EquipmentNotes,
+		dive.TankConfiguration.Name,
+		strconv.Itoa(dive.TankConfiguration.TankCount),
+		dive.TankMaterial.Name,
+		csvFloat(dive.TankVolume),
+		dive.GasMix.Name,
+		csvFloat(dive.FO2),
+		csvPtr(dive.PressureIn, strconv.Itoa),
+		csvPtr(dive.PressureOut, strconv.Itoa),
+		gasUsed,
+		sacRate,
+		dive.GasMixNotes,
+		dive.EntryPoint.Name,
+		strings.Join(properties, "; "),
+		csvPtr(dive.Rating, strconv.Itoa),
+		dive.Notes,
+	}
+}
+
+// diveExportCSV streams the user's dives that match the DiveFilter given in
+// the query string as a CSV file, in the order given by its sort value. The
+// dives are written as they are read from the database, so any error part way
+// through can only be logged and results in a truncated file.
+func (app *app) diveExportCSV(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	qs := r.URL.Query()
+	filter := app.readDiveFilter(qs)
+	sort, _ := readListSort(qs, diveSortOptions, models.SortDiveDefault)
+
+	disposition := fmt.Sprintf("attachment; filename=%q", exportFilename(user, "log-book", "csv"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", disposition)
+
+	cw := csv.NewWriter(w)
+
+	err := cw.Write(diveCSVHeader)
+	if err != nil {
+		app.log.Error("Failed to write CSV export header", "error", err.Error())
+		return
+	}
+
+	err = app.dives.StreamAll(user.ID, filter, sort, func(dive models.Dive) error {
+		return cw.Write(diveCSVRecord(dive))
+	})
+	if err != nil {
+		app.log.Error("Failed to stream CSV export", "user", user.ID, "error", err.Error())
+		return
+	}
+
+	cw.Flush()
+	err = cw.Error()
+	if err != nil {
+		app.log.Error("Failed to flush CSV export", "error", err.Error())
+	}
+}
+
+// diveSiteExportFormats maps each supported dive site export format onto its
+// writer and content type.
+var diveSiteExportFormats = map[string]struct {
+	contentType string
+	write       func(w io.Writer, sites []logbook.Site) error
+}{
+	"gpx": {
+		contentType: "application/gpx+xml",
+		write: func(w io.Writer, sites []logbook.Site) error {
+			return logbook.WriteGPX(w, exportGenerator, sites)
+		},
+	},
+	"kml": {
+		contentType: "application/vnd.google-earth.kml+xml",
+		write: func(w io.Writer, sites []logbook.Site) error {
+			return logbook.WriteKML(w, exportGenerator, sites)
+		},
+	},
+	"geojson": {
+		contentType: "application/geo+json",
+		write:       logbook.WriteGeoJSON,
+	},
+}
+
+// diveSiteExport downloads the dive sites that the user has added or dived at
+// as GPX waypoints, KML placemarks or GeoJSON features, optionally filtered by
+// the country_id and water_body_id query string parameters. Sites without a
+// position are left out as they cannot be shown on a map.
+func (app *app) diveSiteExport(w http.ResponseWriter, r *http.Request) {
+	format := r.PathValue("format")
+	exporter, ok := diveSiteExportFormats[format]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	filter := app.readDiveSiteFilter(r.URL.Query())
+
+	diveSites, err := app.diveSites.ListForDiver(user.ID, filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sites := make([]logbook.Site, 0, len(diveSites))
+	for _, ds := range diveSites {
+		sites = append(sites, *logbookSite(ds))
+	}
+
+	buf := new(bytes.Buffer)
+	err = exporter.write(buf, sites)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to write %s dive site export: %w", format, err))
+		return
+	}
+
+	disposition := fmt.Sprintf("attachment; filename=%q", exportFilename(user, "dive-sites", format))
+	w.Header().Set("Content-Type", exporter.contentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"errors"
 	"fmt"
+	"html/template"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -153,15 +155,8 @@ func (app *app) userCreatePOST(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/user/log-in", http.StatusSeeOther)
 }
 
-func (app *app) userUpdateGET(w http.ResponseWriter, r *http.Request) {
-	data, err := app.newTemplateData(r)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	user := app.contextGetUser(r)
-	data.Form = userProfileForm{
+func userProfileFormFromUser(user *models.User) userProfileForm {
+	return userProfileForm{
 		Name:                   user.Name,
 		Email:                  user.Email,
 		DivingSince:            user.DivingSince,
@@ -170,6 +165,23 @@ func (app *app) userUpdateGET(w http.ResponseWriter, r *http.Request) {
 		DefaultDivingTZ:        user.DefaultDivingTZ,
 		DarkMode:               user.DarkMode,
 	}
+}
+
+func (app *app) userUpdateGET(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = userProfileFormFromUser(app.contextGetUser(r))
+	data.CalendarURL = app.sessionManager.PopString(r.Context(), "calendarURL")
+
+	err = app.addAPITokensToTemplateData(r, &data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
 	app.render(w, r, http.StatusOK, "user/profile_form.tmpl", data)
 }
@@ -189,6 +201,12 @@ func (app *app) userUpdatePOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = app.addAPITokensToTemplateData(r, &data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	form.Validate(false)
 
 	if !form.Valid() {
@@ -344,23 +362,23 @@ func (app *app) home(w http.ResponseWriter, r *http.Request) {
 }
 
 type diveSiteForm struct {
-	ID                  int             `form:"-"`
-	Version             int             `form:"version"`
-	Name                string          `form:"name"`
-	AltName             string          `form:"alt_name"`
-	Location            string          `form:"location"`
-	Region              string          `form:"region"`
-	CountryID           int             `form:"country"`
-	TimeZone            models.TimeZone `form:"timezone"`
-	Latitude            *float64        `form:"latitude"`
-	Longitude           *float64        `form:"longitude"`
-	WaterBodyID         int             `form:"water_body"`
-	WaterTypeID         int             `form:"water_type"`
-	Altitude            int             `form:"altitude"`
-	MaxDepth            *float64        `form:"max_depth"`
-	Notes               string          `form:"notes"`
-	Rating              *int            `form:"rating"`
-	validator.Validator `form:"-"`
+	ID                  int             `form:"-" json:"-"`
+	Version             int             `form:"version" json:"version"`
+	Name                string          `form:"name" json:"name"`
+	AltName             string          `form:"alt_name" json:"alt_name"`
+	Location            string          `form:"location" json:"location"`
+	Region              string          `form:"region" json:"region"`
+	CountryID           int             `form:"country" json:"country"`
+	TimeZone            models.TimeZone `form:"timezone" json:"timezone"`
+	Latitude            *float64        `form:"latitude" json:"latitude"`
+	Longitude           *float64        `form:"longitude" json:"longitude"`
+	WaterBodyID         int             `form:"water_body" json:"water_body"`
+	WaterTypeID         int             `form:"water_type" json:"water_type"`
+	Altitude            int             `form:"altitude" json:"altitude"`
+	MaxDepth            *float64        `form:"max_depth" json:"max_depth"`
+	Notes               string          `form:"notes" json:"notes"`
+	Rating              *int            `form:"rating" json:"rating"`
+	validator.Validator `form:"-" json:"-"`
 }
 
 func (ds *diveSiteForm) Validate() {
@@ -434,6 +452,27 @@ func (ds *diveSiteForm) Validate() {
 	}
 }
 
+func diveSiteFormFromDiveSite(diveSite models.DiveSite) diveSiteForm {
+	return diveSiteForm{
+		ID:          diveSite.ID,
+		Version:     diveSite.Version,
+		Name:        diveSite.Name,
+		AltName:     diveSite.AltName,
+		Location:    diveSite.Location,
+		Region:      diveSite.Region,
+		CountryID:   diveSite.Country.ID,
+		TimeZone:    diveSite.TimeZone,
+		Latitude:    diveSite.Latitude,
+		Longitude:   diveSite.Longitude,
+		WaterBodyID: diveSite.WaterBody.ID,
+		WaterTypeID: diveSite.WaterType.ID,
+		Altitude:    diveSite.Altitude,
+		MaxDepth:    diveSite.MaxDepth,
+		Notes:       diveSite.Notes,
+		Rating:      diveSite.Rating,
+	}
+}
+
 func (app *app) diveSiteCreateGET(w http.ResponseWriter, r *http.Request) {
 	data, err := app.newTemplateData(r)
 	if err != nil {
@@ -527,24 +566,7 @@ func (app *app) diveSiteUpdateGET(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data.Form = diveSiteForm{
-		ID:          id,
-		Version:     diveSite.Version,
-		Name:        diveSite.Name,
-		AltName:     diveSite.AltName,
-		Location:    diveSite.Location,
-		Region:      diveSite.Region,
-		CountryID:   diveSite.Country.ID,
-		TimeZone:    diveSite.TimeZone,
-		Latitude:    diveSite.Latitude,
-		Longitude:   diveSite.Longitude,
-		WaterBodyID: diveSite.WaterBody.ID,
-		WaterTypeID: diveSite.WaterType.ID,
-		Altitude:    diveSite.Altitude,
-		MaxDepth:    diveSite.MaxDepth,
-		Notes:       diveSite.Notes,
-		Rating:      diveSite.Rating,
-	}
+	data.Form = diveSiteFormFromDiveSite(diveSite)
 
 	app.render(w, r, http.StatusOK, "dive_site/form.tmpl", data)
 }
@@ -633,7 +655,9 @@ func (app *app) diveSiteList(w http.ResponseWriter, r *http.Request) {
 	pager := models.NewPager(page, pageSize, defaultPageSize)
 	userID := app.contextGetUser(r).ID
 
-	diveSites, pageData, err := app.diveSites.List(userID, pager, models.SortDiveSiteDefault)
+	sort, sortQuery := readListSort(r.URL.Query(), diveSiteSortOptions, models.SortDiveSiteDefault)
+
+	diveSites, pageData, err := app.diveSites.List(userID, pager, sort)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -645,6 +669,8 @@ func (app *app) diveSiteList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	data.DiveSites = diveSites
+	data.ListQuery = listQuery(nil, sortQuery)
+	data.Sort = sortQuery
 	data.PageData = pageData
 
 	app.render(w, r, http.StatusOK, "dive_site/list.tmpl", data)
@@ -689,105 +715,127 @@ func (app *app) diveSiteGET(w http.ResponseWriter, r *http.Request) {
 }
 
 type operatorForm struct {
-	Name                string `form:"name"`
-	OperatorTypeID      int    `form:"operator_type_id"`
-	Street              string `form:"street"`
-	Suburb              string `form:"suburb"`
-	State               string `form:"state"`
-	Postcode            string `form:"postcode"`
-	CountryID           int    `form:"country"`
-	WebsiteURL          string `form:"website_url"`
-	EmailAddress        string `form:"email_address"`
-	PhoneNumber         string `form:"phone_number"`
-	Comments            string `form:"comments"`
-	validator.Validator `       form:"-"`
-}
-
-func (app *app) operatorCreateGET(w http.ResponseWriter, r *http.Request) {
-	data, err := app.newTemplateData(r)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	data.Form = operatorForm{}
-	app.render(w, r, http.StatusOK, "operator/new.tmpl", data)
+	ID                  int    `form:"-" json:"-"`
+	Name                string `form:"name" json:"name"`
+	OperatorTypeID      int    `form:"operator_type_id" json:"operator_type_id"`
+	Street              string `form:"street" json:"street"`
+	Suburb              string `form:"suburb" json:"suburb"`
+	State               string `form:"state" json:"state"`
+	Postcode            string `form:"postcode" json:"postcode"`
+	CountryID           int    `form:"country" json:"country"`
+	WebsiteURL          string `form:"website_url" json:"website_url"`
+	EmailAddress        string `form:"email_address" json:"email_address"`
+	PhoneNumber         string `form:"phone_number" json:"phone_number"`
+	Comments            string `form:"comments" json:"comments"`
+	validator.Validator `form:"-" json:"-"`
 }
 
-func (app *app) operatorCreatePOST(w http.ResponseWriter, r *http.Request) {
-	form := &operatorForm{}
-	err := app.decodePOSTForm(r, form)
-	if err != nil {
-		app.log.Error("Error whilst decoding operator form input", "error", err.Error())
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
-
+func (of *operatorForm) Validate() {
 	maxCharsErrMsg := "This field cannot be more than %d characters long"
 
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	of.CheckField(validator.NotBlank(of.Name), "name", "This field cannot be blank")
 
-	form.CheckField(form.OperatorTypeID > 0, "operator_type_id", "This field must be selected")
+	of.CheckField(of.OperatorTypeID > 0, "operator_type_id", "This field must be selected")
 
-	form.CheckField(
-		validator.MaxChars(form.Street, 256),
+	of.CheckField(
+		validator.MaxChars(of.Street, 256),
 		"street",
 		fmt.Sprintf(maxCharsErrMsg, 256),
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.Suburb, 256),
+	of.CheckField(
+		validator.MaxChars(of.Suburb, 256),
 		"suburb",
 		fmt.Sprintf(maxCharsErrMsg, 256),
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.Street, 256),
-		"street",
+	of.CheckField(
+		validator.MaxChars(of.State, 256),
+		"state",
 		fmt.Sprintf(maxCharsErrMsg, 256),
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.Postcode, 16),
+	of.CheckField(
+		validator.MaxChars(of.Postcode, 16),
 		"postcode",
 		fmt.Sprintf(maxCharsErrMsg, 16),
 	)
 
-	form.CheckField(form.CountryID > 0, "country_id", "This field must be selected")
+	of.CheckField(of.CountryID > 0, "country", "This field must be selected")
 
-	form.CheckField(
-		form.WebsiteURL == "" || validator.IsHTTPURL(form.WebsiteURL),
+	of.CheckField(
+		of.WebsiteURL == "" || validator.IsHTTPURL(of.WebsiteURL),
 		"website_url",
 		"This field must be a valid HTTP or HTTPS URL",
 	)
-	form.CheckField(
-		validator.MaxChars(form.WebsiteURL, 2048),
+	of.CheckField(
+		validator.MaxChars(of.WebsiteURL, 2048),
 		"website_url",
 		fmt.Sprintf(maxCharsErrMsg, 2048),
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.EmailAddress, 254),
+	of.CheckField(
+		validator.MaxChars(of.EmailAddress, 254),
 		"email_address",
 		fmt.Sprintf(maxCharsErrMsg, 254),
 	)
-	form.CheckField(
-		form.EmailAddress == "" || validator.Matches(form.EmailAddress, validator.EmailRX),
+	of.CheckField(
+		of.EmailAddress == "" || validator.Matches(of.EmailAddress, validator.EmailRX),
 		"email_address",
 		"This field must be a valid email address",
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.PhoneNumber, 32),
+	of.CheckField(
+		validator.MaxChars(of.PhoneNumber, 32),
 		"phone_number",
 		fmt.Sprintf(maxCharsErrMsg, 32),
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.Comments, 4096),
+	of.CheckField(
+		validator.MaxChars(of.Comments, 4096),
 		"comments",
 		fmt.Sprintf(maxCharsErrMsg, 4096),
 	)
+}
+
+func operatorFormFromOperator(operator models.Operator) operatorForm {
+	return operatorForm{
+		ID:             operator.ID,
+		Name:           operator.Name,
+		OperatorTypeID: operator.OperatorType.ID,
+		Street:         operator.Street,
+		Suburb:         operator.Suburb,
+		State:          operator.State,
+		Postcode:       operator.Postcode,
+		CountryID:      operator.Country.ID,
+		WebsiteURL:     operator.WebsiteURL,
+		EmailAddress:   operator.EmailAddress,
+		PhoneNumber:    operator.PhoneNumber,
+		Comments:       operator.Comments,
+	}
+}
+
+func (app *app) operatorCreateGET(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = operatorForm{}
+	app.render(w, r, http.StatusOK, "operator/form.tmpl", data)
+}
+
+func (app *app) operatorCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &operatorForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding operator form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate()
 
 	data, err := app.newTemplateData(r)
 	if err != nil {
@@ -797,7 +845,7 @@ func (app *app) operatorCreatePOST(w http.ResponseWriter, r *http.Request) {
 
 	if !form.Valid() {
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "operator/new.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "operator/form.tmpl", data)
 		return
 	}
 
@@ -819,7 +867,7 @@ func (app *app) operatorCreatePOST(w http.ResponseWriter, r *http.Request) {
 		if errors.Is(err, models.ErrDuplicateEmail) {
 			form.AddFieldError("email", "This operator already exists")
 			data.Form = form
-			app.render(w, r, http.StatusUnprocessableEntity, "operator/new.tmpl", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "operator/form.tmpl", data)
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -839,7 +887,9 @@ func (app *app) operatorList(w http.ResponseWriter, r *http.Request) {
 	pager := models.NewPager(page, pageSize, defaultPageSize)
 	userID := app.contextGetUser(r).ID
 
-	operators, pageData, err := app.operators.List(userID, pager, models.SortOperatorDefault)
+	sort, sortQuery := readListSort(r.URL.Query(), operatorSortOptions, models.SortOperatorDefault)
+
+	operators, pageData, err := app.operators.List(userID, pager, sort)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -852,123 +902,335 @@ func (app *app) operatorList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data.Operators = operators
+	data.ListQuery = listQuery(nil, sortQuery)
+	data.Sort = sortQuery
 	data.PageData = pageData
 
 	app.render(w, r, http.StatusOK, "operator/list.tmpl", data)
 }
 
-type buddyForm struct {
-	Name                string `form:"name"`
-	EmailAddress        string `form:"email_address"`
-	PhoneNumber         string `form:"phone_number"`
-	AgencyID            *int   `form:"agency_id"`
-	AgencyMemberNum     string `form:"agency_member_num"`
-	Notes               string `form:"notes"`
-	validator.Validator `       form:"-"`
-}
+func (app *app) operatorGET(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
 
-func (app *app) buddyList(w http.ResponseWriter, r *http.Request) {
-	const defaultPageSize = 20
+	userID := app.contextGetUser(r).ID
 
-	page := app.readInt(r.URL.Query(), "page", 1)
-	pageSize := app.readInt(r.URL.Query(), "page_size", defaultPageSize)
+	operator, err := app.operators.GetOneByID(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
 
-	userID := app.contextGetUser(r).ID
-	pager := models.NewPager(page, pageSize, defaultPageSize)
-	sort := []models.SortBuddy{models.SortBuddyNameAsc}
+	scorecard, err := app.operators.Scorecard(id, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
-	buddies, pageData, err := app.buddies.List(userID, pager, sort)
+	filter := models.DiveFilter{OperatorID: id}
+	dives, err := app.dives.ListAll(userID, filter, models.SortDiveDefault)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Users only have a handful of trips and certifications, so it is simpler
+	// to pick out the operator's ones here than to filter them in the database.
+	allTrips, err := app.trips.ListAll(userID, models.SortTripDefault)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var trips []models.Trip
+	for _, trip := range allTrips {
+		if trip.Operator != nil && trip.Operator.ID == id {
+			trips = append(trips, trip)
+		}
+	}
+
+	allCerts, err := app.certifications.ListAll(userID, models.SortCertDefault)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	var certs []models.Certification
+	for _, cert := range allCerts {
+		if cert.Operator.ID == id {
+			certs = append(certs, cert)
+		}
+	}
+
 	data, err := app.newTemplateData(r)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
-	data.Buddies = buddies
-	data.PageData = pageData
+	data.Operator = operator
+	data.OperatorScorecard = scorecard
+	data.Dives = dives
+	data.Trips = trips
+	data.Certifications = certs
 
-	app.render(w, r, http.StatusOK, "buddy/list.tmpl", data)
+	app.render(w, r, http.StatusOK, "operator/view.tmpl", data)
 }
 
-func (app *app) buddyCreateGET(w http.ResponseWriter, r *http.Request) {
+// readOwnOperator returns the operator with the ID in the request's path if it
+// belongs to the user. Operators are shared, but only their owner may edit
+// them, so any others are reported as not found. The returned bool is false if
+// a response has already been written.
+func (app *app) readOwnOperator(w http.ResponseWriter, r *http.Request) (models.Operator, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Operator{}, false
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	operator, err := app.operators.GetOneByID(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Operator{}, false
+	}
+
+	if operator.OwnerID != userID {
+		http.NotFound(w, r)
+		return models.Operator{}, false
+	}
+
+	return operator, true
+}
+
+func (app *app) operatorUpdateGET(w http.ResponseWriter, r *http.Request) {
+	operator, ok := app.readOwnOperator(w, r)
+	if !ok {
+		return
+	}
+
 	data, err := app.newTemplateData(r)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	data.Form = buddyForm{}
-	app.render(w, r, http.StatusOK, "buddy/new.tmpl", data)
+	data.Form = operatorFormFromOperator(operator)
+
+	app.render(w, r, http.StatusOK, "operator/form.tmpl", data)
 }
 
-func (app *app) buddyCreatePOST(w http.ResponseWriter, r *http.Request) {
-	form := &buddyForm{}
+func (app *app) operatorUpdatePOST(w http.ResponseWriter, r *http.Request) {
+	operator, ok := app.readOwnOperator(w, r)
+	if !ok {
+		return
+	}
+
+	form := &operatorForm{}
 	err := app.decodePOSTForm(r, form)
 	if err != nil {
-		app.log.Error("Error whilst decoding buddy form input", "error", err.Error())
+		app.log.Error("Error whilst decoding operator form input", "error", err.Error())
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
+	form.ID = operator.ID
+
+	form.Validate()
+	if !form.Valid() {
+		data, err := app.newTemplateData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "operator/form.tmpl", data)
+		return
+	}
+
+	err = app.operators.Update(
+		operator.ID,
+		app.contextGetUser(r).ID,
+		form.OperatorTypeID,
+		form.Name,
+		form.Street,
+		form.Suburb,
+		form.State,
+		form.Postcode,
+		form.CountryID,
+		form.WebsiteURL,
+		form.EmailAddress,
+		form.PhoneNumber,
+		form.Comments,
+	)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			msg := `The dive operator you are trying to change does not exist or
+                    you do not have permission to edit it.`
+			app.sessionManager.Put(r.Context(), "flashError", msg)
+			http.Redirect(w, r, "/operator/", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	msg := "Dive operator " + form.Name + " has been updated successfully."
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+
+	nextUrl := fmt.Sprintf("/operator/view/%d", operator.ID)
+	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+}
+
+type buddyForm struct {
+	ID                  int    `form:"-" json:"-"`
+	Version             int    `form:"version" json:"version"`
+	Name                string `form:"name" json:"name"`
+	EmailAddress        string `form:"email_address" json:"email_address"`
+	PhoneNumber         string `form:"phone_number" json:"phone_number"`
+	AgencyID            *int   `form:"agency_id" json:"agency_id"`
+	AgencyMemberNum     string `form:"agency_member_num" json:"agency_member_num"`
+	Notes               string `form:"notes" json:"notes"`
+	validator.Validator `form:"-" json:"-"`
+}
+
+func (bf *buddyForm) Validate() {
 	maxCharsErrMsg := "This field cannot be more than %d characters long"
 
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(
-		validator.MaxChars(form.Name, 256),
+	bf.CheckField(validator.NotBlank(bf.Name), "name", "This field cannot be blank")
+	bf.CheckField(
+		validator.MaxChars(bf.Name, 256),
 		"name",
 		fmt.Sprintf(maxCharsErrMsg, 256),
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.EmailAddress, 254),
+	bf.CheckField(
+		validator.MaxChars(bf.EmailAddress, 254),
 		"email_address",
 		fmt.Sprintf(maxCharsErrMsg, 254),
 	)
-	form.CheckField(
-		form.EmailAddress == "" || validator.Matches(form.EmailAddress, validator.EmailRX),
+	bf.CheckField(
+		bf.EmailAddress == "" || validator.Matches(bf.EmailAddress, validator.EmailRX),
 		"email_address",
 		"This field must be a valid email address",
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.PhoneNumber, 32),
+	bf.CheckField(
+		validator.MaxChars(bf.PhoneNumber, 32),
 		"phone_number",
 		fmt.Sprintf(maxCharsErrMsg, 32),
 	)
 
-	if form.AgencyID == nil {
-		if form.AgencyMemberNum != "" {
-			form.AddNonFieldError("Please choose an agency for the agency membership number")
+	if bf.AgencyID == nil {
+		if bf.AgencyMemberNum != "" {
+			bf.AddNonFieldError("Please choose an agency for the agency membership number")
 		}
 	} else {
-		form.CheckField(*form.AgencyID > 0, "agency_id", "This field must be selected")
+		bf.CheckField(*bf.AgencyID > 0, "agency_id", "This field must be selected")
 	}
 
-	form.CheckField(
-		validator.MaxChars(form.AgencyMemberNum, 16),
+	bf.CheckField(
+		validator.MaxChars(bf.AgencyMemberNum, 16),
 		"agency_member_num",
 		fmt.Sprintf(maxCharsErrMsg, 16),
 	)
 
-	form.CheckField(
-		validator.MaxChars(form.Notes, 4096),
+	bf.CheckField(
+		validator.MaxChars(bf.Notes, 4096),
 		"notes",
 		fmt.Sprintf(maxCharsErrMsg, 4096),
 	)
+}
 
-	data, err := app.newTemplateData(r)
-	if err != nil {
+func buddyFormFromBuddy(buddy models.Buddy) buddyForm {
+	form := buddyForm{
+		ID:              buddy.ID,
+		Version:         buddy.Version,
+		Name:            buddy.Name,
+		EmailAddress:    buddy.Email,
+		PhoneNumber:     buddy.PhoneNumber,
+		AgencyMemberNum: buddy.AgencyMemberNum,
+		Notes:           buddy.Notes,
+	}
+
+	if buddy.Agency != nil {
+		form.AgencyID = &buddy.Agency.ID
+	}
+
+	return form
+}
+
+func (app *app) buddyList(w http.ResponseWriter, r *http.Request) {
+	const defaultPageSize = 20
+
+	page := app.readInt(r.URL.Query(), "page", 1)
+	pageSize := app.readInt(r.URL.Query(), "page_size", defaultPageSize)
+
+	userID := app.contextGetUser(r).ID
+	pager := models.NewPager(page, pageSize, defaultPageSize)
+	sort, sortQuery := readListSort(r.URL.Query(), buddySortOptions, models.SortBuddyDefault)
+
+	buddies, pageData, err := app.buddies.List(userID, pager, sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.Buddies = buddies
+	data.ListQuery = listQuery(nil, sortQuery)
+	data.PageData = pageData
+	data.Sort = sortQuery
+
+	app.render(w, r, http.StatusOK, "buddy/list.tmpl", data)
+}
+
+func (app *app) buddyCreateGET(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = buddyForm{}
+	app.render(w, r, http.StatusOK, "buddy/form.tmpl", data)
+}
+
+func (app *app) buddyCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &buddyForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding buddy form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate()
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
 	if !form.Valid() {
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "buddy/new.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "buddy/form.tmpl", data)
 		return
 	}
 
@@ -990,44 +1252,191 @@ func (app *app) buddyCreatePOST(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-type tripForm struct {
-	Name                string    `form:"name"`
-	StartDate           time.Time `form:"start_date"`
-	EndDate             time.Time `form:"end_date"`
-	Description         string    `form:"description"`
-	Rating              *int      `form:"rating"`
-	OperatorID          *int      `form:"operator_id"`
-	PriceAmount         *float64  `form:"price"`
-	CurrencyID          *int      `form:"currency_id"`
-	Notes               string    `form:"notes"`
-	validator.Validator `form:"-"`
+func (app *app) buddyGET(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	buddy, err := app.buddies.GetOneByID(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	filter := models.DiveFilter{BuddyID: id}
+	dives, err := app.dives.ListAll(userID, filter, models.SortDiveDefault)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.Buddy = buddy
+	data.Dives = dives
+	data.DiveSiteCounts = diveSiteCounts(dives)
+
+	app.render(w, r, http.StatusOK, "buddy/view.tmpl", data)
 }
 
-func (app *app) tripCreateGET(w http.ResponseWriter, r *http.Request) {
+func (app *app) buddyUpdateGET(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	buddy, err := app.buddies.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
 	data, err := app.newTemplateData(r)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	data.Form = tripForm{}
-	app.render(w, r, http.StatusOK, "trip/new.tmpl", data)
+	data.Form = buddyFormFromBuddy(buddy)
+
+	app.render(w, r, http.StatusOK, "buddy/form.tmpl", data)
 }
 
-func (app *app) tripCreatePOST(w http.ResponseWriter, r *http.Request) {
-	form := &tripForm{}
-	err := app.decodePOSTForm(r, form)
+func (app *app) buddyUpdatePOST(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	form := &buddyForm{}
+	err = app.decodePOSTForm(r, form)
 	if err != nil {
-		app.log.Error("Error whilst decoding trip form input", "error", err.Error())
+		app.log.Error("Error whilst decoding buddy form input", "error", err.Error())
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
+	form.ID = id
+
+	form.Validate()
+	if !form.Valid() {
+		data, err := app.newTemplateData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "buddy/form.tmpl", data)
+		return
+	}
+
+	err = app.buddies.Update(
+		id,
+		app.contextGetUser(r).ID,
+		form.Version,
+		form.Name,
+		form.EmailAddress,
+		form.PhoneNumber,
+		form.AgencyID,
+		form.AgencyMemberNum,
+		form.Notes,
+	)
+	if err != nil {
+		switch err {
+		case models.ErrUpdateConflict:
+			app.buddyUpdateConflict(w, r, form)
+		case models.ErrNoRecord:
+			msg := `The dive buddy you are trying to change does not exist or you
+                    do not have permission to edit it.`
+			app.sessionManager.Put(r.Context(), "flashError", msg)
+			http.Redirect(w, r, "/buddy/", http.StatusSeeOther)
+		default:
+			app.serverError(w, r, err)
+		}
+
+		return
+	}
+
+	msg := "Dive buddy " + form.Name + " has been updated successfully."
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+
+	nextUrl := fmt.Sprintf("/buddy/view/%d", id)
+	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+}
+
+// buddyUpdateConflict re-renders the buddy form with the user's values when the
+// buddy has been updated by someone else since the form was loaded, along with
+// the fields that differ from the stored buddy.
+func (app *app) buddyUpdateConflict(w http.ResponseWriter, r *http.Request, form *buddyForm) {
+	buddy, err := app.buddies.GetOneByID(form.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	options := conflictOptions{
+		"agency_id": optionNames(data.Agencies, func(ag models.Agency) (int, string) {
+			return ag.ID, ag.Acronym
+		}),
+	}
+
+	data.Conflicts = formConflicts(form, buddyFormFromBuddy(buddy), options)
+	form.Version = buddy.Version
+	form.AddNonFieldError(
+		"This dive buddy was changed by someone else whilst you were editing it",
+	)
+
+	data.Form = form
+	app.render(w, r, http.StatusConflict, "buddy/form.tmpl", data)
+}
+
+type tripForm struct {
+	ID                  int       `form:"-" json:"-"`
+	Name                string    `form:"name" json:"name"`
+	StartDate           time.Time `form:"start_date" json:"start_date"`
+	EndDate             time.Time `form:"end_date" json:"end_date"`
+	Description         string    `form:"description" json:"description"`
+	Rating              *int      `form:"rating" json:"rating"`
+	OperatorID          *int      `form:"operator_id" json:"operator_id"`
+	PriceAmount         *float64  `form:"price" json:"price"`
+	CurrencyID          *int      `form:"currency_id" json:"currency_id"`
+	Notes               string    `form:"notes" json:"notes"`
+	validator.Validator `form:"-" json:"-"`
+}
+
+func (tf *tripForm) Validate() {
 	maxCharsErrMsg := "This field cannot be more than %d characters long"
 
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(
-		validator.MaxChars(form.Name, 256),
+	tf.CheckField(validator.NotBlank(tf.Name), "name", "This field cannot be blank")
+	tf.CheckField(
+		validator.MaxChars(tf.Name, 256),
 		"name",
 		fmt.Sprintf(maxCharsErrMsg, 256),
 	)
@@ -1035,8 +1444,8 @@ func (app *app) tripCreatePOST(w http.ResponseWriter, r *http.Request) {
 	earliestDate := time.Date(1960, time.January, 1, 0, 0, 0, 0, time.UTC)
 	latestDate := time.Now().Add(365 * 24 * time.Hour)
 	dateErrorMsg := "This field must be between %s and %s"
-	form.CheckField(
-		validator.TimeBetween(form.StartDate, earliestDate, latestDate),
+	tf.CheckField(
+		validator.TimeBetween(tf.StartDate, earliestDate, latestDate),
 		"start_date",
 		fmt.Sprintf(
 			dateErrorMsg,
@@ -1044,8 +1453,8 @@ func (app *app) tripCreatePOST(w http.ResponseWriter, r *http.Request) {
 			latestDate.Format(time.DateOnly),
 		),
 	)
-	form.CheckField(
-		validator.TimeBetween(form.EndDate, earliestDate, latestDate),
+	tf.CheckField(
+		validator.TimeBetween(tf.EndDate, earliestDate, latestDate),
 		"end_date",
 		fmt.Sprintf(
 			dateErrorMsg,
@@ -1053,56 +1462,102 @@ func (app *app) tripCreatePOST(w http.ResponseWriter, r *http.Request) {
 			latestDate.Format(time.DateOnly),
 		),
 	)
-	if form.EndDate.Before(form.StartDate) {
-		form.AddNonFieldError("The trip start date must be before the end date")
+	if tf.EndDate.Before(tf.StartDate) {
+		tf.AddNonFieldError("The trip start date must be before the end date")
 	}
 
-	form.CheckField(
-		validator.MaxChars(form.Description, 1024),
+	tf.CheckField(
+		validator.MaxChars(tf.Description, 1024),
 		"description",
 		fmt.Sprintf(maxCharsErrMsg, 256),
 	)
 
-	if form.Rating != nil {
-		form.CheckField(
-			validator.NumBetween(*form.Rating, 0, 10),
+	if tf.Rating != nil {
+		tf.CheckField(
+			validator.NumBetween(*tf.Rating, 0, 10),
 			"rating",
 			"This field must be between 0 and 10 inclusive",
 		)
 	}
 
-	if form.OperatorID != nil {
-		form.CheckField(*form.OperatorID > 0, "operator_id", "Select a valid operator")
+	if tf.OperatorID != nil {
+		tf.CheckField(*tf.OperatorID > 0, "operator_id", "Select a valid operator")
 	}
 
-	if form.PriceAmount != nil {
-		form.CheckField(
-			validator.NumBetween(*form.PriceAmount, 0.0, 9_999_999_999.999),
+	if tf.PriceAmount != nil {
+		tf.CheckField(
+			validator.NumBetween(*tf.PriceAmount, 0.0, 9_999_999_999.999),
 			"price",
 			"This field must be between 0.0 and 9,999,999,999.99 inclusive",
 		)
 
-		if form.CurrencyID == nil {
-			form.AddFieldError("currency_id", "A currency must be selected for the price")
+		if tf.CurrencyID == nil {
+			tf.AddFieldError("currency_id", "A currency must be selected for the price")
 		}
 	}
 
-	if form.CurrencyID != nil {
-		form.CheckField(*form.CurrencyID > 0, "currency_id", "Select a valid currency")
+	if tf.CurrencyID != nil {
+		tf.CheckField(*tf.CurrencyID > 0, "currency_id", "Select a valid currency")
 
-		if form.PriceAmount == nil {
-			form.AddFieldError(
+		if tf.PriceAmount == nil {
+			tf.AddFieldError(
 				"price",
 				"A price must be entered for the currency",
 			)
 		}
 	}
 
-	form.CheckField(
-		validator.MaxChars(form.Notes, 4096),
+	tf.CheckField(
+		validator.MaxChars(tf.Notes, 4096),
 		"notes",
 		fmt.Sprintf(maxCharsErrMsg, 4096),
 	)
+}
+
+func tripFormFromTrip(trip models.Trip) tripForm {
+	form := tripForm{
+		ID:          trip.ID,
+		Name:        trip.Name,
+		StartDate:   trip.StartDate,
+		EndDate:     trip.EndDate,
+		Description: trip.Description,
+		Rating:      trip.Rating,
+		Notes:       trip.Notes,
+	}
+
+	if trip.Operator != nil {
+		form.OperatorID = &trip.Operator.ID
+	}
+
+	if trip.Price != nil {
+		form.PriceAmount = &trip.Price.Amount
+		form.CurrencyID = &trip.Price.Currency.ID
+	}
+
+	return form
+}
+
+func (app *app) tripCreateGET(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = tripForm{}
+	app.render(w, r, http.StatusOK, "trip/form.tmpl", data)
+}
+
+func (app *app) tripCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &tripForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding trip form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate()
 
 	data, err := app.newTemplateData(r)
 	if err != nil {
@@ -1112,7 +1567,7 @@ func (app *app) tripCreatePOST(w http.ResponseWriter, r *http.Request) {
 
 	if !form.Valid() {
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "trip/new.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "trip/form.tmpl", data)
 		return
 	}
 
@@ -1146,66 +1601,273 @@ func (app *app) tripList(w http.ResponseWriter, r *http.Request) {
 	pager := models.NewPager(page, pageSize, defaultPageSize)
 	userID := app.contextGetUser(r).ID
 
-	trips, pageData, err := app.trips.List(userID, pager, models.SortTripDefault)
+	sort, sortQuery := readListSort(r.URL.Query(), tripSortOptions, models.SortTripDefault)
+
+	trips, pageData, err := app.trips.List(userID, pager, sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Trips = trips
+	data.ListQuery = listQuery(nil, sortQuery)
+	data.Sort = sortQuery
+	data.PageData = pageData
+
+	app.render(w, r, http.StatusOK, "trip/list.tmpl", data)
+}
+
+// tripDivesForm is the bulk action on the trip page that adds dives to, or
+// removes dives from, the trip.
+type tripDivesForm struct {
+	Action              string `form:"action"`
+	DiveIDs             []int  `form:"dive_id"`
+	validator.Validator `form:"-"`
+}
+
+// renderTrip renders the page that shows the trip along with its itinerary, a
+// summary of its dives and the dives around its dates that could be added to
+// it.
+func (app *app) renderTrip(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	trip models.Trip,
+	form tripDivesForm,
+) {
+	userID := app.contextGetUser(r).ID
+	sort := []models.SortDive{models.SortDiveDateAsc, models.SortDiveIDAsc}
+
+	filter := models.DiveFilter{TripID: trip.ID}
+	dives, err := app.dives.ListAll(userID, filter, sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The dates are compared with the local time of the dives, so the day
+	// after the end of the trip gives an inclusive range.
+	from := trip.StartDate
+	to := trip.EndDate.AddDate(0, 0, 1)
+	filter = models.DiveFilter{DateFrom: &from, DateTo: &to}
+	nearbyDives, err := app.dives.ListAll(userID, filter, sort)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var candidates []models.Dive
+	for _, dive := range nearbyDives {
+		if dive.Trip == nil || dive.Trip.ID != trip.ID {
+			candidates = append(candidates, dive)
+		}
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
+	data.Trip = trip
+	data.Dives = dives
+	data.DiveSummary = summariseDives(dives)
+	data.DiveSiteCounts = diveSiteCounts(dives)
+	data.TripCandidateDives = candidates
+
+	app.render(w, r, status, "trip/view.tmpl", data)
+}
+
+// readTrip returns the user's trip with the ID in the request's path. The
+// returned bool is false if a response has already been written.
+func (app *app) readTrip(w http.ResponseWriter, r *http.Request) (models.Trip, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Trip{}, false
+	}
+
+	trip, err := app.trips.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Trip{}, false
+	}
+
+	return trip, true
+}
+
+func (app *app) tripGET(w http.ResponseWriter, r *http.Request) {
+	trip, ok := app.readTrip(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderTrip(w, r, http.StatusOK, trip, tripDivesForm{})
+}
+
+func (app *app) tripDivesPOST(w http.ResponseWriter, r *http.Request) {
+	trip, ok := app.readTrip(w, r)
+	if !ok {
+		return
+	}
+
+	form := tripDivesForm{}
+	err := app.decodePOSTForm(r, &form)
+	if err != nil {
+		app.log.Error("Error whilst decoding trip dives form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !validator.PermittedValue(form.Action, "attach", "detach") {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if len(form.DiveIDs) == 0 {
+		form.AddNonFieldError("Select at least one dive")
+		app.renderTrip(w, r, http.StatusUnprocessableEntity, trip, form)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	var changed int64
+	var msg string
+	if form.Action == "attach" {
+		changed, err = app.trips.AttachDives(trip.ID, userID, form.DiveIDs)
+		msg = "%d dive(s) have been added to %s."
+	} else {
+		changed, err = app.trips.DetachDives(trip.ID, userID, form.DiveIDs)
+		msg = "%d dive(s) have been removed from %s."
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flashSuccess", fmt.Sprintf(msg, changed, trip.Name))
+
+	nextUrl := fmt.Sprintf("/trip/view/%d", trip.ID)
+	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+}
+
+func (app *app) tripUpdateGET(w http.ResponseWriter, r *http.Request) {
+	trip, ok := app.readTrip(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := app.newTemplateData(r)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	data, err := app.newTemplateData(r)
+	data.Form = tripFormFromTrip(trip)
+
+	app.render(w, r, http.StatusOK, "trip/form.tmpl", data)
+}
+
+func (app *app) tripUpdatePOST(w http.ResponseWriter, r *http.Request) {
+	trip, ok := app.readTrip(w, r)
+	if !ok {
+		return
+	}
+
+	form := &tripForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding trip form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.ID = trip.ID
+
+	form.Validate()
+	if !form.Valid() {
+		data, err := app.newTemplateData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "trip/form.tmpl", data)
+		return
+	}
+
+	err = app.trips.Update(
+		trip.ID,
+		app.contextGetUser(r).ID,
+		form.Name,
+		form.StartDate,
+		form.EndDate,
+		form.Description,
+		form.Rating,
+		form.OperatorID,
+		form.PriceAmount,
+		form.CurrencyID,
+		form.Notes,
+	)
 	if err != nil {
-		app.serverError(w, r, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			msg := `The dive trip you are trying to change does not exist or you
+                    do not have permission to edit it.`
+			app.sessionManager.Put(r.Context(), "flashError", msg)
+			http.Redirect(w, r, "/trip/", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
-	data.Trips = trips
-	data.PageData = pageData
+	msg := "Dive trip " + form.Name + " has been updated successfully."
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
 
-	app.render(w, r, http.StatusOK, "trip/list.tmpl", data)
+	nextUrl := fmt.Sprintf("/trip/view/%d", trip.ID)
+	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
 }
 
 type certificationForm struct {
-	CourseID            int       `form:"course_id"`
-	StartDate           time.Time `form:"start_date"`
-	EndDate             time.Time `form:"end_date"`
-	OperatorID          int       `form:"operator_id"`
-	InstructorID        int       `form:"instructor_id"`
-	PriceAmount         *float64  `form:"price"`
-	CurrencyID          *int      `form:"currency_id"`
-	Rating              *int      `form:"rating"`
-	Notes               string    `form:"notes"`
-	validator.Validator `form:"-"`
-}
-
-func (app *app) certificationCreateGET(w http.ResponseWriter, r *http.Request) {
-	data, err := app.newTemplateData(r)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	data.Form = certificationForm{}
-	app.render(w, r, http.StatusOK, "certification/new.tmpl", data)
+	ID                  int       `form:"-" json:"-"`
+	CourseID            int       `form:"course_id" json:"course_id"`
+	StartDate           time.Time `form:"start_date" json:"start_date"`
+	EndDate             time.Time `form:"end_date" json:"end_date"`
+	OperatorID          int       `form:"operator_id" json:"operator_id"`
+	InstructorID        int       `form:"instructor_id" json:"instructor_id"`
+	PriceAmount         *float64  `form:"price" json:"price"`
+	CurrencyID          *int      `form:"currency_id" json:"currency_id"`
+	Rating              *int      `form:"rating" json:"rating"`
+	Notes               string    `form:"notes" json:"notes"`
+	validator.Validator `form:"-" json:"-"`
 }
 
-func (app *app) certificationCreatePOST(w http.ResponseWriter, r *http.Request) {
-	form := &certificationForm{}
-	err := app.decodePOSTForm(r, form)
-	if err != nil {
-		app.log.Error("Error whilst decoding certification form input", "error", err.Error())
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
-
+func (cf *certificationForm) Validate() {
 	maxCharsErrMsg := "This field cannot be more than %d characters long"
 
-	form.CheckField(form.CourseID > 0, "course_id", "Select a valid course")
+	cf.CheckField(cf.CourseID > 0, "course_id", "Select a valid course")
 
 	earliestDate := time.Date(1960, time.January, 1, 0, 0, 0, 0, time.UTC)
 	latestDate := time.Now().Add(365 * 24 * time.Hour)
 	dateErrorMsg := "This field must be between %s and %s"
-	form.CheckField(
-		validator.TimeBetween(form.StartDate, earliestDate, latestDate),
+	cf.CheckField(
+		validator.TimeBetween(cf.StartDate, earliestDate, latestDate),
 		"start_date",
 		fmt.Sprintf(
 			dateErrorMsg,
@@ -1213,8 +1875,8 @@ func (app *app) certificationCreatePOST(w http.ResponseWriter, r *http.Request)
 			latestDate.Format(time.DateOnly),
 		),
 	)
-	form.CheckField(
-		validator.TimeBetween(form.EndDate, earliestDate, latestDate),
+	cf.CheckField(
+		validator.TimeBetween(cf.EndDate, earliestDate, latestDate),
 		"end_date",
 		fmt.Sprintf(
 			dateErrorMsg,
@@ -1222,50 +1884,93 @@ func (app *app) certificationCreatePOST(w http.ResponseWriter, r *http.Request)
 			latestDate.Format(time.DateOnly),
 		),
 	)
-	if form.EndDate.Before(form.StartDate) {
-		form.AddNonFieldError("The certification start date must be before the end date")
+	if cf.EndDate.Before(cf.StartDate) {
+		cf.AddNonFieldError("The certification start date must be before the end date")
 	}
 
-	form.CheckField(form.OperatorID > 0, "operator_id", "Select a valid operator")
+	cf.CheckField(cf.OperatorID > 0, "operator_id", "Select a valid operator")
 
-	form.CheckField(form.InstructorID > 0, "instructor_id", "Select a valid instructor")
+	cf.CheckField(cf.InstructorID > 0, "instructor_id", "Select a valid instructor")
 
-	if form.PriceAmount != nil {
-		form.CheckField(
-			validator.NumBetween(*form.PriceAmount, 0.0, 9_999_999_999.999),
+	if cf.PriceAmount != nil {
+		cf.CheckField(
+			validator.NumBetween(*cf.PriceAmount, 0.0, 9_999_999_999.999),
 			"price",
 			"This field must be between 0.0 and 9,999,999,999.99 inclusive",
 		)
 
-		if form.CurrencyID == nil {
-			form.AddFieldError("currency_id", "A currency must be selected for the price")
+		if cf.CurrencyID == nil {
+			cf.AddFieldError("currency_id", "A currency must be selected for the price")
 		}
 	}
 
-	if form.CurrencyID != nil {
-		form.CheckField(*form.CurrencyID > 0, "currency_id", "Select a valid currency")
+	if cf.CurrencyID != nil {
+		cf.CheckField(*cf.CurrencyID > 0, "currency_id", "Select a valid currency")
 
-		if form.PriceAmount == nil {
-			form.AddFieldError(
+		if cf.PriceAmount == nil {
+			cf.AddFieldError(
 				"price",
 				"A price must be entered for the currency",
 			)
 		}
 	}
 
-	if form.Rating != nil {
-		form.CheckField(
-			validator.NumBetween(*form.Rating, 0, 10),
+	if cf.Rating != nil {
+		cf.CheckField(
+			validator.NumBetween(*cf.Rating, 0, 10),
 			"rating",
 			"This field must be between 0 and 10 inclusive",
 		)
 	}
 
-	form.CheckField(
-		validator.MaxChars(form.Notes, 4096),
+	cf.CheckField(
+		validator.MaxChars(cf.Notes, 4096),
 		"notes",
 		fmt.Sprintf(maxCharsErrMsg, 4096),
 	)
+}
+
+func certificationFormFromCertification(cert models.Certification) certificationForm {
+	form := certificationForm{
+		ID:           cert.ID,
+		CourseID:     cert.Course.ID,
+		StartDate:    cert.StartDate,
+		EndDate:      cert.EndDate,
+		OperatorID:   cert.Operator.ID,
+		InstructorID: cert.Instructor.ID,
+		Rating:       cert.Rating,
+		Notes:        cert.Notes,
+	}
+
+	if cert.Price != nil {
+		form.PriceAmount = &cert.Price.Amount
+		form.CurrencyID = &cert.Price.Currency.ID
+	}
+
+	return form
+}
+
+func (app *app) certificationCreateGET(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = certificationForm{}
+	app.render(w, r, http.StatusOK, "certification/form.tmpl", data)
+}
+
+func (app *app) certificationCreatePOST(w http.ResponseWriter, r *http.Request) {
+	form := &certificationForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding certification form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate()
 
 	data, err := app.newTemplateData(r)
 	if err != nil {
@@ -1275,7 +1980,7 @@ func (app *app) certificationCreatePOST(w http.ResponseWriter, r *http.Request)
 
 	if !form.Valid() {
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "certification/new.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "certification/form.tmpl", data)
 		return
 	}
 
@@ -1309,7 +2014,9 @@ func (app *app) certificationList(w http.ResponseWriter, r *http.Request) {
 	pager := models.NewPager(page, pageSize, defaultPageSize)
 	userID := app.contextGetUser(r).ID
 
-	certs, pageData, err := app.certifications.List(userID, pager, models.SortCertDefault)
+	sort, sortQuery := readListSort(r.URL.Query(), certSortOptions, models.SortCertDefault)
+
+	certs, pageData, err := app.certifications.List(userID, pager, sort)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -1322,51 +2029,180 @@ func (app *app) certificationList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data.Certifications = certs
+	data.ListQuery = listQuery(nil, sortQuery)
+	data.Sort = sortQuery
 	data.PageData = pageData
 
 	app.render(w, r, http.StatusOK, "certification/list.tmpl", data)
 }
 
+// readCertification returns the user's certification with the ID in the
+// request's path. The returned bool is false if a response has already been
+// written.
+func (app *app) readCertification(
+	w http.ResponseWriter,
+	r *http.Request,
+) (models.Certification, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Certification{}, false
+	}
+
+	cert, err := app.certifications.GetOneByID(id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Certification{}, false
+	}
+
+	return cert, true
+}
+
+func (app *app) certificationGET(w http.ResponseWriter, r *http.Request) {
+	cert, ok := app.readCertification(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderCertification(w, r, http.StatusOK, cert, certificationCardForm{})
+}
+
+func (app *app) certificationUpdateGET(w http.ResponseWriter, r *http.Request) {
+	cert, ok := app.readCertification(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = certificationFormFromCertification(cert)
+
+	app.render(w, r, http.StatusOK, "certification/form.tmpl", data)
+}
+
+func (app *app) certificationUpdatePOST(w http.ResponseWriter, r *http.Request) {
+	cert, ok := app.readCertification(w, r)
+	if !ok {
+		return
+	}
+
+	form := &certificationForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding certification form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.ID = cert.ID
+
+	form.Validate()
+	if !form.Valid() {
+		data, err := app.newTemplateData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "certification/form.tmpl", data)
+		return
+	}
+
+	err = app.certifications.Update(
+		cert.ID,
+		app.contextGetUser(r).ID,
+		form.CourseID,
+		form.StartDate,
+		form.EndDate,
+		form.OperatorID,
+		form.InstructorID,
+		form.PriceAmount,
+		form.CurrencyID,
+		form.Rating,
+		form.Notes,
+	)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			msg := `The dive certification you are trying to change does not exist
+                    or you do not have permission to edit it.`
+			app.sessionManager.Put(r.Context(), "flashError", msg)
+			http.Redirect(w, r, "/certification/", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flashSuccess", "Dive certification has been updated successfully.")
+
+	nextUrl := fmt.Sprintf("/certification/view/%d", cert.ID)
+	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+}
+
 type diveForm struct {
-	ID                  int       `form:"-"`
-	Version             int       `form:"version"`
-	Number              int       `form:"number"`
-	Activity            string    `form:"activity"`
-	DiveSiteID          int       `form:"dive_site_id"`
-	OperatorID          *int      `form:"operator_id"`
-	PriceAmount         *float64  `form:"price_amount"`
-	CurrencyID          *int      `form:"currency_id"`
-	TripID              *int      `form:"trip_id"`
-	CertificationID     *int      `form:"certification_id"`
-	DateTimeIn          time.Time `form:"date_time_in"`
-	MaxDepth            float64   `form:"max_depth"`
-	AvgDepth            *float64  `form:"avg_depth"`
-	BottomTimeMins      int       `form:"bottom_time"`
-	SafetyStopMins      *int      `form:"safety_stop"`
-	WaterTemp           *int      `form:"water_temp"`
-	AirTemp             *int      `form:"air_temp"`
-	Visibility          *float64  `form:"visibility"`
-	CurrentID           *int      `form:"current_id"`
-	WavesID             *int      `form:"waves_id"`
-	BuddyID             *int      `form:"buddy_id"`
-	BuddyRoleID         *int      `form:"buddy_role_id"`
-	Weight              *float64  `form:"weight"`
-	WeightNotes         string    `form:"weight_notes"`
-	EquipmentIDs        []int     `form:"equipment_ids"`
-	EquipmentNotes      string    `form:"equipment_notes"`
-	TankConfigurationID int       `form:"tank_configuration_id"`
-	TankMaterialID      int       `form:"tank_material_id"`
-	TankVolume          float64   `form:"tank_volume"`
-	GasMixID            int       `form:"gas_mix_id"`
-	FO2                 float64   `form:"fo2"`
-	PressureIn          *int      `form:"pressure_in"`
-	PressureOut         *int      `form:"pressure_out"`
-	GasMixNotes         string    `form:"gas_mix_notes"`
-	EntryPointID        int       `form:"entry_point_id"`
-	Rating              *int      `form:"rating"`
-	PropertyIDs         []int     `form:"property_ids"`
-	Notes               string    `form:"notes"`
-	validator.Validator `form:"-"`
+	ID                  int                `form:"-" json:"-"`
+	Version             int                `form:"version" json:"version"`
+	Number              int                `form:"number" json:"number"`
+	Activity            string             `form:"activity" json:"activity"`
+	DiveSiteID          int                `form:"dive_site_id" json:"dive_site_id"`
+	OperatorID          *int               `form:"operator_id" json:"operator_id"`
+	PriceAmount         *float64           `form:"price_amount" json:"price_amount"`
+	CurrencyID          *int               `form:"currency_id" json:"currency_id"`
+	TripID              *int               `form:"trip_id" json:"trip_id"`
+	CertificationID     *int               `form:"certification_id" json:"certification_id"`
+	DateTimeIn          time.Time          `form:"date_time_in" json:"date_time_in"`
+	MaxDepth            float64            `form:"max_depth" json:"max_depth"`
+	AvgDepth            *float64           `form:"avg_depth" json:"avg_depth"`
+	BottomTimeMins      int                `form:"bottom_time" json:"bottom_time"`
+	SafetyStopMins      *int               `form:"safety_stop" json:"safety_stop"`
+	WaterTemp           *int               `form:"water_temp" json:"water_temp"`
+	AirTemp             *int               `form:"air_temp" json:"air_temp"`
+	Visibility          *float64           `form:"visibility" json:"visibility"`
+	CurrentID           *int               `form:"current_id" json:"current_id"`
+	WavesID             *int               `form:"waves_id" json:"waves_id"`
+	BuddyID             *int               `form:"buddy_id" json:"buddy_id"`
+	BuddyRoleID         *int               `form:"buddy_role_id" json:"buddy_role_id"`
+	Weight              *float64           `form:"weight" json:"weight"`
+	WeightNotes         string             `form:"weight_notes" json:"weight_notes"`
+	EquipmentIDs        []int              `form:"equipment_ids" json:"equipment_ids"`
+	EquipmentNotes      string             `form:"equipment_notes" json:"equipment_notes"`
+	TankConfigurationID int                `form:"tank_configuration_id" json:"tank_configuration_id"`
+	TankMaterialID      int                `form:"tank_material_id" json:"tank_material_id"`
+	TankVolume          float64            `form:"tank_volume" json:"tank_volume"`
+	GasMixID            int                `form:"gas_mix_id" json:"gas_mix_id"`
+	FO2                 float64            `form:"fo2" json:"fo2"`
+	PressureIn          *int               `form:"pressure_in" json:"pressure_in"`
+	PressureOut         *int               `form:"pressure_out" json:"pressure_out"`
+	GasMixNotes         string             `form:"gas_mix_notes" json:"gas_mix_notes"`
+	EntryPointID        int                `form:"entry_point_id" json:"entry_point_id"`
+	Rating              *int               `form:"rating" json:"rating"`
+	PropertyIDs         []int              `form:"property_ids" json:"property_ids"`
+	Notes               string             `form:"notes" json:"notes"`
+	HasProfile          bool               `form:"has_profile" json:"-"`
+	Profile             models.DiveProfile `form:"-" json:"-"`
+	validator.Validator `form:"-" json:"-"`
+}
+
+// applyProfile stores the profile on the form and sets its depths and bottom
+// time to the values derived from it.
+func (form *diveForm) applyProfile(profile models.DiveProfile) {
+	form.Profile = profile
+	form.HasProfile = len(profile) > 0
+	if !form.HasProfile {
+		return
+	}
+
+	form.MaxDepth = profile.MaxDepth()
+	form.AvgDepth = ref(profile.AvgDepth())
+	form.BottomTimeMins = int(math.Round(profile.BottomTime().Minutes()))
 }
 
 func diveFormFromDive(dive models.Dive) diveForm {
@@ -1397,6 +2233,7 @@ func diveFormFromDive(dive models.Dive) diveForm {
 		EntryPointID:        dive.EntryPoint.ID,
 		Rating:              dive.Rating,
 		Notes:               dive.Notes,
+		HasProfile:          dive.HasProfile,
 	}
 
 	if dive.Operator != nil {
@@ -1527,7 +2364,7 @@ func (app *app) addStaticdataToDiveForm(r *http.Request, data *templateData) err
 	return nil
 }
 
-func (app *app) validateDiveForm(f *diveForm) error {
+func (app *app) validateDiveForm(f *diveForm, ownerID int) error {
 	f.CheckField(
 		f.Number >= 1 && f.Number <= 100_000,
 		"number",
@@ -1541,14 +2378,14 @@ func (app *app) validateDiveForm(f *diveForm) error {
 		"This field cannot be more than 256 characters long",
 	)
 
-	exists, err := app.diveSites.Exists(f.DiveSiteID)
+	exists, err := app.diveSites.ExistsActive(f.DiveSiteID)
 	if err != nil {
 		return err
 	}
 	f.CheckField(exists, "dive_site_id", "You must select a valid dive site")
 
 	if f.OperatorID != nil {
-		exists, err := app.operators.Exists(*f.OperatorID)
+		exists, err := app.operators.ExistsActive(*f.OperatorID)
 		if err != nil {
 			return err
 		}
@@ -1576,7 +2413,7 @@ func (app *app) validateDiveForm(f *diveForm) error {
 	}
 
 	if f.TripID != nil {
-		exists, err := app.trips.Exists(*f.TripID)
+		exists, err := app.trips.ExistsActive(*f.TripID, ownerID)
 		if err != nil {
 			return err
 		}
@@ -1584,7 +2421,7 @@ func (app *app) validateDiveForm(f *diveForm) error {
 	}
 
 	if f.CertificationID != nil {
-		exists, err := app.certifications.Exists(*f.CertificationID)
+		exists, err := app.certifications.ExistsActive(*f.CertificationID, ownerID)
 		if err != nil {
 			return err
 		}
@@ -1674,7 +2511,7 @@ func (app *app) validateDiveForm(f *diveForm) error {
 	}
 
 	if f.BuddyID != nil {
-		exists, err := app.buddies.Exists(*f.BuddyID)
+		exists, err := app.buddies.ExistsActive(*f.BuddyID, ownerID)
 		if err != nil {
 			return err
 		}
@@ -1835,24 +2672,191 @@ func (app *app) validateDiveForm(f *diveForm) error {
 		"This field cannot be more than 65,536 characters long",
 	)
 
-	return nil
+	return nil
+}
+
+// insertDiveForm inserts a new dive for the given owner from the values in a
+// diveForm that has already been validated.
+func (app *app) insertDiveForm(ownerID int, form *diveForm) (int, error) {
+	var safetyStop *time.Duration
+	if form.SafetyStopMins != nil {
+		ss := time.Duration(*form.SafetyStopMins) * time.Minute
+		safetyStop = &ss
+	}
+
+	return app.dives.Insert(
+		ownerID,
+		form.Number,
+		form.Activity,
+		form.DiveSiteID,
+		form.OperatorID,
+		form.PriceAmount,
+		form.CurrencyID,
+		form.TripID,
+		form.CertificationID,
+		form.DateTimeIn,
+		form.MaxDepth,
+		form.AvgDepth,
+		time.Duration(form.BottomTimeMins)*time.Minute,
+		safetyStop,
+		form.WaterTemp,
+		form.AirTemp,
+		form.Visibility,
+		form.CurrentID,
+		form.WavesID,
+		form.BuddyID,
+		form.BuddyRoleID,
+		form.Weight,
+		form.WeightNotes,
+		form.EquipmentIDs,
+		form.EquipmentNotes,
+		form.TankConfigurationID,
+		form.TankMaterialID,
+		form.TankVolume,
+		form.GasMixID,
+		form.FO2,
+		form.PressureIn,
+		form.PressureOut,
+		form.GasMixNotes,
+		form.EntryPointID,
+		form.PropertyIDs,
+		form.Rating,
+		form.Notes,
+	)
+}
+
+// updateDiveForm updates the dive with the given ID and owner using the values
+// in a diveForm that has already been validated.
+func (app *app) updateDiveForm(id, ownerID int, form *diveForm) error {
+	var safetyStop *time.Duration
+	if form.SafetyStopMins != nil {
+		ss := time.Duration(*form.SafetyStopMins) * time.Minute
+		safetyStop = &ss
+	}
+
+	return app.dives.Update(
+		id,
+		ownerID,
+		form.Version,
+		form.Number,
+		form.Activity,
+		form.DiveSiteID,
+		form.OperatorID,
+		form.PriceAmount,
+		form.CurrencyID,
+		form.TripID,
+		form.CertificationID,
+		form.DateTimeIn,
+		form.MaxDepth,
+		form.AvgDepth,
+		time.Duration(form.BottomTimeMins)*time.Minute,
+		safetyStop,
+		form.WaterTemp,
+		form.AirTemp,
+		form.Visibility,
+		form.CurrentID,
+		form.WavesID,
+		form.BuddyID,
+		form.BuddyRoleID,
+		form.Weight,
+		form.WeightNotes,
+		form.EquipmentIDs,
+		form.EquipmentNotes,
+		form.TankConfigurationID,
+		form.TankMaterialID,
+		form.TankVolume,
+		form.GasMixID,
+		form.FO2,
+		form.PressureIn,
+		form.PressureOut,
+		form.GasMixNotes,
+		form.EntryPointID,
+		form.PropertyIDs,
+		form.Rating,
+		form.Notes,
+	)
+}
+
+// diveFields converts a validated diveForm into the models.DiveFields used for
+// inserting several dives at once.
+func (form *diveForm) diveFields() models.DiveFields {
+	var safetyStop *time.Duration
+	if form.SafetyStopMins != nil {
+		ss := time.Duration(*form.SafetyStopMins) * time.Minute
+		safetyStop = &ss
+	}
+
+	return models.DiveFields{
+		Number:              form.Number,
+		Activity:            form.Activity,
+		DiveSiteID:          form.DiveSiteID,
+		OperatorID:          form.OperatorID,
+		PriceAmount:         form.PriceAmount,
+		PriceCurrencyID:     form.CurrencyID,
+		TripID:              form.TripID,
+		CertificationID:     form.CertificationID,
+		DateTimeIn:          form.DateTimeIn,
+		MaxDepth:            form.MaxDepth,
+		AvgDepth:            form.AvgDepth,
+		BottomTime:          time.Duration(form.BottomTimeMins) * time.Minute,
+		SafetyStop:          safetyStop,
+		WaterTemp:           form.WaterTemp,
+		AirTemp:             form.AirTemp,
+		Visibility:          form.Visibility,
+		CurrentID:           form.CurrentID,
+		WavesID:             form.WavesID,
+		BuddyID:             form.BuddyID,
+		BuddyRoleID:         form.BuddyRoleID,
+		Weight:              form.Weight,
+		WeightNotes:         form.WeightNotes,
+		EquipmentIDs:        form.EquipmentIDs,
+		EquipmentNotes:      form.EquipmentNotes,
+		TankConfigurationID: form.TankConfigurationID,
+		TankMaterialID:      form.TankMaterialID,
+		TankVolume:          form.TankVolume,
+		GasMixID:            form.GasMixID,
+		FO2:                 form.FO2,
+		PressureIn:          form.PressureIn,
+		PressureOut:         form.PressureOut,
+		GasMixNotes:         form.GasMixNotes,
+		EntryPointID:        form.EntryPointID,
+		PropertyIDs:         form.PropertyIDs,
+		Rating:              form.Rating,
+		Notes:               form.Notes,
+		Profile:             form.Profile,
+	}
 }
 
+// diveCreateGET shows the form for logging a new dive. If the "from" query
+// string parameter is given, then the form is pre-filled to follow on from that
+// dive.
 func (app *app) diveCreateGET(w http.ResponseWriter, r *http.Request) {
-	data, err := app.newTemplateData(r)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
+	number := app.contextGetUser(r).NextDiveNumber()
 
-	data.Form = diveForm{
-		Number:         app.contextGetUser(r).TotalDives + 1,
+	form := diveForm{
+		Number:         number,
 		MaxDepth:       5,
 		BottomTimeMins: 10,
 		FO2:            0.21,
 		TankVolume:     11.0,
 	}
 
+	if r.URL.Query().Has("from") {
+		prev, ok := app.readPreviousDive(w, r)
+		if !ok {
+			return
+		}
+		form = nextDiveForm(prev, number)
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
+
 	err = app.addStaticdataToDiveForm(r, &data)
 	if err != nil {
 		app.serverError(w, r, fmt.Errorf("failed to load dive form static data: %w", err))
@@ -1876,7 +2880,7 @@ func (app *app) diveCreatePOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.validateDiveForm(form)
+	err = app.validateDiveForm(form, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverError(w, r, fmt.Errorf("failed to validate dive form: %w", err))
 		return
@@ -1895,51 +2899,7 @@ func (app *app) diveCreatePOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var safetyStop *time.Duration
-	if form.SafetyStopMins != nil {
-		ss := time.Duration(*form.SafetyStopMins) * time.Minute
-		safetyStop = &ss
-	}
-
-	id, err := app.dives.Insert(
-		app.contextGetUser(r).ID,
-		form.Number,
-		form.Activity,
-		form.DiveSiteID,
-		form.OperatorID,
-		form.PriceAmount,
-		form.CurrencyID,
-		form.TripID,
-		form.CertificationID,
-		form.DateTimeIn,
-		form.MaxDepth,
-		form.AvgDepth,
-		time.Duration(form.BottomTimeMins)*time.Minute,
-		safetyStop,
-		form.WaterTemp,
-		form.AirTemp,
-		form.Visibility,
-		form.CurrentID,
-		form.WavesID,
-		form.BuddyID,
-		form.BuddyRoleID,
-		form.Weight,
-		form.WeightNotes,
-		form.EquipmentIDs,
-		form.EquipmentNotes,
-		form.TankConfigurationID,
-		form.TankMaterialID,
-		form.TankVolume,
-		form.GasMixID,
-		form.FO2,
-		form.PressureIn,
-		form.PressureOut,
-		form.GasMixNotes,
-		form.EntryPointID,
-		form.PropertyIDs,
-		form.Rating,
-		form.Notes,
-	)
+	id, err := app.insertDiveForm(app.contextGetUser(r).ID, form)
 	if err != nil {
 		switch err {
 		case models.ErrDuplicateDiveNumber:
@@ -2020,7 +2980,7 @@ func (app *app) diveUpdatePOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.validateDiveForm(form)
+	err = app.validateDiveForm(form, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverError(w, r, fmt.Errorf("failed to validate dive form: %w", err))
 		return
@@ -2039,52 +2999,7 @@ func (app *app) diveUpdatePOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var safetyStop *time.Duration
-	if form.SafetyStopMins != nil {
-		ss := time.Duration(*form.SafetyStopMins) * time.Minute
-		safetyStop = &ss
-	}
-
-	err = app.dives.Update(
-		id,
-		app.contextGetUser(r).ID,
-		form.Number,
-		form.Activity,
-		form.DiveSiteID,
-		form.OperatorID,
-		form.PriceAmount,
-		form.CurrencyID,
-		form.TripID,
-		form.CertificationID,
-		form.DateTimeIn,
-		form.MaxDepth,
-		form.AvgDepth,
-		time.Duration(form.BottomTimeMins)*time.Minute,
-		safetyStop,
-		form.WaterTemp,
-		form.AirTemp,
-		form.Visibility,
-		form.CurrentID,
-		form.WavesID,
-		form.BuddyID,
-		form.BuddyRoleID,
-		form.Weight,
-		form.WeightNotes,
-		form.EquipmentIDs,
-		form.EquipmentNotes,
-		form.TankConfigurationID,
-		form.TankMaterialID,
-		form.TankVolume,
-		form.GasMixID,
-		form.FO2,
-		form.PressureIn,
-		form.PressureOut,
-		form.GasMixNotes,
-		form.EntryPointID,
-		form.PropertyIDs,
-		form.Rating,
-		form.Notes,
-	)
+	err = app.updateDiveForm(id, app.contextGetUser(r).ID, form)
 	if err != nil {
 		switch err {
 		case models.ErrDuplicateDiveNumber:
@@ -2097,6 +3012,8 @@ func (app *app) diveUpdatePOST(w http.ResponseWriter, r *http.Request) {
 			}
 			data.Form = form
 			app.render(w, r, http.StatusUnprocessableEntity, "dive/form.tmpl", data)
+		case models.ErrUpdateConflict:
+			app.diveUpdateConflict(w, r, &data, form)
 		case models.ErrNoRecord:
 			msg := `The dive you are trying to change does not exist or you do
                     not have permission to edit it.`
@@ -2115,6 +3032,95 @@ func (app *app) diveUpdatePOST(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
 }
 
+// diveUpdateConflict re-renders the dive form with the user's values when the
+// dive has been updated by someone else since the form was loaded, along with
+// the fields that differ from the stored dive. The form takes the version of
+// the stored dive so that submitting it again saves the merged values.
+func (app *app) diveUpdateConflict(
+	w http.ResponseWriter,
+	r *http.Request,
+	data *templateData,
+	form *diveForm,
+) {
+	dive, err := app.dives.GetOneByID(app.contextGetUser(r).ID, form.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.addStaticdataToDiveForm(r, data)
+	if err != nil {
+		errMsg := "failed to load dive form static data: %w"
+		app.serverError(w, r, fmt.Errorf(errMsg, err))
+		return
+	}
+
+	data.Conflicts = formConflicts(form, diveFormFromDive(dive), diveConflictOptions(data))
+	form.Version = dive.Version
+	form.AddNonFieldError(
+		"This dive was changed by someone else whilst you were editing it",
+	)
+
+	data.Form = form
+	app.render(w, r, http.StatusConflict, "dive/form.tmpl", *data)
+}
+
+// diveConflictOptions returns the names of the options for the fields of the
+// dive form that refer to other records, from the lists in data.
+func diveConflictOptions(data *templateData) conflictOptions {
+	return conflictOptions{
+		"dive_site_id": optionNames(data.DiveSites, func(ds models.DiveSite) (int, string) {
+			return ds.ID, ds.String()
+		}),
+		"operator_id": optionNames(data.Operators, func(op models.Operator) (int, string) {
+			return op.ID, op.String()
+		}),
+		"currency_id": optionNames(data.Currencies, func(cu models.Currency) (int, string) {
+			return cu.ID, cu.ISOAlpha
+		}),
+		"trip_id": optionNames(data.Trips, func(tr models.Trip) (int, string) {
+			return tr.ID, tr.String()
+		}),
+		"certification_id": optionNames(data.Certifications, func(ce models.Certification) (int, string) {
+			return ce.ID, ce.String()
+		}),
+		"current_id": optionNames(data.Currents, func(cu models.Current) (int, string) {
+			return cu.ID, cu.Name
+		}),
+		"waves_id": optionNames(data.Waves, func(wa models.Waves) (int, string) {
+			return wa.ID, wa.Name
+		}),
+		"buddy_id": optionNames(data.Buddies, func(bu models.Buddy) (int, string) {
+			return bu.ID, bu.String()
+		}),
+		"buddy_role_id": optionNames(data.BuddyRoles, func(br models.BuddyRole) (int, string) {
+			return br.ID, br.Name
+		}),
+		"equipment_ids": optionNames(data.Equipment, func(eq models.Equipment) (int, string) {
+			return eq.ID, eq.Name
+		}),
+		"tank_configuration_id": optionNames(data.TankConfigurations, func(tc models.TankConfiguration) (int, string) {
+			return tc.ID, tc.Name
+		}),
+		"tank_material_id": optionNames(data.TankMaterials, func(tm models.TankMaterial) (int, string) {
+			return tm.ID, tm.Name
+		}),
+		"gas_mix_id": optionNames(data.GasMixes, func(gm models.GasMix) (int, string) {
+			return gm.ID, gm.Name
+		}),
+		"entry_point_id": optionNames(data.EntryPoints, func(ep models.EntryPoint) (int, string) {
+			return ep.ID, ep.Name
+		}),
+		"property_ids": optionNames(data.DiveProperties, func(dp models.DiveProperty) (int, string) {
+			return dp.ID, dp.Name
+		}),
+	}
+}
+
 func (app *app) diveGET(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
@@ -2152,9 +3158,11 @@ func (app *app) diveList(w http.ResponseWriter, r *http.Request) {
 	pageSize := app.readInt(r.URL.Query(), "page_size", defaultPageSize)
 
 	pager := models.NewPager(page, pageSize, defaultPageSize)
-	filter := models.DiveFilter{}
+	filter := app.readDiveFilter(r.URL.Query())
+
+	sort, sortQuery := readListSort(r.URL.Query(), diveSortOptions, models.SortDiveDefault)
 
-	records, pageData, err := app.dives.List(user.ID, pager, filter, models.SortDiveDefault)
+	records, pageData, err := app.dives.List(user.ID, pager, filter, sort)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -2165,8 +3173,19 @@ func (app *app) diveList(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, r, err)
 		return
 	}
+	err = app.addStaticdataToDiveForm(r, &data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	filterValues := diveFilterValues(filter)
 	data.Dives = records
+	data.FilterQuery = template.URL(filterValues.Encode())
+	data.FilterValues = filterValues
+	data.ListQuery = listQuery(filterValues, sortQuery)
 	data.PageData = pageData
+	data.Sort = sortQuery
 
 	app.render(w, r, http.StatusOK, "dive/list.tmpl", data)
 }
@@ -2192,29 +3211,38 @@ func (app *app) statistics(w http.ResponseWriter, r *http.Request) {
 }
 
 type divePlanStopForm struct {
-	Depth    float64 `form:"depth"`
-	Duration float64 `form:"duration"`
-	Comment  string  `form:"comment"`
+	Depth    float64 `form:"depth" json:"depth"`
+	Duration float64 `form:"duration" json:"duration"`
+	Comment  string  `form:"comment" json:"comment"`
+}
+
+func (s divePlanStopForm) String() string {
+	stop := fmt.Sprintf("%gm for %g min", s.Depth, s.Duration)
+	if s.Comment != "" {
+		stop += " (" + s.Comment + ")"
+	}
+
+	return stop
 }
 
 type divePlanForm struct {
-	ID                  int                `form:"-"`
-	Version             int                `form:"version"`
-	Name                string             `form:"name"`
-	Notes               string             `form:"notes"`
-	IsSoloDive          bool               `form:"is_solo_dive"`
-	DescentRate         float64            `form:"descent_rate"`
-	AscentRate          float64            `form:"ascent_rate"`
-	SACRate             float64            `form:"sac_rate"`
-	TankCount           int                `form:"tank_count"`
-	TankVolume          float64            `form:"tank_volume"`
-	WorkingPressure     int                `form:"working_pressure"`
-	DiveFactor          float64            `form:"dive_factor"`
-	FN2                 float64            `form:"fn2"`
-	FHe                 float64            `form:"fhe"`
-	MaxPPO2             float64            `form:"max_ppo2"`
-	Stops               []divePlanStopForm `form:"stops"`
-	validator.Validator `                   form:"-"`
+	ID                  int                `form:"-" json:"-"`
+	Version             int                `form:"version" json:"version"`
+	Name                string             `form:"name" json:"name"`
+	Notes               string             `form:"notes" json:"notes"`
+	IsSoloDive          bool               `form:"is_solo_dive" json:"is_solo_dive"`
+	DescentRate         float64            `form:"descent_rate" json:"descent_rate"`
+	AscentRate          float64            `form:"ascent_rate" json:"ascent_rate"`
+	SACRate             float64            `form:"sac_rate" json:"sac_rate"`
+	TankCount           int                `form:"tank_count" json:"tank_count"`
+	TankVolume          float64            `form:"tank_volume" json:"tank_volume"`
+	WorkingPressure     int                `form:"working_pressure" json:"working_pressure"`
+	DiveFactor          float64            `form:"dive_factor" json:"dive_factor"`
+	FN2                 float64            `form:"fn2" json:"fn2"`
+	FHe                 float64            `form:"fhe" json:"fhe"`
+	MaxPPO2             float64            `form:"max_ppo2" json:"max_ppo2"`
+	Stops               []divePlanStopForm `form:"stops" json:"stops"`
+	validator.Validator `form:"-" json:"-"`
 }
 
 func (dp *divePlanForm) Validate() {
@@ -2285,6 +3313,8 @@ func (dp *divePlanForm) Validate() {
 		"This field must be between 0.0 and 0.99 inclusive",
 	)
 
+	dp.CheckField(len(dp.Stops) > 0, "stops", "At least one stop must be entered")
+
 	for i, stop := range dp.Stops {
 		dp.CheckField(
 			stop.Depth >= 1.0 && stop.Depth <= 300.0,
@@ -2306,6 +3336,53 @@ func (dp *divePlanForm) Validate() {
 	}
 }
 
+func divePlanFormFromDivePlan(divePlan models.DivePlan) divePlanForm {
+	var stops []divePlanStopForm
+	for _, stop := range divePlan.Stops {
+		s := divePlanStopForm{
+			Depth:    stop.Depth,
+			Duration: stop.Duration,
+			Comment:  stop.Comment,
+		}
+		stops = append(stops, s)
+	}
+
+	return divePlanForm{
+		ID:              divePlan.ID,
+		Version:         divePlan.Version,
+		Name:            divePlan.Name,
+		Notes:           divePlan.Notes,
+		IsSoloDive:      divePlan.IsSoloDive,
+		DescentRate:     divePlan.DescentRate,
+		AscentRate:      divePlan.AscentRate,
+		SACRate:         divePlan.SACRate,
+		TankCount:       divePlan.TankCount,
+		TankVolume:      divePlan.TankCapacity,
+		WorkingPressure: divePlan.WorkingPressure,
+		DiveFactor:      divePlan.DiveFactor,
+		FN2:             divePlan.GasMix.FN2,
+		FHe:             divePlan.GasMix.FHe,
+		MaxPPO2:         divePlan.MaxPPO2,
+		Stops:           stops,
+	}
+}
+
+// stopInputs converts the stops of the form into the models.DivePlanStopInput
+// values used to save them.
+func (dp *divePlanForm) stopInputs() []models.DivePlanStopInput {
+	var stops []models.DivePlanStopInput
+	for _, stop := range dp.Stops {
+		s := models.DivePlanStopInput{
+			Depth:    stop.Depth,
+			Duration: stop.Duration,
+			Comment:  stop.Comment,
+		}
+		stops = append(stops, s)
+	}
+
+	return stops
+}
+
 func (app *app) divePlanCreateGET(w http.ResponseWriter, r *http.Request) {
 	data, err := app.newTemplateData(r)
 	if err != nil {
@@ -2356,16 +3433,6 @@ func (app *app) divePlanCreatePOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var stops []models.DivePlanStopInput
-	for _, stop := range form.Stops {
-		s := models.DivePlanStopInput{
-			Depth:    stop.Depth,
-			Duration: stop.Duration,
-			Comment:  stop.Comment,
-		}
-		stops = append(stops, s)
-	}
-
 	id, err := app.divePlans.Insert(
 		app.contextGetUser(r).ID,
 		form.Name,
@@ -2381,15 +3448,13 @@ func (app *app) divePlanCreatePOST(w http.ResponseWriter, r *http.Request) {
 		form.FN2,
 		form.FHe,
 		form.MaxPPO2,
-		stops,
+		form.stopInputs(),
 	)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	fmt.Println(form)
-
 	app.sessionManager.Put(r.Context(), "flashSuccess", "Dive plan added successfully.")
 
 	nextUrl := fmt.Sprintf("/dive-plan/view/%d", id)
@@ -2434,7 +3499,9 @@ func (app *app) divePlanList(w http.ResponseWriter, r *http.Request) {
 	pager := models.NewPager(page, pageSize, defaultPageSize)
 	userID := app.contextGetUser(r).ID
 
-	divePlans, pageData, err := app.divePlans.List(userID, pager, models.SortDivePlanDefault)
+	sort, sortQuery := readListSort(r.URL.Query(), divePlanSortOptions, models.SortDivePlanDefault)
+
+	divePlans, pageData, err := app.divePlans.List(userID, pager, sort)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -2446,6 +3513,8 @@ func (app *app) divePlanList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	data.DivePlans = divePlans
+	data.ListQuery = listQuery(nil, sortQuery)
+	data.Sort = sortQuery
 	data.PageData = pageData
 
 	app.render(w, r, http.StatusOK, "dive_plan/list.tmpl", data)
@@ -2476,34 +3545,7 @@ func (app *app) divePlanUpdateGET(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var stops []divePlanStopForm
-	for _, stop := range divePlan.Stops {
-		s := divePlanStopForm{
-			Depth:    stop.Depth,
-			Duration: stop.Duration,
-			Comment:  stop.Comment,
-		}
-		stops = append(stops, s)
-	}
-
-	data.Form = divePlanForm{
-		ID:              id,
-		Version:         divePlan.Version,
-		Name:            divePlan.Name,
-		Notes:           divePlan.Notes,
-		IsSoloDive:      divePlan.IsSoloDive,
-		DescentRate:     divePlan.DescentRate,
-		AscentRate:      divePlan.AscentRate,
-		SACRate:         divePlan.SACRate,
-		TankCount:       divePlan.TankCount,
-		TankVolume:      divePlan.TankCapacity,
-		WorkingPressure: divePlan.WorkingPressure,
-		DiveFactor:      divePlan.DiveFactor,
-		FN2:             divePlan.GasMix.FN2,
-		FHe:             divePlan.GasMix.FHe,
-		MaxPPO2:         divePlan.MaxPPO2,
-		Stops:           stops,
-	}
+	data.Form = divePlanFormFromDivePlan(divePlan)
 
 	app.render(w, r, http.StatusOK, "dive_plan/form.tmpl", data)
 }
@@ -2537,19 +3579,10 @@ func (app *app) divePlanUpdatePOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var stops []models.DivePlanStopInput
-	for _, stop := range form.Stops {
-		s := models.DivePlanStopInput{
-			Depth:    stop.Depth,
-			Duration: stop.Duration,
-			Comment:  stop.Comment,
-		}
-		stops = append(stops, s)
-	}
-
 	err = app.divePlans.Update(
 		id,
 		app.contextGetUser(r).ID,
+		form.Version,
 		form.Name,
 		form.Notes,
 		form.IsSoloDive,
@@ -2563,10 +3596,12 @@ func (app *app) divePlanUpdatePOST(w http.ResponseWriter, r *http.Request) {
 		form.FN2,
 		form.FHe,
 		form.MaxPPO2,
-		stops,
+		form.stopInputs(),
 	)
 	if err != nil {
 		switch err {
+		case models.ErrUpdateConflict:
+			app.divePlanUpdateConflict(w, r, form)
 		case models.ErrNoRecord:
 			msg := `The dive plan you are trying to change does not exist or you
                     do not have permission to edit it.`
@@ -2585,3 +3620,35 @@ func (app *app) divePlanUpdatePOST(w http.ResponseWriter, r *http.Request) {
 	nextUrl := fmt.Sprintf("/dive-plan/view/%d", id)
 	http.Redirect(w, r, nextUrl, http.StatusSeeOther)
 }
+
+// divePlanUpdateConflict re-renders the dive plan form with the user's values
+// when the plan has been updated by someone else since the form was loaded,
+// along with the fields that differ from the stored plan. The form takes the
+// version of the stored plan so that submitting it again saves the merged
+// values.
+func (app *app) divePlanUpdateConflict(w http.ResponseWriter, r *http.Request, form *divePlanForm) {
+	divePlan, err := app.divePlans.GetOneByID(form.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Conflicts = formConflicts(form, divePlanFormFromDivePlan(divePlan), nil)
+	form.Version = divePlan.Version
+	form.AddNonFieldError(
+		"This dive plan was changed by someone else whilst you were editing it",
+	)
+
+	data.Form = form
+	app.render(w, r, http.StatusConflict, "dive_plan/form.tmpl", data)
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/m5lapp/divesite-monolith/internal/assert"
+	"github.com/m5lapp/divesite-monolith/internal/logbook"
+	"github.com/m5lapp/divesite-monolith/internal/models/mocks"
+	"github.com/m5lapp/divesite-monolith/internal/storage"
 )
 
 func TestStatus(t *testing.T) {
@@ -218,3 +227,1749 @@ func TestUserSignUp(t *testing.T) {
 		})
 	}
 }
+
+func TestDiveExportUDDF(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_ = ts.logIn(t, "", "")
+
+	code, headers, body := ts.get(t, "/log-book/dive/export/uddf?trip_id=1")
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "application/xml")
+	assert.StringContains(t, headers.Get("Content-Disposition"), ".uddf")
+
+	dives, err := logbook.ParseUDDF(strings.NewReader(body))
+	assert.NilError(t, err)
+	assert.Equal(t, len(dives), 1)
+	assert.Equal(t, dives[0].Number, 1)
+	assert.Equal(t, dives[0].Site.Name, "Sail Rock")
+	assert.Equal(t, dives[0].Site.TimeZone, "Asia/Bangkok")
+	assert.Equal(t, dives[0].Buddy(), "John Smith")
+	assert.Equal(t, dives[0].EntryPoint, "Boat")
+
+	// The dive's profile is exported along with it.
+	samples := dives[0].Samples
+	assert.Equal(t, len(samples), 4)
+	assert.Equal(t, samples[1].Time, 20*time.Second)
+	assert.Equal(t, samples[1].Depth, 17.6)
+	assert.Equal(t, *samples[0].Temperature, 28.0)
+	assert.Equal(t, *samples[3].Pressure, 65.0)
+	assert.Equal(t, len(samples[1].Events), 1)
+}
+
+func TestDiveExportPDF(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_ = ts.logIn(t, "", "")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Full page", "/log-book/dive/export/pdf?trip_id=1", http.StatusOK},
+		{"Half page", "/log-book/dive/export/pdf?layout=half&number_from=1&number_to=5", http.StatusOK},
+		{"Invalid layout", "/log-book/dive/export/pdf?layout=quarter", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, headers.Get("Content-Type"), "application/pdf")
+				assert.StringContains(t, headers.Get("Content-Disposition"), ".pdf")
+				assert.StringContains(t, body, "%PDF-1.4")
+				assert.StringContains(t, body, "(#1  Sail Rock) Tj")
+			}
+		})
+	}
+}
+
+func TestDiveExportCSV(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_ = ts.logIn(t, "", "")
+
+	code, headers, body := ts.get(t, "/log-book/dive/export/csv")
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, headers.Get("Content-Type"), "text/csv")
+
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 2)
+	assert.Equal(t, len(records[1]), len(diveCSVHeader))
+
+	row := map[string]string{}
+	for i, col := range records[0] {
+		row[col] = records[1][i]
+	}
+
+	assert.Equal(t, row["dive_site"], "Sail Rock")
+	assert.Equal(t, row["timezone"], "Asia/Bangkok")
+	assert.Equal(t, row["date_time_in"], "2020-01-19T14:21:00+07:00")
+	assert.Equal(t, row["date_time_out"], "2020-01-19T14:21:45+07:00")
+	assert.Equal(t, row["gas_used"], "3248")
+}
+
+func TestImportCSV(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_ = ts.logIn(t, "", "")
+
+	_, _, body := ts.get(t, "/log-book/import/csv")
+	csrfToken := extractCSRFToken(t, body)
+
+	file := "Dive No,Date,Site,Max Depth,Duration,Gas\n" +
+		"2,21/01/2020 09:30,Sail Rock,18.5,42,Air\n" +
+		"3,21/01/2020 13:00,Nowhere,12,50,Air\n" +
+		"4,22/01/2020,Sail Rock,not deep,40,Air\n"
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+
+	t.Run("File too large", func(t *testing.T) {
+		large := strings.Repeat(file, maxImportSize/len(file)+1)
+
+		code, _, _ := ts.postFile(t, "/log-book/import/csv", form, "log.csv", large)
+		assert.Equal(t, code, http.StatusRequestEntityTooLarge)
+	})
+
+	code, headers, _ := ts.postFile(t, "/log-book/import/csv", form, "log.csv", file)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/log-book/import/csv/mapping")
+
+	code, _, body = ts.get(t, "/log-book/import/csv/mapping")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `<option value="dive_site" selected>`)
+	assert.StringContains(t, body, "Spreadsheet")
+
+	mapping := url.Values{}
+	mapping.Add("csrf_token", csrfToken)
+	mapping.Add("columns[0]", "number")
+	mapping.Add("columns[1]", "date_time_in")
+	mapping.Add("columns[2]", "dive_site")
+	mapping.Add("columns[3]", "max_depth")
+	mapping.Add("columns[4]", "bottom_time")
+	mapping.Add("columns[5]", "gas_mix")
+	mapping.Add("date_format", "2/1/2006")
+	mapping.Add("depth_unit", "m")
+	mapping.Add("temp_unit", "c")
+	mapping.Add("pressure_unit", "bar")
+	mapping.Add("weight_unit", "kg")
+	mapping.Add("duration_unit", "min")
+	mapping.Add("keep_numbers", "true")
+	mapping.Add("activity", "Fun Dive")
+	mapping.Add("entry_point_id", "1")
+	mapping.Add("tank_configuration_id", "3")
+	mapping.Add("tank_material_id", "2")
+	mapping.Add("tank_volume", "11")
+
+	t.Run("Missing dive site column", func(t *testing.T) {
+		invalid := url.Values{}
+		for key, values := range mapping {
+			invalid[key] = values
+		}
+		invalid.Set("columns[2]", "")
+
+		code, _, body := ts.postForm(t, "/log-book/import/csv/preview", invalid)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "A column must be mapped onto the dive site")
+	})
+
+	code, _, body = ts.postForm(t, "/log-book/import/csv/preview", mapping)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `action="/log-book/import/csv/commit"`)
+	assert.StringContains(t, body, "<strong>1</strong> dive(s) will be imported")
+	assert.StringContains(t, body, "You have not logged a dive site called &#34;Nowhere&#34;")
+	assert.StringContains(t, body, "&#34;not deep&#34; is not a valid number")
+
+	commit := url.Values{}
+	commit.Add("csrf_token", csrfToken)
+	for _, key := range []string{"activity", "entry_point_id", "tank_configuration_id", "tank_material_id", "tank_volume", "keep_numbers"} {
+		commit.Add(key, mapping.Get(key))
+	}
+
+	code, headers, _ = ts.postForm(t, "/log-book/import/csv/commit", commit)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/log-book/dive/")
+
+	t.Run("Expired import", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/log-book/import/csv/mapping")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/log-book/import/csv")
+	})
+}
+
+func TestImport(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_ = ts.logIn(t, "", "")
+
+	_, _, body := ts.get(t, "/log-book/import")
+	csrfToken := extractCSRFToken(t, body)
+
+	file := `<divelog program='subsurface' version='3'>
+<dives>
+<trip date='2024-03-01' time='08:00:00' location='Gulf of Thailand'>
+<dive number='12' date='2024-03-02' time='09:15:00' duration='48:30 min'>
+  <location gps='9.700000 99.900000'>Twins</location>
+  <buddy>Jane Doe</buddy>
+  <depth max='24.3 m' />
+</dive>
+</trip>
+</dives>
+</divelog>`
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	form.Add("format", "subsurface")
+	form.Add("keep_numbers", "true")
+	form.Add("activity", "Fun Dive")
+	form.Add("entry_point_id", "1")
+	form.Add("tank_configuration_id", "3")
+	form.Add("tank_material_id", "2")
+	form.Add("tank_volume", "11")
+	form.Add("country_id", "1")
+	form.Add("timezone", "Asia/Bangkok")
+	form.Add("water_body_id", "1")
+	form.Add("water_type_id", "1")
+
+	t.Run("Invalid file", func(t *testing.T) {
+		code, _, body := ts.postFile(t, "/log-book/import", form, "log.ssrf", "not a log book")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "The file log.ssrf is not a valid subsurface log book")
+	})
+
+	t.Run("No time zone", func(t *testing.T) {
+		noTZ := url.Values{}
+		maps.Copy(noTZ, form)
+		noTZ.Del("timezone")
+
+		code, _, body := ts.postFile(t, "/log-book/import", noTZ, "log.ssrf", file)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Select a valid time zone")
+	})
+
+	t.Run("Invalid new dive site", func(t *testing.T) {
+		longName := strings.Repeat("x", 257)
+		invalid := strings.Replace(file, ">Twins<", ">"+longName+"<", 1)
+
+		code, _, body := ts.postFile(t, "/log-book/import", form, "log.ssrf", invalid)
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<strong>0</strong> dive(s) will be imported")
+		assert.StringContains(t, body, "<strong>1</strong> dive(s) have errors and will be skipped")
+		assert.StringContains(t, body, "The new dive site is not valid, name: This field cannot be more")
+	})
+
+	code, _, body := ts.postFile(t, "/log-book/import", form, "log.ssrf", file)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `action="/log-book/import/commit"`)
+	assert.StringContains(t, body, "<strong>1</strong> dive(s) will be imported")
+	assert.StringContains(t, body, "<h2>New Dive Sites</h2>")
+	assert.StringContains(t, body, "<li>Jane Doe</li>")
+	assert.StringContains(t, body, "<li>Gulf of Thailand</li>")
+
+	code, headers, _ := ts.postForm(t, "/log-book/import/commit", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/log-book/dive/")
+
+	t.Run("Expired import", func(t *testing.T) {
+		code, headers, _ := ts.postForm(t, "/log-book/import/commit", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/log-book/import")
+	})
+}
+
+func TestNewImportTripForm(t *testing.T) {
+	bangkok, err := time.LoadLocation("Asia/Bangkok")
+	assert.NilError(t, err)
+
+	// Early morning dives east of UTC fall on the previous day in UTC.
+	dates := [2]time.Time{
+		time.Date(2024, time.March, 2, 6, 30, 0, 0, bangkok),
+		time.Date(2024, time.March, 5, 23, 45, 0, 0, bangkok),
+	}
+
+	trip := newImportTripForm(logbook.Trip{Name: "Gulf of Thailand"}, dates)
+	assert.Equal(t, trip.StartDate.Format(time.DateOnly), "2024-03-02")
+	assert.Equal(t, trip.EndDate.Format(time.DateOnly), "2024-03-05")
+}
+
+func TestDiveProfile(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_ = ts.logIn(t, "", "")
+
+	code, _, body := ts.get(t, "/log-book/dive/view/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `<canvas id="chartDiveProfile"`)
+	assert.StringContains(t, body, `const events = ["","gaschange 21%","",""];`)
+	assert.StringContains(t, body, `const stops = [null,null,3,null];`)
+	assert.StringContains(t, body, "Maximum CNS: 5%")
+	assert.StringContains(t, body, "3.0 metres, required from 40 seconds")
+
+	code, _, body = ts.get(t, "/log-book/dive/edit/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, `<input type="hidden" name="max_depth" value="17.6">`)
+
+	_, _, body = ts.get(t, "/log-book/dive/profile/1")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	form.Add("format", "csv")
+	form.Add("depth_unit", "m")
+	form.Add("temp_unit", "c")
+	form.Add("pressure_unit", "bar")
+	form.Add("duration_unit", "mm:ss")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		file     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid",
+			urlPath:  "/log-book/dive/profile/1",
+			file:     "Time,Depth,Temp\n0:00,0,28\n1:00,18,\n40:00,18,26\n42:00,0,\n",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Too shallow",
+			urlPath:  "/log-book/dive/profile/1",
+			file:     "Time,Depth\n0:00,0\n20:00,2\n40:00,0\n",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "The profile&#39;s max depth must be between 4 and 350 metres",
+		},
+		{
+			name:     "No depth column",
+			urlPath:  "/log-book/dive/profile/1",
+			file:     "Time,Temp\n0:00,28\n",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "csv file must have a time and a depth column",
+		},
+		{
+			name:     "Someone else's dive",
+			urlPath:  "/log-book/dive/profile/2",
+			file:     "Time,Depth\n0:00,0\n",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.postFile(t, tt.urlPath, form, "profile.csv", tt.file)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "Valid token",
+			urlPath:  "/calendar/NRAPH5JKQ3ZTJBXGH6ZQKWR5WE.ics",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"X-WR-CALNAME:Alice Person (DiveSite)\r\n",
+				"UID:trip-1@divesite\r\n",
+				"DTSTART;VALUE=DATE:20200117\r\nDTEND;VALUE=DATE:20200125\r\n",
+				"UID:certification-1@divesite\r\n",
+				"UID:dive-1@divesite\r\n",
+				"SUMMARY:Dive #1: Sail Rock\r\n",
+				"DTSTART:20200119T072100Z\r\n",
+			},
+		},
+		{"Invalid token", "/calendar/AAAAAAAAAAAAAAAAAAAAAAAAAA.ics", http.StatusNotFound, nil},
+		{"Missing extension", "/calendar/NRAPH5JKQ3ZTJBXGH6ZQKWR5WE", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusOK {
+				assert.StringContains(t, headers.Get("Content-Type"), "text/calendar")
+				for _, want := range tt.wantBody {
+					assert.StringContains(t, body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUserCalendarToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+
+	code, headers, _ := ts.postForm(t, "/user/calendar/token", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/profile/edit")
+
+	// The feed URL is only shown once after it has been created.
+	_, _, body := ts.get(t, "/user/profile/edit")
+	assert.StringContains(t, body, "/calendar/NRAPH5JKQ3ZTJBXGH6ZQKWR5WE.ics")
+	_, _, body = ts.get(t, "/user/profile/edit")
+	assert.StringContains(t, body, "Your calendar feed is active.")
+
+	code, headers, _ = ts.postForm(t, "/user/calendar/revoke", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/profile/edit")
+}
+
+func TestDiveSiteExport(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_ = ts.logIn(t, "", "")
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantContentType string
+		wantBody        []string
+	}{
+		{
+			name:            "GPX",
+			urlPath:         "/log-book/dive-site/export/gpx",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/gpx+xml",
+			wantBody: []string{
+				`<wpt lat="10.1656" lon="99.7806">`,
+				"<cmt>Hin Pee Wee</cmt>",
+				"<dives>2</dives>",
+				"<firstdive>2020-01-19</firstdive>",
+			},
+		},
+		{
+			name:            "KML",
+			urlPath:         "/log-book/dive-site/export/kml?country_id=1&water_body_id=1",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/vnd.google-earth.kml+xml",
+			wantBody: []string{
+				"<coordinates>99.7806,10.1656,0</coordinates>",
+				"<description>Granite pinnacle with whale sharks.</description>",
+			},
+		},
+		{
+			name:            "GeoJSON",
+			urlPath:         "/log-book/dive-site/export/geojson",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/geo+json",
+			wantBody:        []string{`"name": "Chumphon Pinnacle"`, `"last_dive": "2020-01-19"`},
+		},
+		{
+			name:            "Filtered out",
+			urlPath:         "/log-book/dive-site/export/geojson?country_id=2",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/geo+json",
+			wantBody:        []string{`"features": []`},
+		},
+		{"Unknown format", "/log-book/dive-site/export/shp", http.StatusNotFound, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, headers.Get("Content-Type"), tt.wantContentType)
+				assert.StringContains(t, headers.Get("Content-Disposition"), "dive-sites-1-")
+				for _, want := range tt.wantBody {
+					assert.StringContains(t, body, want)
+				}
+				// Sail Rock has no position so it cannot be exported.
+				assert.Equal(t, strings.Contains(body, "Sail Rock"), false)
+			}
+		})
+	}
+}
+
+func TestImportDiveSites(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_ = ts.logIn(t, "", "")
+
+	code, _, body := ts.get(t, "/log-book/dive-site/import")
+	assert.Equal(t, code, http.StatusOK)
+	csrfToken := extractCSRFToken(t, body)
+
+	file := `<?xml version="1.0"?>
+<gpx version="1.1" creator="Test" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="10.1657" lon="99.7807"><name>Chumphon</name></wpt>
+  <wpt lat="10.0951" lon="99.8412"><name>Twins</name><desc>Two pinnacles</desc></wpt>
+</gpx>`
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	form.Add("format", "gpx")
+	form.Add("duplicate_distance", "100")
+	form.Add("country_id", "1")
+	form.Add("timezone", "Asia/Bangkok")
+	form.Add("water_body_id", "1")
+	form.Add("water_type_id", "1")
+
+	t.Run("Invalid file", func(t *testing.T) {
+		code, _, body := ts.postFile(t, "/log-book/dive-site/import", form, "sites.gpx", "<gpx></gpx>")
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "The file sites.gpx is not a valid GPX file")
+	})
+
+	code, _, body = ts.postFile(t, "/log-book/dive-site/import", form, "sites.gpx", file)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<strong>1</strong> dive site(s) are selected for import")
+	assert.StringContains(t, body, "<strong>1</strong> dive site(s) are likely duplicates")
+	assert.StringContains(t, body, "of Chumphon Pinnacle")
+	assert.StringContains(t, body, "Near Chumphon Pinnacle")
+
+	commit := url.Values{}
+	for _, key := range []string{"csrf_token", "format", "duplicate_distance", "country_id", "timezone", "water_body_id", "water_type_id"} {
+		commit.Add(key, form.Get(key))
+	}
+	commit.Add("sites[1].import", "true")
+
+	t.Run("Invalid time zone", func(t *testing.T) {
+		invalid := url.Values{}
+		for key, values := range commit {
+			invalid[key] = values
+		}
+		invalid.Add("sites[1].timezone", "Asia/Nowhere")
+
+		code, _, body := ts.postForm(t, "/log-book/dive-site/import/commit", invalid)
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "Enter a valid time zone")
+	})
+
+	code, headers, _ := ts.postForm(t, "/log-book/dive-site/import/commit", commit)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/log-book/dive-site/")
+
+	code, headers, _ = ts.postForm(t, "/log-book/dive-site/import/commit", commit)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/log-book/dive-site/import")
+}
+
+func TestAPI(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		code, headers, body := ts.get(t, "/api/v1/dive-sites")
+		assert.Equal(t, code, http.StatusUnauthorized)
+		assert.Equal(t, headers.Get("Content-Type"), "application/json")
+		assert.StringContains(t, body, `"message": "you must be authenticated`)
+	})
+
+	_ = ts.logIn(t, "", "")
+
+	tests := []struct {
+		name        string
+		method      string
+		urlPath     string
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:     "List",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/dive-sites?sort=-name,id",
+			wantCode: http.StatusOK,
+			wantBody: `"total_records": 1`,
+		},
+		{
+			name:     "List dives",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/dives",
+			wantCode: http.StatusOK,
+			wantBody: `"has_profile": true`,
+		},
+		{
+			name:     "Invalid sort",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/dive-sites?sort=depth",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"sort": "This field must be a comma-separated list of: country, id,`,
+		},
+		{
+			name:     "Get",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/dive-sites/1",
+			wantCode: http.StatusOK,
+			wantBody: `"name": "Sail Rock"`,
+		},
+		{
+			name:     "Get non-existent ID",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/buddies/99",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Get invalid ID",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/trips/foo",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unknown path",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/foo",
+			wantCode: http.StatusNotFound,
+			wantBody: `"message": "the requested resource could not be found"`,
+		},
+		{
+			name:     "Create invalid",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/buddies",
+			body:     `{"name": "", "email_address": "foo"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"email_address": "This field must be a valid email address"`,
+		},
+		{
+			name:        "Create form content type",
+			method:      http.MethodPost,
+			urlPath:     "/api/v1/buddies",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=Bob",
+			wantCode:    http.StatusBadRequest,
+			wantBody:    "application/json content type",
+		},
+		{
+			name:     "Create unknown field",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/buddies",
+			body:     `{"name": "Bob", "nickname": "Bobby"}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: `unknown field \"nickname\"`,
+		},
+		{
+			name:     "Update",
+			method:   http.MethodPatch,
+			urlPath:  "/api/v1/dive-sites/1",
+			body:     `{"version": 1, "notes": "Whale sharks"}`,
+			wantCode: http.StatusOK,
+			wantBody: `"name": "Sail Rock"`,
+		},
+		{
+			name:     "Update invalid",
+			method:   http.MethodPatch,
+			urlPath:  "/api/v1/dive-sites/1",
+			body:     `{"latitude": 91}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"latitude": "This field must be between -90 and 90 inclusive"`,
+		},
+		{
+			name:     "Update conflict",
+			method:   http.MethodPatch,
+			urlPath:  "/api/v1/dive-sites/1",
+			body:     `{"version": 2, "name": "Hin Bai"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Update dive conflict",
+			method:   http.MethodPatch,
+			urlPath:  "/api/v1/dives/1",
+			body:     `{"version": 2, "bottom_time": 45, "equipment_ids": [], "property_ids": []}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Update dive plan conflict",
+			method:   http.MethodPatch,
+			urlPath:  "/api/v1/dive-plans/1",
+			body:     `{"version": 2, "notes": "Stay shallow"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Update buddy",
+			method:   http.MethodPatch,
+			urlPath:  "/api/v1/buddies/1",
+			body:     `{"notes": "Great air consumption"}`,
+			wantCode: http.StatusOK,
+			wantBody: `"version": 1`,
+		},
+		{
+			name:     "Update buddy conflict",
+			method:   http.MethodPatch,
+			urlPath:  "/api/v1/buddies/1",
+			body:     `{"version": 2, "notes": "Great air consumption"}`,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Update non-existent ID",
+			method:   http.MethodPatch,
+			urlPath:  "/api/v1/operators/99",
+			body:     `{"name": "Big Bubbles"}`,
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.sendJSON(t, tt.method, tt.urlPath, tt.contentType, tt.body)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Content-Type"), "application/json")
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUserAPIToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	code, _, body := ts.get(t, "/user/profile/edit")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Dive computer sync")
+	assert.StringContains(t, body, "Read &amp; Write")
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	form.Add("token_name", "")
+	form.Add("scope", "admin")
+	form.Add("expires_in_days", "30")
+
+	code, _, body = ts.postForm(t, "/user/api-token", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "This field cannot be blank")
+	assert.StringContains(t, body, "This field must be selected")
+
+	form.Set("token_name", "Log book sync")
+	form.Set("scope", "read_write")
+
+	code, headers, _ := ts.postForm(t, "/user/api-token", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/profile/edit")
+
+	_, _, body = ts.get(t, "/user/profile/edit")
+	assert.StringContains(t, body, `value="K3MWQ7TZX5RB2NHJVLY4GFD6AE" readonly`)
+
+	_, _, body = ts.get(t, "/user/profile/edit")
+	assert.Equal(t, strings.Contains(body, `value="K3MWQ7TZX5RB2NHJVLY4GFD6AE"`), false)
+
+	code, _, _ = ts.postForm(t, "/user/api-token/revoke/1", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	code, _, _ = ts.postForm(t, "/user/api-token/revoke/99", form)
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestAPITokenAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const readToken = "PZ6RLWQ4YKXH3TBJ5FNAVD2ME7"
+	const readWriteToken = "K3MWQ7TZX5RB2NHJVLY4GFD6AE"
+
+	tests := []struct {
+		name          string
+		method        string
+		urlPath       string
+		authorization string
+		contentType   string
+		body          string
+		wantCode      int
+	}{
+		{"No token", http.MethodGet, "/api/v1/dive-sites", "", "", "", http.StatusUnauthorized},
+		{"Read", http.MethodGet, "/api/v1/dive-sites", "Bearer " + readToken, "", "", http.StatusOK},
+		{"Unknown token", http.MethodGet, "/api/v1/dive-sites", "Bearer ABCDEF", "", "", http.StatusUnauthorized},
+		{"Wrong scheme", http.MethodGet, "/api/v1/dive-sites", "Basic " + readToken, "", "", http.StatusUnauthorized},
+		{
+			"Read only write",
+			http.MethodPatch,
+			"/api/v1/dive-sites/1",
+			"Bearer " + readToken,
+			"application/json",
+			`{"notes": "Whale sharks"}`,
+			http.StatusForbidden,
+		},
+		{
+			"Write",
+			http.MethodPatch,
+			"/api/v1/dive-sites/1",
+			"Bearer " + readWriteToken,
+			"application/json",
+			`{"notes": "Whale sharks"}`,
+			http.StatusOK,
+		},
+		{"HTML page", http.MethodGet, "/log-book/dive-site/", "Bearer " + readToken, "", "", http.StatusOK},
+		{
+			"HTML form without CSRF token",
+			http.MethodPost,
+			"/buddy/add",
+			"Bearer " + readWriteToken,
+			"application/x-www-form-urlencoded",
+			"name=Bob",
+			http.StatusSeeOther,
+		},
+		{
+			"Create API token",
+			http.MethodPost,
+			"/user/api-token",
+			"Bearer " + readWriteToken,
+			"application/x-www-form-urlencoded",
+			"name=Script&scope=read_write",
+			http.StatusForbidden,
+		},
+		{
+			"Revoke API token",
+			http.MethodPost,
+			"/user/api-token/revoke/1",
+			"Bearer " + readWriteToken,
+			"application/x-www-form-urlencoded",
+			"",
+			http.StatusForbidden,
+		},
+		{"Profile", http.MethodGet, "/user/profile/edit", "Bearer " + readToken, "", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.authorization != "" {
+				header.Set("Authorization", tt.authorization)
+			}
+			if tt.contentType != "" {
+				header.Set("Content-Type", tt.contentType)
+			}
+
+			code, headers, _ := ts.send(t, tt.method, tt.urlPath, header, tt.body)
+			assert.Equal(t, code, tt.wantCode)
+
+			if code == http.StatusUnauthorized && tt.authorization != "" {
+				assert.Equal(t, headers.Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestDivePlanUpdateConflict(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	form.Add("version", "2")
+	form.Add("name", "Deep plan")
+	form.Add("notes", "Good, conservative dive plan.")
+	form.Add("descent_rate", "18")
+	form.Add("ascent_rate", "9")
+	form.Add("sac_rate", "11")
+	form.Add("tank_count", "1")
+	form.Add("tank_volume", "11")
+	form.Add("working_pressure", "200")
+	form.Add("dive_factor", "1.2")
+	form.Add("fn2", "0.79")
+	form.Add("fhe", "0")
+	form.Add("max_ppo2", "1.4")
+	form.Add("stops[0].depth", "28")
+	form.Add("stops[0].duration", "8")
+	form.Add("stops[1].depth", "15")
+	form.Add("stops[1].duration", "10")
+	form.Add("stops[2].depth", "8")
+	form.Add("stops[2].duration", "5")
+	form.Add("stops[3].depth", "5")
+	form.Add("stops[3].duration", "3")
+	form.Add("stops[3].comment", "Safety stop")
+
+	code, _, body := ts.postForm(t, "/dive-plan/edit/1", form)
+	assert.Equal(t, code, http.StatusConflict)
+	assert.StringContains(t, body, "This dive plan was changed by someone else")
+	assert.StringContains(t, body, `<a href="#id_name">Name</a>`)
+	assert.StringContains(t, body, "<td>Deep plan</td>")
+	assert.StringContains(t, body, "<td>test Plan</td>")
+	assert.StringContains(t, body, `<input type="hidden" name="version" id="id_version" value="1">`)
+	assert.Equal(t, strings.Contains(body, `href="#id_stops"`), false)
+
+	form.Set("version", "1")
+
+	code, headers, _ := ts.postForm(t, "/dive-plan/edit/1", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/dive-plan/view/1")
+}
+
+func TestTrash(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	t.Run("List", func(t *testing.T) {
+		code, _, body := ts.get(t, "/trash/")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Wreck plan")
+		assert.StringContains(t, body, `action="/trash/restore/trip/2"`)
+		assert.StringContains(t, body, "2024-07-01 12:00")
+	})
+
+	t.Run("Delete confirmation", func(t *testing.T) {
+		code, _, body := ts.get(t, "/trash/delete/buddy/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `action="/trash/delete/buddy/1"`)
+	})
+
+	t.Run("Delete blockers", func(t *testing.T) {
+		code, _, body := ts.get(t, "/trash/delete/dive-site/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Dive: Dive 1 at Sail Rock")
+		assert.StringContains(t, body, `action="/trash/reassign/dive-site/1"`)
+		assert.StringContains(t, body, "Chumphon Pinnacle")
+	})
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		reassignTo   string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Delete",
+			urlPath:      "/trash/delete/dive/1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/log-book/dive/",
+		},
+		{
+			name:         "Delete blocked",
+			urlPath:      "/trash/delete/operator/1",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/trash/delete/operator/1",
+		},
+		{
+			name:     "Delete invalid type",
+			urlPath:  "/trash/delete/users/1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Delete non-existent ID",
+			urlPath:  "/trash/delete/dive/99",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Reassign",
+			urlPath:      "/trash/reassign/dive-site/1",
+			reassignTo:   "2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/log-book/dive-site/",
+		},
+		{
+			name:       "Reassign to non-existent ID",
+			urlPath:    "/trash/reassign/dive-site/1",
+			reassignTo: "99",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be selected",
+		},
+		{
+			name:     "Reassign type without references",
+			urlPath:  "/trash/reassign/dive/1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Restore",
+			urlPath:      "/trash/restore/dive-plan/2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/dive-plan/view/2",
+		},
+		{
+			name:         "Restore blocked",
+			urlPath:      "/trash/restore/trip/2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/trash/",
+		},
+		{
+			name:         "Purge",
+			urlPath:      "/trash/purge/trip/2",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/trash/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			if tt.reassignTo != "" {
+				form.Add("reassign_to", tt.reassignTo)
+			}
+
+			code, headers, body := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Undo", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+		ts.postForm(t, "/trash/delete/buddy/1", form)
+
+		code, _, body := ts.get(t, "/trash/")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Test Buddy has been moved to the trash.")
+		assert.StringContains(t, body, `action="/trash/restore/buddy/1"`)
+	})
+
+	t.Run("Purge deletes files", func(t *testing.T) {
+		err := app.files.Put(mocks.TrashCardKey, strings.NewReader("image"))
+		assert.NilError(t, err)
+
+		form := url.Values{}
+		form.Add("csrf_token", csrfToken)
+
+		code, headers, _ := ts.postForm(t, "/trash/purge/certification/1", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/trash/")
+
+		_, err = app.files.Get(mocks.TrashCardKey)
+		assert.Equal(t, errors.Is(err, storage.ErrNotFound), true)
+	})
+}
+
+func TestBuddy(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	t.Run("View", func(t *testing.T) {
+		code, _, body := ts.get(t, "/buddy/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Professional Association of Diving Instructors (PADI)")
+		assert.StringContains(t, body, "Dive Sites Shared (1)")
+		assert.StringContains(t, body, "Dives with John Smith (1)")
+	})
+
+	t.Run("View non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/buddy/view/99")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+		code, _, body := ts.get(t, "/buddy/edit/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `action="/buddy/edit/1"`)
+		assert.StringContains(t, body, `<input type="hidden" name="version" id="id_version" value="1">`)
+	})
+
+	form := url.Values{}
+	form.Add("csrf_token", csrfToken)
+	form.Add("version", "2")
+	form.Add("name", "Jon Smith")
+	form.Add("email_address", "john.smith@example.com")
+	form.Add("phone_number", "07987654321")
+	form.Add("agency_id", "1")
+	form.Add("agency_member_num", "12345")
+	form.Add("notes", "Good diver.")
+
+	t.Run("Update conflict", func(t *testing.T) {
+		code, _, body := ts.postForm(t, "/buddy/edit/1", form)
+		assert.Equal(t, code, http.StatusConflict)
+		assert.StringContains(t, body, "This dive buddy was changed by someone else")
+		assert.StringContains(t, body, "<td>Jon Smith</td>")
+		assert.StringContains(t, body, "<td>John Smith</td>")
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		form.Set("version", "1")
+
+		code, headers, _ := ts.postForm(t, "/buddy/edit/1", form)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/buddy/view/1")
+	})
+}
+
+func TestOperator(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	t.Run("View", func(t *testing.T) {
+		code, _, body := ts.get(t, "/operator/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "123, Fake Street")
+		assert.StringContains(t, body, "8.5/10")
+		assert.StringContains(t, body, "<strong>23900.00</strong>")
+		assert.StringContains(t, body, "Trips (1)")
+		assert.StringContains(t, body, "Certifications (1)")
+		assert.StringContains(t, body, "Dives (1)")
+	})
+
+	t.Run("View non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/operator/view/99")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+		code, _, body := ts.get(t, "/operator/edit/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `action="/operator/edit/1"`)
+		assert.StringContains(t, body, "Update Dive Operator")
+	})
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		operatorName string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Valid", "/operator/edit/1", "Bigger Bubbles", http.StatusSeeOther, "/operator/view/1"},
+		{"Blank name", "/operator/edit/1", "", http.StatusUnprocessableEntity, ""},
+		{"Non-existent ID", "/operator/edit/99", "Bigger Bubbles", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("name", tt.operatorName)
+			form.Add("operator_type_id", "1")
+			form.Add("country", "1")
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestTrip(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	t.Run("View", func(t *testing.T) {
+		code, _, body := ts.get(t, "/trip/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "Big Splash Liveaboard")
+		assert.StringContains(t, body, "AED 1000.00")
+		assert.StringContains(t, body, "over 1 day(s)")
+		assert.StringContains(t, body, "Dive Sites Visited (1)")
+		assert.StringContains(t, body, `value="detach"`)
+	})
+
+	t.Run("View non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/trip/view/99")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+		code, _, body := ts.get(t, "/trip/edit/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `action="/trip/edit/1"`)
+		assert.StringContains(t, body, "Update Dive Trip")
+	})
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		tripName     string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Valid", "/trip/edit/1", "Bigger Splash", http.StatusSeeOther, "/trip/view/1"},
+		{"Blank name", "/trip/edit/1", "", http.StatusUnprocessableEntity, ""},
+		{"Non-existent ID", "/trip/edit/99", "Bigger Splash", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("name", tt.tripName)
+			form.Add("start_date", "2020-01-17")
+			form.Add("end_date", "2020-01-24")
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	diveTests := []struct {
+		name         string
+		urlPath      string
+		action       string
+		diveIDs      []string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Attach dives", "/trip/dives/1", "attach", []string{"1", "2"}, http.StatusSeeOther, "/trip/view/1"},
+		{"Detach dives", "/trip/dives/1", "detach", []string{"1"}, http.StatusSeeOther, "/trip/view/1"},
+		{"No dives selected", "/trip/dives/1", "attach", nil, http.StatusUnprocessableEntity, ""},
+		{"Invalid action", "/trip/dives/1", "delete", []string{"1"}, http.StatusBadRequest, ""},
+		{"Non-existent trip", "/trip/dives/99", "attach", []string{"1"}, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range diveTests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("action", tt.action)
+			for _, id := range tt.diveIDs {
+				form.Add("dive_id", id)
+			}
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestCertification(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	// The smallest possible PNG file signature is enough for it to be detected.
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	err := app.files.Put("certifications/1/1/front", strings.NewReader(png))
+	assert.NilError(t, err)
+
+	t.Run("View", func(t *testing.T) {
+		code, _, body := ts.get(t, "/certification/view/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `<a href="/buddy/view/1">John Smith</a>`)
+		assert.StringContains(t, body, "Training Dives (1)")
+		assert.StringContains(t, body, `src="/certification/card/1/front?v=`)
+		assert.StringContains(t, body, "No image of the back of the card has been uploaded yet.")
+	})
+
+	t.Run("View non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/certification/view/99")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Edit", func(t *testing.T) {
+		code, _, body := ts.get(t, "/certification/edit/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `action="/certification/edit/1"`)
+		assert.StringContains(t, body, "Update Dive Certification")
+	})
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		instructorID string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Valid", "/certification/edit/1", "1", http.StatusSeeOther, "/certification/view/1"},
+		{"No instructor", "/certification/edit/1", "0", http.StatusUnprocessableEntity, ""},
+		{"Non-existent ID", "/certification/edit/99", "1", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("course_id", "1")
+			form.Add("start_date", "2020-01-19")
+			form.Add("end_date", "2020-01-22")
+			form.Add("operator_id", "1")
+			form.Add("instructor_id", tt.instructorID)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	t.Run("Get card image", func(t *testing.T) {
+		code, headers, body := ts.get(t, "/certification/card/1/front")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, headers.Get("Content-Type"), "image/png")
+		assert.Equal(t, body, png)
+	})
+
+	t.Run("Get missing card image", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/certification/card/1/back")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Get invalid card side", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/certification/card/1/side")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Download cards", func(t *testing.T) {
+		code, headers, body := ts.get(t, "/certification/cards/1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, headers.Get("Content-Type"), "application/zip")
+		assert.StringContains(t, headers.Get("Content-Disposition"), "certification-1-cards.zip")
+		assert.StringContains(t, body, "front.png")
+	})
+
+	uploadTests := []struct {
+		name         string
+		urlPath      string
+		contents     string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Upload card image", "/certification/card/1/back", png, http.StatusSeeOther, "/certification/view/1"},
+		{"Upload non-image", "/certification/card/1/back", "Not an image", http.StatusUnprocessableEntity, ""},
+		{"Upload to invalid side", "/certification/card/1/side", png, http.StatusNotFound, ""},
+		{"Upload to non-existent ID", "/certification/card/99/back", png, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range uploadTests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, headers, _ := ts.postFile(t, tt.urlPath, form, "card.png", tt.contents)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+
+	t.Run("Uploaded card image is stored", func(t *testing.T) {
+		f, err := app.files.Get("certifications/1/1/back")
+		assert.NilError(t, err)
+		f.Close()
+	})
+
+	deleteTests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Delete card image", "/certification/card/1/front/delete", http.StatusSeeOther},
+		{"Delete missing card image", "/certification/card/1/back/delete", http.StatusNotFound},
+	}
+
+	for _, tt := range deleteTests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestDiveBulkEdit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	t.Run("List", func(t *testing.T) {
+		code, _, body := ts.get(t, "/log-book/dive/")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `action="/log-book/dive/bulk-edit"`)
+		assert.StringContains(t, body, `name="dive_id"`)
+	})
+
+	t.Run("Edit selected", func(t *testing.T) {
+		code, _, body := ts.get(t, "/log-book/dive/bulk-edit?dive_id=1&dive_id=99")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `name="dives[0].version" value="1"`)
+		assert.StringContains(t, body, "This dive no longer exists")
+	})
+
+	t.Run("Edit none selected", func(t *testing.T) {
+		code, headers, _ := ts.get(t, "/log-book/dive/bulk-edit")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, headers.Get("Location"), "/log-book/dive/")
+	})
+
+	tests := []struct {
+		name         string
+		diveID       string
+		version      string
+		setTrip      bool
+		tripID       string
+		allOrNothing bool
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"Valid", "1", "1", true, "1", false, http.StatusSeeOther, "/log-book/dive/", ""},
+		{"Clear trip", "1", "1", true, "", false, http.StatusSeeOther, "/log-book/dive/", ""},
+		{"No changes", "1", "1", false, "1", false, http.StatusUnprocessableEntity, "", "Choose at least one field to change"},
+		{"No dives", "", "1", true, "1", false, http.StatusUnprocessableEntity, "", "Select at least one dive to edit"},
+		{"Invalid trip", "1", "1", true, "99", false, http.StatusUnprocessableEntity, "", "Invalid dive trip selected"},
+		{"Conflict", "1", "2", true, "1", false, http.StatusConflict, "", "changed by someone else"},
+		{"Non-existent dive", "99", "1", true, "1", false, http.StatusConflict, "", "0 of 1 dives have been updated"},
+		{"All or nothing", "1", "2", true, "1", true, http.StatusConflict, "", "None of the dives have been updated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("dives[0].id", tt.diveID)
+			form.Add("dives[0].version", tt.version)
+			form.Add("trip_id", tt.tripID)
+			if tt.setTrip {
+				form.Add("set_trip", "true")
+			}
+			if tt.allOrNothing {
+				form.Add("all_or_nothing", "true")
+			}
+
+			code, headers, body := ts.postForm(t, "/log-book/dive/bulk-edit", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestDiveDay(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	t.Run("Log next dive", func(t *testing.T) {
+		code, _, body := ts.get(t, "/log-book/dive/add?from=1")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `value="2" id="id_number"`)
+		assert.StringContains(t, body, `value="2020-01-19T15:21"`)
+	})
+
+	t.Run("Log next dive non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/log-book/dive/add?from=99")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	t.Run("Day", func(t *testing.T) {
+		code, _, body := ts.get(t, "/log-book/dive/day?from=1&count=2")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `name="dives[1].number"`)
+		assert.StringContains(t, body, `value="2020-01-19T15:21"`)
+	})
+
+	t.Run("Day non-existent ID", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/log-book/dive/day?from=99")
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	tests := []struct {
+		name         string
+		from         string
+		numbers      []string
+		times        []string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			"Valid", "1", []string{"2", "3"}, []string{"2020-01-19T16:00", "2020-01-19T18:00"},
+			http.StatusSeeOther, "/log-book/dive/", "",
+		},
+		{
+			"Number already logged", "1", []string{"1"}, []string{"2020-01-19T16:00"},
+			http.StatusUnprocessableEntity, "", "A dive has already been logged with this number",
+		},
+		{
+			"Duplicate numbers", "1", []string{"2", "2"}, []string{"2020-01-19T16:00", "2020-01-19T18:00"},
+			http.StatusUnprocessableEntity, "", "This number is used by another dive above",
+		},
+		{
+			"Overlapping dives", "1", []string{"2", "3"}, []string{"2020-01-19T16:00", "2020-01-19T16:30"},
+			http.StatusUnprocessableEntity, "", "This dive cannot start before the previous dive has finished",
+		},
+		{
+			"No dives", "1", nil, nil,
+			http.StatusUnprocessableEntity, "", "Select at least one dive to log",
+		},
+		{
+			"Non-existent previous dive", "99", []string{"2"}, []string{"2020-01-19T16:00"},
+			http.StatusNotFound, "", "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("from", tt.from)
+			for i, number := range tt.numbers {
+				prefix := fmt.Sprintf("dives[%d].", i)
+				form.Add(prefix+"include", "true")
+				form.Add(prefix+"number", number)
+				form.Add(prefix+"date_time_in", tt.times[i])
+				form.Add(prefix+"max_depth", "18")
+				form.Add(prefix+"bottom_time", "45")
+			}
+
+			code, headers, body := ts.postForm(t, "/log-book/dive/day", form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestDiveRenumber(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.logIn(t, "", "")
+
+	t.Run("Preview", func(t *testing.T) {
+		code, _, body := ts.get(t, "/log-book/dive/renumber")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "#2 to #4")
+		assert.StringContains(t, body, `name="changes[0].number" value="2"`)
+	})
+
+	tests := []struct {
+		name         string
+		diveID       string
+		number       string
+		wantLocation string
+	}{
+		{"Valid", "1", "2", "/log-book/dive/"},
+		{"Changed since preview", "1", "3", "/log-book/dive/renumber"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+			form.Add("changes[0].id", tt.diveID)
+			form.Add("changes[0].number", tt.number)
+
+			code, headers, _ := ts.postForm(t, "/log-book/dive/renumber", form)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestDiveListFilter(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.logIn(t, "", "")
+
+	t.Run("Filters kept", func(t *testing.T) {
+		qs := "date_to=2020-01-31&max_depth_to=20&property_id=1&property_id=x&properties=all&notes=boots"
+		code, _, body := ts.get(t, "/log-book/dive/?"+qs)
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, `name="date_to" class="form-control form-control-sm"`)
+		assert.StringContains(t, body, `value="2020-01-31"`)
+		assert.StringContains(t, body, `id="id_properties_all" checked`)
+		assert.StringContains(t, body, `value="boots"`)
+		assert.StringContains(t, body, "#1</a>")
+
+		want := `href="/log-book/dive/?date_to=2020-01-31&amp;max_depth_to=20&amp;notes=boots&amp;page=1&amp;`
+		assert.StringContains(t, body, want)
+		assert.StringContains(t, body, `&amp;properties=all&amp;property_id=1">First</a>`)
+		assert.StringContains(t, body, "/log-book/dive/export/csv?date_to=2020-01-31")
+	})
+
+	t.Run("Export keeps sort", func(t *testing.T) {
+		code, _, body := ts.get(t, "/log-book/dive/?sort=-max_depth&notes=boots")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "/log-book/dive/export/csv?notes=boots&amp;sort=-max_depth")
+		assert.StringContains(t, body, "/log-book/dive/export/pdf?layout=half&notes=boots&amp;sort=-max_depth")
+	})
+
+	t.Run("No matches", func(t *testing.T) {
+		code, _, body := ts.get(t, "/log-book/dive/?max_depth_from=30")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "None of your dives match these filters")
+		assert.StringContains(t, body, `value="30"`)
+	})
+}
+
+func TestReadDiveFilterDates(t *testing.T) {
+	app := newTestApplication(t)
+
+	// The dates are compared with the local time of each dive at its site, so
+	// only their year, month and day are used and date_to is made exclusive.
+	qs := url.Values{"date_from": {"2020-01-01"}, "date_to": {"2020-01-31"}}
+	filter := app.readDiveFilter(qs)
+	assert.Equal(t, filter.DateFrom.Format(time.DateTime), "2020-01-01 00:00:00")
+	assert.Equal(t, filter.DateTo.Format(time.DateTime), "2020-02-01 00:00:00")
+
+	filter = app.readDiveFilter(url.Values{"date_from": {"31/01/2020"}})
+	assert.Equal(t, filter.DateFrom == nil, true)
+}
+
+func TestListSort(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.logIn(t, "", "")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantBody []string
+	}{
+		{
+			name:    "Dives sorted and filtered",
+			urlPath: "/log-book/dive/?sort=-max_depth,+date&max_depth_to=20",
+			wantBody: []string{
+				`href="/log-book/dive/?max_depth_to=20&amp;sort=max_depth" title="Sort by Max Depth">Max Depth ▼</a>`,
+				`href="/log-book/dive/?max_depth_to=20&amp;sort=date" title="Sort by Date">Date</a>`,
+				`&amp;sort=-max_depth%2Cdate">First</a>`,
+				`<input type="hidden" name="sort" value="-max_depth,date">`,
+			},
+		},
+		{
+			name:    "Buddies sorted ascending",
+			urlPath: "/buddy/?sort=dives_with",
+			wantBody: []string{
+				`href="/buddy/?sort=-dives_with" title="Sort by Dives Logged">Dives Logged ▲</a>`,
+				`href="/buddy/?sort=name" title="Sort by Name">Name</a>`,
+				`page_size=20&amp;sort=dives_with">First</a>`,
+			},
+		},
+		{
+			name:    "Repeated keys dropped",
+			urlPath: "/log-book/dive/?sort=date,-date,number,date,-number",
+			wantBody: []string{
+				`&amp;sort=date%2Cnumber">First</a>`,
+			},
+		},
+		{
+			name:    "Invalid sort ignored",
+			urlPath: "/trip/?sort=-price",
+			wantBody: []string{
+				`href="/trip/?sort=start_date" title="Sort by Start Date">Start Date</a>`,
+				`href="/trip/?page=1&amp;page_size=20">First</a>`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, http.StatusOK)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+
+	t.Run("API", func(t *testing.T) {
+		code, _, _ := ts.get(t, "/api/v1/dives?sort=-max_depth,date")
+		assert.Equal(t, code, http.StatusOK)
+	})
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.logIn(t, "", "")
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{"No query", "", http.StatusOK, "Search the notes of your dives"},
+		{
+			"Match",
+			"boots",
+			http.StatusOK,
+			`<h2>Dives</h2>`,
+		},
+		{"No match", "mola", http.StatusOK, "Nothing in your log book matches your search."},
+		{
+			"Too long",
+			strings.Repeat("a", 257),
+			http.StatusUnprocessableEntity,
+			"This field cannot be more than 256 characters long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, "/search?q="+url.QueryEscape(tt.query))
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+
+	t.Run("Snippet escaped and highlighted", func(t *testing.T) {
+		_, _, body := ts.get(t, "/search?q=boots")
+		assert.StringContains(t, body, `href="/log-book/dive/view/1"`)
+		assert.StringContains(t, body, "Wore my new 5mm <mark>boots</mark> &lt;3")
+	})
+}
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"html/template"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
 	"runtime/debug"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
@@ -60,6 +64,48 @@ func (app *app) decodePOSTForm(r *http.Request, dst any) error {
 	return nil
 }
 
+// decodeMultipartForm works in the same way as decodePOSTForm, but for forms
+// submitted with the multipart/form-data encoding such as file uploads. The
+// request body is limited to maxSize bytes, and an *http.MaxBytesError is
+// returned if it is any larger.
+func (app *app) decodeMultipartForm(
+	w http.ResponseWriter,
+	r *http.Request,
+	dst any,
+	maxSize int64,
+) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	err := r.ParseMultipartForm(maxSize)
+	if err != nil {
+		return err
+	}
+
+	err = app.formDecoder.Decode(dst, r.PostForm)
+	if err != nil {
+		var invalidDecoderError *form.InvalidDecoderError
+		if errors.As(err, &invalidDecoderError) {
+			panic(err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// multipartFormErrorStatus returns the HTTP status code for an error returned
+// by decodeMultipartForm, which is 413 if the request body was too large or
+// 400 otherwise.
+func multipartFormErrorStatus(err error) int {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
 func (app *app) isAuthenticated(r *http.Request) bool {
 	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
 	if !ok {
@@ -151,6 +197,7 @@ func (app *app) newTemplateData(r *http.Request) (templateData, error) {
 		NoValidate:      os.Getenv("DIVESITE_NOVALIDATE") == "true",
 		Operators:       operators,
 		OperatorTypes:   operatorTypes,
+		TrashUndo:       app.sessionManager.PopString(r.Context(), "trashUndo"),
 		User:            *user,
 		WasPosted:       r.Method == http.MethodPost,
 		WaterBodies:     waterBodies,
@@ -175,6 +222,319 @@ func (app *app) readInt(qs url.Values, key string, defaultValue int) int {
 	return i
 }
 
+// readFloat returns the float in the query string value key of qs, or
+// defaultValue if it is missing or invalid.
+func (app *app) readFloat(qs url.Values, key string, defaultValue float64) float64 {
+	value := qs.Get(key)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue
+	}
+
+	return f
+}
+
+// readDate returns the date in the query string value key of qs in the format
+// 2006-01-02, or nil if it is missing or invalid. The date is returned at
+// midnight UTC, but only its year, month and day are used when filtering dives
+// as they are compared with the local time of each dive at its site.
+func (app *app) readDate(qs url.Values, key string) *time.Time {
+	date, err := time.Parse(time.DateOnly, qs.Get(key))
+	if err != nil {
+		return nil
+	}
+
+	return &date
+}
+
+// readInts returns the distinct positive integers in the query string values
+// key of qs, which may be repeated, in ascending order. Any invalid values are
+// ignored.
+func (app *app) readInts(qs url.Values, key string) []int {
+	var ints []int
+
+	for _, value := range qs[key] {
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 1 {
+			continue
+		}
+		ints = append(ints, i)
+	}
+
+	slices.Sort(ints)
+	return slices.Compact(ints)
+}
+
+// readDiveFilter builds a DiveFilter from the query string values qs. Any
+// values that are missing or invalid are ignored. The date_to date is
+// inclusive and the bottom times are given in minutes. The property_id and
+// equipment_id values may be repeated, with a dive having to have all of the
+// properties if properties is "all" and any of them otherwise.
+func (app *app) readDiveFilter(qs url.Values) models.DiveFilter {
+	filter := models.DiveFilter{
+		DiveSiteID:      app.readInt(qs, "dive_site_id", 0),
+		OperatorID:      app.readInt(qs, "operator_id", 0),
+		TripID:          app.readInt(qs, "trip_id", 0),
+		CertificationID: app.readInt(qs, "certification_id", 0),
+		BuddyID:         app.readInt(qs, "buddy_id", 0),
+		NumberFrom:      app.readInt(qs, "number_from", 0),
+		NumberTo:        app.readInt(qs, "number_to", 0),
+		DateFrom:        app.readDate(qs, "date_from"),
+		MaxDepthFrom:    app.readFloat(qs, "max_depth_from", 0),
+		MaxDepthTo:      app.readFloat(qs, "max_depth_to", 0),
+		BottomTimeFrom:  time.Duration(app.readInt(qs, "bottom_time_from", 0)) * time.Minute,
+		BottomTimeTo:    time.Duration(app.readInt(qs, "bottom_time_to", 0)) * time.Minute,
+		CountryID:       app.readInt(qs, "country_id", 0),
+		WaterBodyID:     app.readInt(qs, "water_body_id", 0),
+		WaterTypeID:     app.readInt(qs, "water_type_id", 0),
+		GasMixID:        app.readInt(qs, "gas_mix_id", 0),
+		PropertyIDs:     app.readInts(qs, "property_id"),
+		AllProperties:   qs.Get("properties") == "all",
+		EquipmentIDs:    app.readInts(qs, "equipment_id"),
+		MinRating:       app.readInt(qs, "min_rating", 0),
+		Notes:           strings.TrimSpace(qs.Get("notes")),
+	}
+
+	if dateTo := app.readDate(qs, "date_to"); dateTo != nil {
+		dateTo := dateTo.AddDate(0, 0, 1)
+		filter.DateTo = &dateTo
+	}
+
+	return filter
+}
+
+// diveFilterValues is the inverse of readDiveFilter and encodes the non-zero
+// fields of the DiveFilter as query string values.
+func diveFilterValues(filter models.DiveFilter) url.Values {
+	qs := url.Values{}
+
+	for key, value := range map[string]int{
+		"dive_site_id":     filter.DiveSiteID,
+		"operator_id":      filter.OperatorID,
+		"trip_id":          filter.TripID,
+		"certification_id": filter.CertificationID,
+		"buddy_id":         filter.BuddyID,
+		"number_from":      filter.NumberFrom,
+		"number_to":        filter.NumberTo,
+		"bottom_time_from": int(filter.BottomTimeFrom.Minutes()),
+		"bottom_time_to":   int(filter.BottomTimeTo.Minutes()),
+		"country_id":       filter.CountryID,
+		"water_body_id":    filter.WaterBodyID,
+		"water_type_id":    filter.WaterTypeID,
+		"gas_mix_id":       filter.GasMixID,
+		"min_rating":       filter.MinRating,
+	} {
+		if value != 0 {
+			qs.Set(key, strconv.Itoa(value))
+		}
+	}
+
+	for key, value := range map[string]float64{
+		"max_depth_from": filter.MaxDepthFrom,
+		"max_depth_to":   filter.MaxDepthTo,
+	} {
+		if value != 0 {
+			qs.Set(key, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+
+	if filter.DateFrom != nil {
+		qs.Set("date_from", filter.DateFrom.Format(time.DateOnly))
+	}
+	if filter.DateTo != nil {
+		qs.Set("date_to", filter.DateTo.AddDate(0, 0, -1).Format(time.DateOnly))
+	}
+
+	for _, id := range filter.PropertyIDs {
+		qs.Add("property_id", strconv.Itoa(id))
+	}
+	if filter.AllProperties && len(filter.PropertyIDs) > 0 {
+		qs.Set("properties", "all")
+	}
+
+	for _, id := range filter.EquipmentIDs {
+		qs.Add("equipment_id", strconv.Itoa(id))
+	}
+
+	if filter.Notes != "" {
+		qs.Set("notes", filter.Notes)
+	}
+
+	return qs
+}
+
+// diveSiteCount is a dive site along with how many times it was dived in a set
+// of dives.
+type diveSiteCount struct {
+	DiveSite models.DiveSite
+	Dives    int
+}
+
+// diveSiteCounts returns each distinct dive site in dives along with how many
+// of the dives took place there, in the order that each site first appears.
+func diveSiteCounts(dives []models.Dive) []diveSiteCount {
+	var counts []diveSiteCount
+	indexes := map[int]int{}
+
+	for _, dive := range dives {
+		i, ok := indexes[dive.DiveSite.ID]
+		if !ok {
+			i = len(counts)
+			indexes[dive.DiveSite.ID] = i
+			counts = append(counts, diveSiteCount{DiveSite: dive.DiveSite})
+		}
+		counts[i].Dives++
+	}
+
+	return counts
+}
+
+// diveDay is the dives that started on a single day, in the local time of
+// their dive sites.
+type diveDay struct {
+	Date  time.Time
+	Dives []models.Dive
+}
+
+// diveSummary is the itinerary and totals for a set of dives.
+type diveSummary struct {
+	Days       []diveDay
+	BottomTime time.Duration
+	Deepest    *models.Dive
+}
+
+// summariseDives groups dives, which must already be sorted by date, into the
+// days that they took place on and totals up their bottom times.
+func summariseDives(dives []models.Dive) diveSummary {
+	var summary diveSummary
+
+	for i, dive := range dives {
+		y, m, d := dive.DateTimeIn.Date()
+		date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+		last := len(summary.Days) - 1
+		if last < 0 || !summary.Days[last].Date.Equal(date) {
+			summary.Days = append(summary.Days, diveDay{Date: date})
+			last++
+		}
+		summary.Days[last].Dives = append(summary.Days[last].Dives, dive)
+
+		summary.BottomTime += dive.BottomTime
+		if summary.Deepest == nil || dive.MaxDepth > summary.Deepest.MaxDepth {
+			summary.Deepest = &dives[i]
+		}
+	}
+
+	return summary
+}
+
+// readDiveSiteFilter builds a DiveSiteFilter from the query string values qs.
+// Any values that are missing or invalid are ignored.
+func (app *app) readDiveSiteFilter(qs url.Values) models.DiveSiteFilter {
+	return models.DiveSiteFilter{
+		CountryID:   app.readInt(qs, "country_id", 0),
+		WaterBodyID: app.readInt(qs, "water_body_id", 0),
+	}
+}
+
+// sortKeys splits a comma-separated sort value into its keys, dropping any that
+// are blank or that repeat an earlier key in either direction, and keeping at
+// most maxKeys of them.
+func sortKeys(value string, maxKeys int) []string {
+	var keys []string
+	seen := map[string]bool{}
+
+	for key := range strings.SplitSeq(value, ",") {
+		key = strings.TrimSpace(key)
+		name := strings.TrimPrefix(key, "-")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if len(keys) == maxKeys {
+			break
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// readSort builds a list of sort columns from the comma-separated keys in the
+// "sort" query string value of qs, such as "-start_date,name". Each key is
+// mapped onto its ascending and descending sort column by options, with a
+// leading "-" selecting the descending one. Repeated keys are ignored and there
+// can be no more keys than options. If no sort is given, then defaultSort is
+// returned. The returned bool is false if any of the keys are not in options.
+func readSort[T models.Sorter](
+	qs url.Values,
+	options map[string][2]T,
+	defaultSort []T,
+) ([]T, bool) {
+	value := qs.Get("sort")
+	if value == "" {
+		return defaultSort, true
+	}
+
+	var sort []T
+	for _, key := range sortKeys(value, len(options)) {
+		key, desc := strings.CutPrefix(key, "-")
+
+		cols, ok := options[key]
+		if !ok {
+			return nil, false
+		}
+
+		if desc {
+			sort = append(sort, cols[1])
+		} else {
+			sort = append(sort, cols[0])
+		}
+	}
+
+	if len(sort) == 0 {
+		return defaultSort, true
+	}
+
+	return sort, true
+}
+
+// readListSort reads the sort for an HTML list page from the "sort" query
+// string value of qs in the same way as readSort, except that defaultSort is
+// used if it is invalid. It also returns the sort value to carry through links
+// back to the list, which is empty for the default sort.
+func readListSort[T models.Sorter](
+	qs url.Values,
+	options map[string][2]T,
+	defaultSort []T,
+) ([]T, string) {
+	sort, ok := readSort(qs, options, defaultSort)
+	if !ok {
+		return defaultSort, ""
+	}
+
+	keys := sortKeys(qs.Get("sort"), len(options))
+	return sort, strings.Join(keys, ",")
+}
+
+// listQuery returns the query string for links to a page of a list, which
+// keeps its filters and its sort if it is not the default one.
+func listQuery(filter url.Values, sort string) template.URL {
+	qs := url.Values{}
+	maps.Copy(qs, filter)
+	if sort != "" {
+		qs.Set("sort", sort)
+	}
+
+	return template.URL(qs.Encode())
+}
+
 func (app *app) render(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -0,0 +1,1146 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/logbook"
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// maxImportSize is the maximum size in bytes of a log book file that can be
+// uploaded for importing.
+const maxImportSize = 16 << 20
+
+// siteMatchDistance is the distance in metres within which an imported dive
+// site is considered to be the same as an existing dive site.
+const siteMatchDistance = 100.0
+
+// unnamedSiteMatchDistance is the distance in metres within which an imported
+// dive site that only has a position, such as the GPS start point recorded by a
+// dive computer, is considered to be the same as an existing dive site. It is
+// larger than siteMatchDistance as a dive computer will usually only get a fix
+// once it is back on the surface.
+const unnamedSiteMatchDistance = 1000.0
+
+// importParsers maps each of the supported log book file formats to the
+// function that parses it.
+var importParsers = map[string]func(io.Reader) ([]logbook.Dive, error){
+	"subsurface": logbook.ParseSubsurface,
+	"uddf":       logbook.ParseUDDF,
+	"fit":        logbook.ParseFIT,
+	"shearwater": logbook.ParseShearwater,
+}
+
+// importForm holds the options for a log book import. As imported log books
+// rarely contain everything required to log a dive or dive site, the defaults
+// given here are used to fill in the gaps.
+type importForm struct {
+	Format              string          `form:"format"`
+	KeepNumbers         bool            `form:"keep_numbers"`
+	Activity            string          `form:"activity"`
+	EntryPointID        int             `form:"entry_point_id"`
+	TankConfigurationID int             `form:"tank_configuration_id"`
+	TankMaterialID      int             `form:"tank_material_id"`
+	TankVolume          float64         `form:"tank_volume"`
+	CountryID           int             `form:"country_id"`
+	TimeZone            models.TimeZone `form:"timezone"`
+	WaterBodyID         int             `form:"water_body_id"`
+	WaterTypeID         int             `form:"water_type_id"`
+	validator.Validator `form:"-"`
+}
+
+func (app *app) validateImportForm(f *importForm) error {
+	_, ok := importParsers[f.Format]
+	f.CheckField(ok, "format", "Select a valid file format")
+
+	err := app.validateImportDiveDefaults(f)
+	if err != nil {
+		return err
+	}
+
+	f.CheckField(f.CountryID > 0, "country_id", "Select a valid country")
+	f.CheckField(f.TimeZone.String() != "", "timezone", "Select a valid time zone")
+	f.CheckField(f.WaterBodyID > 0, "water_body_id", "Select a valid water body")
+	f.CheckField(f.WaterTypeID > 0, "water_type_id", "Select a valid water type")
+
+	return nil
+}
+
+// validateImportDiveDefaults validates just the fields of an importForm that
+// provide the defaults for imported dives, ignoring those for new dive sites.
+func (app *app) validateImportDiveDefaults(f *importForm) error {
+	f.CheckField(validator.NotBlank(f.Activity), "activity", "This field cannot be blank")
+	f.CheckField(
+		validator.MaxChars(f.Activity, 256),
+		"activity",
+		"This field cannot be more than 256 characters long",
+	)
+
+	f.CheckField(
+		validator.NumBetween(f.TankVolume, 2.0, 22.0),
+		"tank_volume",
+		"This field must be between 2 and 22 litres inclusive",
+	)
+
+	exists, err := app.entryPoints.Exists(f.EntryPointID)
+	if err != nil {
+		return err
+	}
+	f.CheckField(exists, "entry_point_id", "Invalid entry point selected")
+
+	exists, err = app.tankConfigurations.Exists(f.TankConfigurationID)
+	if err != nil {
+		return err
+	}
+	f.CheckField(exists, "tank_configuration_id", "Invalid tank configuration selected")
+
+	exists, err = app.tankMaterials.Exists(f.TankMaterialID)
+	if err != nil {
+		return err
+	}
+	f.CheckField(exists, "tank_material_id", "Invalid tank material selected")
+
+	return nil
+}
+
+// importLookups maps the lower-cased names of the static data items and the
+// user's own records that an imported dive can refer to onto their IDs.
+type importLookups struct {
+	buddyRoles         map[string]int
+	certifications     map[string]int
+	countries          map[string]int
+	currencies         map[string]int
+	currents           map[string]int
+	diveProperties     map[string]int
+	entryPoints        map[string]int
+	equipment          map[string]int
+	gasMixes           map[string]int
+	operators          map[string]int
+	tankConfigurations map[string]int
+	tankMaterials      map[string]int
+	waterBodies        map[string]int
+	waterTypes         map[string]int
+	waves              map[string]int
+}
+
+// lookupID returns the ID of the item called name in the lookup m, ignoring
+// case. The returned bool is false if there is no such item.
+func lookupID(m map[string]int, name string) (int, bool) {
+	id, ok := m[strings.ToLower(strings.TrimSpace(name))]
+	return id, ok && name != ""
+}
+
+// lookupIDPtr works in the same way as lookupID, but returns nil if the item
+// does not exist.
+func lookupIDPtr(m map[string]int, name string) *int {
+	if id, ok := lookupID(m, name); ok {
+		return &id
+	}
+
+	return nil
+}
+
+// newLookup builds a lookup from the items using the name and ID returned by
+// the key function for each item.
+func newLookup[T any](items []T, key func(T) (string, int)) map[string]int {
+	m := make(map[string]int, len(items))
+	for _, item := range items {
+		name, id := key(item)
+		m[strings.ToLower(strings.TrimSpace(name))] = id
+	}
+
+	return m
+}
+
+func (app *app) newImportLookups(userID int) (importLookups, error) {
+	var l importLookups
+
+	buddyRoles, err := app.buddyRoles.List()
+	if err != nil {
+		return l, fmt.Errorf("could not fetch buddy roles list: %w", err)
+	}
+	l.buddyRoles = newLookup(buddyRoles, func(i models.BuddyRole) (string, int) {
+		return i.Name, i.ID
+	})
+
+	certifications, err := app.certifications.ListAll(userID, models.SortCertDefault)
+	if err != nil {
+		return l, fmt.Errorf("could not fetch certifications list: %w", err)
+	}
+	l.certifications = newLookup(certifications, func(i models.Certification) (string, int) {
+		return i.Course.Name, i.ID
+	})
+
+	countries, err := app.countries.List()
+	if err != nil {
+		return l, fmt.Errorf("could not fetch countries list: %w", err)
+	}
+	l.countries = newLookup(countries, func(i models.Country) (string, int) {
+		return i.Name, i.ID
+	})
+	// Countries can be looked up by either their name or their ISO code.
+	for _, c := range countries {
+		l.countries[strings.ToLower(c.ISO2Code)] = c.ID
+	}
+
+	currencies, err := app.currencies.List()
+	if err != nil {
+		return l, fmt.Errorf("could not fetch currencies list: %w", err)
+	}
+	l.currencies = newLookup(currencies, func(i models.Currency) (string, int) {
+		return i.ISOAlpha, i.ID
+	})
+
+	currents, err := app.currents.List(false)
+	if err != nil {
+		return l, fmt.Errorf("could not fetch currents list: %w", err)
+	}
+	l.currents = newLookup(currents, func(i models.Current) (string, int) {
+		return i.Name, i.ID
+	})
+
+	diveProperties, err := app.diveProperties.List()
+	if err != nil {
+		return l, fmt.Errorf("could not fetch dive properties list: %w", err)
+	}
+	l.diveProperties = newLookup(diveProperties, func(i models.DiveProperty) (string, int) {
+		return i.Name, i.ID
+	})
+
+	entryPoints, err := app.entryPoints.List(false)
+	if err != nil {
+		return l, fmt.Errorf("could not fetch entry points list: %w", err)
+	}
+	l.entryPoints = newLookup(entryPoints, func(i models.EntryPoint) (string, int) {
+		return i.Name, i.ID
+	})
+
+	equipment, err := app.equipment.List()
+	if err != nil {
+		return l, fmt.Errorf("could not fetch equipment list: %w", err)
+	}
+	l.equipment = newLookup(equipment, func(i models.Equipment) (string, int) {
+		return i.Name, i.ID
+	})
+
+	gasMixes, err := app.gasMixes.List(false)
+	if err != nil {
+		return l, fmt.Errorf("could not fetch gas mixes list: %w", err)
+	}
+	l.gasMixes = newLookup(gasMixes, func(i models.GasMix) (string, int) {
+		return i.Name, i.ID
+	})
+
+	operators, err := app.operators.ListAll(userID, models.SortOperatorDefault)
+	if err != nil {
+		return l, fmt.Errorf("could not fetch operators list: %w", err)
+	}
+	l.operators = newLookup(operators, func(i models.Operator) (string, int) {
+		return i.Name, i.ID
+	})
+
+	tankConfigurations, err := app.tankConfigurations.List(false)
+	if err != nil {
+		return l, fmt.Errorf("could not fetch tank configurations list: %w", err)
+	}
+	l.tankConfigurations = newLookup(tankConfigurations, func(i models.TankConfiguration) (string, int) {
+		return i.Name, i.ID
+	})
+
+	tankMaterials, err := app.tankMaterials.List(false)
+	if err != nil {
+		return l, fmt.Errorf("could not fetch tank materials list: %w", err)
+	}
+	l.tankMaterials = newLookup(tankMaterials, func(i models.TankMaterial) (string, int) {
+		return i.Name, i.ID
+	})
+
+	waterBodies, err := app.waterBodies.List()
+	if err != nil {
+		return l, fmt.Errorf("could not fetch water bodies list: %w", err)
+	}
+	l.waterBodies = newLookup(waterBodies, func(i models.WaterBody) (string, int) {
+		return i.Name, i.ID
+	})
+
+	waterTypes, err := app.waterTypes.List()
+	if err != nil {
+		return l, fmt.Errorf("could not fetch water types list: %w", err)
+	}
+	l.waterTypes = newLookup(waterTypes, func(i models.WaterType) (string, int) {
+		return i.Name, i.ID
+	})
+
+	waves, err := app.waves.List(false)
+	if err != nil {
+		return l, fmt.Errorf("could not fetch waves list: %w", err)
+	}
+	l.waves = newLookup(waves, func(i models.Waves) (string, int) {
+		return i.Name, i.ID
+	})
+
+	return l, nil
+}
+
+// importDive is a single dive from an imported log book along with the dive
+// form it maps to and how its dive site, buddy and trip were matched against
+// the user's existing records. Line is the line of the file that the dive was
+// read from, if known.
+type importDive struct {
+	Line      int
+	Dive      logbook.Dive
+	Form      diveForm
+	SiteName  string
+	NewSite   bool
+	BuddyName string
+	NewBuddy  bool
+	TripName  string
+	NewTrip   bool
+	Duplicate bool
+}
+
+// Importable reports whether the dive will be created when the import is
+// committed.
+func (d importDive) Importable() bool {
+	return !d.Duplicate && d.Form.Valid()
+}
+
+// importPreview is the result of a dry-run of an import. It lists every dive in
+// the log book and the dive sites, buddies and trips that will be created when
+// the import is committed, which is done by posting the import options to
+// CommitURL.
+type importPreview struct {
+	CommitURL  string
+	Dives      []importDive
+	NewSites   map[string]logbook.Site
+	NewBuddies map[string]string
+	NewTrips   map[string]logbook.Trip
+	lookups    importLookups
+	sites      map[string]diveSiteForm
+}
+
+func (p importPreview) ImportCount() int {
+	count := 0
+	for _, d := range p.Dives {
+		if d.Importable() {
+			count++
+		}
+	}
+	return count
+}
+
+func (p importPreview) DuplicateCount() int {
+	count := 0
+	for _, d := range p.Dives {
+		if d.Duplicate {
+			count++
+		}
+	}
+	return count
+}
+
+func (p importPreview) InvalidCount() int {
+	count := 0
+	for _, d := range p.Dives {
+		if !d.Duplicate && !d.Form.Valid() {
+			count++
+		}
+	}
+	return count
+}
+
+// matchDiveSite returns the existing dive site that matches the imported site,
+// either by having the same name or by being the nearest dive site within
+// siteMatchDistance metres of it. Sites without a name are matched on position
+// alone using unnamedSiteMatchDistance instead.
+func matchDiveSite(site logbook.Site, diveSites []models.DiveSite) *models.DiveSite {
+	if site.Name != "" {
+		for i, ds := range diveSites {
+			if strings.EqualFold(strings.TrimSpace(ds.Name), strings.TrimSpace(site.Name)) {
+				return &diveSites[i]
+			}
+		}
+	}
+
+	if !site.HasPosition() {
+		return nil
+	}
+
+	maxDistance := siteMatchDistance
+	if site.Name == "" {
+		maxDistance = unnamedSiteMatchDistance
+	}
+
+	var nearest *models.DiveSite
+	for i, ds := range diveSites {
+		if ds.Latitude == nil || ds.Longitude == nil {
+			continue
+		}
+
+		distance := logbook.Distance(*site.Latitude, *site.Longitude, *ds.Latitude, *ds.Longitude)
+		if distance <= maxDistance {
+			nearest = &diveSites[i]
+			maxDistance = distance
+		}
+	}
+
+	return nearest
+}
+
+// nameUnnamedSite gives an imported dive site that only has a position a name.
+// If a new dive site that will be created by the import is within
+// unnamedSiteMatchDistance metres of it, then the name of the nearest one is
+// used so that the dives share it, otherwise a name is made from its position.
+func nameUnnamedSite(site *logbook.Site, newSites map[string]logbook.Site) {
+	maxDistance := unnamedSiteMatchDistance
+	for _, ns := range newSites {
+		if !ns.HasPosition() {
+			continue
+		}
+
+		distance := logbook.Distance(*site.Latitude, *site.Longitude, *ns.Latitude, *ns.Longitude)
+		if distance <= maxDistance {
+			site.Name = ns.Name
+			maxDistance = distance
+		}
+	}
+
+	if site.Name == "" {
+		site.Name = fmt.Sprintf("Dive Site at %.4f, %.4f", *site.Latitude, *site.Longitude)
+	}
+}
+
+// previewImport maps each of the imported dives onto a diveForm, matching dive
+// sites, buddies and trips against the user's existing records and checking for
+// dives that have already been logged. The resulting forms are validated using
+// the same rules as a manually logged dive, except that dive sites, buddies and
+// trips that are yet to be created will not have an ID. Those are validated in
+// turn and any dive that refers to an invalid one will not be imported.
+func (app *app) previewImport(
+	user *models.User,
+	dives []logbook.Dive,
+	opts *importForm,
+) (importPreview, error) {
+	preview := importPreview{
+		CommitURL:  "/log-book/import/commit",
+		NewSites:   map[string]logbook.Site{},
+		NewBuddies: map[string]string{},
+		NewTrips:   map[string]logbook.Trip{},
+	}
+
+	diveSites, err := app.diveSites.ListAll(user.ID)
+	if err != nil {
+		return preview, fmt.Errorf("could not fetch dive sites list: %w", err)
+	}
+
+	buddies, err := app.buddies.ListAll(user.ID, models.SortBuddyDefault)
+	if err != nil {
+		return preview, fmt.Errorf("could not fetch buddies list: %w", err)
+	}
+
+	trips, err := app.trips.ListAll(user.ID, models.SortTripDefault)
+	if err != nil {
+		return preview, fmt.Errorf("could not fetch trips list: %w", err)
+	}
+
+	lookups, err := app.newImportLookups(user.ID)
+	if err != nil {
+		return preview, err
+	}
+	preview.lookups = lookups
+
+	nextNumber := user.NextDiveNumber()
+	seenNumbers := map[int]bool{}
+	seenDives := map[string]bool{}
+
+	for _, dive := range dives {
+		item := importDive{Dive: dive}
+		f := &item.Form
+
+		f.Activity = cmp.Or(dive.Activity, opts.Activity)
+		f.DateTimeIn = dive.DateTimeIn
+		f.MaxDepth = math.Round(dive.MaxDepth*10) / 10
+		f.BottomTimeMins = int(math.Round(dive.Duration.Minutes()))
+		f.Rating = dive.Rating
+		f.Visibility = dive.Visibility
+		f.Weight = dive.Weight
+		f.WeightNotes = dive.WeightNotes
+		f.EquipmentNotes = dive.EquipmentNotes
+		f.TankVolume = opts.TankVolume
+		f.Notes = dive.Notes
+
+		// Use the static data named by the log book where possible, falling back
+		// to the defaults from the import options for anything that is required.
+		f.EntryPointID = opts.EntryPointID
+		if id, ok := lookupID(lookups.entryPoints, dive.EntryPoint); ok {
+			f.EntryPointID = id
+		}
+		f.TankConfigurationID = opts.TankConfigurationID
+		if id, ok := lookupID(lookups.tankConfigurations, dive.TankConfiguration); ok {
+			f.TankConfigurationID = id
+		}
+		f.TankMaterialID = opts.TankMaterialID
+		if id, ok := lookupID(lookups.tankMaterials, dive.TankMaterial); ok {
+			f.TankMaterialID = id
+		}
+
+		f.CurrentID = lookupIDPtr(lookups.currents, dive.Current)
+		f.WavesID = lookupIDPtr(lookups.waves, dive.Waves)
+		f.BuddyRoleID = lookupIDPtr(lookups.buddyRoles, dive.BuddyRole)
+		f.OperatorID = lookupIDPtr(lookups.operators, dive.Operator)
+		f.CertificationID = lookupIDPtr(lookups.certifications, dive.Certification)
+
+		if dive.Price != nil {
+			if currencyID := lookupIDPtr(lookups.currencies, dive.Currency); currencyID != nil {
+				f.PriceAmount = dive.Price
+				f.CurrencyID = currencyID
+			}
+		}
+
+		if dive.SafetyStop != nil {
+			f.SafetyStopMins = ref(int(math.Round(dive.SafetyStop.Minutes())))
+		}
+
+		for _, name := range dive.Equipment {
+			if id, ok := lookupID(lookups.equipment, name); ok {
+				f.EquipmentIDs = append(f.EquipmentIDs, id)
+			}
+		}
+		for _, name := range dive.Properties {
+			if id, ok := lookupID(lookups.diveProperties, name); ok {
+				f.PropertyIDs = append(f.PropertyIDs, id)
+			}
+		}
+
+		if dive.AvgDepth != nil {
+			f.AvgDepth = ref(math.Round(*dive.AvgDepth*10) / 10)
+		}
+		if len(dive.Samples) > 0 {
+			f.applyProfile(newDiveProfile(dive.Samples))
+		}
+		if dive.WaterTemp != nil {
+			f.WaterTemp = ref(int(math.Round(*dive.WaterTemp)))
+		}
+		if dive.AirTemp != nil {
+			f.AirTemp = ref(int(math.Round(*dive.AirTemp)))
+		}
+
+		cylinder := dive.Cylinder()
+		f.FO2 = cylinder.FO2()
+		if cylinder.Volume != nil {
+			f.TankVolume = math.Round(*cylinder.Volume*10) / 10
+		}
+		if cylinder.StartPressure != nil {
+			f.PressureIn = ref(int(math.Round(*cylinder.StartPressure)))
+		}
+		if cylinder.EndPressure != nil {
+			f.PressureOut = ref(int(math.Round(*cylinder.EndPressure)))
+		}
+		f.GasMixNotes = cmp.Or(dive.GasMixNotes, cylinder.Description)
+		if len(dive.Cylinders) > 1 && dive.GasMixNotes == "" {
+			gases := make([]string, len(dive.Cylinders))
+			for i, c := range dive.Cylinders {
+				gases[i] = c.GasLabel()
+			}
+			f.GasMixNotes = strings.TrimSpace(f.GasMixNotes + "\nGases: " + strings.Join(gases, ", "))
+		}
+		if id, ok := lookupID(lookups.gasMixes, cylinder.GasMixName()); ok {
+			f.GasMixID = id
+		}
+
+		if opts.KeepNumbers && dive.Number > 0 {
+			f.Number = dive.Number
+		} else {
+			f.Number = nextNumber
+			nextNumber++
+		}
+
+		siteKey := ""
+		if dive.Site != nil && (dive.Site.Name != "" || dive.Site.HasPosition()) {
+			if ds := matchDiveSite(*dive.Site, diveSites); ds != nil {
+				f.DiveSiteID = ds.ID
+				item.SiteName = ds.Name
+				siteKey = fmt.Sprintf("id:%d", ds.ID)
+			} else {
+				if dive.Site.Name == "" {
+					nameUnnamedSite(dive.Site, preview.NewSites)
+				}
+
+				item.SiteName = dive.Site.Name
+				siteKey = dive.Site.Key()
+				item.NewSite = true
+				if _, ok := preview.NewSites[siteKey]; !ok {
+					preview.NewSites[siteKey] = *dive.Site
+				}
+			}
+		}
+
+		if buddyName := dive.Buddy(); buddyName != "" {
+			item.BuddyName = buddyName
+			for _, bu := range buddies {
+				if strings.EqualFold(strings.TrimSpace(bu.Name), buddyName) {
+					f.BuddyID = &bu.ID
+					item.BuddyName = bu.Name
+					break
+				}
+			}
+
+			if f.BuddyID == nil {
+				item.NewBuddy = true
+				preview.NewBuddies[strings.ToLower(buddyName)] = buddyName
+			}
+		}
+
+		if dive.Trip != nil && dive.Trip.Name != "" {
+			item.TripName = dive.Trip.Name
+			for _, tr := range trips {
+				inTrip := !dive.DateTimeIn.Before(tr.StartDate) &&
+					dive.DateTimeIn.Before(tr.EndDate.Add(24*time.Hour))
+
+				if strings.EqualFold(strings.TrimSpace(tr.Name), dive.Trip.Name) && inTrip {
+					f.TripID = &tr.ID
+					item.TripName = tr.Name
+					break
+				}
+			}
+
+			if f.TripID == nil {
+				item.NewTrip = true
+				preview.NewTrips[dive.Trip.Key()] = *dive.Trip
+			}
+		}
+
+		// Skip any dives that appear more than once in the uploaded files, or
+		// that have already been logged. Dives at a new or unknown dive site are
+		// checked against the user's dives at every site.
+		diveKey := siteKey + "@" + dive.DateTimeIn.Format(time.DateTime)
+		if siteKey != "" && seenDives[diveKey] {
+			item.Duplicate = true
+		}
+		seenDives[diveKey] = true
+
+		if !item.Duplicate {
+			if f.DiveSiteID != 0 {
+				item.Duplicate, err = app.dives.ExistsAt(user.ID, f.DiveSiteID, dive.DateTimeIn)
+			} else {
+				item.Duplicate, err = app.dives.ExistsAtTime(user.ID, dive.DateTimeIn)
+			}
+			if err != nil {
+				return preview, err
+			}
+		}
+
+		if item.Duplicate {
+			preview.Dives = append(preview.Dives, item)
+			continue
+		}
+
+		err = app.validateDiveForm(f, user.ID)
+		if err != nil {
+			return preview, err
+		}
+
+		// Dive sites that will be created by the import do not exist yet and so
+		// will have failed the validation check.
+		if item.NewSite {
+			delete(f.FieldErrors, "dive_site_id")
+		}
+
+		numberExists, err := app.dives.NumberExists(user.ID, f.Number)
+		if err != nil {
+			return preview, err
+		}
+		f.CheckField(
+			!numberExists && !seenNumbers[f.Number],
+			"number",
+			"A dive has already been logged with this number",
+		)
+		seenNumbers[f.Number] = true
+
+		preview.Dives = append(preview.Dives, item)
+	}
+
+	app.validateImportRecords(&preview, opts)
+
+	return preview, nil
+}
+
+// validateImportRecords validates the dive sites, buddies and trips that will
+// be created by an import. Rather than failing the whole import, each dive that
+// refers to an invalid one is given an error so that it will be skipped.
+func (app *app) validateImportRecords(preview *importPreview, opts *importForm) {
+	preview.sites = map[string]diveSiteForm{}
+	siteErrors := map[string]string{}
+	for key, site := range preview.NewSites {
+		siteForm := newImportSiteForm(site, opts, preview.lookups)
+		siteForm.Validate()
+		siteForm.CheckField(siteForm.TimeZone.String() != "", "timezone", "Select a valid time zone")
+		if !siteForm.Valid() {
+			siteErrors[key] = importRecordError("dive site", siteForm.Validator)
+		}
+		preview.sites[key] = siteForm
+	}
+
+	buddyErrors := map[string]string{}
+	for key, name := range preview.NewBuddies {
+		buddy := buddyForm{Name: name}
+		buddy.Validate()
+		if !buddy.Valid() {
+			buddyErrors[key] = importRecordError("buddy", buddy.Validator)
+		}
+	}
+
+	tripErrors := map[string]string{}
+	for key, dates := range importTripDates(preview.Dives, func(d importDive) bool { return !d.Duplicate }) {
+		trip := newImportTripForm(preview.NewTrips[key], dates)
+		trip.Validate()
+		if !trip.Valid() {
+			tripErrors[key] = importRecordError("trip", trip.Validator)
+		}
+	}
+
+	for i := range preview.Dives {
+		d := &preview.Dives[i]
+		if d.Duplicate {
+			continue
+		}
+
+		if d.NewSite {
+			if msg := siteErrors[d.Dive.Site.Key()]; msg != "" {
+				d.Form.AddFieldError("dive_site", msg)
+			}
+		}
+		if d.NewBuddy {
+			if msg := buddyErrors[strings.ToLower(d.BuddyName)]; msg != "" {
+				d.Form.AddFieldError("buddy", msg)
+			}
+		}
+		if d.NewTrip {
+			if msg := tripErrors[d.Dive.Trip.Key()]; msg != "" {
+				d.Form.AddFieldError("trip", msg)
+			}
+		}
+	}
+}
+
+// importRecordError returns a message for the user describing the first of the
+// errors in v for a new record of the given kind that an imported dive refers
+// to.
+func importRecordError(kind string, v validator.Validator) string {
+	if keys := slices.Sorted(maps.Keys(v.FieldErrors)); len(keys) > 0 {
+		return fmt.Sprintf("The new %s is not valid, %s: %s", kind, keys[0], v.FieldErrors[keys[0]])
+	}
+
+	if len(v.NonFieldErrors) > 0 {
+		return fmt.Sprintf("The new %s is not valid: %s", kind, v.NonFieldErrors[0])
+	}
+
+	return ""
+}
+
+// newImportSiteForm builds the form for a new dive site from an imported log
+// book, using the defaults from the import options for anything that the log
+// book does not say about the site.
+func newImportSiteForm(site logbook.Site, opts *importForm, lookups importLookups) diveSiteForm {
+	location := site.Location
+	if location == "" {
+		location = site.Name
+	}
+
+	siteForm := diveSiteForm{
+		Name:        site.Name,
+		AltName:     site.AltName,
+		Location:    location,
+		Region:      site.Region,
+		CountryID:   opts.CountryID,
+		TimeZone:    opts.TimeZone,
+		Latitude:    site.Latitude,
+		Longitude:   site.Longitude,
+		WaterBodyID: opts.WaterBodyID,
+		WaterTypeID: opts.WaterTypeID,
+		MaxDepth:    site.MaxDepth,
+		Notes:       site.Notes,
+		Rating:      site.Rating,
+	}
+	if site.Altitude != nil {
+		siteForm.Altitude = *site.Altitude
+	}
+
+	if id, ok := lookupID(lookups.countries, site.CountryCode); ok {
+		siteForm.CountryID = id
+	} else if id, ok := lookupID(lookups.countries, site.Country); ok {
+		siteForm.CountryID = id
+	}
+	if tz, err := models.NewTimeZone(site.TimeZone); site.TimeZone != "" && err == nil {
+		siteForm.TimeZone = tz
+	}
+	if id, ok := lookupID(lookups.waterBodies, site.WaterBody); ok {
+		siteForm.WaterBodyID = id
+	}
+	if id, ok := lookupID(lookups.waterTypes, site.WaterType); ok {
+		siteForm.WaterTypeID = id
+	}
+
+	return siteForm
+}
+
+// importTripDates returns the first and last dates of the dives in each new
+// trip, keyed by the trip, that an import will create, using only the dives
+// for which include returns true. The trip's own dates from the log book are
+// used as the starting point if it has them.
+func importTripDates(dives []importDive, include func(importDive) bool) map[string][2]time.Time {
+	tripDates := map[string][2]time.Time{}
+
+	for _, d := range dives {
+		if !d.NewTrip || !include(d) {
+			continue
+		}
+
+		key := d.Dive.Trip.Key()
+		dates, ok := tripDates[key]
+		if !ok {
+			dates = [2]time.Time{d.Dive.Trip.StartDate, d.Dive.Trip.EndDate}
+		}
+		if dates[0].IsZero() || d.Dive.DateTimeIn.Before(dates[0]) {
+			dates[0] = d.Dive.DateTimeIn
+		}
+		if dates[1].IsZero() || d.Dive.DateTimeIn.After(dates[1]) {
+			dates[1] = d.Dive.DateTimeIn
+		}
+		tripDates[key] = dates
+	}
+
+	return tripDates
+}
+
+// newImportTripForm builds the form for a new trip from an imported log book
+// that runs between the given dates. The dates are taken from the local times
+// of the dives rather than being truncated in UTC.
+func newImportTripForm(trip logbook.Trip, dates [2]time.Time) tripForm {
+	dateOf := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+
+	return tripForm{
+		Name:        trip.Name,
+		StartDate:   dateOf(dates[0]),
+		EndDate:     dateOf(dates[1]),
+		Description: trip.Description,
+		Rating:      trip.Rating,
+		Notes:       trip.Notes,
+	}
+}
+
+// commitImport creates the dive sites, buddies, trips and dives described in
+// the importPreview in a single transaction. Dives whose numbers have already
+// been logged are skipped rather than failing the whole import. The number of
+// dives imported is returned along with a message for each dive that could
+// not be.
+func (app *app) commitImport(
+	user *models.User,
+	preview importPreview,
+) (int, []string, error) {
+	batch := models.DiveImport{
+		Sites:   map[string]models.DiveSiteFields{},
+		Buddies: map[string]string{},
+		Trips:   map[string]models.TripFields{},
+	}
+
+	// Only create the dive sites, buddies and trips that are actually used by a
+	// dive that is going to be imported.
+	for _, d := range preview.Dives {
+		if !d.Importable() {
+			continue
+		}
+
+		if d.NewSite {
+			key := d.Dive.Site.Key()
+			site := preview.sites[key]
+			batch.Sites[key] = models.DiveSiteFields{
+				Name:        site.Name,
+				AltName:     site.AltName,
+				Location:    site.Location,
+				Region:      site.Region,
+				CountryID:   site.CountryID,
+				TimeZone:    site.TimeZone,
+				Latitude:    site.Latitude,
+				Longitude:   site.Longitude,
+				WaterBodyID: site.WaterBodyID,
+				WaterTypeID: site.WaterTypeID,
+				Altitude:    site.Altitude,
+				MaxDepth:    site.MaxDepth,
+				Notes:       site.Notes,
+				Rating:      site.Rating,
+			}
+		}
+
+		if d.NewBuddy {
+			key := strings.ToLower(d.BuddyName)
+			batch.Buddies[key] = preview.NewBuddies[key]
+		}
+	}
+
+	// The trips only span the dives that are going to be imported, which are
+	// within the dates that they were validated with.
+	for key, dates := range importTripDates(preview.Dives, importDive.Importable) {
+		trip := newImportTripForm(preview.NewTrips[key], dates)
+		batch.Trips[key] = models.TripFields{
+			Name:            trip.Name,
+			StartDate:       trip.StartDate,
+			EndDate:         trip.EndDate,
+			Description:     trip.Description,
+			Rating:          trip.Rating,
+			OperatorID:      trip.OperatorID,
+			PriceAmount:     trip.PriceAmount,
+			PriceCurrencyID: trip.CurrencyID,
+			Notes:           trip.Notes,
+		}
+	}
+
+	for _, d := range preview.Dives {
+		if !d.Importable() {
+			continue
+		}
+
+		item := models.ImportDive{Dive: d.Form.diveFields()}
+		if d.NewSite {
+			item.SiteKey = d.Dive.Site.Key()
+		}
+		if d.NewBuddy {
+			item.BuddyKey = strings.ToLower(d.BuddyName)
+		}
+		if d.NewTrip {
+			item.TripKey = d.Dive.Trip.Key()
+		}
+		batch.Dives = append(batch.Dives, item)
+	}
+
+	ids, duplicates, err := app.dives.Import(user.ID, batch)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var failures []string
+	for _, i := range duplicates {
+		dive := batch.Dives[i].Dive
+		msg := "Dive #%d on %s: a dive has already been logged with this number"
+		failures = append(failures, fmt.Sprintf(msg, dive.Number, dive.DateTimeIn.Format(time.DateTime)))
+	}
+
+	return len(ids), failures, nil
+}
+
+func (app *app) importGET(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.addStaticdataToDiveForm(r, &data)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to load dive form static data: %w", err))
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	data.Form = importForm{
+		Format:      "subsurface",
+		KeepNumbers: true,
+		Activity:    "Fun Dive",
+		TankVolume:  11.0,
+		CountryID:   user.DefaultDivingCountryID,
+		TimeZone:    user.DefaultDivingTZ,
+		WaterBodyID: 1,
+		WaterTypeID: 1,
+	}
+
+	app.render(w, r, http.StatusOK, "import/form.tmpl", data)
+}
+
+// importPOST parses an uploaded log book and renders a dry-run preview of what
+// will be imported. The parsed dives are stored in the user's session so that
+// the import can be committed without uploading the file again.
+func (app *app) importPOST(w http.ResponseWriter, r *http.Request) {
+	form := &importForm{}
+	err := app.decodeMultipartForm(w, r, form, maxImportSize)
+	if err != nil {
+		app.log.Error("Error whilst decoding import form input", "error", err.Error())
+		app.clientError(w, multipartFormErrorStatus(err))
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.validateImportForm(form)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to validate import form: %w", err))
+		return
+	}
+
+	var dives []logbook.Dive
+
+	if form.Valid() {
+		var msg string
+		dives, msg = app.parseImportFiles(r, form.Format)
+		form.CheckField(msg == "", "file", msg)
+	}
+
+	if !form.Valid() {
+		err = app.addStaticdataToDiveForm(r, &data)
+		if err != nil {
+			app.serverError(w, r, fmt.Errorf("failed to load dive form static data: %w", err))
+			return
+		}
+
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "import/form.tmpl", data)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	preview, err := app.previewImport(user, dives, form)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to preview import: %w", err))
+		return
+	}
+
+	importData, err := json.Marshal(dives)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to encode imported dives: %w", err))
+		return
+	}
+
+	err = app.putPendingImport(r, models.PendingImportLogBook, importData)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
+	data.Import = &preview
+
+	app.render(w, r, http.StatusOK, "import/preview.tmpl", data)
+}
+
+// parseImportFiles parses each of the files uploaded in the "file" field of a
+// multipart form using the parser for the given format. If any of the files
+// cannot be parsed, then a message suitable for displaying to the user is
+// returned instead.
+func (app *app) parseImportFiles(r *http.Request, format string) ([]logbook.Dive, string) {
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		return nil, "Select a log book file to import"
+	}
+
+	var dives []logbook.Dive
+
+	for _, fh := range files {
+		file, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Sprintf("The file %s could not be read", fh.Filename)
+		}
+
+		fileDives, err := importParsers[format](file)
+		file.Close()
+		if err != nil {
+			app.log.Info("Failed to parse imported log book", "file", fh.Filename, "error", err.Error())
+			return nil, fmt.Sprintf("The file %s is not a valid %s log book", fh.Filename, format)
+		}
+
+		dives = append(dives, fileDives...)
+	}
+
+	return dives, ""
+}
+
+func (app *app) importCommitPOST(w http.ResponseWriter, r *http.Request) {
+	form := &importForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding import form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.validateImportForm(form)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to validate import form: %w", err))
+		return
+	}
+
+	importData, err := app.getPendingImport(r, models.PendingImportLogBook)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, fmt.Errorf("failed to fetch pending import: %w", err))
+		return
+	}
+
+	if err != nil || !form.Valid() {
+		msg := "Your import has expired or is invalid, please upload the file again."
+		app.sessionManager.Put(r.Context(), "flashError", msg)
+		http.Redirect(w, r, "/log-book/import", http.StatusSeeOther)
+		return
+	}
+
+	var dives []logbook.Dive
+	err = json.Unmarshal(importData, &dives)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to decode imported dives: %w", err))
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	preview, err := app.previewImport(user, dives, form)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to preview import: %w", err))
+		return
+	}
+
+	imported, failures, err := app.commitImport(user, preview)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to commit import: %w", err))
+		return
+	}
+
+	err = app.removePendingImport(r, models.PendingImportLogBook)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	msg := fmt.Sprintf(
+		"%d dive(s) imported successfully, %d duplicate(s) skipped.",
+		imported,
+		preview.DuplicateCount(),
+	)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+
+	skipped := preview.InvalidCount() + len(failures)
+	if skipped > 0 {
+		msg := fmt.Sprintf("%d dive(s) could not be imported.", skipped)
+		if len(failures) > 0 {
+			msg = fmt.Sprintf("%s %s.", msg, strings.Join(failures, "; "))
+		}
+		app.sessionManager.Put(r.Context(), "flashWarning", msg)
+	}
+
+	http.Redirect(w, r, "/log-book/dive/", http.StatusSeeOther)
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/m5lapp/divesite-monolith/internal/logbook"
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// csvImportFormat is the importForm.Format of a CSV import. CSV files are not
+// listed in importParsers as they can only be parsed once their columns have
+// been mapped.
+const csvImportFormat = "csv"
+
+// csvSampleRows is the number of rows of an uploaded CSV file that are shown
+// alongside each column when choosing the mapping.
+const csvSampleRows = 3
+
+// csvUploadForm is the first step of a CSV import, which just uploads the file.
+type csvUploadForm struct {
+	validator.Validator `form:"-"`
+}
+
+// csvImportForm holds the mapping of each column of an uploaded CSV file onto a
+// dive field along with the units and date format its values are written in.
+// If SaveAs is set, then the mapping is saved under that name so that it can be
+// used again for the next file from the same source.
+type csvImportForm struct {
+	importForm
+	MappingID    int      `form:"mapping_id"`
+	Columns      []string `form:"columns"`
+	DateFormat   string   `form:"date_format"`
+	DepthUnit    string   `form:"depth_unit"`
+	TempUnit     string   `form:"temp_unit"`
+	PressureUnit string   `form:"pressure_unit"`
+	WeightUnit   string   `form:"weight_unit"`
+	DurationUnit string   `form:"duration_unit"`
+	SaveAs       string   `form:"save_as"`
+}
+
+// mapping returns the logbook.CSVMapping described by the form.
+func (f *csvImportForm) mapping() logbook.CSVMapping {
+	return logbook.CSVMapping{
+		Columns:      f.Columns,
+		DateFormat:   f.DateFormat,
+		DepthUnit:    f.DepthUnit,
+		TempUnit:     f.TempUnit,
+		PressureUnit: f.PressureUnit,
+		WeightUnit:   f.WeightUnit,
+		DurationUnit: f.DurationUnit,
+	}
+}
+
+// applySavedMapping sets the form's column mapping, units and date format from
+// a saved mapping, matching the columns by their headings.
+func (f *csvImportForm) applySavedMapping(m models.CSVMapping, headers []string) {
+	f.MappingID = m.ID
+	f.Columns = make([]string, len(headers))
+	for i, header := range headers {
+		f.Columns[i] = m.FieldFor(header)
+	}
+
+	f.DateFormat = m.DateFormat
+	f.DepthUnit = m.DepthUnit
+	f.TempUnit = m.TempUnit
+	f.PressureUnit = m.PressureUnit
+	f.WeightUnit = m.WeightUnit
+	f.DurationUnit = m.DurationUnit
+	f.SaveAs = m.Name
+}
+
+func (app *app) validateCSVImportForm(f *csvImportForm, headers []string) error {
+	err := app.validateImportDiveDefaults(&f.importForm)
+	if err != nil {
+		return err
+	}
+
+	// Any missing columns are ignored and any extra ones are not in the file.
+	f.Columns = append(f.Columns, make([]string, max(0, len(headers)-len(f.Columns)))...)
+	f.Columns = f.Columns[:len(headers)]
+
+	mapped := map[string]bool{}
+	for i, key := range f.Columns {
+		if key == "" {
+			continue
+		}
+
+		valid := slices.ContainsFunc(logbook.CSVFields, func(field logbook.CSVField) bool {
+			return field.Key == key
+		})
+		if !valid {
+			f.AddFieldError("columns", fmt.Sprintf("Column %q is mapped onto an unknown field", headers[i]))
+			continue
+		}
+
+		if mapped[key] {
+			f.AddFieldError("columns", fmt.Sprintf("More than one column is mapped onto %s", key))
+		}
+		mapped[key] = true
+	}
+
+	f.CheckField(mapped["dive_site"], "columns", "A column must be mapped onto the dive site")
+	f.CheckField(
+		mapped["date_time_in"] || mapped["date"],
+		"columns",
+		"A column must be mapped onto either the date & time in or the date",
+	)
+	f.CheckField(
+		!(mapped["date_time_in"] && mapped["date"]),
+		"columns",
+		"Map a column onto either the date & time in or the date, not both",
+	)
+
+	validFormat := slices.ContainsFunc(logbook.CSVDateFormats, func(df logbook.CSVDateFormat) bool {
+		return df.Layout == f.DateFormat
+	})
+	f.CheckField(validFormat, "date_format", "Select a valid date format")
+
+	f.CheckField(
+		validator.PermittedValue(f.DepthUnit, logbook.DepthMetres, logbook.DepthFeet),
+		"depth_unit",
+		"Select a valid depth unit",
+	)
+	f.CheckField(
+		validator.PermittedValue(f.TempUnit, logbook.TempCelsius, logbook.TempFahrenheit),
+		"temp_unit",
+		"Select a valid temperature unit",
+	)
+	f.CheckField(
+		validator.PermittedValue(f.PressureUnit, logbook.PressureBar, logbook.PressurePSI),
+		"pressure_unit",
+		"Select a valid pressure unit",
+	)
+	f.CheckField(
+		validator.PermittedValue(f.WeightUnit, logbook.WeightKilograms, logbook.WeightPounds),
+		"weight_unit",
+		"Select a valid weight unit",
+	)
+	f.CheckField(
+		validator.PermittedValue(
+			f.DurationUnit,
+			logbook.DurationMinutes,
+			logbook.DurationSeconds,
+			logbook.DurationMinsSecs,
+			logbook.DurationHoursMins,
+		),
+		"duration_unit",
+		"Select a valid duration unit",
+	)
+
+	f.SaveAs = strings.TrimSpace(f.SaveAs)
+	f.CheckField(
+		validator.MaxChars(f.SaveAs, 256),
+		"save_as",
+		"This field cannot be more than 256 characters long",
+	)
+
+	return nil
+}
+
+// csvImportColumns describes the columns of an uploaded CSV file for the
+// mapping step of a CSV import. Samples holds the first few values of each
+// column, by column index.
+type csvImportColumns struct {
+	Headers     []string
+	Samples     [][]string
+	Fields      []logbook.CSVField
+	DateFormats []logbook.CSVDateFormat
+	Mappings    []models.CSVMapping
+}
+
+// readCSVImportFile returns the contents of the CSV file uploaded earlier in
+// the import along with its column headings. models.ErrNoRecord is returned if
+// there is no CSV import in progress or the file can no longer be read.
+func (app *app) readCSVImportFile(r *http.Request) ([]byte, []string, [][]string, error) {
+	data, err := app.getPendingImport(r, models.PendingImportCSV)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, nil, nil, err
+		}
+		return nil, nil, nil, fmt.Errorf("failed to fetch pending csv import: %w", err)
+	}
+
+	headers, rows, err := logbook.ReadCSVHeader(bytes.NewReader(data), csvSampleRows)
+	if err != nil {
+		return nil, nil, nil, models.ErrNoRecord
+	}
+
+	return data, headers, rows, nil
+}
+
+// csvImportExpired sends the user back to the start of a CSV import when the
+// uploaded file has expired or cannot be read. Any other error is treated as a
+// server error.
+func (app *app) csvImportExpired(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	msg := "Your import has expired or is invalid, please upload the file again."
+	app.sessionManager.Put(r.Context(), "flashError", msg)
+	http.Redirect(w, r, "/log-book/import/csv", http.StatusSeeOther)
+}
+
+// previewCSVImport previews the import of the rows of a CSV file in the same
+// way as for any other log book. As a CSV file only names the dive site, buddy
+// and trip of each dive, they must match ones that the user already has, so
+// any that do not are reported as errors rather than being created. Any values
+// that could not be read from the file are also reported against each dive.
+func (app *app) previewCSVImport(
+	user *models.User,
+	rows []logbook.CSVRow,
+	opts *importForm,
+) (importPreview, error) {
+	dives := make([]logbook.Dive, len(rows))
+	for i, row := range rows {
+		dives[i] = row.Dive
+	}
+
+	preview, err := app.previewImport(user, dives, opts)
+	if err != nil {
+		return preview, err
+	}
+	preview.CommitURL = "/log-book/import/csv/commit"
+
+	for i := range preview.Dives {
+		item := &preview.Dives[i]
+		item.Line = rows[i].Line
+
+		if item.Duplicate {
+			continue
+		}
+
+		// Replace any validation errors caused by values that could not be read
+		// with the reason why they could not be read.
+		for key, msg := range rows[i].Errors {
+			delete(item.Form.FieldErrors, key)
+			item.Form.AddFieldError(key, msg)
+		}
+
+		// These replace any errors from validating the records that a log book
+		// import would have created for them.
+		if item.NewSite {
+			msg := fmt.Sprintf("You have not logged a dive site called %q", item.SiteName)
+			delete(item.Form.FieldErrors, "dive_site")
+			item.Form.AddFieldError("dive_site", msg)
+		}
+		if item.NewBuddy {
+			msg := fmt.Sprintf("You do not have a buddy called %q", item.BuddyName)
+			delete(item.Form.FieldErrors, "buddy")
+			item.Form.AddFieldError("buddy", msg)
+		}
+		if item.NewTrip {
+			msg := fmt.Sprintf("You do not have a trip called %q on this date", item.TripName)
+			delete(item.Form.FieldErrors, "trip")
+			item.Form.AddFieldError("trip", msg)
+		}
+	}
+
+	preview.NewSites = nil
+	preview.NewBuddies = nil
+	preview.NewTrips = nil
+
+	return preview, nil
+}
+
+func (app *app) importCSVGET(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = csvUploadForm{}
+	app.render(w, r, http.StatusOK, "import/csv_upload.tmpl", data)
+}
+
+// importCSVPOST checks that an uploaded CSV file can be read and then stores
+// it in the user's session for the following steps of the import.
+func (app *app) importCSVPOST(w http.ResponseWriter, r *http.Request) {
+	form := &csvUploadForm{}
+	err := app.decodeMultipartForm(w, r, form, maxImportSize)
+	if err != nil {
+		app.log.Error("Error whilst decoding CSV import form input", "error", err.Error())
+		app.clientError(w, multipartFormErrorStatus(err))
+		return
+	}
+
+	var contents []byte
+
+	file, fh, err := r.FormFile("file")
+	if err != nil {
+		form.AddFieldError("file", "Select a CSV file to import")
+	} else {
+		defer file.Close()
+
+		contents, err = io.ReadAll(file)
+		if err != nil {
+			form.AddFieldError("file", fmt.Sprintf("The file %s could not be read", fh.Filename))
+		} else if _, _, err = logbook.ReadCSVHeader(bytes.NewReader(contents), 1); err != nil {
+			app.log.Info("Failed to parse imported CSV file", "file", fh.Filename, "error", err.Error())
+			form.AddFieldError("file", fmt.Sprintf("The file %s is not a valid CSV file", fh.Filename))
+		}
+	}
+
+	if !form.Valid() {
+		data, err := app.newTemplateData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "import/csv_upload.tmpl", data)
+		return
+	}
+
+	err = app.putPendingImport(r, models.PendingImportCSV, contents)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/log-book/import/csv/mapping", http.StatusSeeOther)
+}
+
+// importCSVMappingGET shows the columns of the uploaded CSV file so that each
+// one can be mapped onto a dive field. The initial mapping is either the saved
+// mapping given by the mapping_id query string parameter, a saved mapping with
+// exactly the same column headings as the file or a guess based on the column
+// headings.
+func (app *app) importCSVMappingGET(w http.ResponseWriter, r *http.Request) {
+	_, headers, rows, err := app.readCSVImportFile(r)
+	if err != nil {
+		app.csvImportExpired(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	mappings, err := app.csvMappings.ListAll(user.ID)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to fetch saved csv mappings: %w", err))
+		return
+	}
+
+	form := &csvImportForm{
+		importForm: importForm{
+			Format:      csvImportFormat,
+			KeepNumbers: true,
+			Activity:    "Fun Dive",
+			TankVolume:  11.0,
+		},
+		Columns:      logbook.GuessCSVMapping(headers),
+		DateFormat:   logbook.CSVDateFormats[0].Layout,
+		DepthUnit:    logbook.DepthMetres,
+		TempUnit:     logbook.TempCelsius,
+		PressureUnit: logbook.PressureBar,
+		WeightUnit:   logbook.WeightKilograms,
+		DurationUnit: logbook.DurationMinutes,
+	}
+
+	mappingID := app.readInt(r.URL.Query(), "mapping_id", 0)
+	for _, m := range mappings {
+		sameHeaders := slices.EqualFunc(m.Headers, headers, strings.EqualFold)
+		if m.ID == mappingID || (mappingID == 0 && sameHeaders) {
+			form.applySavedMapping(m, headers)
+			break
+		}
+	}
+
+	app.renderCSVMapping(w, r, http.StatusOK, form, headers, rows, mappings)
+}
+
+func (app *app) renderCSVMapping(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	form *csvImportForm,
+	headers []string,
+	rows [][]string,
+	mappings []models.CSVMapping,
+) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.addStaticdataToDiveForm(r, &data)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to load dive form static data: %w", err))
+		return
+	}
+
+	samples := make([][]string, len(headers))
+	for _, row := range rows {
+		for i := range headers {
+			if i < len(row) && strings.TrimSpace(row[i]) != "" {
+				samples[i] = append(samples[i], row[i])
+			}
+		}
+	}
+
+	data.Form = form
+	data.CSVImport = &csvImportColumns{
+		Headers:     headers,
+		Samples:     samples,
+		Fields:      logbook.CSVFields,
+		DateFormats: logbook.CSVDateFormats,
+		Mappings:    mappings,
+	}
+
+	app.render(w, r, status, "import/csv_mapping.tmpl", data)
+}
+
+// importCSVPreviewPOST parses the uploaded CSV file using the chosen mapping
+// and renders a dry-run preview of the import. The mapping is stored in the
+// user's session so that the import can be committed without choosing it again.
+func (app *app) importCSVPreviewPOST(w http.ResponseWriter, r *http.Request) {
+	form := &csvImportForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding CSV import form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.Format = csvImportFormat
+
+	contents, headers, rows, err := app.readCSVImportFile(r)
+	if err != nil {
+		app.csvImportExpired(w, r, err)
+		return
+	}
+
+	err = app.validateCSVImportForm(form, headers)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to validate csv import form: %w", err))
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if !form.Valid() {
+		mappings, err := app.csvMappings.ListAll(user.ID)
+		if err != nil {
+			app.serverError(w, r, fmt.Errorf("failed to fetch saved csv mappings: %w", err))
+			return
+		}
+
+		app.renderCSVMapping(w, r, http.StatusUnprocessableEntity, form, headers, rows, mappings)
+		return
+	}
+
+	if form.SaveAs != "" {
+		form.MappingID, err = app.csvMappings.Upsert(
+			user.ID,
+			form.SaveAs,
+			headers,
+			form.Columns,
+			form.DateFormat,
+			form.DepthUnit,
+			form.TempUnit,
+			form.PressureUnit,
+			form.WeightUnit,
+			form.DurationUnit,
+		)
+		if err != nil {
+			app.serverError(w, r, fmt.Errorf("failed to save csv mapping: %w", err))
+			return
+		}
+	}
+
+	csvRows, err := logbook.ParseCSV(bytes.NewReader(contents), form.mapping())
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to parse csv import: %w", err))
+		return
+	}
+
+	preview, err := app.previewCSVImport(user, csvRows, &form.importForm)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to preview csv import: %w", err))
+		return
+	}
+
+	mapping, err := json.Marshal(form.mapping())
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to encode csv mapping: %w", err))
+		return
+	}
+	app.sessionManager.Put(r.Context(), "csvImportMapping", mapping)
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = &form.importForm
+	data.Import = &preview
+
+	app.render(w, r, http.StatusOK, "import/preview.tmpl", data)
+}
+
+// importCSVCommitPOST imports every valid dive from the uploaded CSV file in a
+// single transaction, so that if any dive cannot be inserted, then none are.
+func (app *app) importCSVCommitPOST(w http.ResponseWriter, r *http.Request) {
+	form := &importForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding CSV import form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.Format = csvImportFormat
+
+	err = app.validateImportDiveDefaults(form)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to validate import form: %w", err))
+		return
+	}
+
+	contents, _, _, err := app.readCSVImportFile(r)
+	if err != nil {
+		app.csvImportExpired(w, r, err)
+		return
+	}
+
+	mappingData, hasMapping := app.sessionManager.Get(r.Context(), "csvImportMapping").([]byte)
+	if !hasMapping || !form.Valid() {
+		app.csvImportExpired(w, r, models.ErrNoRecord)
+		return
+	}
+
+	var mapping logbook.CSVMapping
+	err = json.Unmarshal(mappingData, &mapping)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to decode csv mapping: %w", err))
+		return
+	}
+
+	rows, err := logbook.ParseCSV(bytes.NewReader(contents), mapping)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to parse csv import: %w", err))
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	preview, err := app.previewCSVImport(user, rows, form)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to preview csv import: %w", err))
+		return
+	}
+
+	var dives []models.DiveFields
+	for _, d := range preview.Dives {
+		if d.Importable() {
+			dives = append(dives, d.Form.diveFields())
+		}
+	}
+
+	if len(dives) > 0 {
+		_, err = app.dives.InsertMany(user.ID, dives)
+		if err != nil {
+			if errors.Is(err, models.ErrDuplicateDiveNumber) {
+				msg := "No dives were imported as one of their numbers has already been logged, " +
+					"please check the file and try again."
+				app.sessionManager.Put(r.Context(), "flashError", msg)
+				http.Redirect(w, r, "/log-book/import/csv/mapping", http.StatusSeeOther)
+				return
+			}
+
+			app.serverError(w, r, fmt.Errorf("failed to commit csv import: %w", err))
+			return
+		}
+	}
+
+	err = app.removePendingImport(r, models.PendingImportCSV)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "csvImportMapping")
+
+	msg := fmt.Sprintf(
+		"%d dive(s) imported successfully, %d duplicate(s) skipped.",
+		len(dives),
+		preview.DuplicateCount(),
+	)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+
+	if skipped := preview.InvalidCount(); skipped > 0 {
+		msg := fmt.Sprintf("%d row(s) had errors and could not be imported.", skipped)
+		app.sessionManager.Put(r.Context(), "flashWarning", msg)
+	}
+
+	http.Redirect(w, r, "/log-book/dive/", http.StatusSeeOther)
+}
+
+// importCSVMappingDeletePOST deletes one of the user's saved CSV mappings and
+// returns to the mapping step of the import.
+func (app *app) importCSVMappingDeletePOST(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.csvMappings.Delete(user.ID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flashSuccess", "Saved mapping deleted.")
+	http.Redirect(w, r, "/log-book/import/csv/mapping", http.StatusSeeOther)
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/m5lapp/divesite-monolith/internal/logbook"
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// siteSuggestDistance is the distance in metres within which the country and
+// time zone of an existing dive site are suggested for an imported one.
+const siteSuggestDistance = 50_000.0
+
+// siteImportParsers maps each of the supported dive site file formats to the
+// function that parses it.
+var siteImportParsers = map[string]func(io.Reader) ([]logbook.Site, error){
+	"gpx":     logbook.ParseGPXSites,
+	"kml":     logbook.ParseKMLSites,
+	"geojson": logbook.ParseGeoJSONSites,
+}
+
+// siteImportForm holds the options for a dive site import. The country and time
+// zone are only used for sites whose position does not suggest them, while the
+// water body and type apply to every site that the file does not give them for.
+// Sites holds the choices made for each site on the preview page.
+type siteImportForm struct {
+	Format              string          `form:"format"`
+	DuplicateDistance   float64         `form:"duplicate_distance"`
+	CountryID           int             `form:"country_id"`
+	TimeZone            models.TimeZone `form:"timezone"`
+	WaterBodyID         int             `form:"water_body_id"`
+	WaterTypeID         int             `form:"water_type_id"`
+	Sites               []siteImportRow `form:"sites"`
+	validator.Validator `form:"-"`
+}
+
+// siteImportRow holds whether a single imported dive site should be created and
+// any changes to its suggested country and time zone.
+type siteImportRow struct {
+	Import    bool   `form:"import"`
+	CountryID int    `form:"country_id"`
+	TimeZone  string `form:"timezone"`
+}
+
+func (f *siteImportForm) Validate() {
+	_, ok := siteImportParsers[f.Format]
+	f.CheckField(ok, "format", "Select a valid file format")
+
+	f.CheckField(
+		validator.NumBetween(f.DuplicateDistance, 1.0, 10_000.0),
+		"duplicate_distance",
+		"This field must be between 1 and 10,000 metres inclusive",
+	)
+
+	f.CheckField(f.CountryID > 0, "country_id", "Select a valid country")
+	f.CheckField(f.WaterBodyID > 0, "water_body_id", "Select a valid water body")
+	f.CheckField(f.WaterTypeID > 0, "water_type_id", "Select a valid water type")
+}
+
+// importSite is a single dive site read from an imported file. Form holds the
+// dive site that will be created from it and Source describes where its
+// country and time zone came from. DuplicateOf names the existing dive site, or
+// earlier site in the same file, that it is within the duplicate distance of.
+type importSite struct {
+	Site        logbook.Site
+	Form        diveSiteForm
+	Source      string
+	DuplicateOf string
+	Distance    float64
+	Selected    bool
+}
+
+// siteImportPreview is the result of a dry-run of a dive site import.
+type siteImportPreview struct {
+	Sites []importSite
+}
+
+func (p siteImportPreview) ImportCount() int {
+	count := 0
+	for _, s := range p.Sites {
+		if s.Selected && s.Form.Valid() {
+			count++
+		}
+	}
+	return count
+}
+
+func (p siteImportPreview) DuplicateCount() int {
+	count := 0
+	for _, s := range p.Sites {
+		if s.DuplicateOf != "" {
+			count++
+		}
+	}
+	return count
+}
+
+func (p siteImportPreview) InvalidCount() int {
+	count := 0
+	for _, s := range p.Sites {
+		if !s.Form.Valid() {
+			count++
+		}
+	}
+	return count
+}
+
+// suggestSiteLocation fills in the country and time zone of the dive site form
+// for an imported site. Each is taken from the first of these that gives one:
+// the imported file itself, the nearest existing dive site within
+// siteSuggestDistance metres, the nearest time zone in the time zone database,
+// and finally the defaults in the import options. A description of the source
+// of the suggestion is returned.
+func suggestSiteLocation(
+	form *diveSiteForm,
+	site logbook.Site,
+	diveSites []models.DiveSite,
+	lookups importLookups,
+) string {
+	countryID := 0
+	var tz *models.TimeZone
+	source := ""
+
+	if id, ok := lookupID(lookups.countries, site.CountryCode); ok {
+		countryID = id
+	} else if id, ok := lookupID(lookups.countries, site.Country); ok {
+		countryID = id
+	}
+	if t, err := models.NewTimeZone(site.TimeZone); site.TimeZone != "" && err == nil {
+		tz = &t
+	}
+	if countryID != 0 || tz != nil {
+		source = "File"
+	}
+
+	if (countryID == 0 || tz == nil) && site.HasPosition() {
+		nearest := nearestDiveSite(site, diveSites, siteSuggestDistance)
+		if nearest != nil {
+			if countryID == 0 {
+				countryID = nearest.Country.ID
+			}
+			if tz == nil {
+				tz = &nearest.TimeZone
+			}
+			source = cmp.Or(source, "Near "+nearest.Name)
+		}
+	}
+
+	if (countryID == 0 || tz == nil) && site.HasPosition() {
+		if zone, ok := logbook.NearestZone(*site.Latitude, *site.Longitude); ok {
+			if id, ok := lookupID(lookups.countries, zone.CountryCode); ok && countryID == 0 {
+				countryID = id
+			}
+			if t, err := models.NewTimeZone(zone.TimeZone); err == nil && tz == nil {
+				tz = &t
+			}
+			source = cmp.Or(source, "Time zone database")
+		}
+	}
+
+	if countryID != 0 {
+		form.CountryID = countryID
+	}
+	if tz != nil {
+		form.TimeZone = *tz
+	}
+
+	return source
+}
+
+// previewSiteImport maps each of the imported sites onto a diveSiteForm,
+// suggesting their country and time zone and flagging any that are within the
+// duplicate distance of an existing dive site or an earlier site in the file.
+// The forms are validated using the same rules as a manually added dive site.
+// Sites are selected for import unless they are likely duplicates or are
+// invalid, or the choices already made on the preview page say otherwise.
+func (app *app) previewSiteImport(
+	user *models.User,
+	sites []logbook.Site,
+	opts *siteImportForm,
+) (siteImportPreview, error) {
+	lookups, err := app.newImportLookups(user.ID)
+	if err != nil {
+		return siteImportPreview{}, err
+	}
+
+	diveSites, err := app.diveSites.ListAll(user.ID)
+	if err != nil {
+		return siteImportPreview{}, fmt.Errorf("could not fetch dive site list: %w", err)
+	}
+
+	preview := siteImportPreview{Sites: make([]importSite, 0, len(sites))}
+
+	for i, site := range sites {
+		if site.Name == "" {
+			nameUnnamedSite(&site, nil)
+		}
+
+		is := importSite{
+			Site: site,
+			Form: diveSiteForm{
+				Name:        site.Name,
+				AltName:     site.AltName,
+				Location:    cmp.Or(site.Location, site.Name),
+				Region:      site.Region,
+				CountryID:   opts.CountryID,
+				TimeZone:    opts.TimeZone,
+				Latitude:    site.Latitude,
+				Longitude:   site.Longitude,
+				WaterBodyID: opts.WaterBodyID,
+				WaterTypeID: opts.WaterTypeID,
+				MaxDepth:    site.MaxDepth,
+				Notes:       site.Notes,
+				Rating:      site.Rating,
+			},
+		}
+		if site.Altitude != nil {
+			is.Form.Altitude = *site.Altitude
+		}
+		if id, ok := lookupID(lookups.waterBodies, site.WaterBody); ok {
+			is.Form.WaterBodyID = id
+		}
+		if id, ok := lookupID(lookups.waterTypes, site.WaterType); ok {
+			is.Form.WaterTypeID = id
+		}
+
+		is.Source = suggestSiteLocation(&is.Form, site, diveSites, lookups)
+
+		if match := nearestDiveSite(site, diveSites, opts.DuplicateDistance); match != nil {
+			is.DuplicateOf = match.Name
+			is.Distance = logbook.Distance(
+				*site.Latitude, *site.Longitude, *match.Latitude, *match.Longitude,
+			)
+		} else {
+			for _, prev := range preview.Sites {
+				distance := logbook.Distance(
+					*site.Latitude, *site.Longitude, *prev.Site.Latitude, *prev.Site.Longitude,
+				)
+				if distance <= opts.DuplicateDistance {
+					is.DuplicateOf = prev.Site.Name + " (in this file)"
+					is.Distance = distance
+					break
+				}
+			}
+		}
+
+		is.Selected = is.DuplicateOf == ""
+
+		// Apply any choices that have already been made on the preview page.
+		if i < len(opts.Sites) {
+			row := opts.Sites[i]
+			is.Selected = row.Import
+
+			if row.CountryID > 0 {
+				is.Form.CountryID = row.CountryID
+				is.Source = "Chosen"
+			}
+			if row.TimeZone != "" {
+				tz, err := models.NewTimeZone(row.TimeZone)
+				if err != nil {
+					is.Form.AddFieldError("timezone", "Enter a valid time zone")
+				} else {
+					is.Form.TimeZone = tz
+					is.Source = "Chosen"
+				}
+			}
+		}
+
+		is.Form.Validate()
+
+		is.Form.CheckField(is.Form.CountryID > 0, "country", "Select a valid country")
+
+		if !is.Form.Valid() {
+			is.Selected = false
+		}
+
+		preview.Sites = append(preview.Sites, is)
+	}
+
+	return preview, nil
+}
+
+// nearestDiveSite returns the nearest of the dive sites within maxDistance
+// metres of the imported site, or nil if there are none.
+func nearestDiveSite(
+	site logbook.Site,
+	diveSites []models.DiveSite,
+	maxDistance float64,
+) *models.DiveSite {
+	var nearest *models.DiveSite
+	for i, ds := range diveSites {
+		if ds.Latitude == nil || ds.Longitude == nil {
+			continue
+		}
+
+		distance := logbook.Distance(*site.Latitude, *site.Longitude, *ds.Latitude, *ds.Longitude)
+		if distance <= maxDistance {
+			nearest = &diveSites[i]
+			maxDistance = distance
+		}
+	}
+
+	return nearest
+}
+
+func (app *app) importSitesGET(w http.ResponseWriter, r *http.Request) {
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	data.Form = siteImportForm{
+		Format:            "kml",
+		DuplicateDistance: siteMatchDistance,
+		CountryID:         user.DefaultDivingCountryID,
+		TimeZone:          user.DefaultDivingTZ,
+		WaterBodyID:       1,
+		WaterTypeID:       1,
+	}
+
+	app.render(w, r, http.StatusOK, "dive_site/import_form.tmpl", data)
+}
+
+// importSitesPOST parses the uploaded dive site files and renders a preview of
+// the sites that will be created. The parsed sites are stored in the user's
+// session so that the import can be committed without uploading the files
+// again.
+func (app *app) importSitesPOST(w http.ResponseWriter, r *http.Request) {
+	form := &siteImportForm{}
+	err := app.decodeMultipartForm(w, r, form, maxImportSize)
+	if err != nil {
+		app.log.Error("Error whilst decoding dive site import form input", "error", err.Error())
+		app.clientError(w, multipartFormErrorStatus(err))
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form.Validate()
+
+	var sites []logbook.Site
+
+	if form.Valid() {
+		var msg string
+		sites, msg = app.parseSiteImportFiles(r, form.Format)
+		form.CheckField(msg == "", "file", msg)
+	}
+
+	if !form.Valid() {
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "dive_site/import_form.tmpl", data)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	preview, err := app.previewSiteImport(user, sites, form)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to preview dive site import: %w", err))
+		return
+	}
+
+	importData, err := json.Marshal(sites)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to encode imported dive sites: %w", err))
+		return
+	}
+	app.sessionManager.Put(r.Context(), "siteImportData", importData)
+
+	data.Form = form
+	data.SiteImport = &preview
+
+	app.render(w, r, http.StatusOK, "dive_site/import_preview.tmpl", data)
+}
+
+// parseSiteImportFiles parses each of the files uploaded in the "file" field of
+// a multipart form using the parser for the given format. If any of the files
+// cannot be parsed, then a message suitable for displaying to the user is
+// returned instead.
+func (app *app) parseSiteImportFiles(r *http.Request, format string) ([]logbook.Site, string) {
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		return nil, "Select a file to import"
+	}
+
+	var sites []logbook.Site
+
+	for _, fh := range files {
+		file, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Sprintf("The file %s could not be read", fh.Filename)
+		}
+
+		fileSites, err := siteImportParsers[format](file)
+		file.Close()
+		if err != nil {
+			app.log.Info("Failed to parse imported dive sites", "file", fh.Filename, "error", err.Error())
+			return nil, fmt.Sprintf(
+				"The file %s is not a valid %s file or has no dive sites in it",
+				fh.Filename,
+				strings.ToUpper(format),
+			)
+		}
+
+		sites = append(sites, fileSites...)
+	}
+
+	return sites, ""
+}
+
+// importSitesCommitPOST creates the dive sites selected on the preview page. If
+// any of the choices made on the preview page are invalid, then the preview is
+// shown again with the errors.
+func (app *app) importSitesCommitPOST(w http.ResponseWriter, r *http.Request) {
+	form := &siteImportForm{}
+	err := app.decodePOSTForm(r, form)
+	if err != nil {
+		app.log.Error("Error whilst decoding dive site import form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Validate()
+
+	importData, ok := app.sessionManager.Get(r.Context(), "siteImportData").([]byte)
+	if !ok || !form.Valid() {
+		msg := "Your import has expired or is invalid, please upload the file again."
+		app.sessionManager.Put(r.Context(), "flashError", msg)
+		http.Redirect(w, r, "/log-book/dive-site/import", http.StatusSeeOther)
+		return
+	}
+
+	var sites []logbook.Site
+	err = json.Unmarshal(importData, &sites)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to decode imported dive sites: %w", err))
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	preview, err := app.previewSiteImport(user, sites, form)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to preview dive site import: %w", err))
+		return
+	}
+
+	// Show the preview again if any of the selected sites are invalid, such as
+	// when a time zone has been entered incorrectly.
+	for i, s := range preview.Sites {
+		if i < len(form.Sites) && form.Sites[i].Import && !s.Form.Valid() {
+			data, err := app.newTemplateData(r)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			data.Form = form
+			data.SiteImport = &preview
+			app.render(w, r, http.StatusUnprocessableEntity, "dive_site/import_preview.tmpl", data)
+			return
+		}
+	}
+
+	imported := 0
+	for _, s := range preview.Sites {
+		if !s.Selected {
+			continue
+		}
+
+		f := s.Form
+		_, err := app.diveSites.Insert(
+			user.ID,
+			f.Name,
+			f.AltName,
+			f.Location,
+			f.Region,
+			f.CountryID,
+			f.TimeZone,
+			f.Latitude,
+			f.Longitude,
+			f.WaterBodyID,
+			f.WaterTypeID,
+			f.Altitude,
+			f.MaxDepth,
+			f.Notes,
+			f.Rating,
+		)
+		if err != nil {
+			app.serverError(w, r, fmt.Errorf("failed to insert dive site %q: %w", f.Name, err))
+			return
+		}
+
+		imported++
+	}
+
+	app.sessionManager.Remove(r.Context(), "siteImportData")
+
+	msg := fmt.Sprintf(
+		"%d dive site(s) imported successfully, %d skipped.",
+		imported,
+		len(preview.Sites)-imported,
+	)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+	http.Redirect(w, r, "/log-book/dive-site/", http.StatusSeeOther)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/storage"
 
 	_ "github.com/lib/pq"
 )
@@ -27,9 +28,11 @@ type config struct {
 		maxConnIdleTime time.Duration
 		timeouts        models.QueryTimeouts
 	}
-	termPeriod time.Duration
-	tlsCert    string
-	tlsKey     string
+	storageDir     string
+	termPeriod     time.Duration
+	tlsCert        string
+	tlsKey         string
+	trashRetention time.Duration
 }
 
 func (c config) validate(logger *slog.Logger) {
@@ -42,6 +45,24 @@ func (c config) validate(logger *slog.Logger) {
 		os.Exit(1)
 	}
 
+	if c.storageDir == "" {
+		logger.Error(
+			"A directory must be given in which to store uploaded files",
+			"--storage-dir",
+			c.storageDir,
+		)
+		os.Exit(1)
+	}
+
+	if c.trashRetention < 1*time.Hour {
+		logger.Error(
+			"The trash retention period must be at least 1 hour",
+			"--trash-retention",
+			c.trashRetention.String(),
+		)
+		os.Exit(1)
+	}
+
 	if (c.tlsCert == "" && c.tlsKey != "") || (c.tlsCert != "" && c.tlsKey == "") {
 		logger.Error(
 			"The --tls-cert and --tls-key flags are mutually inclusive and must both be provided to use TLS",
@@ -56,12 +77,14 @@ func (c config) validate(logger *slog.Logger) {
 
 type app struct {
 	agencies           models.AgencyModelInterface
+	apiTokens          models.APITokenModelInterface
 	agencyCourses      models.AgencyCourseModelInterface
 	buddies            models.BuddyModelInterface
 	buddyRoles         models.BuddyRoleModelInterface
 	certifications     models.CertificationModelInterface
 	config             config
 	countries          models.CountryModelInterface
+	csvMappings        models.CSVMappingModelInterface
 	currencies         models.CurrencyModelInterface
 	currents           models.CurrentModelInterface
 	diveProperties     models.DivePropertyModelInterface
@@ -70,14 +93,18 @@ type app struct {
 	diveSites          models.DiveSiteModelInterface
 	entryPoints        models.EntryPointModelInterface
 	equipment          models.EquipmentModelInterface
+	files              storage.Store
 	formDecoder        *form.Decoder
 	gasMixes           models.GasMixModelInterface
 	log                *slog.Logger
 	operators          models.OperatorModelInterface
 	operatorTypes      models.OperatorTypeModelInterface
+	pendingImports     models.PendingImportModelInterface
+	search             models.SearchModelInterface
 	tankConfigurations models.TankConfigurationModelInterface
 	tankMaterials      models.TankMaterialModelInterface
 	templateCache      map[string]*template.Template
+	trash              models.TrashModelInterface
 	trips              models.TripModelInterface
 	users              models.UserModelInterface
 	sessionManager     *scs.SessionManager
@@ -155,9 +182,16 @@ func main() {
 		20*time.Second,
 		"DB timeout for large, bulk queries",
 	)
+	flag.StringVar(&cfg.storageDir, "storage-dir", "./uploads", "Directory to store uploaded files in")
 	flag.DurationVar(&cfg.termPeriod, "term-period", 30*time.Second, "Termination grace period")
 	flag.StringVar(&cfg.tlsCert, "tls-cert", "", "TLS cert file path if TLS is required")
 	flag.StringVar(&cfg.tlsKey, "tls-key", "", "TLS key file path if TLS is required")
+	flag.DurationVar(
+		&cfg.trashRetention,
+		"trash-retention",
+		30*24*time.Hour,
+		"How long deleted records are kept in the trash before being purged",
+	)
 	flag.Parse()
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{}))
@@ -177,6 +211,12 @@ func main() {
 	}
 	defer db.Close()
 
+	files, err := storage.NewLocalStore(cfg.storageDir)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(6)
+	}
+
 	formDecoder := form.NewDecoder()
 	FormDecoderRegisterTimeType(formDecoder, nil)
 	FormDecoderRegisterTimeLocationType(formDecoder)
@@ -193,11 +233,13 @@ func main() {
 		log:                logger,
 		templateCache:      templateCache,
 		agencies:           &models.AgencyModel{DB: db, Timeouts: cfg.db.timeouts},
+		apiTokens:          &models.APITokenModel{DB: db, Timeouts: cfg.db.timeouts},
 		agencyCourses:      &models.AgencyCourseModel{DB: db, Timeouts: cfg.db.timeouts},
 		buddies:            &models.BuddyModel{DB: db, Timeouts: cfg.db.timeouts},
 		buddyRoles:         &models.BuddyRoleModel{DB: db, Timeouts: cfg.db.timeouts},
 		certifications:     &models.CertificationModel{DB: db, Timeouts: cfg.db.timeouts},
 		countries:          &models.CountryModel{DB: db, Timeouts: cfg.db.timeouts},
+		csvMappings:        &models.CSVMappingModel{DB: db, Timeouts: cfg.db.timeouts},
 		currencies:         &models.CurrencyModel{DB: db, Timeouts: cfg.db.timeouts},
 		currents:           &models.CurrentModel{DB: db, Timeouts: cfg.db.timeouts},
 		diveProperties:     &models.DivePropertyModel{DB: db, Timeouts: cfg.db.timeouts},
@@ -205,13 +247,17 @@ func main() {
 		diveSites:          &models.DiveSiteModel{DB: db, Timeouts: cfg.db.timeouts},
 		entryPoints:        &models.EntryPointModel{DB: db, Timeouts: cfg.db.timeouts},
 		equipment:          &models.EquipmentModel{DB: db, Timeouts: cfg.db.timeouts},
+		files:              files,
 		formDecoder:        formDecoder,
 		gasMixes:           &models.GasMixModel{DB: db, Timeouts: cfg.db.timeouts},
 		operators:          &models.OperatorModel{DB: db, Timeouts: cfg.db.timeouts},
 		operatorTypes:      &models.OperatorTypeModel{DB: db, Timeouts: cfg.db.timeouts},
+		pendingImports:     &models.PendingImportModel{DB: db, Timeouts: cfg.db.timeouts},
+		search:             &models.SearchModel{DB: db, Timeouts: cfg.db.timeouts},
 		sessionManager:     sessionManager,
 		tankConfigurations: &models.TankConfigurationModel{DB: db, Timeouts: cfg.db.timeouts},
 		tankMaterials:      &models.TankMaterialModel{DB: db, Timeouts: cfg.db.timeouts},
+		trash:              &models.TrashModel{DB: db, Timeouts: cfg.db.timeouts},
 		trips:              &models.TripModel{DB: db, Timeouts: cfg.db.timeouts},
 		users:              &models.UserModel{DB: db, Timeouts: cfg.db.timeouts},
 		waterBodies:        &models.WaterBodyModel{DB: db, Timeouts: cfg.db.timeouts},
@@ -226,6 +272,9 @@ func main() {
 	}
 	app.dives = dm
 
+	go app.purgeExpiredTrash(trashPurgeInterval)
+	go app.purgeExpiredImports(pendingImportPurgeInterval)
+
 	err = app.serve()
 
 	if err != nil {
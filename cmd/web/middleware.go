@@ -45,6 +45,78 @@ func (app *app) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// authenticateToken authenticates requests that include a personal API token
+// in their Authorization header, such as those made by scripts, in place of the
+// session. As with authenticate, the user's models.User struct is added to the
+// request Context so that handlers do not need to know how the user was
+// authenticated. Read only tokens can only be used for safe requests.
+func (app *app) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, found := strings.Cut(authorization, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			app.apiInvalidToken(w, r)
+			return
+		}
+
+		apiToken, err := app.apiTokens.Authenticate(strings.TrimSpace(token))
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiInvalidToken(w, r)
+			} else {
+				app.apiServerError(w, r, fmt.Errorf("failed to authenticate API token: %w", err))
+			}
+			return
+		}
+
+		user, err := app.users.GetByID(apiToken.OwnerID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.apiInvalidToken(w, r)
+			} else {
+				app.apiServerError(w, r, fmt.Errorf("failed to fetch user with id %d: %w", apiToken.OwnerID, err))
+			}
+			return
+		}
+
+		safeMethod := r.Method == http.MethodGet ||
+			r.Method == http.MethodHead ||
+			r.Method == http.MethodOptions
+		if apiToken.Scope != models.APITokenScopeReadWrite && !safeMethod {
+			msg := "this API token is read only and cannot be used to make changes"
+			app.apiErrorResponse(w, r, http.StatusForbidden, msg)
+			return
+		}
+
+		r = app.contextSetIsAuthenticated(r, true)
+		r = app.contextSetUser(r, &user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectAPIToken stops API tokens from being used to manage the user's account,
+// such as creating further tokens, which would otherwise let a token outlive
+// its expiry or escape its scope. These routes need a logged in session.
+func (app *app) rejectAPIToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			msg := "API tokens cannot be used to manage your account"
+			app.apiErrorResponse(w, r, http.StatusForbidden, msg)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *app) commonHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Build the Content-Server-Policy header.
@@ -97,9 +169,38 @@ func noSurf(next http.Handler) http.Handler {
 		Secure:   true,
 	})
 
+	// Browsers do not add an Authorization header to cross-site requests on
+	// their own, so requests that use an API token cannot be forged and do not
+	// need a CSRF token. Invalid tokens are rejected by authenticateToken.
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") != ""
+	})
+
 	return csrfHandler
 }
 
+// limitUpload limits the body of requests that upload files to maxSize bytes.
+// The multipart form is parsed here, before noSurf reads the CSRF token from
+// it, so that an upload that is too large is rejected with a 413 status rather
+// than being read into memory and temporary files in full.
+func limitUpload(maxSize int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+			err := r.ParseMultipartForm(maxSize)
+			if err != nil && multipartFormErrorStatus(err) == http.StatusRequestEntityTooLarge {
+				w.Header().Set("Connection", "close")
+				status := http.StatusRequestEntityTooLarge
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *app) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
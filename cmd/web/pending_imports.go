@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+// pendingImportLifetime is how long an uploaded import is kept for the user to
+// preview and commit it before it expires.
+const pendingImportLifetime = 12 * time.Hour
+
+// pendingImportPurgeInterval is how often expired pending imports are purged.
+const pendingImportPurgeInterval = 1 * time.Hour
+
+// pendingImportSessionKey returns the session key that holds the ID of the
+// user's pending import of the given kind.
+func pendingImportSessionKey(kind string) string {
+	return "pendingImportID." + kind
+}
+
+// putPendingImport stores data as the user's pending import of the given kind,
+// replacing any earlier one, and keeps only its ID in the session as the data
+// can be many megabytes in size.
+func (app *app) putPendingImport(r *http.Request, kind string, data []byte) error {
+	err := app.removePendingImport(r, kind)
+	if err != nil {
+		return err
+	}
+
+	user := app.contextGetUser(r)
+	id, err := app.pendingImports.Insert(user.ID, kind, data, pendingImportLifetime)
+	if err != nil {
+		return fmt.Errorf("failed to insert pending %s import: %w", kind, err)
+	}
+
+	app.sessionManager.Put(r.Context(), pendingImportSessionKey(kind), id)
+	return nil
+}
+
+// getPendingImport returns the data of the user's pending import of the given
+// kind. models.ErrNoRecord is returned if there is no import in progress or it
+// has expired.
+func (app *app) getPendingImport(r *http.Request, kind string) ([]byte, error) {
+	id := app.sessionManager.GetInt(r.Context(), pendingImportSessionKey(kind))
+	if id == 0 {
+		return nil, models.ErrNoRecord
+	}
+
+	user := app.contextGetUser(r)
+	return app.pendingImports.Get(user.ID, id, kind)
+}
+
+// removePendingImport deletes the user's pending import of the given kind, if
+// they have one, and removes its ID from the session.
+func (app *app) removePendingImport(r *http.Request, kind string) error {
+	id := app.sessionManager.PopInt(r.Context(), pendingImportSessionKey(kind))
+	if id == 0 {
+		return nil
+	}
+
+	user := app.contextGetUser(r)
+	err := app.pendingImports.Delete(user.ID, id)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return fmt.Errorf("failed to delete pending %s import: %w", kind, err)
+	}
+
+	return nil
+}
+
+// purgeExpiredImports deletes the pending imports that have expired, then again
+// after every interval. It never returns, so should be run in its own
+// goroutine.
+func (app *app) purgeExpiredImports(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := app.pendingImports.DeleteExpired()
+		if err != nil {
+			app.log.Error("Failed to purge expired imports", "error", err.Error())
+		} else if purged > 0 {
+			app.log.Info("Purged expired imports", "imports", purged)
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/logbook"
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// profileMatchWindow is how far apart the start of a dive in an uploaded log
+// book and the start of the logged dive can be for them to be considered the
+// same dive, allowing for dive computers whose clocks have drifted.
+const profileMatchWindow = time.Hour
+
+// diveProfileForm holds the options for uploading the profile of a dive. The
+// units are only used for CSV files as the other formats always use metric.
+type diveProfileForm struct {
+	Format              string `form:"format"`
+	DepthUnit           string `form:"depth_unit"`
+	TempUnit            string `form:"temp_unit"`
+	PressureUnit        string `form:"pressure_unit"`
+	DurationUnit        string `form:"duration_unit"`
+	validator.Validator `form:"-"`
+}
+
+func (f *diveProfileForm) Validate() {
+	_, ok := importParsers[f.Format]
+	f.CheckField(ok || f.Format == csvImportFormat, "format", "Select a valid file format")
+
+	f.CheckField(
+		validator.PermittedValue(f.DepthUnit, logbook.DepthMetres, logbook.DepthFeet),
+		"depth_unit",
+		"Select a valid depth unit",
+	)
+	f.CheckField(
+		validator.PermittedValue(f.TempUnit, logbook.TempCelsius, logbook.TempFahrenheit),
+		"temp_unit",
+		"Select a valid temperature unit",
+	)
+	f.CheckField(
+		validator.PermittedValue(f.PressureUnit, logbook.PressureBar, logbook.PressurePSI),
+		"pressure_unit",
+		"Select a valid pressure unit",
+	)
+	f.CheckField(
+		validator.PermittedValue(
+			f.DurationUnit,
+			logbook.DurationMinutes,
+			logbook.DurationSeconds,
+			logbook.DurationMinsSecs,
+			logbook.DurationHoursMins,
+		),
+		"duration_unit",
+		"Select a valid time unit",
+	)
+}
+
+// newDiveProfile converts the samples from a log book into a DiveProfile. The
+// samples are sorted and rounded to the nearest second, with the events of any
+// samples that fall in the same second being merged into the first of them.
+func newDiveProfile(samples []logbook.Sample) models.DiveProfile {
+	samples = slices.Clone(samples)
+	slices.SortStableFunc(samples, func(a, b logbook.Sample) int {
+		return int(a.Time - b.Time)
+	})
+
+	var profile models.DiveProfile
+	for _, s := range samples {
+		elapsed := max(s.Time.Round(time.Second), 0)
+
+		if n := len(profile); n > 0 && profile[n-1].Elapsed == elapsed {
+			profile[n-1].Events = append(profile[n-1].Events, s.Events...)
+			continue
+		}
+
+		profile = append(profile, models.DiveSample{
+			Elapsed:     elapsed,
+			Depth:       math.Max(s.Depth, 0),
+			Temperature: s.Temperature,
+			Pressure:    s.Pressure,
+			PPO2:        s.PPO2,
+			CNS:         s.CNS,
+			Events:      s.Events,
+		})
+
+		if s.StopDepth != nil && *s.StopDepth > 0 {
+			profile[len(profile)-1].StopDepth = s.StopDepth
+			profile[len(profile)-1].StopTime = s.StopTime
+		}
+	}
+
+	return profile
+}
+
+// checkDiveProfile checks that the values derived from the profile are within
+// the same limits as the dive form places on them and returns a message for
+// the user if they are not.
+func checkDiveProfile(profile models.DiveProfile) string {
+	switch {
+	case len(profile) < 2:
+		return "The profile must have at least two samples"
+	case profile.MaxDepth() < 4.0 || profile.MaxDepth() > 350.0:
+		return "The profile's max depth must be between 4 and 350 metres"
+	case profile.BottomTime() < 10*time.Minute || profile.BottomTime() > 1440*time.Minute:
+		return "The profile's bottom time must be between 10 and 1,440 minutes"
+	default:
+		return ""
+	}
+}
+
+// matchProfileDive returns the dive from a log book that has the closest start
+// time to dateTimeIn, ignoring any dives without samples or that are further
+// apart than the profileMatchWindow. If the log book only holds one dive with
+// samples, then that is used regardless of when it started.
+func matchProfileDive(dives []logbook.Dive, dateTimeIn time.Time) (logbook.Dive, bool) {
+	// Compare the wall-clock times as the log book's times have no time zone.
+	wallClock := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	}
+	dateTimeIn = wallClock(dateTimeIn)
+
+	dives = slices.DeleteFunc(slices.Clone(dives), func(d logbook.Dive) bool {
+		return len(d.Samples) == 0
+	})
+
+	if len(dives) == 1 {
+		return dives[0], true
+	}
+
+	var match logbook.Dive
+	found := false
+	closest := profileMatchWindow
+
+	for _, d := range dives {
+		diff := wallClock(d.DateTimeIn).Sub(dateTimeIn).Abs()
+		if diff <= closest {
+			match, closest, found = d, diff, true
+		}
+	}
+
+	return match, found
+}
+
+// parseProfileFile parses the file uploaded in the "file" field of a multipart
+// form and returns the profile of the dive starting at dateTimeIn. If the file
+// cannot be read or holds no matching dive, then a message suitable for
+// displaying to the user is returned instead.
+func (app *app) parseProfileFile(
+	r *http.Request,
+	form *diveProfileForm,
+	dateTimeIn time.Time,
+) (models.DiveProfile, string) {
+	file, fh, err := r.FormFile("file")
+	if err != nil {
+		return nil, "Select a file containing the dive's profile"
+	}
+	defer file.Close()
+
+	var samples []logbook.Sample
+
+	if form.Format == csvImportFormat {
+		samples, err = logbook.ParseSampleCSV(file, logbook.CSVMapping{
+			DepthUnit:    form.DepthUnit,
+			TempUnit:     form.TempUnit,
+			PressureUnit: form.PressureUnit,
+			DurationUnit: form.DurationUnit,
+		})
+		if err != nil {
+			return nil, fmt.Sprintf("The file %s could not be read: %s", fh.Filename, err.Error())
+		}
+	} else {
+		dives, err := importParsers[form.Format](file)
+		if err != nil {
+			app.log.Info("Failed to parse uploaded profile", "file", fh.Filename, "error", err.Error())
+			return nil, fmt.Sprintf("The file %s is not a valid %s log book", fh.Filename, form.Format)
+		}
+
+		dive, ok := matchProfileDive(dives, dateTimeIn)
+		if !ok {
+			return nil, fmt.Sprintf("The file %s has no profile for a dive starting at %s",
+				fh.Filename, dateTimeIn.Format("2006-01-02 15:04"))
+		}
+		samples = dive.Samples
+	}
+
+	profile := newDiveProfile(samples)
+
+	return profile, checkDiveProfile(profile)
+}
+
+// getOwnDive fetches the dive with the ID given in the request's path for the
+// logged in user. If it cannot be found, then a response has already been sent
+// and the returned bool is false.
+func (app *app) getOwnDive(w http.ResponseWriter, r *http.Request) (models.Dive, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		http.NotFound(w, r)
+		return models.Dive{}, false
+	}
+
+	dive, err := app.dives.GetOneByID(app.contextGetUser(r).ID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Dive{}, false
+	}
+
+	return dive, true
+}
+
+func (app *app) diveProfileGET(w http.ResponseWriter, r *http.Request) {
+	dive, ok := app.getOwnDive(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Dive = dive
+	data.Form = diveProfileForm{
+		Format:       "subsurface",
+		DepthUnit:    logbook.DepthMetres,
+		TempUnit:     logbook.TempCelsius,
+		PressureUnit: logbook.PressureBar,
+		DurationUnit: logbook.DurationMinsSecs,
+	}
+
+	app.render(w, r, http.StatusOK, "dive/profile.tmpl", data)
+}
+
+// diveProfilePOST replaces the profile of a dive with the one in the uploaded
+// file, which also sets the dive's depths and bottom time from it.
+func (app *app) diveProfilePOST(w http.ResponseWriter, r *http.Request) {
+	form := &diveProfileForm{}
+	err := app.decodeMultipartForm(w, r, form, maxImportSize)
+	if err != nil {
+		app.log.Error("Error whilst decoding dive profile form input", "error", err.Error())
+		app.clientError(w, multipartFormErrorStatus(err))
+		return
+	}
+
+	dive, ok := app.getOwnDive(w, r)
+	if !ok {
+		return
+	}
+
+	form.Validate()
+
+	var profile models.DiveProfile
+	if form.Valid() {
+		var msg string
+		profile, msg = app.parseProfileFile(r, form, dive.DateTimeIn)
+		form.CheckField(msg == "", "file", msg)
+	}
+
+	if !form.Valid() {
+		data, err := app.newTemplateData(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Dive = dive
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "dive/profile.tmpl", data)
+		return
+	}
+
+	err = app.dives.SetProfile(app.contextGetUser(r).ID, dive.ID, profile)
+	if err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to set dive profile: %w", err))
+		return
+	}
+
+	msg := fmt.Sprintf("The profile of dive number %d has been uploaded successfully.", dive.Number)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+
+	http.Redirect(w, r, fmt.Sprintf("/log-book/dive/view/%d", dive.ID), http.StatusSeeOther)
+}
+
+func (app *app) diveProfileDeletePOST(w http.ResponseWriter, r *http.Request) {
+	dive, ok := app.getOwnDive(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.dives.DeleteProfile(app.contextGetUser(r).ID, dive.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, fmt.Errorf("failed to delete dive profile: %w", err))
+		return
+	}
+
+	msg := fmt.Sprintf("The profile of dive number %d has been removed.", dive.Number)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+
+	http.Redirect(w, r, fmt.Sprintf("/log-book/dive/view/%d", dive.ID), http.StatusSeeOther)
+}
@@ -15,8 +15,16 @@ func (app *app) routes() http.Handler {
 	mux.Handle("GET /static", http.NotFoundHandler())
 	mux.Handle("GET /static/", fileserver)
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	dynamic := alice.New(
+		app.sessionManager.LoadAndSave,
+		noSurf,
+		app.authenticate,
+		app.authenticateToken,
+	)
 	protected := dynamic.Append(app.requireAuthentication)
+	account := protected.Append(app.rejectAPIToken)
+	upload := alice.New(limitUpload(maxImportSize)).Extend(protected)
+	cardUpload := alice.New(limitUpload(maxCardSize)).Extend(protected)
 
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home))
 	mux.HandleFunc("GET /status", status)
@@ -25,16 +33,34 @@ func (app *app) routes() http.Handler {
 	mux.Handle("POST /user/sign-up", dynamic.ThenFunc(app.userCreatePOST))
 	mux.Handle("GET  /user/log-in", dynamic.ThenFunc(app.userLogInGET))
 	mux.Handle("POST /user/log-in", dynamic.ThenFunc(app.userLogInPOST))
-	mux.Handle("POST /user/log-out", protected.ThenFunc(app.userLogOutPOST))
-	mux.Handle("GET  /user/profile/edit", protected.ThenFunc(app.userUpdateGET))
-	mux.Handle("POST /user/profile/edit", protected.ThenFunc(app.userUpdatePOST))
+	mux.Handle("POST /user/log-out", account.ThenFunc(app.userLogOutPOST))
+	mux.Handle("GET  /user/profile/edit", account.ThenFunc(app.userUpdateGET))
+	mux.Handle("POST /user/profile/edit", account.ThenFunc(app.userUpdatePOST))
+	mux.Handle("POST /user/calendar/token", account.ThenFunc(app.userCalendarTokenPOST))
+	mux.Handle("POST /user/calendar/revoke", account.ThenFunc(app.userCalendarRevokePOST))
+	mux.Handle("POST /user/api-token", account.ThenFunc(app.userAPITokenCreatePOST))
+	mux.Handle("POST /user/api-token/revoke/{id}", account.ThenFunc(app.userAPITokenRevokePOST))
+
+	mux.HandleFunc("GET  /calendar/{file}", app.calendarFeed)
 
 	mux.Handle("GET  /log-book/dive/", protected.ThenFunc(app.diveList))
 	mux.Handle("GET  /log-book/dive/add", protected.ThenFunc(app.diveCreateGET))
 	mux.Handle("POST /log-book/dive/add", protected.ThenFunc(app.diveCreatePOST))
+	mux.Handle("GET  /log-book/dive/day", protected.ThenFunc(app.diveDayGET))
+	mux.Handle("POST /log-book/dive/day", protected.ThenFunc(app.diveDayPOST))
+	mux.Handle("GET  /log-book/dive/renumber", protected.ThenFunc(app.diveRenumberGET))
+	mux.Handle("POST /log-book/dive/renumber", protected.ThenFunc(app.diveRenumberPOST))
+	mux.Handle("GET  /log-book/dive/bulk-edit", protected.ThenFunc(app.diveBulkEditGET))
+	mux.Handle("POST /log-book/dive/bulk-edit", protected.ThenFunc(app.diveBulkEditPOST))
 	mux.Handle("GET  /log-book/dive/edit/{id}", protected.ThenFunc(app.diveUpdateGET))
 	mux.Handle("POST /log-book/dive/edit/{id}", protected.ThenFunc(app.diveUpdatePOST))
 	mux.Handle("GET  /log-book/dive/view/{id}", protected.ThenFunc(app.diveGET))
+	mux.Handle("GET  /log-book/dive/profile/{id}", protected.ThenFunc(app.diveProfileGET))
+	mux.Handle("POST /log-book/dive/profile/{id}", upload.ThenFunc(app.diveProfilePOST))
+	mux.Handle("POST /log-book/dive/profile/delete/{id}", protected.ThenFunc(app.diveProfileDeletePOST))
+	mux.Handle("GET  /log-book/dive/export/csv", protected.ThenFunc(app.diveExportCSV))
+	mux.Handle("GET  /log-book/dive/export/uddf", protected.ThenFunc(app.diveExportUDDF))
+	mux.Handle("GET  /log-book/dive/export/pdf", protected.ThenFunc(app.diveExportPDF))
 
 	mux.Handle("GET  /log-book/dive-site/", protected.ThenFunc(app.diveSiteList))
 	mux.Handle("GET  /log-book/dive-site/add", protected.ThenFunc(app.diveSiteCreateGET))
@@ -42,24 +68,55 @@ func (app *app) routes() http.Handler {
 	mux.Handle("GET  /log-book/dive-site/edit/{id}", protected.ThenFunc(app.diveSiteUpdateGET))
 	mux.Handle("POST /log-book/dive-site/edit/{id}", protected.ThenFunc(app.diveSiteUpdatePOST))
 	mux.Handle("GET  /log-book/dive-site/view/{id}", protected.ThenFunc(app.diveSiteGET))
+	mux.Handle("GET  /log-book/dive-site/export/{format}", protected.ThenFunc(app.diveSiteExport))
+	mux.Handle("GET  /log-book/dive-site/import", protected.ThenFunc(app.importSitesGET))
+	mux.Handle("POST /log-book/dive-site/import", upload.ThenFunc(app.importSitesPOST))
+	mux.Handle("POST /log-book/dive-site/import/commit", protected.ThenFunc(app.importSitesCommitPOST))
 
 	mux.Handle("GET  /log-book/statistics", protected.ThenFunc(app.statistics))
 
+	mux.Handle("GET  /log-book/import", protected.ThenFunc(app.importGET))
+	mux.Handle("POST /log-book/import", upload.ThenFunc(app.importPOST))
+	mux.Handle("POST /log-book/import/commit", protected.ThenFunc(app.importCommitPOST))
+	mux.Handle("GET  /log-book/import/csv", protected.ThenFunc(app.importCSVGET))
+	mux.Handle("POST /log-book/import/csv", upload.ThenFunc(app.importCSVPOST))
+	mux.Handle("GET  /log-book/import/csv/mapping", protected.ThenFunc(app.importCSVMappingGET))
+	mux.Handle("POST /log-book/import/csv/mapping/delete/{id}", protected.ThenFunc(app.importCSVMappingDeletePOST))
+	mux.Handle("POST /log-book/import/csv/preview", protected.ThenFunc(app.importCSVPreviewPOST))
+	mux.Handle("POST /log-book/import/csv/commit", protected.ThenFunc(app.importCSVCommitPOST))
+
 	mux.Handle("GET  /buddy/", protected.ThenFunc(app.buddyList))
 	mux.Handle("GET  /buddy/add", protected.ThenFunc(app.buddyCreateGET))
 	mux.Handle("POST /buddy/add", protected.ThenFunc(app.buddyCreatePOST))
+	mux.Handle("GET  /buddy/edit/{id}", protected.ThenFunc(app.buddyUpdateGET))
+	mux.Handle("POST /buddy/edit/{id}", protected.ThenFunc(app.buddyUpdatePOST))
+	mux.Handle("GET  /buddy/view/{id}", protected.ThenFunc(app.buddyGET))
 
 	mux.Handle("GET  /certification/", protected.ThenFunc(app.certificationList))
 	mux.Handle("GET  /certification/add", protected.ThenFunc(app.certificationCreateGET))
 	mux.Handle("POST /certification/add", protected.ThenFunc(app.certificationCreatePOST))
+	mux.Handle("GET  /certification/card/{id}/{side}", protected.ThenFunc(app.certificationCardGET))
+	mux.Handle("POST /certification/card/{id}/{side}", cardUpload.ThenFunc(app.certificationCardPOST))
+	mux.Handle("POST /certification/card/{id}/{side}/delete", protected.ThenFunc(app.certificationCardDeletePOST))
+	mux.Handle("GET  /certification/cards/{id}", protected.ThenFunc(app.certificationCardsDownload))
+	mux.Handle("GET  /certification/edit/{id}", protected.ThenFunc(app.certificationUpdateGET))
+	mux.Handle("POST /certification/edit/{id}", protected.ThenFunc(app.certificationUpdatePOST))
+	mux.Handle("GET  /certification/view/{id}", protected.ThenFunc(app.certificationGET))
 
 	mux.Handle("GET  /operator/", protected.ThenFunc(app.operatorList))
 	mux.Handle("GET  /operator/add", protected.ThenFunc(app.operatorCreateGET))
 	mux.Handle("POST /operator/add", protected.ThenFunc(app.operatorCreatePOST))
+	mux.Handle("GET  /operator/edit/{id}", protected.ThenFunc(app.operatorUpdateGET))
+	mux.Handle("POST /operator/edit/{id}", protected.ThenFunc(app.operatorUpdatePOST))
+	mux.Handle("GET  /operator/view/{id}", protected.ThenFunc(app.operatorGET))
 
 	mux.Handle("GET  /trip/", protected.ThenFunc(app.tripList))
 	mux.Handle("GET  /trip/add", protected.ThenFunc(app.tripCreateGET))
 	mux.Handle("POST /trip/add", protected.ThenFunc(app.tripCreatePOST))
+	mux.Handle("POST /trip/dives/{id}", protected.ThenFunc(app.tripDivesPOST))
+	mux.Handle("GET  /trip/edit/{id}", protected.ThenFunc(app.tripUpdateGET))
+	mux.Handle("POST /trip/edit/{id}", protected.ThenFunc(app.tripUpdatePOST))
+	mux.Handle("GET  /trip/view/{id}", protected.ThenFunc(app.tripGET))
 
 	mux.Handle("GET  /dive-plan/", protected.ThenFunc(app.divePlanList))
 	mux.Handle("GET  /dive-plan/add", protected.ThenFunc(app.divePlanCreateGET))
@@ -68,6 +125,61 @@ func (app *app) routes() http.Handler {
 	mux.Handle("POST /dive-plan/edit/{id}", protected.ThenFunc(app.divePlanUpdatePOST))
 	mux.Handle("GET  /dive-plan/view/{id}", protected.ThenFunc(app.divePlanGET))
 
+	mux.Handle("GET  /search", protected.ThenFunc(app.searchGET))
+
+	mux.Handle("GET  /trash/", protected.ThenFunc(app.trashList))
+	mux.Handle("GET  /trash/delete/{type}/{id}", protected.ThenFunc(app.trashDeleteGET))
+	mux.Handle("POST /trash/delete/{type}/{id}", protected.ThenFunc(app.trashDeletePOST))
+	mux.Handle("POST /trash/reassign/{type}/{id}", protected.ThenFunc(app.trashReassignPOST))
+	mux.Handle("POST /trash/restore/{type}/{id}", protected.ThenFunc(app.trashRestorePOST))
+	mux.Handle("POST /trash/purge/{type}/{id}", protected.ThenFunc(app.trashPurgePOST))
+
+	// The API does not use noSurf as requests with a body must be sent as
+	// application/json, which browsers will not do cross-origin.
+	api := alice.New(
+		app.sessionManager.LoadAndSave,
+		app.authenticate,
+		app.authenticateToken,
+		app.requireAPIAuthentication,
+	)
+
+	mux.Handle("GET   /api/v1/dives", api.ThenFunc(app.apiDiveList))
+	mux.Handle("POST  /api/v1/dives", api.ThenFunc(app.apiDiveCreatePOST))
+	mux.Handle("GET   /api/v1/dives/{id}", api.ThenFunc(app.apiDiveGET))
+	mux.Handle("PATCH /api/v1/dives/{id}", api.ThenFunc(app.apiDiveUpdatePATCH))
+
+	mux.Handle("GET   /api/v1/dive-sites", api.ThenFunc(app.apiDiveSiteList))
+	mux.Handle("POST  /api/v1/dive-sites", api.ThenFunc(app.apiDiveSiteCreatePOST))
+	mux.Handle("GET   /api/v1/dive-sites/{id}", api.ThenFunc(app.apiDiveSiteGET))
+	mux.Handle("PATCH /api/v1/dive-sites/{id}", api.ThenFunc(app.apiDiveSiteUpdatePATCH))
+
+	mux.Handle("GET   /api/v1/buddies", api.ThenFunc(app.apiBuddyList))
+	mux.Handle("POST  /api/v1/buddies", api.ThenFunc(app.apiBuddyCreatePOST))
+	mux.Handle("GET   /api/v1/buddies/{id}", api.ThenFunc(app.apiBuddyGET))
+	mux.Handle("PATCH /api/v1/buddies/{id}", api.ThenFunc(app.apiBuddyUpdatePATCH))
+
+	mux.Handle("GET   /api/v1/operators", api.ThenFunc(app.apiOperatorList))
+	mux.Handle("POST  /api/v1/operators", api.ThenFunc(app.apiOperatorCreatePOST))
+	mux.Handle("GET   /api/v1/operators/{id}", api.ThenFunc(app.apiOperatorGET))
+	mux.Handle("PATCH /api/v1/operators/{id}", api.ThenFunc(app.apiOperatorUpdatePATCH))
+
+	mux.Handle("GET   /api/v1/trips", api.ThenFunc(app.apiTripList))
+	mux.Handle("POST  /api/v1/trips", api.ThenFunc(app.apiTripCreatePOST))
+	mux.Handle("GET   /api/v1/trips/{id}", api.ThenFunc(app.apiTripGET))
+	mux.Handle("PATCH /api/v1/trips/{id}", api.ThenFunc(app.apiTripUpdatePATCH))
+
+	mux.Handle("GET   /api/v1/certifications", api.ThenFunc(app.apiCertificationList))
+	mux.Handle("POST  /api/v1/certifications", api.ThenFunc(app.apiCertificationCreatePOST))
+	mux.Handle("GET   /api/v1/certifications/{id}", api.ThenFunc(app.apiCertificationGET))
+	mux.Handle("PATCH /api/v1/certifications/{id}", api.ThenFunc(app.apiCertificationUpdatePATCH))
+
+	mux.Handle("GET   /api/v1/dive-plans", api.ThenFunc(app.apiDivePlanList))
+	mux.Handle("POST  /api/v1/dive-plans", api.ThenFunc(app.apiDivePlanCreatePOST))
+	mux.Handle("GET   /api/v1/dive-plans/{id}", api.ThenFunc(app.apiDivePlanGET))
+	mux.Handle("PATCH /api/v1/dive-plans/{id}", api.ThenFunc(app.apiDivePlanUpdatePATCH))
+
+	mux.Handle("/api/v1/", api.ThenFunc(app.apiNotFound))
+
 	standard := alice.New(app.recoverPanic, app.logRequest, app.commonHeaders)
 	return standard.Then(mux)
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// searchResultsPerType is the most results that are shown for each type of
+// record on the search page.
+const searchResultsPerType = 10
+
+// searchForm holds the query for a search of the user's log book.
+type searchForm struct {
+	Query               string `form:"q"`
+	validator.Validator `form:"-"`
+}
+
+// searchResultURL returns the path of the page that shows result.
+func searchResultURL(result models.SearchResult) string {
+	switch result.Type {
+	case models.SearchBuddy:
+		return fmt.Sprintf("/buddy/view/%d", result.ID)
+	case models.SearchDive:
+		return fmt.Sprintf("/log-book/dive/view/%d", result.ID)
+	case models.SearchDiveSite:
+		return fmt.Sprintf("/log-book/dive-site/view/%d", result.ID)
+	case models.SearchOperator:
+		return fmt.Sprintf("/operator/view/%d", result.ID)
+	case models.SearchTrip:
+		return fmt.Sprintf("/trip/view/%d", result.ID)
+	default:
+		return "/"
+	}
+}
+
+// searchSnippet escapes the snippet of a search result and marks up its
+// highlighted words so that it can be displayed as HTML.
+func searchSnippet(snippet string) template.HTML {
+	snippet = template.HTMLEscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, models.SearchHighlightStart, "<mark>")
+	snippet = strings.ReplaceAll(snippet, models.SearchHighlightStop, "</mark>")
+
+	return template.HTML(snippet)
+}
+
+// searchGET shows the records in the user's log book that match the query
+// given in the "q" query string parameter, grouped by their type.
+func (app *app) searchGET(w http.ResponseWriter, r *http.Request) {
+	form := searchForm{Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+	form.CheckField(
+		validator.MaxChars(form.Query, 256),
+		"q",
+		"This field cannot be more than 256 characters long",
+	)
+
+	var results []models.SearchGroup
+	if form.Query != "" && form.Valid() {
+		var err error
+		results, err = app.search.Search(app.contextGetUser(r).ID, form.Query, searchResultsPerType)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
+	data.SearchResults = results
+
+	status := http.StatusOK
+	if !form.Valid() {
+		status = http.StatusUnprocessableEntity
+	}
+
+	app.render(w, r, status, "search.tmpl", data)
+}
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"html/template"
 	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/hako/durafmt"
@@ -196,53 +198,88 @@ var functions = template.FuncMap{
 	"isoCountryToEmoji": isoCountryToEmoji,
 	"multiplyF64":       multiply[float64],
 	"pageControls":      ui.PageControls,
+	"searchResultURL":   searchResultURL,
+	"searchSnippet":     searchSnippet,
+	"sortLink":          ui.SortLink,
 	"stringsReplace":    strings.Replace,
 	"textToHTMLParas":   textToHTMLParas,
+	"trashItemURL":      trashItemURL,
 }
 
 type templateData struct {
-	Agencies           []models.Agency
-	AgencyCourses      []models.AgencyCourse
-	Buddies            []models.Buddy
-	BuddyRoles         []models.BuddyRole
-	CSPNonce           string
-	CSRFToken          string
-	Certifications     []models.Certification
-	Countries          []models.Country
-	Currencies         []models.Currency
-	Currents           []models.Current
-	CurrentYear        int
-	DarkMode           bool
-	Dive               models.Dive
-	Dives              []models.Dive
-	DivePlan           *models.DivePlan
-	DivePlans          []models.DivePlan
-	DiveProperties     []models.DiveProperty
-	DiveSite           models.DiveSite
-	DiveSites          []models.DiveSite
-	EntryPoints        []models.EntryPoint
-	Equipment          []models.Equipment
-	Flash              string
-	FlashError         string
-	FlashInfo          string
-	FlashSuccess       string
-	FlashWarning       string
-	Form               any
-	GasMixes           []models.GasMix
-	IsAuthenticated    bool
-	NoValidate         bool
-	Operators          []models.Operator
-	OperatorTypes      []models.OperatorType
-	PageData           models.PageData
-	TankConfigurations []models.TankConfiguration
-	TankMaterials      []models.TankMaterial
-	Trips              []models.Trip
-	User               models.User
-	DiveStats          models.DiveStats
-	WasPosted          bool
-	WaterBodies        []models.WaterBody
-	WaterTypes         []models.WaterType
-	Waves              []models.Waves
+	Agencies             []models.Agency
+	AgencyCourses        []models.AgencyCourse
+	APITokenExpiryDays   []int
+	APITokenForm         apiTokenForm
+	APITokens            []models.APIToken
+	Buddies              []models.Buddy
+	Buddy                models.Buddy
+	BuddyRoles           []models.BuddyRole
+	CSPNonce             string
+	CSRFToken            string
+	CSVImport            *csvImportColumns
+	CalendarURL          string
+	Certification        models.Certification
+	CertificationCards   []certificationCardSlot
+	Certifications       []models.Certification
+	Conflicts            []fieldConflict
+	Countries            []models.Country
+	Currencies           []models.Currency
+	Currents             []models.Current
+	CurrentYear          int
+	DarkMode             bool
+	Dive                 models.Dive
+	DiveBulkEditItems    []diveBulkEditItem
+	DiveNumbering        models.DiveNumberingReport
+	Dives                []models.Dive
+	DivePlan             *models.DivePlan
+	DivePlans            []models.DivePlan
+	DiveProperties       []models.DiveProperty
+	DiveSite             models.DiveSite
+	DiveSiteCounts       []diveSiteCount
+	DiveSites            []models.DiveSite
+	DiveSummary          diveSummary
+	EntryPoints          []models.EntryPoint
+	Equipment            []models.Equipment
+	FilterQuery          template.URL
+	FilterValues         url.Values
+	Flash                string
+	FlashError           string
+	FlashInfo            string
+	FlashSuccess         string
+	FlashWarning         string
+	Form                 any
+	GasMixes             []models.GasMix
+	Import               *importPreview
+	IsAuthenticated      bool
+	ListQuery            template.URL
+	NewAPIToken          string
+	NoValidate           bool
+	Operators            []models.Operator
+	Operator             models.Operator
+	OperatorScorecard    models.OperatorScorecard
+	OperatorTypes        []models.OperatorType
+	PageData             models.PageData
+	SearchResults        []models.SearchGroup
+	SiteImport           *siteImportPreview
+	Sort                 string
+	TankConfigurations   []models.TankConfiguration
+	TankMaterials        []models.TankMaterial
+	TrashBlockers        models.TrashBlockers
+	TrashItem            models.TrashItem
+	TrashItems           []models.TrashItem
+	TrashReassignOptions []trashOption
+	TrashRetention       time.Duration
+	TrashUndo            string
+	Trip                 models.Trip
+	TripCandidateDives   []models.Dive
+	Trips                []models.Trip
+	User                 models.User
+	DiveStats            models.DiveStats
+	WasPosted            bool
+	WaterBodies          []models.WaterBody
+	WaterTypes           []models.WaterType
+	Waves                []models.Waves
 }
 
 // https://stackoverflow.com/questions/26809484/how-to-use-double-star-glob-in-go
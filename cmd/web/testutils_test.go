@@ -6,17 +6,20 @@ import (
 	"html"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	"github.com/m5lapp/divesite-monolith/internal/models/mocks"
+	"github.com/m5lapp/divesite-monolith/internal/storage"
 )
 
 var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+)">`)
@@ -36,23 +39,34 @@ func newTestApplication(t *testing.T) *app {
 		t.Fatal(err)
 	}
 
+	files, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	formDecoder := form.NewDecoder()
+	FormDecoderRegisterTimeType(formDecoder, nil)
+	FormDecoderRegisterTimeLocationType(formDecoder)
 
 	sessionManager := scs.New()
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
 	return &app{
+		config:             config{trashRetention: 30 * 24 * time.Hour},
 		log:                slog.New(slog.NewTextHandler(io.Discard, nil)),
+		files:              files,
 		formDecoder:        formDecoder,
 		sessionManager:     sessionManager,
 		templateCache:      templateCache,
 		agencies:           &mocks.AgencyModel{},
 		agencyCourses:      &mocks.AgencyCourseModel{},
+		apiTokens:          &mocks.APITokenModel{},
 		buddies:            &mocks.BuddyModel{},
 		buddyRoles:         &mocks.BuddyRoleModel{},
 		certifications:     &mocks.CertificationModel{},
 		countries:          &mocks.CountryModel{},
+		csvMappings:        &mocks.CSVMappingModel{},
 		currencies:         &mocks.CurrencyModel{},
 		currents:           &mocks.CurrentModel{},
 		divePlans:          &mocks.DivePlanModel{},
@@ -64,8 +78,11 @@ func newTestApplication(t *testing.T) *app {
 		gasMixes:           &mocks.GasMixModel{},
 		operators:          &mocks.OperatorModel{},
 		operatorTypes:      &mocks.OperatorTypeModel{},
+		pendingImports:     &mocks.PendingImportModel{},
+		search:             &mocks.SearchModel{},
 		tankConfigurations: &mocks.TankConfigurationModel{},
 		tankMaterials:      &mocks.TankMaterialModel{},
+		trash:              &mocks.TrashModel{},
 		trips:              &mocks.TripModel{},
 		users:              &mocks.UserModel{},
 		waterBodies:        &mocks.WaterBodyModel{},
@@ -165,3 +182,102 @@ func (ts *testServer) postForm(
 
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// postFile submits a multipart form containing the given form values along with
+// a single file in the field named "file".
+func (ts *testServer) postFile(
+	t *testing.T,
+	urlPath string,
+	form url.Values,
+	filename string,
+	contents string,
+) (int, http.Header, string) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	for key, values := range form {
+		for _, value := range values {
+			err := mw.WriteField(key, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = io.WriteString(fw, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Post(ts.URL+urlPath, mw.FormDataContentType(), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = bytes.TrimSpace(body)
+
+	return rs.StatusCode, rs.Header, string(body)
+}
+
+// sendJSON sends a request with the given method and JSON body, which is sent
+// with the application/json content type unless contentType is given.
+func (ts *testServer) sendJSON(
+	t *testing.T,
+	method string,
+	urlPath string,
+	contentType string,
+	body string,
+) (int, http.Header, string) {
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	return ts.send(t, method, urlPath, header, body)
+}
+
+// send sends a request with the given method, headers and body.
+func (ts *testServer) send(
+	t *testing.T,
+	method string,
+	urlPath string,
+	header http.Header,
+	body string,
+) (int, http.Header, string) {
+	rq, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rq.Header = header
+
+	rs, err := ts.Client().Do(rq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	rsBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsBody = bytes.TrimSpace(rsBody)
+
+	return rs.StatusCode, rs.Header, string(rsBody)
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+	"github.com/m5lapp/divesite-monolith/internal/validator"
+)
+
+// trashPurgeInterval is how often records that have been in the trash for
+// longer than the retention period are purged.
+const trashPurgeInterval = 1 * time.Hour
+
+// trashListURLs are the paths of the pages that list each type of record.
+var trashListURLs = map[models.TrashItemType]string{
+	models.TrashBuddy:         "/buddy/",
+	models.TrashCertification: "/certification/",
+	models.TrashDive:          "/log-book/dive/",
+	models.TrashDivePlan:      "/dive-plan/",
+	models.TrashDiveSite:      "/log-book/dive-site/",
+	models.TrashOperator:      "/operator/",
+	models.TrashTrip:          "/trip/",
+}
+
+// trashItemURL returns the path of the page that shows item, or the page that
+// lists records of its type if they do not have their own pages.
+func trashItemURL(item models.TrashItem) string {
+	switch item.Type {
+	case models.TrashBuddy:
+		return fmt.Sprintf("/buddy/view/%d", item.ID)
+	case models.TrashCertification:
+		return fmt.Sprintf("/certification/view/%d", item.ID)
+	case models.TrashDive:
+		return fmt.Sprintf("/log-book/dive/view/%d", item.ID)
+	case models.TrashDivePlan:
+		return fmt.Sprintf("/dive-plan/view/%d", item.ID)
+	case models.TrashDiveSite:
+		return fmt.Sprintf("/log-book/dive-site/view/%d", item.ID)
+	case models.TrashOperator:
+		return fmt.Sprintf("/operator/view/%d", item.ID)
+	case models.TrashTrip:
+		return fmt.Sprintf("/trip/view/%d", item.ID)
+	default:
+		return trashListURLs[item.Type]
+	}
+}
+
+// trashOption is a record that the records blocking another from being moved
+// to the trash can be reassigned to.
+type trashOption struct {
+	ID   int
+	Name string
+}
+
+type trashReassignForm struct {
+	ReassignTo          int `form:"reassign_to"`
+	validator.Validator `form:"-"`
+}
+
+// readTrashItemParams returns the record type and ID from the "type" and "id"
+// path values of r. The returned bool is false if either is invalid.
+func readTrashItemParams(r *http.Request) (models.TrashItemType, int, bool) {
+	itemType := models.TrashItemType(r.PathValue("type"))
+	if !itemType.IsValid() {
+		return "", 0, false
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		return "", 0, false
+	}
+
+	return itemType, id, true
+}
+
+// trashReassignOptions returns the records that the blockers of item can be
+// reassigned to instead, which are the other records of the same type.
+func (app *app) trashReassignOptions(r *http.Request, item models.TrashItem) ([]trashOption, error) {
+	userID := app.contextGetUser(r).ID
+
+	var options []trashOption
+	switch item.Type {
+	case models.TrashBuddy:
+		buddies, err := app.buddies.ListAll(userID, models.SortBuddyDefault)
+		if err != nil {
+			return nil, err
+		}
+		for _, bu := range buddies {
+			options = append(options, trashOption{ID: bu.ID, Name: bu.String()})
+		}
+	case models.TrashDiveSite:
+		diveSites, err := app.diveSites.ListAll(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ds := range diveSites {
+			options = append(options, trashOption{ID: ds.ID, Name: ds.String()})
+		}
+	case models.TrashOperator:
+		operators, err := app.operators.ListAll(userID, models.SortOperatorDefault)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range operators {
+			options = append(options, trashOption{ID: op.ID, Name: op.String()})
+		}
+	}
+
+	// A record cannot be reassigned to itself.
+	for i, option := range options {
+		if option.ID == item.ID {
+			options = append(options[:i], options[i+1:]...)
+			break
+		}
+	}
+
+	return options, nil
+}
+
+// renderTrashDelete renders the page that confirms that a record should be
+// moved to the trash, or lists the records that stop it from being moved.
+func (app *app) renderTrashDelete(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	item models.TrashItem,
+	form trashReassignForm,
+) {
+	userID := app.contextGetUser(r).ID
+
+	blockers, err := app.trash.Blockers(userID, item.Type, item.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if len(blockers.Items) > 0 && blockers.Others == 0 {
+		data.TrashReassignOptions, err = app.trashReassignOptions(r, item)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data.Form = form
+	data.TrashBlockers = blockers
+	data.TrashItem = item
+	data.TrashRetention = app.config.trashRetention
+
+	app.render(w, r, status, "trash/delete.tmpl", data)
+}
+
+func (app *app) trashList(w http.ResponseWriter, r *http.Request) {
+	items, err := app.trash.List(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data, err := app.newTemplateData(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.TrashItems = items
+	data.TrashRetention = app.config.trashRetention
+
+	app.render(w, r, http.StatusOK, "trash/list.tmpl", data)
+}
+
+func (app *app) trashDeleteGET(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := readTrashItemParams(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	item, err := app.trash.GetOneByID(app.contextGetUser(r).ID, itemType, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if item.Deleted != nil {
+		http.Redirect(w, r, "/trash/", http.StatusSeeOther)
+		return
+	}
+
+	app.renderTrashDelete(w, r, http.StatusOK, item, trashReassignForm{})
+}
+
+func (app *app) trashDeletePOST(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := readTrashItemParams(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	app.moveToTrash(w, r, itemType, id)
+}
+
+// moveToTrash moves the user's record to the trash and redirects to the list of
+// records of its type, where the move can be undone.
+func (app *app) moveToTrash(
+	w http.ResponseWriter,
+	r *http.Request,
+	itemType models.TrashItemType,
+	id int,
+) {
+	userID := app.contextGetUser(r).ID
+
+	item, err := app.trash.GetOneByID(userID, itemType, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.trash.Delete(userID, itemType, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDeleteBlocked):
+			msg := fmt.Sprintf(
+				"%s cannot be deleted while other records refer to it.",
+				item.Name,
+			)
+			app.sessionManager.Put(r.Context(), "flashError", msg)
+			nextUrl := fmt.Sprintf("/trash/delete/%s/%d", itemType, id)
+			http.Redirect(w, r, nextUrl, http.StatusSeeOther)
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	msg := fmt.Sprintf("%s has been moved to the trash.", item.Name)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+	app.sessionManager.Put(r.Context(), "trashUndo", fmt.Sprintf("%s/%d", itemType, id))
+	http.Redirect(w, r, trashListURLs[itemType], http.StatusSeeOther)
+}
+
+func (app *app) trashReassignPOST(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := readTrashItemParams(r)
+	if !ok || !itemType.CanBeReassigned() {
+		http.NotFound(w, r)
+		return
+	}
+
+	form := trashReassignForm{}
+	err := app.decodePOSTForm(r, &form)
+	if err != nil {
+		app.log.Error("Error whilst decoding trash reassign form input", "error", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	item, err := app.trash.GetOneByID(userID, itemType, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	_, err = app.trash.Reassign(userID, itemType, id, form.ReassignTo)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			form.AddFieldError("reassign_to", "This field must be selected")
+			app.renderTrashDelete(w, r, http.StatusUnprocessableEntity, item, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.moveToTrash(w, r, itemType, id)
+}
+
+func (app *app) trashRestorePOST(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := readTrashItemParams(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	item, err := app.trash.GetOneByID(userID, itemType, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.trash.Restore(userID, itemType, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrRestoreBlocked):
+			msg := fmt.Sprintf(
+				"%s refers to a dive site, operator or buddy that is also in the "+
+					"trash. Please restore that first.",
+				item.Name,
+			)
+			app.sessionManager.Put(r.Context(), "flashError", msg)
+			http.Redirect(w, r, "/trash/", http.StatusSeeOther)
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	msg := fmt.Sprintf("%s has been restored.", item.Name)
+	app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+	http.Redirect(w, r, trashItemURL(item), http.StatusSeeOther)
+}
+
+func (app *app) trashPurgePOST(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := readTrashItemParams(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	item, err := app.trash.GetOneByID(userID, itemType, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	files, err := app.trash.Purge(userID, itemType, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDeleteBlocked):
+			msg := fmt.Sprintf(
+				"%s cannot be permanently deleted while other records in the "+
+					"trash refer to it. Please delete those first.",
+				item.Name,
+			)
+			app.sessionManager.Put(r.Context(), "flashError", msg)
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+			return
+		default:
+			app.serverError(w, r, err)
+			return
+		}
+	} else {
+		app.deleteFiles(files)
+
+		msg := fmt.Sprintf("%s has been permanently deleted.", item.Name)
+		app.sessionManager.Put(r.Context(), "flashSuccess", msg)
+	}
+
+	http.Redirect(w, r, "/trash/", http.StatusSeeOther)
+}
+
+// deleteFiles deletes the files with the given keys from the file store once
+// the records that they belonged to have been purged. The files are no longer
+// referred to, so failing to delete one only leaves an orphaned file behind.
+func (app *app) deleteFiles(keys []string) {
+	for _, key := range keys {
+		err := app.files.Delete(key)
+		if err != nil {
+			app.log.Error("Failed to delete purged file", "key", key, "error", err.Error())
+		}
+	}
+}
+
+// purgeExpiredTrash permanently deletes the records that have been in the trash
+// for longer than the retention period, then again after every interval. It
+// never returns, so should be run in its own goroutine.
+func (app *app) purgeExpiredTrash(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, files, err := app.trash.PurgeExpired(time.Now().Add(-app.config.trashRetention))
+		if err != nil {
+			app.log.Error("Failed to purge expired trash", "error", err.Error())
+		} else if purged > 0 {
+			app.log.Info("Purged expired trash", "records", purged)
+			app.deleteFiles(files)
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,159 @@
+// Package ical writes iCalendar (RFC 5545) feeds made up of simple events so
+// that they can be subscribed to from calendar applications.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineLength is the maximum length in octets of a content line, excluding
+// the line break, after which it must be folded.
+const maxLineLength = 75
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405Z"
+)
+
+// Event is a single VEVENT in a Calendar. The UID must remain the same for the
+// lifetime of the thing the event represents so that calendar applications
+// replace their copy of it when it changes rather than adding a new one.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Latitude    *float64
+	Longitude   *float64
+	Start       time.Time
+	End         time.Time
+	// AllDay events only use the date of Start and End and last until the end
+	// of the End date.
+	AllDay   bool
+	Modified time.Time
+}
+
+// Calendar is a VCALENDAR containing a list of events.
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// escape escapes the characters in s that have a special meaning in TEXT
+// property values.
+func escape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	)
+	return r.Replace(s)
+}
+
+// fold splits line into content lines of no more than maxLineLength octets,
+// each continuation line beginning with a single space, without splitting any
+// multi-byte UTF-8 characters.
+func fold(line string) string {
+	var sb strings.Builder
+
+	limit := maxLineLength
+	for len(line) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+
+		sb.WriteString(line[:i])
+		sb.WriteString("\r\n ")
+		line = line[i:]
+
+		// Continuation lines lose one octet to the leading space.
+		limit = maxLineLength - 1
+	}
+	sb.WriteString(line)
+
+	return sb.String()
+}
+
+// WriteTo writes the calendar to w as a complete iCalendar stream.
+func (c Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	line := func(format string, a ...any) {
+		fmt.Fprint(cw, fold(fmt.Sprintf(format, a...)), "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:%s", c.ProdID)
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME:%s", escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN:VEVENT")
+		line("UID:%s", e.UID)
+		line("DTSTAMP:%s", e.Modified.UTC().Format(dateTimeFormat))
+		line("LAST-MODIFIED:%s", e.Modified.UTC().Format(dateTimeFormat))
+
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE:%s", e.Start.Format(dateFormat))
+			line("DTEND;VALUE=DATE:%s", e.End.AddDate(0, 0, 1).Format(dateFormat))
+		} else {
+			line("DTSTART:%s", e.Start.UTC().Format(dateTimeFormat))
+			line("DTEND:%s", e.End.UTC().Format(dateTimeFormat))
+		}
+
+		line("SUMMARY:%s", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:%s", escape(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION:%s", escape(e.Location))
+		}
+		if e.Latitude != nil && e.Longitude != nil {
+			line("GEO:%.6f;%.6f", *e.Latitude, *e.Longitude)
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+
+	return cw.n, cw.w.Flush()
+}
+
+// countingWriter keeps track of the number of bytes written so far. The first
+// error is kept and all further writes are ignored.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+
+	return n, err
+}
@@ -0,0 +1,86 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestCalendarWriteTo(t *testing.T) {
+	bangkok := time.FixedZone("ICT", 7*60*60)
+	lat, lon := 9.95, 99.99
+
+	cal := Calendar{
+		ProdID: "-//DiveSite//Log Book//EN",
+		Name:   "Alice's Diving",
+		Events: []Event{
+			{
+				UID:       "dive-1@divesite",
+				Summary:   "Dive #1: Sail Rock",
+				Location:  "Sail Rock, Thailand",
+				Latitude:  &lat,
+				Longitude: &lon,
+				Start:     time.Date(2020, 1, 20, 9, 30, 0, 0, bangkok),
+				End:       time.Date(2020, 1, 20, 10, 15, 0, 0, bangkok),
+				Modified:  time.Date(2020, 1, 21, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				UID:         "trip-1@divesite",
+				Summary:     "Big Splash Liveaboard",
+				Description: "Operator: Big Bubbles\nSharks; lots of them",
+				Start:       time.Date(2020, 1, 17, 0, 0, 0, 0, bangkok),
+				End:         time.Date(2020, 1, 24, 0, 0, 0, 0, bangkok),
+				AllDay:      true,
+				Modified:    time.Date(2020, 1, 25, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	n, err := cal.WriteTo(&buf)
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(buf.Len()))
+
+	out := buf.String()
+	assert.Equal(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"), true)
+	assert.Equal(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"), true)
+	assert.Equal(t, strings.Count(out, "BEGIN:VEVENT"), 2)
+	assert.StringContains(t, out, "X-WR-CALNAME:Alice's Diving\r\n")
+	assert.StringContains(t, out, "DTSTART:20200120T023000Z\r\nDTEND:20200120T031500Z\r\n")
+	assert.StringContains(t, out, `LOCATION:Sail Rock\, Thailand`)
+	assert.StringContains(t, out, "GEO:9.950000;99.990000\r\n")
+	assert.StringContains(t, out, "DTSTART;VALUE=DATE:20200117\r\nDTEND;VALUE=DATE:20200125\r\n")
+	assert.StringContains(t, out, `DESCRIPTION:Operator: Big Bubbles\nSharks\; lots of them`)
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"Short", "SUMMARY:Sail Rock"},
+		{"ASCII", "DESCRIPTION:" + strings.Repeat("Whale shark! ", 20)},
+		{"Multi-byte", "DESCRIPTION:" + strings.Repeat("🐠🦈", 40)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			folded := fold(tt.line)
+			lines := strings.Split(folded, "\r\n")
+
+			for i, l := range lines {
+				assert.Equal(t, len(l) <= maxLineLength, true)
+				assert.Equal(t, utf8.ValidString(l), true)
+				if i > 0 {
+					assert.Equal(t, strings.HasPrefix(l, " "), true)
+				}
+			}
+
+			assert.Equal(t, strings.ReplaceAll(folded, "\r\n ", ""), tt.line)
+		})
+	}
+}
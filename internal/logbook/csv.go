@@ -0,0 +1,607 @@
+package logbook
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVField is a field of a Dive that a column of a CSV log book can be mapped
+// onto. Aliases are alternative column headings, in lower case and with words
+// separated by single spaces, that are recognised by GuessCSVMapping.
+type CSVField struct {
+	Key     string
+	Label   string
+	Aliases []string
+}
+
+// CSVFields lists every field that a CSV column can be mapped onto. Dive sites,
+// buddies, trips and all static data are given by name and are looked up when
+// the dives are imported.
+var CSVFields = []CSVField{
+	{"number", "Dive Number", []string{"#", "no", "dive", "dive no", "dive #"}},
+	{"activity", "Activity", []string{"type", "dive type"}},
+	{"date_time_in", "Date & Time In", []string{"datetime", "date time", "date/time", "start"}},
+	{"date", "Date", []string{"dive date", "day"}},
+	{"time", "Time In", []string{"time in", "entry time", "start time"}},
+	{"dive_site", "Dive Site", []string{"site", "site name", "location"}},
+	{"buddy", "Buddy", []string{"buddies", "dive buddy"}},
+	{"buddy_role", "Buddy Role", []string{"role"}},
+	{"operator", "Operator", []string{"dive centre", "dive center", "dive shop"}},
+	{"trip", "Trip", []string{"trip name"}},
+	{"certification", "Certification", []string{"course"}},
+	{"price", "Price", []string{"cost"}},
+	{"currency", "Currency", []string{"price currency"}},
+	{"max_depth", "Max Depth", []string{"depth", "maximum depth"}},
+	{"avg_depth", "Average Depth", []string{"average depth", "mean depth"}},
+	{"bottom_time", "Bottom Time", []string{"bottom time mins", "duration", "dive time", "time underwater"}},
+	{"safety_stop", "Safety Stop", []string{"safety stop mins"}},
+	{"surface_interval", "Surface Interval", []string{"surface interval mins", "si"}},
+	{"water_temp", "Water Temperature", []string{"water temperature", "temp", "temperature"}},
+	{"air_temp", "Air Temperature", []string{"air temperature"}},
+	{"visibility", "Visibility", []string{"vis"}},
+	{"current", "Current", nil},
+	{"waves", "Waves", []string{"surface", "sea state"}},
+	{"weight", "Weight", []string{"weights", "weight used"}},
+	{"weight_notes", "Weight Notes", nil},
+	{"equipment", "Equipment", []string{"gear"}},
+	{"equipment_notes", "Equipment Notes", []string{"gear notes"}},
+	{"tank_configuration", "Tank Configuration", nil},
+	{"tank_material", "Tank Material", nil},
+	{"tank_volume", "Tank Volume (litres)", []string{"tank size", "cylinder size"}},
+	{"gas_mix", "Gas Mix", []string{"gas"}},
+	{"fo2", "FO2", []string{"o2", "o2 %", "oxygen"}},
+	{"pressure_in", "Pressure In", []string{"start pressure"}},
+	{"pressure_out", "Pressure Out", []string{"end pressure"}},
+	{"gas_mix_notes", "Gas Mix Notes", []string{"gas notes"}},
+	{"entry_point", "Entry Point", []string{"entry"}},
+	{"properties", "Properties", []string{"tags"}},
+	{"rating", "Rating", []string{"stars"}},
+	{"notes", "Notes", []string{"comments", "description"}},
+}
+
+// Units that the values in a CSV log book can be given in. All values are
+// converted to the metric units used by Dive when the file is parsed.
+const (
+	DepthMetres = "m"
+	DepthFeet   = "ft"
+
+	TempCelsius    = "c"
+	TempFahrenheit = "f"
+
+	PressureBar = "bar"
+	PressurePSI = "psi"
+
+	WeightKilograms = "kg"
+	WeightPounds    = "lb"
+
+	DurationMinutes   = "min"
+	DurationSeconds   = "s"
+	DurationMinsSecs  = "mm:ss"
+	DurationHoursMins = "h:mm"
+)
+
+const (
+	metresPerFoot     = 0.3048
+	barPerPSI         = 0.0689475729
+	kilogramsPerPound = 0.45359237
+)
+
+// csvListSeparator separates the names in columns that hold a list, such as
+// equipment and dive properties.
+const csvListSeparator = ";"
+
+// CSVDateFormat is one of the date formats that the dates in a CSV log book
+// can be written in. Layout is a time.Parse layout for just the date; dates may
+// be followed by a time when mapped onto the "date_time_in" field.
+type CSVDateFormat struct {
+	Layout string
+	Label  string
+}
+
+// CSVDateFormats lists the supported date formats. The layouts do not require
+// leading zeroes, so they also match dates such as "2/3/2024".
+var CSVDateFormats = []CSVDateFormat{
+	{"2006-1-2", "YYYY-MM-DD"},
+	{"2/1/2006", "DD/MM/YYYY"},
+	{"1/2/2006", "MM/DD/YYYY"},
+	{"2.1.2006", "DD.MM.YYYY"},
+	{"2-1-2006", "DD-MM-YYYY"},
+}
+
+// csvTimeLayouts are the layouts tried in turn when parsing a time of day.
+var csvTimeLayouts = []string{"15:04:05", "15:04", "3:04:05 PM", "3:04 PM", "3:04PM"}
+
+// CSVMapping describes how to read a CSV log book. Columns holds the key of
+// the CSVField that each column is mapped onto, by column index, with the
+// empty string for columns that should be ignored.
+type CSVMapping struct {
+	Columns      []string
+	DateFormat   string
+	DepthUnit    string
+	TempUnit     string
+	PressureUnit string
+	WeightUnit   string
+	DurationUnit string
+}
+
+// CSVRow is a single dive read from a CSV log book. Line is the line number of
+// the row in the file and Errors maps the keys of any fields whose values could
+// not be read to a message describing the problem.
+type CSVRow struct {
+	Line   int
+	Dive   Dive
+	Errors map[string]string
+}
+
+// normaliseCSVHeader lower-cases a column heading and replaces underscores,
+// hyphens and runs of white space with a single space.
+func normaliseCSVHeader(header string) string {
+	header = strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(header))
+	return strings.Join(strings.Fields(header), " ")
+}
+
+// GuessCSVMapping suggests the field that each of the given column headings
+// should be mapped onto by comparing them to the keys, labels and aliases of
+// the CSVFields. Each field is only suggested for the first matching column.
+func GuessCSVMapping(headers []string) []string {
+	return guessCSVColumns(headers, CSVFields)
+}
+
+// guessCSVColumns matches each of the column headings against the keys, labels
+// and aliases of the given fields.
+func guessCSVColumns(headers []string, fields []CSVField) []string {
+	columns := make([]string, len(headers))
+	used := map[string]bool{}
+
+	for i, header := range headers {
+		header = normaliseCSVHeader(header)
+
+		for _, field := range fields {
+			if used[field.Key] {
+				continue
+			}
+
+			names := append(
+				[]string{normaliseCSVHeader(field.Key), normaliseCSVHeader(field.Label)},
+				field.Aliases...,
+			)
+			for _, name := range names {
+				if header == name {
+					columns[i] = field.Key
+					used[field.Key] = true
+					break
+				}
+			}
+
+			if columns[i] != "" {
+				break
+			}
+		}
+	}
+
+	return columns
+}
+
+// ReadCSVHeader reads the column headings and up to n rows of a CSV log book
+// so that they can be shown to the user when choosing a CSVMapping.
+func ReadCSVHeader(r io.Reader, n int) ([]string, [][]string, error) {
+	cr := newCSVReader(r)
+
+	headers, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("csv file is empty")
+		}
+		return nil, nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	for i, header := range headers {
+		headers[i] = strings.TrimSpace(header)
+	}
+
+	var rows [][]string
+	for len(rows) < n {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read csv row: %w", err)
+		}
+		rows = append(rows, record)
+	}
+
+	return headers, rows, nil
+}
+
+// newCSVReader returns a csv.Reader that tolerates rows with differing numbers
+// of fields and any UTF-8 byte order mark at the start of the file, both of
+// which are common in spreadsheet exports.
+func newCSVReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(&bomSkipper{r: r})
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	return cr
+}
+
+// bomSkipper is an io.Reader that drops a UTF-8 byte order mark from the start
+// of the underlying reader.
+type bomSkipper struct {
+	r       io.Reader
+	checked bool
+}
+
+func (b *bomSkipper) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if !b.checked && n > 0 {
+		b.checked = true
+		if n >= 3 && p[0] == 0xEF && p[1] == 0xBB && p[2] == 0xBF {
+			n = copy(p, p[3:n])
+		}
+	}
+	return n, err
+}
+
+// ParseCSV reads every row of a CSV log book after the header row using the
+// given mapping. Rows that are entirely empty are skipped. Values that cannot be
+// read are reported in the Errors of the row rather than failing the whole file,
+// so that they can be shown to the user alongside any validation errors.
+func ParseCSV(r io.Reader, m CSVMapping) ([]CSVRow, error) {
+	cr := newCSVReader(r)
+
+	_, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	var rows []CSVRow
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv row: %w", err)
+		}
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, m.parseRow(line, record))
+	}
+
+	return rows, nil
+}
+
+// parseRow maps a single CSV record onto a Dive.
+func (m CSVMapping) parseRow(line int, record []string) CSVRow {
+	row := CSVRow{Line: line, Errors: map[string]string{}}
+	d := &row.Dive
+	cylinder := Cylinder{}
+
+	var date, timeOfDay time.Time
+	var hasDate, hasTime bool
+
+	fail := func(key, msg string) {
+		if _, ok := row.Errors[key]; !ok {
+			row.Errors[key] = msg
+		}
+	}
+
+	number := func(key, value string) (float64, bool) {
+		f, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			fail(key, fmt.Sprintf("%q is not a valid number", value))
+			return 0, false
+		}
+		return f, true
+	}
+
+	duration := func(key, value string) (time.Duration, bool) {
+		dur, err := parseCSVDuration(value, m.DurationUnit)
+		if err != nil {
+			fail(key, fmt.Sprintf("%q is not a valid duration", value))
+			return 0, false
+		}
+		return dur, true
+	}
+
+	for i, key := range m.Columns {
+		if key == "" || i >= len(record) {
+			continue
+		}
+
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+
+		switch key {
+		case "number":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				fail(key, fmt.Sprintf("%q is not a whole number", value))
+				continue
+			}
+			d.Number = n
+		case "activity":
+			d.Activity = value
+		case "date_time_in":
+			t, err := m.parseDateTime(value)
+			if err != nil {
+				fail(key, fmt.Sprintf("%q is not a date and time in the chosen format", value))
+				continue
+			}
+			d.DateTimeIn = t
+		case "date":
+			t, err := time.Parse(m.DateFormat, value)
+			if err != nil {
+				fail(key, fmt.Sprintf("%q is not a date in the chosen format", value))
+				continue
+			}
+			date, hasDate = t, true
+		case "time":
+			t, err := parseCSVTime(value)
+			if err != nil {
+				fail(key, fmt.Sprintf("%q is not a valid time", value))
+				continue
+			}
+			timeOfDay, hasTime = t, true
+		case "dive_site":
+			d.Site = &Site{Name: value}
+		case "buddy":
+			d.Buddies = []string{value}
+		case "buddy_role":
+			d.BuddyRole = value
+		case "operator":
+			d.Operator = value
+		case "trip":
+			d.Trip = &Trip{Name: value}
+		case "certification":
+			d.Certification = value
+		case "price":
+			if f, ok := number(key, value); ok {
+				d.Price = &f
+			}
+		case "currency":
+			d.Currency = strings.ToUpper(value)
+		case "max_depth":
+			if f, ok := number(key, value); ok {
+				d.MaxDepth = m.depth(f)
+			}
+		case "avg_depth":
+			if f, ok := number(key, value); ok {
+				d.AvgDepth = ref(m.depth(f))
+			}
+		case "bottom_time":
+			if dur, ok := duration(key, value); ok {
+				d.Duration = dur
+			}
+		case "safety_stop":
+			if dur, ok := duration(key, value); ok {
+				d.SafetyStop = &dur
+			}
+		case "surface_interval":
+			if dur, ok := duration(key, value); ok {
+				d.SurfaceInterval = &dur
+			}
+		case "water_temp":
+			if f, ok := number(key, value); ok {
+				d.WaterTemp = ref(m.temperature(f))
+			}
+		case "air_temp":
+			if f, ok := number(key, value); ok {
+				d.AirTemp = ref(m.temperature(f))
+			}
+		case "visibility":
+			if f, ok := number(key, value); ok {
+				d.Visibility = ref(m.depth(f))
+			}
+		case "current":
+			d.Current = value
+		case "waves":
+			d.Waves = value
+		case "weight":
+			if f, ok := number(key, value); ok {
+				d.Weight = ref(m.weight(f))
+			}
+		case "weight_notes":
+			d.WeightNotes = value
+		case "equipment":
+			d.Equipment = splitCSVList(value)
+		case "equipment_notes":
+			d.EquipmentNotes = value
+		case "tank_configuration":
+			d.TankConfiguration = value
+		case "tank_material":
+			d.TankMaterial = value
+		case "tank_volume":
+			if f, ok := number(key, value); ok {
+				cylinder.Volume = &f
+			}
+		case "gas_mix":
+			cylinder.Mix = value
+		case "fo2":
+			if f, ok := number(key, strings.TrimSuffix(value, "%")); ok {
+				// Accept both fractions such as 0.32 and percentages such as 32.
+				if f > 1 {
+					f /= 100
+				}
+				cylinder.O2 = f
+			}
+		case "pressure_in":
+			if f, ok := number(key, value); ok {
+				cylinder.StartPressure = ref(m.pressure(f))
+			}
+		case "pressure_out":
+			if f, ok := number(key, value); ok {
+				cylinder.EndPressure = ref(m.pressure(f))
+			}
+		case "gas_mix_notes":
+			d.GasMixNotes = value
+		case "entry_point":
+			d.EntryPoint = value
+		case "properties":
+			d.Properties = splitCSVList(value)
+		case "rating":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				fail(key, fmt.Sprintf("%q is not a whole number", value))
+				continue
+			}
+			d.Rating = &n
+		case "notes":
+			d.Notes = value
+		}
+	}
+
+	if hasDate {
+		d.DateTimeIn = time.Date(
+			date.Year(), date.Month(), date.Day(),
+			timeOfDay.Hour(), timeOfDay.Minute(), timeOfDay.Second(), 0,
+			time.UTC,
+		)
+	} else if hasTime && !d.DateTimeIn.IsZero() {
+		d.DateTimeIn = time.Date(
+			d.DateTimeIn.Year(), d.DateTimeIn.Month(), d.DateTimeIn.Day(),
+			timeOfDay.Hour(), timeOfDay.Minute(), timeOfDay.Second(), 0,
+			time.UTC,
+		)
+	}
+
+	d.Cylinders = []Cylinder{cylinder}
+
+	return row
+}
+
+// parseDateTime parses a combined date and time. RFC 3339 timestamps, such as
+// those written by the CSV export, are always accepted; the wall-clock time is
+// kept and the offset discarded. Otherwise, the value must start with a date in
+// the mapping's DateFormat, optionally followed by a time.
+func (m CSVMapping) parseDateTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return time.Date(
+			t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC,
+		), nil
+	}
+
+	datePart, timePart, _ := strings.Cut(strings.Replace(value, "T", " ", 1), " ")
+
+	date, err := time.Parse(m.DateFormat, datePart)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if strings.TrimSpace(timePart) == "" {
+		return date, nil
+	}
+
+	tod, err := parseCSVTime(strings.TrimSpace(timePart))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Date(
+		date.Year(), date.Month(), date.Day(),
+		tod.Hour(), tod.Minute(), tod.Second(), 0,
+		time.UTC,
+	), nil
+}
+
+// parseCSVTime parses a time of day in any of the csvTimeLayouts.
+func parseCSVTime(value string) (time.Time, error) {
+	var err error
+	for _, layout := range csvTimeLayouts {
+		var t time.Time
+		t, err = time.Parse(layout, strings.ToUpper(value))
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+// parseCSVDuration parses a duration given in the unit, which must be one of
+// the Duration constants.
+func parseCSVDuration(value, unit string) (time.Duration, error) {
+	switch unit {
+	case DurationMinsSecs, DurationHoursMins:
+		major, minor, found := strings.Cut(value, ":")
+		if !found {
+			minor = "0"
+		}
+
+		a, err := strconv.Atoi(major)
+		if err != nil {
+			return 0, err
+		}
+		b, err := strconv.Atoi(minor)
+		if err != nil || b < 0 || b >= 60 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+
+		if unit == DurationMinsSecs {
+			return time.Duration(a)*time.Minute + time.Duration(b)*time.Second, nil
+		}
+		return time.Duration(a)*time.Hour + time.Duration(b)*time.Minute, nil
+	}
+
+	f, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	if unit == DurationSeconds {
+		return time.Duration(f * float64(time.Second)).Round(time.Second), nil
+	}
+	return time.Duration(f * float64(time.Minute)).Round(time.Second), nil
+}
+
+// splitCSVList splits a list of names separated by semicolons.
+func splitCSVList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, csvListSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (m CSVMapping) depth(v float64) float64 {
+	if m.DepthUnit == DepthFeet {
+		return v * metresPerFoot
+	}
+	return v
+}
+
+func (m CSVMapping) temperature(v float64) float64 {
+	if m.TempUnit == TempFahrenheit {
+		return (v - 32) * 5 / 9
+	}
+	return v
+}
+
+func (m CSVMapping) pressure(v float64) float64 {
+	if m.PressureUnit == PressurePSI {
+		return v * barPerPSI
+	}
+	return v
+}
+
+func (m CSVMapping) weight(v float64) float64 {
+	if m.WeightUnit == WeightPounds {
+		return v * kilogramsPerPound
+	}
+	return v
+}
@@ -0,0 +1,83 @@
+package logbook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+const csvTestLog = "\xEF\xBB\xBFDive #,Date,Time,Site,Depth (ft),Duration,Water Temp,O2,Gear,Comments\n" +
+	"7,14/03/2024,9:05 AM,Sail Rock,66,45:30,82,32%,Computer; Torch,Whale shark!\n" +
+	",,,,,,,,,\n" +
+	"8,15/03/2024,14:10,Chumphon Pinnacle,deep,50:00,,,,\n"
+
+func TestGuessCSVMapping(t *testing.T) {
+	headers := []string{"Dive #", "Date", "Time", "Site", "Max_Depth", "Bottom Time Mins", "Unknown", "depth"}
+
+	columns := GuessCSVMapping(headers)
+
+	assert.Equal(t, strings.Join(columns, ","), "number,date,time,dive_site,max_depth,bottom_time,,")
+}
+
+func TestParseCSV(t *testing.T) {
+	mapping := CSVMapping{
+		Columns: []string{
+			"number", "date", "time", "dive_site", "max_depth", "bottom_time",
+			"water_temp", "fo2", "equipment", "notes",
+		},
+		DateFormat:   "2/1/2006",
+		DepthUnit:    DepthFeet,
+		TempUnit:     TempFahrenheit,
+		PressureUnit: PressureBar,
+		WeightUnit:   WeightKilograms,
+		DurationUnit: DurationMinsSecs,
+	}
+
+	rows, err := ParseCSV(strings.NewReader(csvTestLog), mapping)
+	assert.NilError(t, err)
+	assert.Equal(t, len(rows), 2)
+
+	first := rows[0]
+	assert.Equal(t, first.Line, 2)
+	assert.Equal(t, len(first.Errors), 0)
+	assert.Equal(t, first.Dive.Number, 7)
+	assert.Equal(t, first.Dive.DateTimeIn.Format(time.DateTime), "2024-03-14 09:05:00")
+	assert.Equal(t, first.Dive.Site.Name, "Sail Rock")
+	assert.Equal(t, first.Dive.MaxDepth, 66*metresPerFoot)
+	assert.Equal(t, first.Dive.Duration, 45*time.Minute+30*time.Second)
+	assert.Equal(t, *first.Dive.WaterTemp, 27.77777777777778)
+	assert.Equal(t, first.Dive.Cylinder().FO2(), 0.32)
+	assert.Equal(t, strings.Join(first.Dive.Equipment, "|"), "Computer|Torch")
+	assert.Equal(t, first.Dive.Notes, "Whale shark!")
+
+	second := rows[1]
+	assert.Equal(t, second.Line, 4)
+	assert.Equal(t, second.Dive.DateTimeIn.Format(time.DateTime), "2024-03-15 14:10:00")
+	assert.Equal(t, second.Errors["max_depth"], `"deep" is not a valid number`)
+	assert.Equal(t, second.Dive.Cylinder().GasMixName(), "Air")
+}
+
+func TestParseCSVDateTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+		value  string
+		want   string
+	}{
+		{"RFC 3339", "2/1/2006", "2020-01-19T14:21:00+07:00", "2020-01-19 14:21:00"},
+		{"ISO", "2006-1-2", "2024-03-02 09:15", "2024-03-02 09:15:00"},
+		{"US", "1/2/2006", "3/2/2024 2:30 PM", "2024-03-02 14:30:00"},
+		{"Date only", "2.1.2006", "02.03.2024", "2024-03-02 00:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := CSVMapping{DateFormat: tt.layout}
+			got, err := m.parseDateTime(tt.value)
+			assert.NilError(t, err)
+			assert.Equal(t, got.Format(time.DateTime), tt.want)
+		})
+	}
+}
@@ -0,0 +1,513 @@
+package logbook
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// Global message numbers from the FIT profile of the messages that are read by
+// ParseFIT.
+const (
+	fitMesgFileID      = 0
+	fitMesgSession     = 18
+	fitMesgRecord      = 20
+	fitMesgActivity    = 34
+	fitMesgDiveGas     = 259
+	fitMesgDiveSummary = 268
+	fitMesgTankUpdate  = 319
+	fitMesgTankSummary = 323
+)
+
+const (
+	// fitFieldTimestamp is the field number used for the timestamp of every
+	// message that has one.
+	fitFieldTimestamp = 253
+	// fitFileActivity is the file_id type of an activity file.
+	fitFileActivity = 4
+	// fitSportDiving is the session sport of a dive.
+	fitSportDiving = 53
+	// fitDiveGasEnabled is the dive_gas status of a gas that was enabled on the
+	// dive computer.
+	fitDiveGasEnabled = 1
+)
+
+// fitEpoch is the start of the FIT epoch, from which all FIT timestamps are
+// counted in seconds.
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// fitCRCTable is the lookup table used to calculate the CRC-16 of a FIT file.
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// fitCRC returns the CRC-16 of the given bytes as used by FIT files.
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
+
+// fitBaseTypeSizes holds the size in bytes of each numeric FIT base type, keyed
+// by the base type number.
+var fitBaseTypeSizes = map[byte]int{
+	0x00: 1, 0x01: 1, 0x02: 1, 0x0A: 1, 0x0D: 1,
+	0x03: 2, 0x04: 2, 0x0B: 2,
+	0x05: 4, 0x06: 4, 0x08: 4, 0x0C: 4,
+	0x09: 8, 0x0E: 8, 0x0F: 8, 0x10: 8,
+}
+
+type fitFieldDef struct {
+	num      byte
+	size     int
+	baseType byte
+}
+
+type fitDefinition struct {
+	global    uint16
+	bigEndian bool
+	fields    []fitFieldDef
+	devSize   int
+}
+
+// fitMessage is a decoded FIT data message. Only numeric fields are kept and
+// fields holding the invalid value for their base type are left out. Array
+// fields only hold their first element. No scale or offset has been applied.
+type fitMessage struct {
+	global uint16
+	fields map[byte]float64
+}
+
+func (m fitMessage) value(num byte) (float64, bool) {
+	v, ok := m.fields[num]
+	return v, ok
+}
+
+func (m fitMessage) time(num byte) (time.Time, bool) {
+	v, ok := m.fields[num]
+	if !ok {
+		return time.Time{}, false
+	}
+	return fitEpoch.Add(time.Duration(v) * time.Second), true
+}
+
+// decodeFITValue decodes a single value of the given base type from b, which
+// must hold at least one value of the type. The returned bool is false if the
+// value is the invalid value for the type or the type is not numeric.
+func decodeFITValue(b []byte, baseType byte, order binary.ByteOrder) (float64, bool) {
+	t := baseType & 0x1F
+	if n, ok := fitBaseTypeSizes[t]; !ok || len(b) < n {
+		return 0, false
+	}
+
+	switch t {
+	case 0x00, 0x02, 0x0D:
+		return float64(b[0]), b[0] != 0xFF
+	case 0x01:
+		return float64(int8(b[0])), b[0] != 0x7F
+	case 0x0A:
+		return float64(b[0]), b[0] != 0x00
+	case 0x03:
+		v := order.Uint16(b)
+		return float64(int16(v)), v != 0x7FFF
+	case 0x04:
+		v := order.Uint16(b)
+		return float64(v), v != 0xFFFF
+	case 0x0B:
+		v := order.Uint16(b)
+		return float64(v), v != 0x0000
+	case 0x05:
+		v := order.Uint32(b)
+		return float64(int32(v)), v != 0x7FFFFFFF
+	case 0x06:
+		v := order.Uint32(b)
+		return float64(v), v != 0xFFFFFFFF
+	case 0x0C:
+		v := order.Uint32(b)
+		return float64(v), v != 0x00000000
+	case 0x08:
+		v := order.Uint32(b)
+		return float64(math.Float32frombits(v)), v != 0xFFFFFFFF
+	case 0x09:
+		v := order.Uint64(b)
+		return math.Float64frombits(v), v != 0xFFFFFFFFFFFFFFFF
+	case 0x0E:
+		v := order.Uint64(b)
+		return float64(int64(v)), v != 0x7FFFFFFFFFFFFFFF
+	case 0x0F:
+		v := order.Uint64(b)
+		return float64(v), v != 0xFFFFFFFFFFFFFFFF
+	case 0x10:
+		v := order.Uint64(b)
+		return float64(v), v != 0
+	}
+
+	return 0, false
+}
+
+// decodeFIT reads every data message from a FIT file after checking its header
+// and CRC. Messages from chained FIT files after the first are ignored.
+func decodeFIT(data []byte) ([]fitMessage, error) {
+	if len(data) < 12 {
+		return nil, errors.New("file is too short to be a fit file")
+	}
+
+	headerSize := int(data[0])
+	if headerSize < 12 || string(data[8:12]) != ".FIT" {
+		return nil, errors.New("invalid fit file header")
+	}
+
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+	if len(data) < end+2 {
+		return nil, errors.New("fit file is truncated")
+	}
+
+	crc := binary.LittleEndian.Uint16(data[end : end+2])
+	if crc != 0 && crc != fitCRC(data[:end]) {
+		return nil, errors.New("fit file failed its crc check")
+	}
+
+	definitions := map[byte]fitDefinition{}
+	var messages []fitMessage
+	var lastTimestamp uint32
+
+	pos := headerSize
+	for pos < end {
+		header := data[pos]
+		pos++
+
+		var local byte
+		var compressedTime *uint32
+
+		switch {
+		case header&0x80 != 0:
+			// A compressed timestamp header gives the time as an offset from
+			// the last full timestamp.
+			local = (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			ts := lastTimestamp&^0x1F + offset
+			if offset < lastTimestamp&0x1F {
+				ts += 0x20
+			}
+			lastTimestamp = ts
+			compressedTime = &ts
+		case header&0x40 != 0:
+			def, n, err := decodeFITDefinition(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			definitions[header&0x0F] = def
+			pos += n
+			continue
+		default:
+			local = header & 0x0F
+		}
+
+		def, ok := definitions[local]
+		if !ok {
+			return nil, fmt.Errorf("fit data message refers to undefined local message %d", local)
+		}
+
+		var order binary.ByteOrder = binary.LittleEndian
+		if def.bigEndian {
+			order = binary.BigEndian
+		}
+
+		msg := fitMessage{global: def.global, fields: map[byte]float64{}}
+		for _, f := range def.fields {
+			if pos+f.size > end {
+				return nil, errors.New("fit data message is truncated")
+			}
+			if v, ok := decodeFITValue(data[pos:pos+f.size], f.baseType, order); ok {
+				msg.fields[f.num] = v
+			}
+			pos += f.size
+		}
+		pos += def.devSize
+
+		if ts, ok := msg.fields[fitFieldTimestamp]; ok {
+			lastTimestamp = uint32(ts)
+		} else if compressedTime != nil {
+			msg.fields[fitFieldTimestamp] = float64(*compressedTime)
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// decodeFITDefinition decodes the definition message at the start of b and
+// returns it along with its length in bytes.
+func decodeFITDefinition(b []byte, hasDevFields bool) (fitDefinition, int, error) {
+	truncated := errors.New("fit definition message is truncated")
+
+	if len(b) < 5 {
+		return fitDefinition{}, 0, truncated
+	}
+
+	def := fitDefinition{bigEndian: b[1] == 1}
+	if def.bigEndian {
+		def.global = binary.BigEndian.Uint16(b[2:4])
+	} else {
+		def.global = binary.LittleEndian.Uint16(b[2:4])
+	}
+
+	count := int(b[4])
+	pos := 5
+	if len(b) < pos+count*3 {
+		return fitDefinition{}, 0, truncated
+	}
+
+	for range count {
+		def.fields = append(def.fields, fitFieldDef{
+			num:      b[pos],
+			size:     int(b[pos+1]),
+			baseType: b[pos+2],
+		})
+		pos += 3
+	}
+
+	if hasDevFields {
+		if len(b) < pos+1 {
+			return fitDefinition{}, 0, truncated
+		}
+		devCount := int(b[pos])
+		pos++
+		if len(b) < pos+devCount*3 {
+			return fitDefinition{}, 0, truncated
+		}
+		for range devCount {
+			def.devSize += int(b[pos+1])
+			pos += 3
+		}
+	}
+
+	return def, pos, nil
+}
+
+// ParseFIT reads a Garmin FIT activity file, such as one exported from a
+// Garmin Descent dive computer, from r and returns the dives within it in
+// chronological order. Each diving session in the file becomes a dive along
+// with its depth samples. FIT files do not name the dive site, so the Site of
+// each dive only has the GPS position the dive started at, if one was recorded.
+func ParseFIT(r io.Reader) ([]Dive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fit file: %w", err)
+	}
+
+	messages, err := decodeFIT(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode fit file: %w", err)
+	}
+
+	byType := map[uint16][]fitMessage{}
+	for _, m := range messages {
+		byType[m.global] = append(byType[m.global], m)
+	}
+
+	isActivity := slices.ContainsFunc(byType[fitMesgFileID], func(m fitMessage) bool {
+		t, ok := m.value(0)
+		return ok && t == fitFileActivity
+	})
+	if !isActivity {
+		return nil, errors.New("fit file is not an activity")
+	}
+
+	// The activity's local timestamp gives the offset of the dive computer's
+	// clock from UTC, which is rounded to the nearest quarter of an hour.
+	var utcOffset time.Duration
+	for _, m := range byType[fitMesgActivity] {
+		local, hasLocal := m.value(5)
+		ts, hasTS := m.value(fitFieldTimestamp)
+		if hasLocal && hasTS {
+			utcOffset = (time.Duration(local-ts) * time.Second).Round(15 * time.Minute)
+		}
+	}
+
+	var dives []Dive
+
+	for i, session := range byType[fitMesgSession] {
+		if sport, _ := session.value(5); sport != fitSportDiving {
+			continue
+		}
+
+		dive, err := newFITDive(session, i, byType, utcOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		dives = append(dives, dive)
+	}
+
+	if len(dives) == 0 {
+		return nil, errors.New("fit file does not contain a dive")
+	}
+
+	slices.SortStableFunc(dives, func(a, b Dive) int {
+		return a.DateTimeIn.Compare(b.DateTimeIn)
+	})
+
+	return dives, nil
+}
+
+// newFITDive builds a Dive from the session with the given index and the other
+// messages in the file that fall within it.
+func newFITDive(
+	session fitMessage,
+	index int,
+	byType map[uint16][]fitMessage,
+	utcOffset time.Duration,
+) (Dive, error) {
+	start, ok := session.time(2)
+	if !ok {
+		return Dive{}, fmt.Errorf("fit session %d has no start time", index)
+	}
+
+	elapsed, _ := session.value(7)
+	end := start.Add(time.Duration(elapsed) * time.Millisecond)
+
+	local := start.Add(utcOffset)
+	dive := Dive{
+		DateTimeIn: time.Date(
+			local.Year(), local.Month(), local.Day(),
+			local.Hour(), local.Minute(), local.Second(), 0, time.UTC,
+		),
+		Duration: end.Sub(start),
+	}
+
+	lat, hasLat := session.value(3)
+	lon, hasLon := session.value(4)
+	if hasLat && hasLon {
+		dive.Site = &Site{
+			Latitude:  ref(fitSemicirclesToDegrees(lat)),
+			Longitude: ref(fitSemicirclesToDegrees(lon)),
+		}
+	}
+
+	inSession := func(m fitMessage) (time.Duration, bool) {
+		t, ok := m.time(fitFieldTimestamp)
+		if !ok || t.Before(start) || (elapsed > 0 && t.After(end)) {
+			return 0, false
+		}
+		return t.Sub(start), true
+	}
+
+	for _, m := range byType[fitMesgRecord] {
+		t, ok := inSession(m)
+		if !ok {
+			continue
+		}
+
+		depth, ok := m.value(92)
+		if !ok {
+			continue
+		}
+
+		sample := Sample{Time: t, Depth: depth / 1000}
+		if temp, ok := m.value(13); ok {
+			sample.Temperature = &temp
+			if dive.WaterTemp == nil || temp < *dive.WaterTemp {
+				dive.WaterTemp = ref(temp)
+			}
+		}
+
+		dive.MaxDepth = max(dive.MaxDepth, sample.Depth)
+		dive.Samples = append(dive.Samples, sample)
+	}
+
+	// Only the pressures from the first paired tank are recorded in the
+	// samples as they can only hold one.
+	var sensor *float64
+	for _, m := range byType[fitMesgTankUpdate] {
+		t, ok := inSession(m)
+		pressure, hasPressure := m.value(1)
+		id, _ := m.value(0)
+		if !ok || !hasPressure || (sensor != nil && id != *sensor) {
+			continue
+		}
+		sensor = &id
+
+		for i := range dive.Samples {
+			if dive.Samples[i].Time >= t {
+				if dive.Samples[i].Pressure == nil {
+					dive.Samples[i].Pressure = ref(pressure / 100)
+				}
+				break
+			}
+		}
+	}
+
+	for _, m := range byType[fitMesgDiveSummary] {
+		ref18, _ := m.value(0)
+		refIndex, hasIndex := m.value(1)
+		if ref18 != fitMesgSession || (hasIndex && int(refIndex) != index) {
+			continue
+		}
+
+		if n, ok := m.value(10); ok {
+			dive.Number = int(n)
+		}
+		if v, ok := m.value(3); ok {
+			dive.MaxDepth = v / 1000
+		}
+		if v, ok := m.value(2); ok {
+			dive.AvgDepth = ref(v / 1000)
+		}
+		if v, ok := m.value(11); ok {
+			dive.Duration = time.Duration(v) * time.Millisecond
+		}
+		if v, ok := m.value(4); ok {
+			dive.SurfaceInterval = ref(time.Duration(v) * time.Second)
+		}
+	}
+
+	for _, m := range byType[fitMesgDiveGas] {
+		if status, ok := m.value(2); ok && status != fitDiveGasEnabled {
+			continue
+		}
+
+		o2, _ := m.value(1)
+		he, _ := m.value(0)
+		dive.Cylinders = append(dive.Cylinders, Cylinder{O2: o2 / 100, He: he / 100})
+	}
+
+	for _, m := range byType[fitMesgTankSummary] {
+		if _, ok := inSession(m); !ok {
+			continue
+		}
+
+		if len(dive.Cylinders) == 0 {
+			dive.Cylinders = append(dive.Cylinders, Cylinder{O2: 0.21})
+		}
+		if v, ok := m.value(1); ok {
+			dive.Cylinders[0].StartPressure = ref(v / 100)
+		}
+		if v, ok := m.value(2); ok {
+			dive.Cylinders[0].EndPressure = ref(v / 100)
+		}
+		break
+	}
+
+	return dive, nil
+}
+
+// fitSemicirclesToDegrees converts a FIT latitude or longitude from semicircles
+// into decimal degrees.
+func fitSemicirclesToDegrees(semicircles float64) float64 {
+	return semicircles * 180 / (1 << 31)
+}
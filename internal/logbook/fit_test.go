@@ -0,0 +1,180 @@
+package logbook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+// fitField is a single field written by fitBuilder. The value is written as
+// the given base type, which must be one of sint8, uint8, uint16, sint32 or
+// uint32.
+type fitField struct {
+	num      byte
+	baseType byte
+	value    int64
+}
+
+// fitBuilder writes minimal little-endian FIT files for use in tests. Each
+// message is written with its own definition using local message type 0.
+type fitBuilder struct {
+	data bytes.Buffer
+}
+
+func (b *fitBuilder) message(global uint16, fields ...fitField) {
+	sizes := map[byte]int{0x01: 1, 0x02: 1, 0x84: 2, 0x85: 4, 0x86: 4}
+
+	b.data.Write([]byte{0x40, 0, 0})
+	binary.Write(&b.data, binary.LittleEndian, global)
+	b.data.WriteByte(byte(len(fields)))
+	for _, f := range fields {
+		b.data.Write([]byte{f.num, byte(sizes[f.baseType]), f.baseType})
+	}
+
+	b.data.WriteByte(0x00)
+	for _, f := range fields {
+		switch sizes[f.baseType] {
+		case 1:
+			b.data.WriteByte(byte(f.value))
+		case 2:
+			binary.Write(&b.data, binary.LittleEndian, uint16(f.value))
+		case 4:
+			binary.Write(&b.data, binary.LittleEndian, uint32(f.value))
+		}
+	}
+}
+
+func (b *fitBuilder) bytes() []byte {
+	header := make([]byte, 12)
+	header[0] = 12
+	header[1] = 0x20
+	binary.LittleEndian.PutUint32(header[4:8], uint32(b.data.Len()))
+	copy(header[8:12], ".FIT")
+
+	file := append(header, b.data.Bytes()...)
+	return binary.LittleEndian.AppendUint16(file, fitCRC(file))
+}
+
+func fitTime(t time.Time) int64 {
+	return int64(t.Sub(fitEpoch) / time.Second)
+}
+
+func TestParseFIT(t *testing.T) {
+	start := time.Date(2024, 3, 2, 2, 15, 0, 0, time.UTC)
+	lat, lon := 9.7185, 99.9756
+
+	var b fitBuilder
+	b.message(fitMesgFileID, fitField{0, 0x02, fitFileActivity})
+	b.message(fitMesgDiveGas,
+		fitField{0, 0x02, 0}, fitField{1, 0x02, 32}, fitField{2, 0x02, fitDiveGasEnabled})
+	b.message(fitMesgDiveGas,
+		fitField{0, 0x02, 0}, fitField{1, 0x02, 100}, fitField{2, 0x02, 0})
+
+	depths := []int64{0, 12000, 18400, 5000, 0}
+	temps := []int64{30, 28, 27, 28, 29}
+	for i, depth := range depths {
+		ts := fitTime(start.Add(time.Duration(i) * 10 * time.Minute))
+		b.message(fitMesgRecord,
+			fitField{fitFieldTimestamp, 0x86, ts},
+			fitField{13, 0x01, temps[i]},
+			fitField{92, 0x86, depth})
+	}
+
+	b.message(fitMesgTankUpdate,
+		fitField{fitFieldTimestamp, 0x86, fitTime(start.Add(10 * time.Minute))},
+		fitField{0, 0x86, 123456}, fitField{1, 0x84, 18000})
+	b.message(fitMesgTankSummary,
+		fitField{fitFieldTimestamp, 0x86, fitTime(start.Add(40 * time.Minute))},
+		fitField{0, 0x86, 123456}, fitField{1, 0x86, 20000}, fitField{2, 0x86, 6500})
+	b.message(fitMesgSession,
+		fitField{2, 0x86, fitTime(start)},
+		fitField{3, 0x85, int64(lat * (1 << 31) / 180)},
+		fitField{4, 0x85, int64(lon * (1 << 31) / 180)},
+		fitField{5, 0x02, fitSportDiving},
+		fitField{7, 0x86, 40 * 60 * 1000})
+	b.message(fitMesgDiveSummary,
+		fitField{0, 0x84, fitMesgSession}, fitField{1, 0x84, 0},
+		fitField{2, 0x86, 9300}, fitField{3, 0x86, 18400},
+		fitField{10, 0x86, 57}, fitField{11, 0x86, 38 * 60 * 1000})
+	b.message(fitMesgActivity,
+		fitField{fitFieldTimestamp, 0x86, fitTime(start.Add(time.Hour))},
+		fitField{5, 0x86, fitTime(start.Add(8 * time.Hour))})
+
+	dives, err := ParseFIT(bytes.NewReader(b.bytes()))
+	assert.NilError(t, err)
+	assert.Equal(t, len(dives), 1)
+
+	dive := dives[0]
+	assert.Equal(t, dive.Number, 57)
+	assert.Equal(t, dive.DateTimeIn, time.Date(2024, 3, 2, 9, 15, 0, 0, time.UTC))
+	assert.Equal(t, dive.Duration, 38*time.Minute)
+	assert.Equal(t, dive.MaxDepth, 18.4)
+	assert.Equal(t, *dive.AvgDepth, 9.3)
+	assert.Equal(t, *dive.WaterTemp, 27.0)
+	assert.Equal(t, dive.Site.Name, "")
+	assert.Equal(t, *dive.Site.Latitude > 9.718 && *dive.Site.Latitude < 9.719, true)
+	assert.Equal(t, *dive.Site.Longitude > 99.975 && *dive.Site.Longitude < 99.976, true)
+
+	assert.Equal(t, len(dive.Cylinders), 1)
+	assert.Equal(t, dive.Cylinders[0].GasMixName(), "Nitrox")
+	assert.Equal(t, dive.Cylinders[0].FO2(), 0.32)
+	assert.Equal(t, *dive.Cylinders[0].StartPressure, 200.0)
+	assert.Equal(t, *dive.Cylinders[0].EndPressure, 65.0)
+
+	assert.Equal(t, len(dive.Samples), 5)
+	assert.Equal(t, dive.Samples[2].Time, 20*time.Minute)
+	assert.Equal(t, dive.Samples[2].Depth, 18.4)
+	assert.Equal(t, *dive.Samples[2].Temperature, 27.0)
+	assert.Equal(t, *dive.Samples[1].Pressure, 180.0)
+	assert.Equal(t, dive.Samples[0].Pressure == nil, true)
+}
+
+func TestParseFITErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data func() []byte
+	}{
+		{
+			name: "Not a FIT file",
+			data: func() []byte { return []byte("<divelog></divelog>") },
+		},
+		{
+			name: "Bad CRC",
+			data: func() []byte {
+				var b fitBuilder
+				b.message(fitMesgFileID, fitField{0, 0x02, fitFileActivity})
+				data := b.bytes()
+				data[len(data)-1] ^= 0xFF
+				return data
+			},
+		},
+		{
+			name: "Not an activity",
+			data: func() []byte {
+				var b fitBuilder
+				b.message(fitMesgFileID, fitField{0, 0x02, 1})
+				return b.bytes()
+			},
+		},
+		{
+			name: "No dives",
+			data: func() []byte {
+				var b fitBuilder
+				b.message(fitMesgFileID, fitField{0, 0x02, fitFileActivity})
+				b.message(fitMesgSession,
+					fitField{2, 0x86, fitTime(time.Now())}, fitField{5, 0x02, 1})
+				return b.bytes()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFIT(bytes.NewReader(tt.data()))
+			assert.Equal(t, err != nil, true)
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Package logbook converts dive log books to and from the file formats used by
+// other dive logging applications and dive computers. Importers produce a slice
+// of format-agnostic Dive values which the web application then matches against
+// the user's existing records before inserting them.
+package logbook
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Site is a dive site as described by a log book. Country holds the country's
+// name and CountryCode its ISO 3166-1 alpha-2 code if known. TimeZone is an IANA
+// time zone name such as "Asia/Bangkok". Dives, FirstDive and LastDive summarise
+// the diver's dives at the site and are only used by the dive site exporters.
+type Site struct {
+	Name        string
+	AltName     string
+	Location    string
+	Region      string
+	Country     string
+	CountryCode string
+	TimeZone    string
+	Latitude    *float64
+	Longitude   *float64
+	Altitude    *int
+	MaxDepth    *float64
+	WaterBody   string
+	WaterType   string
+	Rating      *int
+	Notes       string
+	Dives       int
+	FirstDive   *time.Time
+	LastDive    *time.Time
+}
+
+// Key returns a normalised key for the Site which can be used to match sites
+// with the same name across a single import.
+func (s Site) Key() string {
+	return strings.ToLower(strings.TrimSpace(s.Name))
+}
+
+// HasPosition reports whether the Site has both a latitude and longitude.
+func (s Site) HasPosition() bool {
+	return s.Latitude != nil && s.Longitude != nil
+}
+
+// Trip is a dive trip as described by a log book. StartDate and EndDate are
+// zero if the log book does not record them.
+type Trip struct {
+	Name        string
+	StartDate   time.Time
+	EndDate     time.Time
+	Description string
+	Rating      *int
+	Notes       string
+}
+
+// Key returns a normalised key for the Trip which can be used to match trips
+// with the same name across a single import.
+func (t Trip) Key() string {
+	return strings.ToLower(strings.TrimSpace(t.Name))
+}
+
+// Cylinder is a single tank or cylinder used on a dive. Volume is the water
+// capacity of the cylinder in litres and the pressures are in bar. O2 and He
+// are the fractions of oxygen and helium in the mix, with an O2 of zero being
+// taken to mean air. Mix is the name of the gas mix if the log book gave one.
+type Cylinder struct {
+	Description   string
+	Mix           string
+	Volume        *float64
+	StartPressure *float64
+	EndPressure   *float64
+	O2            float64
+	He            float64
+}
+
+// FO2 returns the fraction of oxygen in the Cylinder's gas, defaulting to 0.21
+// for air when it has not been set.
+func (c Cylinder) FO2() float64 {
+	if c.O2 <= 0 {
+		return 0.21
+	}
+
+	return math.Round(c.O2*100) / 100
+}
+
+// GasMixName maps the Cylinder's gas to the name of one of the gas mixes held
+// in the gas_mixes static data table. If the Cylinder has an explicit Mix, then
+// that is returned instead.
+func (c Cylinder) GasMixName() string {
+	if c.Mix != "" {
+		return c.Mix
+	}
+
+	fo2 := c.FO2()
+
+	switch {
+	case c.He > 0 && fo2+c.He >= 0.995:
+		return "Heliox"
+	case c.He > 0:
+		return "Trimix"
+	case fo2 >= 0.995:
+		return "Oxygen"
+	case fo2 > 0.21:
+		return "Nitrox"
+	default:
+		return "Air"
+	}
+}
+
+// GasLabel returns the short name that divers use for the Cylinder's gas, such
+// as "Air", "EAN32", "Oxygen" or "Tx18/45".
+func (c Cylinder) GasLabel() string {
+	fo2 := c.FO2()
+	he := math.Round(c.He * 100)
+
+	switch {
+	case he > 0:
+		return fmt.Sprintf("Tx%.0f/%.0f", fo2*100, he)
+	case fo2 >= 0.995:
+		return "Oxygen"
+	case fo2 > 0.21:
+		return fmt.Sprintf("EAN%.0f", fo2*100)
+	default:
+		return "Air"
+	}
+}
+
+// Sample is a single point in a dive's profile as recorded by a dive computer.
+// Time is the time elapsed since the start of the dive, Depth is in metres,
+// Temperature in degrees Celsius, Pressure is the tank pressure in bar and PPO2
+// is the partial pressure of oxygen in bar. CNS is the diver's oxygen toxicity
+// as a percentage of the CNS limit. StopDepth and StopTime give the depth in
+// metres and length of the first decompression stop the diver was required to
+// make, and are nil when the diver had no decompression obligation. Events
+// holds the names of anything the dive computer noted at the time, such as gas
+// switches or ascent warnings.
+type Sample struct {
+	Time        time.Duration
+	Depth       float64
+	Temperature *float64
+	Pressure    *float64
+	PPO2        *float64
+	CNS         *float64
+	StopDepth   *float64
+	StopTime    *time.Duration
+	Events      []string
+}
+
+// addSampleEvent records the named event against the first sample taken at or
+// after time t. If the event happened after the last sample, then a sample is
+// added for it at the same depth as the last one.
+func addSampleEvent(samples []Sample, t time.Duration, name string) []Sample {
+	if name == "" {
+		return samples
+	}
+
+	for i := range samples {
+		if samples[i].Time >= t {
+			samples[i].Events = append(samples[i].Events, name)
+			return samples
+		}
+	}
+
+	sample := Sample{Time: t, Events: []string{name}}
+	if len(samples) > 0 {
+		sample.Depth = samples[len(samples)-1].Depth
+	}
+
+	return append(samples, sample)
+}
+
+// Dive is a single dive in a log book. DateTimeIn holds the local wall-clock
+// time of the dive at the dive site; its time.Location should be ignored as it
+// will be replaced with the dive site's time zone when stored. Rating is on a
+// scale of 0 to 10.
+//
+// Samples holds the dive's profile in chronological order if the log book
+// includes one.
+//
+// Most formats only provide a subset of the fields. Those that describe static
+// data such as EntryPoint, Current and Properties hold the names of the static
+// data items and are left empty if they are not known.
+type Dive struct {
+	Number            int
+	Activity          string
+	DateTimeIn        time.Time
+	SurfaceInterval   *time.Duration
+	Duration          time.Duration
+	SafetyStop        *time.Duration
+	MaxDepth          float64
+	AvgDepth          *float64
+	WaterTemp         *float64
+	AirTemp           *float64
+	Visibility        *float64
+	Current           string
+	Waves             string
+	Rating            *int
+	Site              *Site
+	Trip              *Trip
+	Operator          string
+	Certification     string
+	Price             *float64
+	Currency          string
+	Buddies           []string
+	BuddyRole         string
+	Cylinders         []Cylinder
+	TankConfiguration string
+	TankMaterial      string
+	GasMixNotes       string
+	Weight            *float64
+	WeightNotes       string
+	Equipment         []string
+	EquipmentNotes    string
+	EntryPoint        string
+	Properties        []string
+	Notes             string
+	Samples           []Sample
+}
+
+// Buddy returns the first buddy listed for the Dive, or the empty string if no
+// buddies were recorded.
+func (d Dive) Buddy() string {
+	if len(d.Buddies) == 0 {
+		return ""
+	}
+
+	return d.Buddies[0]
+}
+
+// Cylinder returns the first cylinder used on the dive, which is assumed to be
+// the back gas. If no cylinders were recorded, then an air cylinder of unknown
+// size is returned.
+func (d Dive) Cylinder() Cylinder {
+	if len(d.Cylinders) == 0 {
+		return Cylinder{O2: 0.21}
+	}
+
+	return d.Cylinders[0]
+}
+
+// earthRadius is the mean radius of the Earth in metres.
+const earthRadius = 6_371_008.8
+
+// Distance returns the great-circle distance in metres between the two given
+// latitude/longitude points using the haversine formula.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
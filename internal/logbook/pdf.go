@@ -0,0 +1,375 @@
+package logbook
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/pdf"
+)
+
+// The page layouts that a PDF log book can be printed in.
+const (
+	PDFLayoutFull = "full"
+	PDFLayoutHalf = "half"
+)
+
+// pdfMargin is the space in points left around the edge of every page.
+const pdfMargin = 40.0
+
+// PDFCover holds the details of the diver that are printed on the cover page of
+// a PDF log book. DivingSince is left off the cover if it is the zero time.
+type PDFCover struct {
+	Name        string
+	TotalDives  int
+	DivingSince time.Time
+}
+
+// pdfStyle holds the font sizes and spacing used to print a dive, which differ
+// between the full and half page layouts.
+type pdfStyle struct {
+	heading   float64
+	title     float64
+	text      float64
+	rowHeight float64
+	signature float64
+}
+
+var pdfStyles = map[string]pdfStyle{
+	PDFLayoutFull: {heading: 16, title: 11, text: 9, rowHeight: 13, signature: 70},
+	PDFLayoutHalf: {heading: 12, title: 9, text: 7.5, rowHeight: 10, signature: 45},
+}
+
+// pdfRow is a single labelled value printed for a dive.
+type pdfRow struct {
+	label string
+	value string
+}
+
+// pdfSection is a titled group of rows. Rows without a value are left out.
+type pdfSection struct {
+	title string
+	rows  []pdfRow
+}
+
+func (s pdfSection) visibleRows() []pdfRow {
+	var rows []pdfRow
+	for _, r := range s.rows {
+		if strings.TrimSpace(r.value) != "" {
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+func pdfFloat(v *float64, format string) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf(format, *v)
+}
+
+func pdfMins(d *time.Duration) string {
+	if d == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.0f min", d.Minutes())
+}
+
+func pdfJoin(sep string, values ...string) string {
+	var parts []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// pdfSections returns the sections of details printed for the dive, split into
+// the left and right hand columns of the page.
+func pdfSections(d Dive) ([]pdfSection, []pdfSection) {
+	site := Site{}
+	if d.Site != nil {
+		site = *d.Site
+	}
+
+	position := ""
+	if site.HasPosition() {
+		position = fmt.Sprintf("%.5f, %.5f", *site.Latitude, *site.Longitude)
+	}
+
+	rating := ""
+	if d.Rating != nil {
+		rating = fmt.Sprintf("%d/10", *d.Rating)
+	}
+
+	cylinder := d.Cylinder()
+	pressures := ""
+	if cylinder.StartPressure != nil || cylinder.EndPressure != nil {
+		pressures = fmt.Sprintf(
+			"%s to %s",
+			cmp.Or(pdfFloat(cylinder.StartPressure, "%.0f bar"), "?"),
+			cmp.Or(pdfFloat(cylinder.EndPressure, "%.0f bar"), "?"),
+		)
+	}
+
+	price := ""
+	if d.Price != nil {
+		price = strings.TrimSpace(fmt.Sprintf("%s %.2f", d.Currency, *d.Price))
+	}
+
+	trip := ""
+	if d.Trip != nil {
+		trip = d.Trip.Name
+	}
+
+	left := []pdfSection{
+		{"Dive", []pdfRow{
+			{"Date", d.DateTimeIn.Format("Monday 2 January 2006")},
+			{"Time In", pdfJoin(" ", d.DateTimeIn.Format("15:04"), site.TimeZone)},
+			{"Time Out", d.DateTimeIn.Add(d.Duration).Format("15:04")},
+			{"Bottom Time", pdfMins(&d.Duration)},
+			{"Max Depth", fmt.Sprintf("%.1f m", d.MaxDepth)},
+			{"Avg Depth", pdfFloat(d.AvgDepth, "%.1f m")},
+			{"Safety Stop", pdfMins(d.SafetyStop)},
+			{"Surface Int.", pdfMins(d.SurfaceInterval)},
+			{"Activity", d.Activity},
+			{"Entry", d.EntryPoint},
+			{"Rating", rating},
+		}},
+		{"Conditions", []pdfRow{
+			{"Water Temp", pdfFloat(d.WaterTemp, "%.0f °C")},
+			{"Air Temp", pdfFloat(d.AirTemp, "%.0f °C")},
+			{"Visibility", pdfFloat(d.Visibility, "%.0f m")},
+			{"Current", d.Current},
+			{"Waves", d.Waves},
+		}},
+		{"Equipment", []pdfRow{
+			{"Weight", pdfFloat(d.Weight, "%.1f kg")},
+			{"Weight Notes", d.WeightNotes},
+			{"Equipment", strings.Join(d.Equipment, ", ")},
+			{"Notes", d.EquipmentNotes},
+		}},
+	}
+
+	right := []pdfSection{
+		{"Site", []pdfRow{
+			{"Name", site.Name},
+			{"Also Known As", site.AltName},
+			{"Location", pdfJoin(", ", site.Location, site.Region)},
+			{"Country", site.Country},
+			{"Water", pdfJoin(", ", site.WaterBody, site.WaterType)},
+			{"Position", position},
+		}},
+		{"Gas", []pdfRow{
+			{"Mix", pdfJoin(" ", cylinder.GasMixName(), fmt.Sprintf("(%.0f%% O2)", cylinder.FO2()*100))},
+			{"Tanks", pdfJoin(", ", d.TankConfiguration, d.TankMaterial, pdfFloat(cylinder.Volume, "%.1f L"))},
+			{"Pressure", pressures},
+			{"Gas Notes", d.GasMixNotes},
+		}},
+		{"Dived With", []pdfRow{
+			{"Buddy", pdfJoin(" ", d.Buddy(), pdfParens(d.BuddyRole))},
+			{"Operator", d.Operator},
+			{"Price", price},
+			{"Trip", trip},
+			{"Course", d.Certification},
+			{"Properties", strings.Join(d.Properties, ", ")},
+		}},
+	}
+
+	return left, right
+}
+
+func pdfParens(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "(" + s + ")"
+}
+
+// drawSections draws the sections in a column of the given width starting at
+// x, y and returns the y position below the last of them.
+func drawSections(page *pdf.Page, style pdfStyle, x, y, width float64, sections []pdfSection) float64 {
+	labelWidth := width * 0.32
+
+	for _, section := range sections {
+		rows := section.visibleRows()
+		if len(rows) == 0 {
+			continue
+		}
+
+		y += style.rowHeight
+		page.Text(x, y, pdf.HelveticaBold, style.title, section.title)
+		page.Line(x, y+3, x+width, y+3, 0.5)
+		y += 3
+
+		for _, row := range rows {
+			y += style.rowHeight
+			page.Text(x, y, pdf.HelveticaBold, style.text, row.label)
+			value := pdf.Truncate(pdf.Helvetica, style.text, width-labelWidth, row.value)
+			page.Text(x+labelWidth, y, pdf.Helvetica, style.text, value)
+		}
+
+		y += style.rowHeight / 2
+	}
+
+	return y
+}
+
+// drawDive prints the dive into the box with its top left corner at x, y.
+func drawDive(page *pdf.Page, style pdfStyle, d Dive, x, y, width, height float64) {
+	bottom := y + height
+
+	// Heading bar with the dive number, site and date.
+	barHeight := style.heading * 1.8
+	page.FillRect(x, y, width, barHeight, 0.9)
+	baseline := y + barHeight/2 + style.heading*0.35
+
+	siteName := ""
+	if d.Site != nil {
+		siteName = d.Site.Name
+	}
+	date := d.DateTimeIn.Format("2006-01-02")
+	dateWidth := pdf.TextWidth(pdf.HelveticaBold, style.heading, date)
+	heading := pdfJoin("  ", "#"+strconv.Itoa(d.Number), siteName)
+	heading = pdf.Truncate(pdf.HelveticaBold, style.heading, width-dateWidth-24, heading)
+	page.Text(x+6, baseline, pdf.HelveticaBold, style.heading, heading)
+	page.TextRight(x+width-6, baseline, pdf.HelveticaBold, style.heading, date)
+
+	// Two columns of details.
+	gap := 16.0
+	colWidth := (width - gap) / 2
+	left, right := pdfSections(d)
+	leftBottom := drawSections(page, style, x, y+barHeight, colWidth, left)
+	rightBottom := drawSections(page, style, x+colWidth+gap, y+barHeight, colWidth, right)
+	y = max(leftBottom, rightBottom)
+
+	// The signature boxes take up the bottom of the dive's space, with the
+	// notes filling whatever is left above them.
+	sigTop := bottom - style.signature
+	notes := strings.TrimSpace(d.Notes)
+	if notes != "" && y+style.rowHeight*2 < sigTop {
+		y += style.rowHeight
+		page.Text(x, y, pdf.HelveticaBold, style.title, "Notes")
+		page.Line(x, y+3, x+width, y+3, 0.5)
+		y += 3
+
+		lines := pdf.WrapText(pdf.Helvetica, style.text, width, notes)
+		space := int((sigTop - y - style.rowHeight/2) / style.rowHeight)
+		if len(lines) > space {
+			lines = lines[:max(space, 0)]
+			if len(lines) > 0 {
+				last := lines[len(lines)-1] + "…"
+				lines[len(lines)-1] = pdf.Truncate(pdf.Helvetica, style.text, width, last)
+			}
+		}
+
+		for _, line := range lines {
+			y += style.rowHeight
+			page.Text(x, y, pdf.Helvetica, style.text, line)
+		}
+	}
+
+	boxHeight := style.signature - style.rowHeight*1.5
+	boxWidth := (width - gap) / 2
+	boxTop := bottom - boxHeight
+	labelY := boxTop - style.rowHeight/2
+
+	labels := []string{
+		pdfJoin(" ", "Buddy Signature", pdfParens(d.Buddy())),
+		pdfJoin(" ", "Instructor / Dive Centre Stamp", pdfParens(d.Operator)),
+	}
+	for i, label := range labels {
+		boxX := x + float64(i)*(boxWidth+gap)
+		label = pdf.Truncate(pdf.HelveticaBold, style.text, boxWidth, label)
+		page.Text(boxX, labelY, pdf.HelveticaBold, style.text, label)
+		page.Rect(boxX, boxTop, boxWidth, boxHeight, 0.75)
+	}
+}
+
+// drawCover prints the cover page of the log book.
+func drawCover(page *pdf.Page, generator string, cover PDFCover, dives []Dive) {
+	centre := pdf.A4Width / 2
+
+	page.Rect(pdfMargin, pdfMargin, pdf.A4Width-pdfMargin*2, pdf.A4Height-pdfMargin*2, 2)
+	page.TextCentre(centre, 240, pdf.HelveticaBold, 32, "Dive Log Book")
+	page.TextCentre(centre, 290, pdf.Helvetica, 20, cover.Name)
+
+	lines := []string{fmt.Sprintf("Total Dives: %d", cover.TotalDives)}
+	if !cover.DivingSince.IsZero() {
+		lines = append(lines, "Diving Since: "+cover.DivingSince.Format("January 2006"))
+	}
+
+	if len(dives) > 0 {
+		first, last := dives[0], dives[len(dives)-1]
+		lines = append(lines,
+			"",
+			fmt.Sprintf("This book holds %d dive(s)", len(dives)),
+			fmt.Sprintf("from #%d on %s", first.Number, first.DateTimeIn.Format("2 January 2006")),
+			fmt.Sprintf("to #%d on %s", last.Number, last.DateTimeIn.Format("2 January 2006")),
+		)
+	}
+
+	y := 380.0
+	for _, line := range lines {
+		page.TextCentre(centre, y, pdf.Helvetica, 14, line)
+		y += 22
+	}
+
+	generated := fmt.Sprintf("Generated by %s on %s", generator, time.Now().Format("2 January 2006"))
+	page.TextCentre(centre, pdf.A4Height-pdfMargin-20, pdf.Helvetica, 9, generated)
+}
+
+// WritePDF writes a printable log book of the dives to w as a PDF file. The
+// first page is a cover with the diver's totals, followed by each dive on a
+// page of its own or two to a page, depending on the layout. Dives are printed
+// in the order given.
+func WritePDF(w io.Writer, generator string, cover PDFCover, dives []Dive, layout string) error {
+	style, ok := pdfStyles[layout]
+	if !ok {
+		return fmt.Errorf("unknown pdf layout %q", layout)
+	}
+
+	doc := &pdf.Document{
+		Title:   "Dive Log Book of " + cover.Name,
+		Author:  cover.Name,
+		Creator: generator,
+	}
+
+	drawCover(doc.AddPage(), generator, cover, dives)
+
+	width := pdf.A4Width - pdfMargin*2
+	height := pdf.A4Height - pdfMargin*2
+
+	perPage := 1
+	if layout == PDFLayoutHalf {
+		perPage = 2
+		height = (height - pdfMargin) / 2
+	}
+
+	var page *pdf.Page
+	for i, d := range dives {
+		slot := i % perPage
+		if slot == 0 {
+			page = doc.AddPage()
+			pageNumber := fmt.Sprintf("Page %d", doc.PageCount()-1)
+			page.TextCentre(pdf.A4Width/2, pdf.A4Height-pdfMargin/2, pdf.Helvetica, 8, pageNumber)
+		} else {
+			// Mark where to cut the page in half.
+			cut := pdf.A4Height / 2
+			for x := pdfMargin; x < pdf.A4Width-pdfMargin; x += 8 {
+				page.Line(x, cut, x+4, cut, 0.25)
+			}
+		}
+
+		top := pdfMargin + float64(slot)*(height+pdfMargin)
+		drawDive(page, style, d, pdfMargin, top, width, height)
+	}
+
+	_, err := doc.WriteTo(w)
+	return err
+}
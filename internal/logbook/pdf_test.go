@@ -0,0 +1,59 @@
+package logbook
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestWritePDF(t *testing.T) {
+	cover := PDFCover{
+		Name:        "Alice Person",
+		TotalDives:  112,
+		DivingSince: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	var dives []Dive
+	for i := range 3 {
+		dives = append(dives, Dive{
+			Number:     i + 1,
+			Activity:   "Fun Dive",
+			DateTimeIn: time.Date(2024, 3, 2+i, 9, 15, 0, 0, time.UTC),
+			Duration:   48 * time.Minute,
+			MaxDepth:   24.3,
+			Site:       &Site{Name: "Sail Rock", Country: "Thailand"},
+			Buddies:    []string{"John Smith"},
+			Operator:   "Big Bubbles",
+			Notes:      strings.Repeat("A very long note about the dive. ", 200),
+		})
+	}
+
+	tests := []struct {
+		layout string
+		pages  string
+	}{
+		{PDFLayoutFull, "/Count 4"},
+		{PDFLayoutHalf, "/Count 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WritePDF(&buf, "DiveSite", cover, dives, tt.layout)
+			assert.NilError(t, err)
+
+			out := buf.String()
+			assert.StringContains(t, out, tt.pages)
+			assert.StringContains(t, out, "(Total Dives: 112) Tj")
+			assert.StringContains(t, out, "(Diving Since: June 2015) Tj")
+			assert.StringContains(t, out, "(#3  Sail Rock) Tj")
+			assert.StringContains(t, out, "(Buddy Signature \\(John Smith\\)) Tj")
+		})
+	}
+
+	err := WritePDF(&bytes.Buffer{}, "DiveSite", cover, dives, "quarter")
+	assert.Equal(t, err != nil, true)
+}
@@ -0,0 +1,130 @@
+package logbook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SampleCSVFields lists the columns that ParseSampleCSV recognises. The time
+// and depth columns are required.
+var SampleCSVFields = []CSVField{
+	{"time", "Time", []string{"elapsed", "elapsed time", "dive time", "runtime", "time (s)", "time (min)"}},
+	{"depth", "Depth", []string{"depth (m)", "depth (ft)"}},
+	{"temperature", "Temperature", []string{"temp", "water temp", "temperature (c)", "temperature (f)"}},
+	{"pressure", "Tank Pressure", []string{"cylinder pressure", "pressure (bar)", "pressure (psi)"}},
+	{"ppo2", "ppO2", []string{"po2", "pp o2", "ppo2 (bar)"}},
+	{"events", "Events", []string{"event", "alarms", "notes"}},
+}
+
+// ParseSampleCSV reads the profile of a single dive from a CSV file with one
+// sample per row. The columns are found from their headings using the
+// SampleCSVFields, and the units of the mapping are used to read the values;
+// its Columns are ignored. Any events should be separated by semicolons. The
+// samples are returned in chronological order.
+func ParseSampleCSV(r io.Reader, m CSVMapping) ([]Sample, error) {
+	cr := newCSVReader(r)
+
+	headers, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("csv file is empty")
+		}
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := guessCSVColumns(headers, SampleCSVFields)
+	if !slices.Contains(columns, "time") || !slices.Contains(columns, "depth") {
+		return nil, errors.New("csv file must have a time and a depth column")
+	}
+
+	var samples []Sample
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv row: %w", err)
+		}
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		sample, err := m.parseSample(columns, record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		samples = append(samples, sample)
+	}
+
+	slices.SortStableFunc(samples, func(a, b Sample) int {
+		return int(a.Time - b.Time)
+	})
+
+	return samples, nil
+}
+
+// parseSample maps a single CSV record onto a Sample.
+func (m CSVMapping) parseSample(columns []string, record []string) (Sample, error) {
+	var sample Sample
+	var hasTime, hasDepth bool
+
+	for i, key := range columns {
+		if key == "" || i >= len(record) {
+			continue
+		}
+
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+
+		if key == "time" {
+			t, err := parseCSVDuration(value, m.DurationUnit)
+			if err != nil {
+				return Sample{}, fmt.Errorf("%q is not a valid time", value)
+			}
+			sample.Time = t
+			hasTime = true
+			continue
+		}
+
+		if key == "events" {
+			sample.Events = splitCSVList(value)
+			continue
+		}
+
+		f, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return Sample{}, fmt.Errorf("%q is not a valid %s", value, key)
+		}
+
+		switch key {
+		case "depth":
+			sample.Depth = m.depth(f)
+			hasDepth = true
+		case "temperature":
+			sample.Temperature = ref(m.temperature(f))
+		case "pressure":
+			sample.Pressure = ref(m.pressure(f))
+		case "ppo2":
+			sample.PPO2 = &f
+		}
+	}
+
+	if !hasTime || !hasDepth {
+		return Sample{}, errors.New("every sample must have a time and a depth")
+	}
+
+	return sample, nil
+}
@@ -0,0 +1,48 @@
+package logbook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestParseSampleCSV(t *testing.T) {
+	mapping := CSVMapping{
+		DepthUnit:    DepthFeet,
+		TempUnit:     TempCelsius,
+		PressureUnit: PressureBar,
+		DurationUnit: DurationMinsSecs,
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		data := "Time,Depth (ft),Temp,Pressure,Events\n" +
+			"1:00,33,28,190,\n" +
+			"0:00,0,29,200,\n" +
+			"2:00,66,,,ascent; gaschange 50%\n"
+
+		samples, err := ParseSampleCSV(strings.NewReader(data), mapping)
+		assert.NilError(t, err)
+		assert.Equal(t, len(samples), 3)
+
+		// Samples are sorted into chronological order.
+		assert.Equal(t, samples[0].Time, time.Duration(0))
+		assert.Equal(t, *samples[0].Temperature, 29.0)
+		assert.Equal(t, samples[1].Time, time.Minute)
+		assert.Equal(t, samples[1].Depth, 33*metresPerFoot)
+		assert.Equal(t, *samples[1].Pressure, 190.0)
+		assert.Equal(t, samples[2].Temperature == nil, true)
+		assert.Equal(t, strings.Join(samples[2].Events, "|"), "ascent|gaschange 50%")
+	})
+
+	t.Run("Missing depth column", func(t *testing.T) {
+		_, err := ParseSampleCSV(strings.NewReader("Time,Temp\n0:00,29\n"), mapping)
+		assert.Equal(t, err.Error(), "csv file must have a time and a depth column")
+	})
+
+	t.Run("Invalid value", func(t *testing.T) {
+		_, err := ParseSampleCSV(strings.NewReader("Time,Depth\n0:00,0\n0:10,deep\n"), mapping)
+		assert.Equal(t, err.Error(), `line 3: "deep" is not a valid depth`)
+	})
+}
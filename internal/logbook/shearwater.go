@@ -0,0 +1,250 @@
+package logbook
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqliteHeader is the magic string at the start of every SQLite database file.
+const sqliteHeader = "SQLite format 3\x00"
+
+// shearwaterDateLayouts are the layouts that Shearwater applications have used
+// for the start date of a dive.
+var shearwaterDateLayouts = []string{
+	"1/2/2006 3:04:05 PM",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+}
+
+type shearwaterDive struct {
+	Log shearwaterDiveLog `xml:"diveLog"`
+}
+
+type shearwaterDiveLog struct {
+	Number        string             `xml:"number"`
+	StartDate     string             `xml:"startDate"`
+	ImperialUnits string             `xml:"imperialUnits"`
+	Note          string             `xml:"note"`
+	Records       []shearwaterRecord `xml:"diveLogRecords>diveLogRecord"`
+}
+
+type shearwaterRecord struct {
+	CurrentTime    string `xml:"currentTime"`
+	CurrentDepth   string `xml:"currentDepth"`
+	WaterTemp      string `xml:"waterTemp"`
+	AveragePPO2    string `xml:"averagePPO2"`
+	FractionO2     string `xml:"fractionO2"`
+	FractionHe     string `xml:"fractionHe"`
+	FirstStopDepth string `xml:"firstStopDepth"`
+	FirstStopTime  string `xml:"firstStopTime"`
+	CNS            string `xml:"cns"`
+	TankPressure   string `xml:"tank0pressurePSI"`
+}
+
+// parseShearwaterValue parses a number from a Shearwater export, returning
+// false if the value is missing or invalid.
+func parseShearwaterValue(value string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+
+	return v, true
+}
+
+func parseShearwaterDateTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range shearwaterDateLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return time.Date(
+				t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC,
+			), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a valid shearwater date", value)
+}
+
+// ParseShearwater reads the dives from an XML export of the dive log of a
+// Shearwater dive computer, as produced by Shearwater Cloud and Desktop, from
+// r. The file may hold a single dive element or any number of them wrapped in
+// another element.
+//
+// Each gas breathed during the dive becomes one of the dive's cylinders, in the
+// order that they were first breathed, with each switch between them recorded
+// as a gaschange event. The ppO2, CNS and decompression stop readings of the
+// computer are kept with the depth samples.
+//
+// Shearwater Cloud's own SQLite database cannot be read directly; its dives
+// must be exported as XML first.
+func ParseShearwater(r io.Reader) ([]Dive, error) {
+	br := bufio.NewReader(r)
+	if header, _ := br.Peek(len(sqliteHeader)); string(header) == sqliteHeader {
+		msg := "shearwater cloud databases are not supported, export the dives as xml instead"
+		return nil, errors.New(msg)
+	}
+
+	decoder := xml.NewDecoder(br)
+
+	var dives []Dive
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode shearwater xml: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "dive" {
+			continue
+		}
+
+		var d shearwaterDive
+		err = decoder.DecodeElement(&d, &start)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode shearwater xml: %w", err)
+		}
+
+		dive, err := d.Log.toDive()
+		if err != nil {
+			return nil, fmt.Errorf("dive %d: %w", len(dives)+1, err)
+		}
+
+		dives = append(dives, dive)
+	}
+
+	if len(dives) == 0 {
+		return nil, errors.New("shearwater xml does not contain any dives")
+	}
+
+	return dives, nil
+}
+
+func (l shearwaterDiveLog) toDive() (Dive, error) {
+	dateTimeIn, err := parseShearwaterDateTime(l.StartDate)
+	if err != nil {
+		return Dive{}, err
+	}
+
+	dive := Dive{DateTimeIn: dateTimeIn, Notes: strings.TrimSpace(l.Note)}
+	if n, ok := parseShearwaterValue(l.Number); ok {
+		dive.Number = int(n)
+	}
+
+	imperial := strings.EqualFold(strings.TrimSpace(l.ImperialUnits), "true")
+	depth := func(v float64) float64 {
+		if imperial {
+			return v * metresPerFoot
+		}
+		return v
+	}
+
+	var depthTotal float64
+	var gas *Cylinder
+
+	for _, rec := range l.Records {
+		// Record times are given in milliseconds since the start of the dive.
+		ms, ok := parseShearwaterValue(rec.CurrentTime)
+		if !ok {
+			continue
+		}
+		d, ok := parseShearwaterValue(rec.CurrentDepth)
+		if !ok {
+			continue
+		}
+
+		sample := Sample{
+			Time:  time.Duration(ms) * time.Millisecond,
+			Depth: depth(d),
+		}
+
+		if temp, ok := parseShearwaterValue(rec.WaterTemp); ok {
+			if imperial {
+				temp = (temp - 32) * 5 / 9
+			}
+			sample.Temperature = &temp
+			if dive.WaterTemp == nil || temp < *dive.WaterTemp {
+				dive.WaterTemp = ref(temp)
+			}
+		}
+		if ppo2, ok := parseShearwaterValue(rec.AveragePPO2); ok && ppo2 > 0 {
+			sample.PPO2 = &ppo2
+		}
+		if cns, ok := parseShearwaterValue(rec.CNS); ok {
+			sample.CNS = &cns
+		}
+		if psi, ok := parseShearwaterValue(rec.TankPressure); ok && psi > 0 {
+			sample.Pressure = ref(psi * barPerPSI)
+		}
+
+		// When the diver is not in deco, the first stop time holds the no
+		// decompression limit instead.
+		if stop, ok := parseShearwaterValue(rec.FirstStopDepth); ok && stop > 0 {
+			sample.StopDepth = ref(depth(stop))
+			if mins, ok := parseShearwaterValue(rec.FirstStopTime); ok {
+				sample.StopTime = ref(time.Duration(mins) * time.Minute)
+			}
+		}
+
+		// Some versions give the gas fractions as percentages.
+		o2, hasO2 := parseShearwaterValue(rec.FractionO2)
+		he, _ := parseShearwaterValue(rec.FractionHe)
+		if o2 > 1 {
+			o2, he = o2/100, he/100
+		}
+		if hasO2 && o2 > 0 {
+			c := Cylinder{O2: o2, He: he}
+			if gas != nil && (c.O2 != gas.O2 || c.He != gas.He) {
+				sample.Events = append(sample.Events, fmt.Sprintf("gaschange %.0f%%", o2*100))
+			}
+			gas = &c
+
+			seen := false
+			for _, existing := range dive.Cylinders {
+				seen = seen || (existing.O2 == c.O2 && existing.He == c.He)
+			}
+			if !seen {
+				dive.Cylinders = append(dive.Cylinders, c)
+			}
+		}
+
+		depthTotal += sample.Depth
+		dive.MaxDepth = max(dive.MaxDepth, sample.Depth)
+		dive.Samples = append(dive.Samples, sample)
+	}
+
+	if len(dive.Samples) == 0 {
+		return Dive{}, errors.New("dive has no log records")
+	}
+
+	dive.Duration = dive.Samples[len(dive.Samples)-1].Time
+	dive.AvgDepth = ref(depthTotal / float64(len(dive.Samples)))
+
+	// The tank pressures are only recorded against the back gas as there is no
+	// way to tell which cylinder the transmitter was fitted to.
+	for _, s := range dive.Samples {
+		if s.Pressure == nil {
+			continue
+		}
+		if len(dive.Cylinders) == 0 {
+			dive.Cylinders = append(dive.Cylinders, Cylinder{O2: 0.21})
+		}
+		if dive.Cylinders[0].StartPressure == nil {
+			dive.Cylinders[0].StartPressure = s.Pressure
+		}
+		dive.Cylinders[0].EndPressure = s.Pressure
+	}
+
+	return dive, nil
+}
@@ -0,0 +1,152 @@
+package logbook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+const shearwaterTestXML = `<?xml version="1.0" encoding="utf-8"?>
+<dives>
+  <dive version="2">
+    <diveLog>
+      <number>112</number>
+      <startDate>3/2/2024 9:15:00 AM</startDate>
+      <imperialUnits>False</imperialUnits>
+      <note>Deep wreck.</note>
+      <diveLogRecords>
+        <diveLogRecord>
+          <currentTime>0</currentTime>
+          <currentDepth>0</currentDepth>
+          <waterTemp>29</waterTemp>
+          <averagePPO2>0.21</averagePPO2>
+          <fractionO2>0.18</fractionO2>
+          <fractionHe>0.45</fractionHe>
+          <firstStopDepth>0</firstStopDepth>
+          <firstStopTime>99</firstStopTime>
+          <cns>2</cns>
+          <tank0pressurePSI>3000</tank0pressurePSI>
+        </diveLogRecord>
+        <diveLogRecord>
+          <currentTime>1200000</currentTime>
+          <currentDepth>55.2</currentDepth>
+          <waterTemp>24</waterTemp>
+          <averagePPO2>1.17</averagePPO2>
+          <fractionO2>0.18</fractionO2>
+          <fractionHe>0.45</fractionHe>
+          <firstStopDepth>9</firstStopDepth>
+          <firstStopTime>2</firstStopTime>
+          <cns>10</cns>
+        </diveLogRecord>
+        <diveLogRecord>
+          <currentTime>2400000</currentTime>
+          <currentDepth>21</currentDepth>
+          <waterTemp>26</waterTemp>
+          <averagePPO2>1.55</averagePPO2>
+          <fractionO2>0.50</fractionO2>
+          <fractionHe>0</fractionHe>
+          <firstStopDepth>6</firstStopDepth>
+          <firstStopTime>4</firstStopTime>
+          <cns>21</cns>
+        </diveLogRecord>
+        <diveLogRecord>
+          <currentTime>3300000</currentTime>
+          <currentDepth>6</currentDepth>
+          <averagePPO2>1.60</averagePPO2>
+          <fractionO2>1.0</fractionO2>
+          <fractionHe>0</fractionHe>
+          <firstStopDepth>0</firstStopDepth>
+          <cns>34</cns>
+          <tank0pressurePSI>1000</tank0pressurePSI>
+        </diveLogRecord>
+        <diveLogRecord>
+          <currentTime>3600000</currentTime>
+          <currentDepth>0</currentDepth>
+          <fractionO2>1.0</fractionO2>
+        </diveLogRecord>
+      </diveLogRecords>
+    </diveLog>
+  </dive>
+  <dive version="2">
+    <diveLog>
+      <number>113</number>
+      <startDate>2024-03-02 14:00:00</startDate>
+      <imperialUnits>True</imperialUnits>
+      <diveLogRecords>
+        <diveLogRecord>
+          <currentTime>0</currentTime>
+          <currentDepth>0</currentDepth>
+          <fractionO2>0.32</fractionO2>
+        </diveLogRecord>
+        <diveLogRecord>
+          <currentTime>600000</currentTime>
+          <currentDepth>60</currentDepth>
+          <waterTemp>77</waterTemp>
+          <fractionO2>0.32</fractionO2>
+        </diveLogRecord>
+      </diveLogRecords>
+    </diveLog>
+  </dive>
+</dives>`
+
+func TestParseShearwater(t *testing.T) {
+	dives, err := ParseShearwater(strings.NewReader(shearwaterTestXML))
+	assert.NilError(t, err)
+	assert.Equal(t, len(dives), 2)
+
+	dive := dives[0]
+	assert.Equal(t, dive.Number, 112)
+	assert.Equal(t, dive.DateTimeIn, time.Date(2024, 3, 2, 9, 15, 0, 0, time.UTC))
+	assert.Equal(t, dive.Duration, time.Hour)
+	assert.Equal(t, dive.MaxDepth, 55.2)
+	assert.Equal(t, *dive.WaterTemp, 24.0)
+	assert.Equal(t, dive.Notes, "Deep wreck.")
+
+	assert.Equal(t, len(dive.Cylinders), 3)
+	assert.Equal(t, dive.Cylinders[0].GasMixName(), "Trimix")
+	assert.Equal(t, dive.Cylinders[0].GasLabel(), "Tx18/45")
+	assert.Equal(t, dive.Cylinders[1].GasLabel(), "EAN50")
+	assert.Equal(t, dive.Cylinders[2].GasLabel(), "Oxygen")
+	assert.Equal(t, *dive.Cylinders[0].StartPressure > 206 && *dive.Cylinders[0].StartPressure < 207, true)
+	assert.Equal(t, *dive.Cylinders[0].EndPressure > 68 && *dive.Cylinders[0].EndPressure < 69, true)
+
+	assert.Equal(t, len(dive.Samples), 5)
+	assert.Equal(t, dive.Samples[0].StopDepth == nil, true)
+	assert.Equal(t, *dive.Samples[1].StopDepth, 9.0)
+	assert.Equal(t, *dive.Samples[1].StopTime, 2*time.Minute)
+	assert.Equal(t, *dive.Samples[2].PPO2, 1.55)
+	assert.Equal(t, *dive.Samples[3].CNS, 34.0)
+	assert.Equal(t, strings.Join(dive.Samples[2].Events, ","), "gaschange 50%")
+	assert.Equal(t, strings.Join(dive.Samples[3].Events, ","), "gaschange 100%")
+	assert.Equal(t, len(dive.Samples[4].Events), 0)
+
+	dive = dives[1]
+	assert.Equal(t, dive.DateTimeIn, time.Date(2024, 3, 2, 14, 0, 0, 0, time.UTC))
+	assert.Equal(t, dive.MaxDepth > 18.28 && dive.MaxDepth < 18.29, true)
+	assert.Equal(t, *dive.WaterTemp, 25.0)
+	assert.Equal(t, dive.Cylinders[0].GasLabel(), "EAN32")
+}
+
+func TestParseShearwaterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"SQLite database", "SQLite format 3\x00\x10\x00"},
+		{"No dives", "<dives></dives>"},
+		{"Invalid date", "<dive><diveLog><startDate>yesterday</startDate></diveLog></dive>"},
+		{
+			"No records",
+			"<dive><diveLog><startDate>2024-03-02 14:00:00</startDate></diveLog></dive>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseShearwater(strings.NewReader(tt.data))
+			assert.Equal(t, err != nil, true)
+		})
+	}
+}
@@ -0,0 +1,604 @@
+package logbook
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gpxNamespace = "http://www.topografix.com/GPX/1/1"
+	kmlNamespace = "http://www.opengis.net/kml/2.2"
+	// siteDate is the layout used for the first and last dive dates of sites.
+	siteDate = "2006-01-02"
+)
+
+type gpxDocument struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Namespace string        `xml:"xmlns,attr,omitempty"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Metadata  *gpxMetadata  `xml:"metadata,omitempty"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+type gpxWaypoint struct {
+	Latitude    float64  `xml:"lat,attr"`
+	Longitude   float64  `xml:"lon,attr"`
+	Elevation   *float64 `xml:"ele,omitempty"`
+	Name        string   `xml:"name,omitempty"`
+	Comment     string   `xml:"cmt,omitempty"`
+	Description string   `xml:"desc,omitempty"`
+	Type        string   `xml:"type,omitempty"`
+	Site        *gpxSite `xml:"extensions>site,omitempty"`
+}
+
+// gpxSite is the DiveSite GPX extension that holds the details of a dive site
+// that GPX waypoints have no elements for.
+type gpxSite struct {
+	XMLName     xml.Name `xml:"https://github.com/m5lapp/dive-site/gpx/1 site"`
+	Location    string   `xml:"location,omitempty"`
+	Region      string   `xml:"region,omitempty"`
+	Country     string   `xml:"country,omitempty"`
+	CountryCode string   `xml:"countrycode,omitempty"`
+	TimeZone    string   `xml:"timezone,omitempty"`
+	MaxDepth    *float64 `xml:"maxdepth,omitempty"`
+	WaterBody   string   `xml:"waterbody,omitempty"`
+	WaterType   string   `xml:"watertype,omitempty"`
+	Rating      *int     `xml:"rating,omitempty"`
+	Dives       int      `xml:"dives,omitempty"`
+	FirstDive   string   `xml:"firstdive,omitempty"`
+	LastDive    string   `xml:"lastdive,omitempty"`
+}
+
+type kmlDocument struct {
+	XMLName   xml.Name  `xml:"kml"`
+	Namespace string    `xml:"xmlns,attr,omitempty"`
+	Document  kmlFolder `xml:"Document"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name,omitempty"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name         string           `xml:"name"`
+	Description  string           `xml:"description,omitempty"`
+	ExtendedData *kmlExtendedData `xml:"ExtendedData,omitempty"`
+	Point        *kmlPoint        `xml:"Point"`
+}
+
+type kmlExtendedData struct {
+	Data []kmlData `xml:"Data"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// kmlPoint holds a position as a longitude, latitude and optional altitude
+// separated by commas.
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   geoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// geoJSONGeometry holds a GeoJSON Point whose coordinates are a longitude,
+// latitude and optional altitude.
+type geoJSONGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// siteProperty is a single named detail of a dive site as written into the
+// KML extended data and GeoJSON properties of a site.
+type siteProperty struct {
+	Name  string
+	Value any
+}
+
+// siteProperties returns the details of the Site other than its name and
+// position that have a value, in a stable order.
+func siteProperties(s Site) []siteProperty {
+	var props []siteProperty
+	add := func(name string, value any, ok bool) {
+		if ok {
+			props = append(props, siteProperty{Name: name, Value: value})
+		}
+	}
+
+	add("alt_name", s.AltName, s.AltName != "")
+	add("location", s.Location, s.Location != "")
+	add("region", s.Region, s.Region != "")
+	add("country", s.Country, s.Country != "")
+	add("country_code", s.CountryCode, s.CountryCode != "")
+	add("timezone", s.TimeZone, s.TimeZone != "")
+	if s.MaxDepth != nil {
+		add("max_depth", *s.MaxDepth, true)
+	}
+	if s.Altitude != nil {
+		add("altitude", *s.Altitude, true)
+	}
+	add("water_body", s.WaterBody, s.WaterBody != "")
+	add("water_type", s.WaterType, s.WaterType != "")
+	if s.Rating != nil {
+		add("rating", *s.Rating, true)
+	}
+	add("dives", s.Dives, true)
+	add("first_dive", formatDate(s.FirstDive), s.FirstDive != nil)
+	add("last_dive", formatDate(s.LastDive), s.LastDive != nil)
+	add("notes", s.Notes, s.Notes != "")
+
+	return props
+}
+
+// formatDate formats t as a date, or returns the empty string if it is nil.
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(siteDate)
+}
+
+func writeXML(w io.Writer, format string, doc any) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	err = enc.Encode(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+
+	return enc.Close()
+}
+
+// WriteGPX writes the sites as GPX 1.1 waypoints. The site's alternative name
+// is written as the waypoint's comment and its notes as the description, with
+// the remaining details held in a DiveSite extension element. Sites without a
+// position are left out.
+func WriteGPX(w io.Writer, generator string, sites []Site) error {
+	doc := gpxDocument{
+		Namespace: gpxNamespace,
+		Version:   "1.1",
+		Creator:   generator,
+		Metadata: &gpxMetadata{
+			Name: "Dive Sites",
+			Time: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	for _, s := range sites {
+		if !s.HasPosition() {
+			continue
+		}
+
+		wpt := gpxWaypoint{
+			Latitude:    *s.Latitude,
+			Longitude:   *s.Longitude,
+			Name:        s.Name,
+			Comment:     s.AltName,
+			Description: s.Notes,
+			Type:        "Dive Site",
+			Site: &gpxSite{
+				Location:    s.Location,
+				Region:      s.Region,
+				Country:     s.Country,
+				CountryCode: s.CountryCode,
+				TimeZone:    s.TimeZone,
+				MaxDepth:    s.MaxDepth,
+				WaterBody:   s.WaterBody,
+				WaterType:   s.WaterType,
+				Rating:      s.Rating,
+				Dives:       s.Dives,
+				FirstDive:   formatDate(s.FirstDive),
+				LastDive:    formatDate(s.LastDive),
+			},
+		}
+		if s.Altitude != nil {
+			wpt.Elevation = ref(float64(*s.Altitude))
+		}
+
+		doc.Waypoints = append(doc.Waypoints, wpt)
+	}
+
+	return writeXML(w, "gpx", doc)
+}
+
+// WriteKML writes the sites as KML placemarks. The site's notes are written as
+// the placemark's description and its other details as extended data. Sites
+// without a position are left out.
+func WriteKML(w io.Writer, generator string, sites []Site) error {
+	doc := kmlDocument{
+		Namespace: kmlNamespace,
+		Document:  kmlFolder{Name: generator + " Dive Sites"},
+	}
+
+	for _, s := range sites {
+		if !s.HasPosition() {
+			continue
+		}
+
+		coords := strconv.FormatFloat(*s.Longitude, 'f', -1, 64) + "," +
+			strconv.FormatFloat(*s.Latitude, 'f', -1, 64)
+		if s.Altitude != nil {
+			coords += "," + strconv.Itoa(*s.Altitude)
+		}
+
+		data := &kmlExtendedData{}
+		for _, p := range siteProperties(s) {
+			if p.Name == "notes" {
+				continue
+			}
+			data.Data = append(data.Data, kmlData{Name: p.Name, Value: fmt.Sprint(p.Value)})
+		}
+
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name:         s.Name,
+			Description:  s.Notes,
+			ExtendedData: data,
+			Point:        &kmlPoint{Coordinates: coords},
+		})
+	}
+
+	return writeXML(w, "kml", doc)
+}
+
+// WriteGeoJSON writes the sites as a GeoJSON FeatureCollection of Points with
+// the site's details as the properties of each feature. Sites without a
+// position are left out.
+func WriteGeoJSON(w io.Writer, sites []Site) error {
+	fc := geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []geoJSONFeature{},
+	}
+
+	for _, s := range sites {
+		if !s.HasPosition() {
+			continue
+		}
+
+		coords := []float64{*s.Longitude, *s.Latitude}
+		if s.Altitude != nil {
+			coords = append(coords, float64(*s.Altitude))
+		}
+
+		props := map[string]any{"name": s.Name}
+		for _, p := range siteProperties(s) {
+			props[p.Name] = p.Value
+		}
+
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geoJSONGeometry{Type: "Point", Coordinates: coords},
+			Properties: props,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(fc)
+	if err != nil {
+		return fmt.Errorf("failed to encode geojson: %w", err)
+	}
+
+	return nil
+}
+
+// decodeXMLElements calls fn with each element called name found anywhere in
+// the XML document read from r, regardless of how the document is structured.
+func decodeXMLElements[T any](r io.Reader, name string, fn func(T)) error {
+	dec := xml.NewDecoder(r)
+
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != name {
+			continue
+		}
+
+		var element T
+		err = dec.DecodeElement(&element, &start)
+		if err != nil {
+			return err
+		}
+		fn(element)
+	}
+}
+
+// validPosition reports whether lat and lon are a valid latitude and longitude.
+func validPosition(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// setSiteProperty sets the field of the Site matching one of the property
+// names written by siteProperties, ignoring any unknown names and values that
+// cannot be parsed.
+func setSiteProperty(s *Site, name, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+
+	switch strings.ToLower(name) {
+	case "alt_name":
+		s.AltName = value
+	case "location":
+		s.Location = value
+	case "region":
+		s.Region = value
+	case "country":
+		s.Country = value
+	case "country_code":
+		s.CountryCode = strings.ToUpper(value)
+	case "timezone":
+		s.TimeZone = value
+	case "max_depth":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			s.MaxDepth = &f
+		}
+	case "altitude":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			s.Altitude = ref(int(math.Round(f)))
+		}
+	case "water_body":
+		s.WaterBody = value
+	case "water_type":
+		s.WaterType = value
+	case "rating":
+		if i, err := strconv.Atoi(value); err == nil {
+			s.Rating = &i
+		}
+	case "notes":
+		s.Notes = value
+	case "description":
+		// Notes take precedence over a description as they are more specific.
+		if s.Notes == "" {
+			s.Notes = value
+		}
+	}
+}
+
+// htmlTag matches the HTML tags that mapping tools often use to format the
+// descriptions of places.
+var htmlTag = regexp.MustCompile(`(?i)<br\s*/?>|</p>|<[^>]*>`)
+
+// plainText converts an HTML description into plain text, keeping its line
+// breaks.
+func plainText(s string) string {
+	s = htmlTag.ReplaceAllStringFunc(s, func(tag string) string {
+		if strings.HasPrefix(strings.ToLower(tag), "<br") || strings.EqualFold(tag, "</p>") {
+			return "\n"
+		}
+		return ""
+	})
+
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// ParseGPXSites reads the waypoints of a GPX file as dive sites. Waypoints
+// written by WriteGPX keep all of their details, while the comment and
+// description of those from elsewhere are used as the site's notes.
+func ParseGPXSites(r io.Reader) ([]Site, error) {
+	var sites []Site
+
+	err := decodeXMLElements(r, "wpt", func(wpt gpxWaypoint) {
+		if !validPosition(wpt.Latitude, wpt.Longitude) {
+			return
+		}
+
+		s := Site{
+			Name:      strings.TrimSpace(wpt.Name),
+			Latitude:  ref(wpt.Latitude),
+			Longitude: ref(wpt.Longitude),
+		}
+		if wpt.Elevation != nil {
+			s.Altitude = ref(int(math.Round(*wpt.Elevation)))
+		}
+
+		if ext := wpt.Site; ext != nil {
+			s.AltName = strings.TrimSpace(wpt.Comment)
+			s.Notes = strings.TrimSpace(wpt.Description)
+			s.Location = strings.TrimSpace(ext.Location)
+			s.Region = strings.TrimSpace(ext.Region)
+			s.Country = strings.TrimSpace(ext.Country)
+			s.CountryCode = strings.ToUpper(strings.TrimSpace(ext.CountryCode))
+			s.TimeZone = strings.TrimSpace(ext.TimeZone)
+			s.MaxDepth = ext.MaxDepth
+			s.WaterBody = strings.TrimSpace(ext.WaterBody)
+			s.WaterType = strings.TrimSpace(ext.WaterType)
+			s.Rating = ext.Rating
+		} else {
+			var notes []string
+			for _, n := range []string{wpt.Comment, wpt.Description} {
+				if n = strings.TrimSpace(n); n != "" && !slices.Contains(notes, n) {
+					notes = append(notes, n)
+				}
+			}
+			s.Notes = strings.Join(notes, "\n\n")
+		}
+
+		sites = append(sites, s)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode gpx: %w", err)
+	}
+
+	if len(sites) == 0 {
+		return nil, errors.New("gpx file does not contain any waypoints")
+	}
+
+	return sites, nil
+}
+
+// ParseKMLSites reads the placemarks of a KML file that are points as dive
+// sites, wherever they are in the document's folders. Extended data using the
+// names written by WriteKML is used to fill in the other details of the site.
+func ParseKMLSites(r io.Reader) ([]Site, error) {
+	var sites []Site
+
+	err := decodeXMLElements(r, "Placemark", func(pm kmlPlacemark) {
+		if pm.Point == nil {
+			return
+		}
+
+		coords := strings.Split(strings.TrimSpace(pm.Point.Coordinates), ",")
+		if len(coords) < 2 {
+			return
+		}
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(coords[0]), 64)
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(coords[1]), 64)
+		if lonErr != nil || latErr != nil || !validPosition(lat, lon) {
+			return
+		}
+
+		s := Site{
+			Name:      strings.TrimSpace(pm.Name),
+			Latitude:  &lat,
+			Longitude: &lon,
+			Notes:     plainText(pm.Description),
+		}
+		if len(coords) > 2 {
+			setSiteProperty(&s, "altitude", coords[2])
+		}
+		if pm.ExtendedData != nil {
+			for _, d := range pm.ExtendedData.Data {
+				setSiteProperty(&s, d.Name, d.Value)
+			}
+		}
+
+		sites = append(sites, s)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode kml: %w", err)
+	}
+
+	if len(sites) == 0 {
+		return nil, errors.New("kml file does not contain any point placemarks")
+	}
+
+	return sites, nil
+}
+
+// ParseGeoJSONSites reads the Point features of a GeoJSON FeatureCollection, or
+// a single Feature, as dive sites. The site's name is taken from the name or
+// title property and its other details from the properties written by
+// WriteGeoJSON.
+func ParseGeoJSONSites(r io.Reader) ([]Site, error) {
+	type feature struct {
+		Type     string `json:"type"`
+		Geometry *struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]any `json:"properties"`
+	}
+
+	var doc struct {
+		feature
+		Features []feature `json:"features"`
+	}
+
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode geojson: %w", err)
+	}
+
+	features := doc.Features
+	switch doc.Type {
+	case "FeatureCollection":
+	case "Feature":
+		features = []feature{doc.feature}
+	default:
+		return nil, fmt.Errorf("unsupported geojson type %q", doc.Type)
+	}
+
+	var sites []Site
+
+	for _, f := range features {
+		if f.Geometry == nil || f.Geometry.Type != "Point" {
+			continue
+		}
+
+		var coords []float64
+		err := json.Unmarshal(f.Geometry.Coordinates, &coords)
+		if err != nil || len(coords) < 2 || !validPosition(coords[1], coords[0]) {
+			continue
+		}
+
+		s := Site{Latitude: &coords[1], Longitude: &coords[0]}
+		if len(coords) > 2 {
+			s.Altitude = ref(int(math.Round(coords[2])))
+		}
+
+		for name, value := range f.Properties {
+			str := ""
+			if value != nil {
+				str = fmt.Sprint(value)
+			}
+
+			switch strings.ToLower(name) {
+			case "name":
+				s.Name = strings.TrimSpace(str)
+			case "title":
+				if s.Name == "" {
+					s.Name = strings.TrimSpace(str)
+				}
+			case "altitude":
+				// The altitude in the coordinates takes precedence.
+				if s.Altitude == nil {
+					setSiteProperty(&s, name, str)
+				}
+			default:
+				setSiteProperty(&s, name, str)
+			}
+		}
+
+		sites = append(sites, s)
+	}
+
+	if len(sites) == 0 {
+		return nil, errors.New("geojson file does not contain any point features")
+	}
+
+	return sites, nil
+}
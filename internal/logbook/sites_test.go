@@ -0,0 +1,240 @@
+package logbook
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func testSites() []Site {
+	firstDive := time.Date(2020, 1, 19, 14, 21, 0, 0, time.UTC)
+	lastDive := time.Date(2023, 5, 2, 9, 0, 0, 0, time.UTC)
+
+	return []Site{
+		{
+			Name:        "Sail Rock",
+			AltName:     "Hin Bai",
+			Location:    "Koh Phangan",
+			Country:     "Thailand",
+			CountryCode: "TH",
+			TimeZone:    "Asia/Bangkok",
+			Latitude:    ref(9.9503),
+			Longitude:   ref(100.0092),
+			Altitude:    ref(0),
+			MaxDepth:    ref(40.0),
+			WaterBody:   "Ocean",
+			WaterType:   "Salt",
+			Notes:       "Chimney & whale sharks",
+			Dives:       3,
+			FirstDive:   &firstDive,
+			LastDive:    &lastDive,
+		},
+		{Name: "Unknown Reef"},
+	}
+}
+
+func TestWriteGPX(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteGPX(&buf, "DiveSite", testSites())
+	assert.NilError(t, err)
+	assert.StringContains(t, buf.String(), `xmlns="http://www.topografix.com/GPX/1/1"`)
+	assert.StringContains(t, buf.String(), "<desc>Chimney &amp; whale sharks</desc>")
+
+	var doc gpxDocument
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	assert.NilError(t, err)
+	assert.Equal(t, len(doc.Waypoints), 1)
+
+	wpt := doc.Waypoints[0]
+	assert.Equal(t, wpt.Latitude, 9.9503)
+	assert.Equal(t, wpt.Longitude, 100.0092)
+	assert.Equal(t, wpt.Name, "Sail Rock")
+	assert.Equal(t, wpt.Comment, "Hin Bai")
+	assert.Equal(t, wpt.Site.Dives, 3)
+	assert.Equal(t, wpt.Site.FirstDive, "2020-01-19")
+	assert.Equal(t, wpt.Site.LastDive, "2023-05-02")
+	assert.Equal(t, *wpt.Site.MaxDepth, 40.0)
+}
+
+func TestWriteKML(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteKML(&buf, "DiveSite", testSites())
+	assert.NilError(t, err)
+
+	var doc kmlDocument
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	assert.NilError(t, err)
+	assert.Equal(t, len(doc.Document.Placemarks), 1)
+
+	pm := doc.Document.Placemarks[0]
+	assert.Equal(t, pm.Name, "Sail Rock")
+	assert.Equal(t, pm.Description, "Chimney & whale sharks")
+	assert.Equal(t, pm.Point.Coordinates, "100.0092,9.9503,0")
+
+	data := map[string]string{}
+	for _, d := range pm.ExtendedData.Data {
+		data[d.Name] = d.Value
+	}
+	assert.Equal(t, data["alt_name"], "Hin Bai")
+	assert.Equal(t, data["dives"], "3")
+	assert.Equal(t, data["first_dive"], "2020-01-19")
+	assert.Equal(t, data["last_dive"], "2023-05-02")
+}
+
+func TestWriteGeoJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteGeoJSON(&buf, testSites())
+	assert.NilError(t, err)
+
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry   geoJSONGeometry `json:"geometry"`
+			Properties map[string]any  `json:"properties"`
+		} `json:"features"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &fc)
+	assert.NilError(t, err)
+	assert.Equal(t, fc.Type, "FeatureCollection")
+	assert.Equal(t, len(fc.Features), 1)
+
+	f := fc.Features[0]
+	assert.Equal(t, f.Geometry.Type, "Point")
+	assert.Equal(t, len(f.Geometry.Coordinates), 3)
+	assert.Equal(t, f.Geometry.Coordinates[0], 100.0092)
+	assert.Equal(t, f.Properties["name"], any("Sail Rock"))
+	assert.Equal(t, f.Properties["alt_name"], any("Hin Bai"))
+	assert.Equal(t, f.Properties["dives"], any(3.0))
+	assert.Equal(t, f.Properties["notes"], any("Chimney & whale sharks"))
+	assert.Equal(t, f.Properties["last_dive"], any("2023-05-02"))
+}
+
+func TestParseSitesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer, []Site) error
+		parse func(io.Reader) ([]Site, error)
+	}{
+		{
+			"GPX",
+			func(buf *bytes.Buffer, sites []Site) error { return WriteGPX(buf, "DiveSite", sites) },
+			ParseGPXSites,
+		},
+		{
+			"KML",
+			func(buf *bytes.Buffer, sites []Site) error { return WriteKML(buf, "DiveSite", sites) },
+			ParseKMLSites,
+		},
+		{
+			"GeoJSON",
+			func(buf *bytes.Buffer, sites []Site) error { return WriteGeoJSON(buf, sites) },
+			ParseGeoJSONSites,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := tt.write(&buf, testSites())
+			assert.NilError(t, err)
+
+			sites, err := tt.parse(&buf)
+			assert.NilError(t, err)
+			assert.Equal(t, len(sites), 1)
+
+			s := sites[0]
+			assert.Equal(t, s.Name, "Sail Rock")
+			assert.Equal(t, s.AltName, "Hin Bai")
+			assert.Equal(t, s.Location, "Koh Phangan")
+			assert.Equal(t, s.CountryCode, "TH")
+			assert.Equal(t, s.TimeZone, "Asia/Bangkok")
+			assert.Equal(t, *s.Latitude, 9.9503)
+			assert.Equal(t, *s.Longitude, 100.0092)
+			assert.Equal(t, *s.Altitude, 0)
+			assert.Equal(t, *s.MaxDepth, 40.0)
+			assert.Equal(t, s.WaterType, "Salt")
+			assert.Equal(t, s.Notes, "Chimney & whale sharks")
+		})
+	}
+}
+
+func TestParseSites(t *testing.T) {
+	gpx := `<?xml version="1.0"?>
+<gpx version="1.1" creator="Garmin" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="27.7833" lon="34.3167"><name>Ras Mohammed</name><cmt>Shark Reef</cmt><desc>Strong currents</desc></wpt>
+  <wpt lat="95" lon="34.3167"><name>Invalid</name></wpt>
+  <trk><name>Boat track</name></trk>
+</gpx>`
+
+	kml := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2"><Document><Folder><name>North</name>
+  <Placemark><name>Thistlegorm</name><description><![CDATA[Wreck<br>WWII &amp; more]]></description>
+    <Point><coordinates> 33.9217,27.8136,0 </coordinates></Point></Placemark>
+  <Placemark><name>Route</name><LineString><coordinates>1,2 3,4</coordinates></LineString></Placemark>
+</Folder></Document></kml>`
+
+	geojson := `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-5.2, 36.1]},
+  "properties": {"title": "Europa Point", "description": "Cold", "max_depth": 30}}`
+
+	sites, err := ParseGPXSites(strings.NewReader(gpx))
+	assert.NilError(t, err)
+	assert.Equal(t, len(sites), 1)
+	assert.Equal(t, sites[0].Name, "Ras Mohammed")
+	assert.Equal(t, sites[0].AltName, "")
+	assert.Equal(t, sites[0].Notes, "Shark Reef\n\nStrong currents")
+
+	sites, err = ParseKMLSites(strings.NewReader(kml))
+	assert.NilError(t, err)
+	assert.Equal(t, len(sites), 1)
+	assert.Equal(t, sites[0].Name, "Thistlegorm")
+	assert.Equal(t, *sites[0].Longitude, 33.9217)
+	assert.Equal(t, sites[0].Notes, "Wreck\nWWII & more")
+
+	sites, err = ParseGeoJSONSites(strings.NewReader(geojson))
+	assert.NilError(t, err)
+	assert.Equal(t, len(sites), 1)
+	assert.Equal(t, sites[0].Name, "Europa Point")
+	assert.Equal(t, *sites[0].Latitude, 36.1)
+	assert.Equal(t, *sites[0].MaxDepth, 30.0)
+	assert.Equal(t, sites[0].Notes, "Cold")
+
+	_, err = ParseGPXSites(strings.NewReader(`<gpx></gpx>`))
+	assert.Equal(t, err != nil, true)
+	_, err = ParseKMLSites(strings.NewReader(`<kml><Document>`))
+	assert.Equal(t, err != nil, true)
+	_, err = ParseGeoJSONSites(strings.NewReader(`{"type": "Polygon"}`))
+	assert.Equal(t, err != nil, true)
+}
+
+func TestNearestZone(t *testing.T) {
+	tests := []struct {
+		name        string
+		lat, lon    float64
+		countryCode string
+		timeZone    string
+	}{
+		{"Koh Tao", 10.1, 99.83, "TH", "Asia/Bangkok"},
+		{"Sharm El Sheikh", 27.91, 34.33, "EG", "Africa/Cairo"},
+		{"Cozumel", 20.42, -86.92, "MX", "America/Cancun"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, ok := NearestZone(tt.lat, tt.lon)
+			assert.Equal(t, ok, true)
+			assert.Equal(t, z.CountryCode, tt.countryCode)
+			assert.Equal(t, z.TimeZone, tt.timeZone)
+		})
+	}
+
+	lat, lon, ok := parseISO6709("+513030-0000731")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, lat, 51.508333333333333)
+	assert.Equal(t, lon > -0.1254 && lon < -0.1252, true)
+}
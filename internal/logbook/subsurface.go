@@ -0,0 +1,419 @@
+package logbook
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subsurface geo taxonomy categories as stored in the cat attribute of a dive
+// site's geo elements.
+const (
+	ssrfGeoCountry  = 2
+	ssrfGeoAdminL1  = 3
+	ssrfGeoLocality = 5
+)
+
+type ssrfDivelog struct {
+	XMLName xml.Name   `xml:"divelog"`
+	Program string     `xml:"program,attr"`
+	Sites   []ssrfSite `xml:"divesites>site"`
+	Trips   []ssrfTrip `xml:"dives>trip"`
+	Dives   []ssrfDive `xml:"dives>dive"`
+}
+
+type ssrfSite struct {
+	UUID        string `xml:"uuid,attr"`
+	Name        string `xml:"name,attr"`
+	GPS         string `xml:"gps,attr"`
+	Description string `xml:"description,attr"`
+	Notes       string `xml:"notes"`
+	Geo         []struct {
+		Cat   int    `xml:"cat,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"geo"`
+}
+
+type ssrfTrip struct {
+	Date     string     `xml:"date,attr"`
+	Time     string     `xml:"time,attr"`
+	Location string     `xml:"location,attr"`
+	Notes    string     `xml:"notes"`
+	Dives    []ssrfDive `xml:"dive"`
+}
+
+type ssrfDepth struct {
+	Max  string `xml:"max,attr"`
+	Mean string `xml:"mean,attr"`
+}
+
+type ssrfTemperature struct {
+	Air   string `xml:"air,attr"`
+	Water string `xml:"water,attr"`
+}
+
+type ssrfSample struct {
+	Time     string `xml:"time,attr"`
+	Depth    string `xml:"depth,attr"`
+	Temp     string `xml:"temp,attr"`
+	Pressure string `xml:"pressure,attr"`
+	PO2      string `xml:"po2,attr"`
+}
+
+type ssrfEvent struct {
+	Time  string `xml:"time,attr"`
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type ssrfDiveComputer struct {
+	Model       string          `xml:"model,attr"`
+	Depth       ssrfDepth       `xml:"depth"`
+	Temperature ssrfTemperature `xml:"temperature"`
+	Samples     []ssrfSample    `xml:"sample"`
+	Events      []ssrfEvent     `xml:"event"`
+}
+
+type ssrfDive struct {
+	Number     int    `xml:"number,attr"`
+	Rating     int    `xml:"rating,attr"`
+	DiveSiteID string `xml:"divesiteid,attr"`
+	Date       string `xml:"date,attr"`
+	Time       string `xml:"time,attr"`
+	Duration   string `xml:"duration,attr"`
+	Location   *struct {
+		GPS  string `xml:"gps,attr"`
+		Name string `xml:",chardata"`
+	} `xml:"location"`
+	Buddy     string `xml:"buddy"`
+	Notes     string `xml:"notes"`
+	Cylinders []struct {
+		Description string `xml:"description,attr"`
+		Size        string `xml:"size,attr"`
+		O2          string `xml:"o2,attr"`
+		He          string `xml:"he,attr"`
+		Start       string `xml:"start,attr"`
+		End         string `xml:"end,attr"`
+	} `xml:"cylinder"`
+	WeightSystems []struct {
+		Weight string `xml:"weight,attr"`
+	} `xml:"weightsystem"`
+	// Older versions of the Subsurface format store the depth and temperature
+	// directly on the dive rather than on the dive computer.
+	Depth         ssrfDepth          `xml:"depth"`
+	Temperature   ssrfTemperature    `xml:"temperature"`
+	DiveComputers []ssrfDiveComputer `xml:"divecomputer"`
+}
+
+// ParseSubsurface reads a Subsurface XML log book (.ssrf or .xml) from r and
+// returns the dives within it in chronological order.
+func ParseSubsurface(r io.Reader) ([]Dive, error) {
+	var divelog ssrfDivelog
+
+	err := xml.NewDecoder(r).Decode(&divelog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode subsurface xml: %w", err)
+	}
+
+	sites := make(map[string]*Site, len(divelog.Sites))
+	for _, s := range divelog.Sites {
+		sites[s.UUID] = s.toSite()
+	}
+
+	var dives []Dive
+
+	for _, t := range divelog.Trips {
+		trip := &Trip{Name: strings.TrimSpace(t.Location), Notes: strings.TrimSpace(t.Notes)}
+		if trip.Name == "" {
+			trip.Name = "Trip starting " + t.Date
+		}
+
+		for _, d := range t.Dives {
+			dive, err := d.toDive(sites)
+			if err != nil {
+				return nil, err
+			}
+
+			dive.Trip = trip
+			// Subsurface only stores the location on the trip, so use it as
+			// the location for the trip's dive sites if they do not have one.
+			if dive.Site != nil && dive.Site.Location == "" {
+				dive.Site.Location = strings.TrimSpace(t.Location)
+			}
+
+			dives = append(dives, dive)
+		}
+	}
+
+	for _, d := range divelog.Dives {
+		dive, err := d.toDive(sites)
+		if err != nil {
+			return nil, err
+		}
+		dives = append(dives, dive)
+	}
+
+	slices.SortStableFunc(dives, func(a, b Dive) int {
+		return a.DateTimeIn.Compare(b.DateTimeIn)
+	})
+
+	return dives, nil
+}
+
+func (s ssrfSite) toSite() *Site {
+	site := &Site{
+		Name:  strings.TrimSpace(s.Name),
+		Notes: strings.TrimSpace(s.Notes),
+	}
+
+	if site.Notes == "" {
+		site.Notes = strings.TrimSpace(s.Description)
+	}
+
+	site.Latitude, site.Longitude = parseSubsurfaceGPS(s.GPS)
+
+	for _, geo := range s.Geo {
+		switch geo.Cat {
+		case ssrfGeoCountry:
+			site.Country = geo.Value
+		case ssrfGeoLocality:
+			site.Location = geo.Value
+		case ssrfGeoAdminL1:
+			if site.Location == "" {
+				site.Location = geo.Value
+			}
+		}
+	}
+
+	return site
+}
+
+func (d ssrfDive) toDive(sites map[string]*Site) (Dive, error) {
+	dateTimeIn, err := time.Parse(time.DateTime, d.Date+" "+d.Time)
+	if err != nil {
+		msg := "failed to parse date and time of subsurface dive number %d: %w"
+		return Dive{}, fmt.Errorf(msg, d.Number, err)
+	}
+
+	duration, err := parseSubsurfaceDuration(d.Duration)
+	if err != nil {
+		msg := "failed to parse duration of subsurface dive number %d: %w"
+		return Dive{}, fmt.Errorf(msg, d.Number, err)
+	}
+
+	dive := Dive{
+		Number:     d.Number,
+		DateTimeIn: dateTimeIn,
+		Duration:   duration,
+		Notes:      strings.TrimSpace(d.Notes),
+	}
+
+	if d.Rating > 0 {
+		// Subsurface rates dives out of five stars.
+		rating := min(d.Rating*2, 10)
+		dive.Rating = &rating
+	}
+
+	if site, ok := sites[d.DiveSiteID]; ok {
+		// Take a copy so that any changes made to one dive's site do not
+		// affect any other dives at the same site.
+		siteCopy := *site
+		dive.Site = &siteCopy
+	} else if d.Location != nil && strings.TrimSpace(d.Location.Name) != "" {
+		dive.Site = &Site{Name: strings.TrimSpace(d.Location.Name)}
+		dive.Site.Latitude, dive.Site.Longitude = parseSubsurfaceGPS(d.Location.GPS)
+	}
+
+	for buddy := range strings.SplitSeq(d.Buddy, ",") {
+		if buddy = strings.TrimSpace(buddy); buddy != "" {
+			dive.Buddies = append(dive.Buddies, buddy)
+		}
+	}
+
+	depth := d.Depth
+	temperature := d.Temperature
+	if len(d.DiveComputers) > 0 {
+		if d.DiveComputers[0].Depth.Max != "" {
+			depth = d.DiveComputers[0].Depth
+		}
+		if d.DiveComputers[0].Temperature != (ssrfTemperature{}) {
+			temperature = d.DiveComputers[0].Temperature
+		}
+	}
+
+	if maxDepth, ok := parseSubsurfaceValue(depth.Max); ok {
+		dive.MaxDepth = maxDepth
+	}
+	if avgDepth, ok := parseSubsurfaceValue(depth.Mean); ok {
+		dive.AvgDepth = &avgDepth
+	}
+	if waterTemp, ok := parseSubsurfaceValue(temperature.Water); ok {
+		dive.WaterTemp = &waterTemp
+	}
+	if airTemp, ok := parseSubsurfaceValue(temperature.Air); ok {
+		dive.AirTemp = &airTemp
+	}
+
+	for _, c := range d.Cylinders {
+		cylinder := Cylinder{Description: c.Description}
+
+		if size, ok := parseSubsurfaceValue(c.Size); ok && size > 0 {
+			cylinder.Volume = &size
+		}
+		if start, ok := parseSubsurfaceValue(c.Start); ok {
+			cylinder.StartPressure = &start
+		}
+		if end, ok := parseSubsurfaceValue(c.End); ok {
+			cylinder.EndPressure = &end
+		}
+		if o2, ok := parseSubsurfaceValue(c.O2); ok {
+			cylinder.O2 = o2 / 100
+		}
+		if he, ok := parseSubsurfaceValue(c.He); ok {
+			cylinder.He = he / 100
+		}
+
+		dive.Cylinders = append(dive.Cylinders, cylinder)
+	}
+
+	if len(d.DiveComputers) > 0 {
+		dive.Samples, err = d.DiveComputers[0].toSamples()
+		if err != nil {
+			msg := "failed to parse samples of subsurface dive number %d: %w"
+			return Dive{}, fmt.Errorf(msg, d.Number, err)
+		}
+	}
+
+	for _, ws := range d.WeightSystems {
+		if weight, ok := parseSubsurfaceValue(ws.Weight); ok {
+			total := weight
+			if dive.Weight != nil {
+				total += *dive.Weight
+			}
+			dive.Weight = &total
+		}
+	}
+
+	return dive, nil
+}
+
+// toSamples converts the dive computer's samples and events into a profile.
+// Subsurface only writes the temperature and pressure of a sample when they
+// change, so they are left nil on the samples in between.
+func (dc ssrfDiveComputer) toSamples() ([]Sample, error) {
+	var samples []Sample
+
+	for _, s := range dc.Samples {
+		t, err := parseSubsurfaceDuration(s.Time)
+		if err != nil {
+			return nil, err
+		}
+
+		sample := Sample{Time: t}
+		if depth, ok := parseSubsurfaceValue(s.Depth); ok {
+			sample.Depth = depth
+		}
+		if temp, ok := parseSubsurfaceValue(s.Temp); ok {
+			sample.Temperature = &temp
+		}
+		if pressure, ok := parseSubsurfaceValue(s.Pressure); ok {
+			sample.Pressure = &pressure
+		}
+		if po2, ok := parseSubsurfaceValue(s.PO2); ok {
+			sample.PPO2 = &po2
+		}
+
+		samples = append(samples, sample)
+	}
+
+	for _, e := range dc.Events {
+		t, err := parseSubsurfaceDuration(e.Time)
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSpace(e.Name)
+		if name == "gaschange" && e.Value != "" {
+			name = fmt.Sprintf("gaschange %s%%", e.Value)
+		}
+
+		samples = addSampleEvent(samples, t, name)
+	}
+
+	return samples, nil
+}
+
+// parseSubsurfaceValue parses a Subsurface value such as "17.6 m", "28.0 C" or
+// "32.0%" and returns the numeric part of it. Subsurface always stores its
+// values in metric units. The returned bool is false if the value is empty or
+// could not be parsed.
+func parseSubsurfaceValue(value string) (float64, bool) {
+	fields := strings.Fields(strings.ReplaceAll(value, "%", ""))
+	if len(fields) == 0 {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return f, true
+}
+
+// parseSubsurfaceDuration parses a Subsurface duration such as "45:30 min" or
+// "1:05:30 min" into a time.Duration.
+func parseSubsurfaceDuration(value string) (time.Duration, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, nil
+	}
+
+	var duration time.Duration
+	parts := strings.Split(fields[0], ":")
+	units := []time.Duration{time.Second, time.Minute, time.Hour}
+
+	if len(parts) > len(units) {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	for i := range parts {
+		n, err := strconv.Atoi(parts[len(parts)-1-i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		duration += time.Duration(n) * units[i]
+	}
+
+	// A lone number is a count of minutes rather than seconds.
+	if len(parts) == 1 {
+		duration *= 60
+	}
+
+	return duration, nil
+}
+
+// parseSubsurfaceGPS parses a Subsurface GPS attribute which holds a decimal
+// latitude and longitude separated by a space.
+func parseSubsurfaceGPS(value string) (*float64, *float64) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return nil, nil
+	}
+
+	lat, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	lon, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, nil
+	}
+
+	return &lat, &lon
+}
@@ -0,0 +1,111 @@
+package logbook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+const ssrfTestLog = `<divelog program='subsurface' version='3'>
+<divesites>
+<site uuid='4a3b2c1d' name='Sail Rock' gps='9.718500 99.975600'>
+  <geo cat='2' origin='2' value='Thailand'/>
+  <geo cat='5' origin='0' value='Koh Tao'/>
+</site>
+</divesites>
+<dives>
+<trip date='2024-03-01' time='08:00:00' location='Gulf of Thailand'>
+<dive number='12' rating='4' divesiteid='4a3b2c1d' date='2024-03-02' time='09:15:00' duration='48:30 min'>
+  <buddy>John Smith, Jane Doe</buddy>
+  <cylinder size='12.0 l' workpressure='232.0 bar' description='12ℓ 232 bar' o2='32.0%' start='200.0 bar' end='60.0 bar' />
+  <weightsystem weight='4.0 kg' description='belt' />
+  <weightsystem weight='2.0 kg' description='pockets' />
+  <divecomputer model='Shearwater Peregrine'>
+  <depth max='24.3 m' mean='14.1 m' />
+  <temperature water='29.0 C' />
+  <event time='20:00 min' type='25' flags='1' name='gaschange' value='32' />
+  <sample time='0:10 min' depth='3.2 m' temp='29.0 C' pressure='200.0 bar' />
+  <sample time='20:00 min' depth='24.3 m' po2='1.1 bar' />
+  <sample time='48:30 min' depth='0.0 m' pressure='60.0 bar' />
+  </divecomputer>
+</dive>
+</trip>
+<dive number='11' date='2024-02-20' time='14:00:00' duration='35 min'>
+  <location gps='9.700000 99.900000'>Twins</location>
+  <depth max='12.0 m' />
+</dive>
+</dives>
+</divelog>`
+
+func TestParseSubsurface(t *testing.T) {
+	dives, err := ParseSubsurface(strings.NewReader(ssrfTestLog))
+	assert.NilError(t, err)
+	assert.Equal(t, len(dives), 2)
+
+	// Dives are returned in chronological order, regardless of trips.
+	older, newer := dives[0], dives[1]
+
+	assert.Equal(t, older.Number, 11)
+	assert.Equal(t, older.Duration, 35*time.Minute)
+	assert.Equal(t, older.MaxDepth, 12.0)
+	assert.Equal(t, older.Site.Name, "Twins")
+	assert.Equal(t, older.Site.HasPosition(), true)
+	assert.Equal(t, older.Trip == nil, true)
+	assert.Equal(t, older.Cylinder().GasMixName(), "Air")
+
+	assert.Equal(t, newer.Number, 12)
+	assert.Equal(t, newer.DateTimeIn.Format(time.DateTime), "2024-03-02 09:15:00")
+	assert.Equal(t, newer.Duration, 48*time.Minute+30*time.Second)
+	assert.Equal(t, newer.MaxDepth, 24.3)
+	assert.Equal(t, *newer.AvgDepth, 14.1)
+	assert.Equal(t, *newer.WaterTemp, 29.0)
+	assert.Equal(t, *newer.Rating, 8)
+	assert.Equal(t, *newer.Weight, 6.0)
+	assert.Equal(t, newer.Buddy(), "John Smith")
+	assert.Equal(t, len(newer.Buddies), 2)
+	assert.Equal(t, newer.Site.Name, "Sail Rock")
+	assert.Equal(t, newer.Site.Country, "Thailand")
+	assert.Equal(t, newer.Site.Location, "Koh Tao")
+	assert.Equal(t, newer.Trip.Name, "Gulf of Thailand")
+
+	cylinder := newer.Cylinder()
+	assert.Equal(t, cylinder.FO2(), 0.32)
+	assert.Equal(t, cylinder.GasMixName(), "Nitrox")
+	assert.Equal(t, *cylinder.Volume, 12.0)
+	assert.Equal(t, *cylinder.StartPressure, 200.0)
+	assert.Equal(t, *cylinder.EndPressure, 60.0)
+
+	assert.Equal(t, len(older.Samples), 0)
+	assert.Equal(t, len(newer.Samples), 3)
+	assert.Equal(t, newer.Samples[0].Time, 10*time.Second)
+	assert.Equal(t, newer.Samples[0].Depth, 3.2)
+	assert.Equal(t, *newer.Samples[0].Temperature, 29.0)
+	assert.Equal(t, *newer.Samples[0].Pressure, 200.0)
+	assert.Equal(t, newer.Samples[1].Temperature == nil, true)
+	assert.Equal(t, *newer.Samples[1].PPO2, 1.1)
+	assert.Equal(t, newer.Samples[1].Events[0], "gaschange 32%")
+	assert.Equal(t, *newer.Samples[2].Pressure, 60.0)
+}
+
+func TestParseSubsurfaceDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "minutes and seconds", value: "45:30 min", want: 45*time.Minute + 30*time.Second},
+		{name: "hours", value: "1:05:30 min", want: time.Hour + 5*time.Minute + 30*time.Second},
+		{name: "minutes only", value: "35 min", want: 35 * time.Minute},
+		{name: "empty", value: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSubsurfaceDuration(tt.value)
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,920 @@
+package logbook
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UDDFVersion is the version of the Universal Dive Data Format written by
+// WriteUDDF. ParseUDDF accepts any 3.x version.
+const UDDFVersion = "3.2.3"
+
+const (
+	uddfNamespace = "http://www.streit.cc/uddf/3.2/"
+	// uddfDateTime is the layout used for UDDF date and time values. UDDF
+	// stores the local time of the dive without a UTC offset.
+	uddfDateTime = "2006-01-02T15:04:05"
+	// kelvinOffset converts between degrees Celsius and Kelvin which UDDF uses
+	// for all of its temperatures.
+	kelvinOffset = 273.15
+	// pascalsPerBar converts between bar and Pascals which UDDF uses for all
+	// of its pressures.
+	pascalsPerBar = 100_000
+)
+
+type uddfDocument struct {
+	XMLName         xml.Name              `xml:"uddf"`
+	Namespace       string                `xml:"xmlns,attr,omitempty"`
+	Version         string                `xml:"version,attr"`
+	Generator       uddfGenerator         `xml:"generator"`
+	Diver           uddfDiver             `xml:"diver"`
+	DiveSite        uddfDiveSiteSection   `xml:"divesite"`
+	DiveTrips       *uddfDiveTrips        `xml:"divetrip,omitempty"`
+	GasDefinitions  *uddfGasDefinitions   `xml:"gasdefinitions,omitempty"`
+	RepetitionGroup []uddfRepetitionGroup `xml:"profiledata>repetitiongroup"`
+}
+
+type uddfGenerator struct {
+	Name     string `xml:"name"`
+	Type     string `xml:"type"`
+	Version  string `xml:"version,omitempty"`
+	DateTime string `xml:"datetime,omitempty"`
+}
+
+type uddfDiver struct {
+	Owner   uddfOwner    `xml:"owner"`
+	Buddies []uddfPerson `xml:"buddy"`
+}
+
+type uddfOwner struct {
+	ID        string               `xml:"id,attr"`
+	Equipment *uddfEquipmentPieces `xml:"equipment,omitempty"`
+}
+
+type uddfEquipmentPieces struct {
+	Pieces []uddfEquipment `xml:"variouspieces"`
+}
+
+type uddfEquipment struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name"`
+}
+
+type uddfPerson struct {
+	ID       string       `xml:"id,attr"`
+	Personal uddfPersonal `xml:"personal"`
+}
+
+type uddfPersonal struct {
+	FirstName  string `xml:"firstname,omitempty"`
+	MiddleName string `xml:"middlename,omitempty"`
+	LastName   string `xml:"lastname,omitempty"`
+}
+
+// Name joins the parts of the person's name together.
+func (p uddfPersonal) Name() string {
+	parts := []string{}
+	for _, part := range []string{p.FirstName, p.MiddleName, p.LastName} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+type uddfDiveSiteSection struct {
+	DiveBases []uddfDiveBase `xml:"divebase"`
+	Sites     []uddfSite     `xml:"site"`
+}
+
+type uddfDiveBase struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name"`
+}
+
+type uddfSite struct {
+	ID        string         `xml:"id,attr"`
+	Name      string         `xml:"name"`
+	AliasName string         `xml:"aliasname,omitempty"`
+	Geography uddfGeography  `xml:"geography"`
+	SiteData  *uddfSiteData  `xml:"sitedata,omitempty"`
+	Rating    *uddfRating    `xml:"rating,omitempty"`
+	Notes     *uddfNotes     `xml:"notes,omitempty"`
+	AppData   *uddfSiteExtra `xml:"applicationdata>divesite,omitempty"`
+}
+
+type uddfGeography struct {
+	Location  string       `xml:"location,omitempty"`
+	Address   *uddfAddress `xml:"address,omitempty"`
+	Latitude  *float64     `xml:"latitude,omitempty"`
+	Longitude *float64     `xml:"longitude,omitempty"`
+	Altitude  *float64     `xml:"altitude,omitempty"`
+}
+
+type uddfAddress struct {
+	Province string `xml:"province,omitempty"`
+	Country  string `xml:"country,omitempty"`
+}
+
+type uddfSiteData struct {
+	MaximumDepth *float64 `xml:"maximumdepth,omitempty"`
+}
+
+type uddfRating struct {
+	Value int `xml:"ratingvalue"`
+}
+
+type uddfNotes struct {
+	Paras []string `xml:"para"`
+}
+
+// Text joins the paragraphs of the notes together with blank lines.
+func (n *uddfNotes) Text() string {
+	if n == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.Join(n.Paras, "\n\n"))
+}
+
+// uddfSiteExtra holds the dive site fields which UDDF has no element for.
+type uddfSiteExtra struct {
+	CountryCode string `xml:"countrycode,omitempty"`
+	TimeZone    string `xml:"timezone,omitempty"`
+	WaterBody   string `xml:"waterbody,omitempty"`
+	WaterType   string `xml:"watertype,omitempty"`
+}
+
+type uddfDiveTrips struct {
+	Trips []uddfTrip `xml:"trip"`
+}
+
+type uddfTrip struct {
+	ID        string         `xml:"id,attr"`
+	Name      string         `xml:"name"`
+	TripParts []uddfTripPart `xml:"trippart"`
+	Rating    *uddfRating    `xml:"rating,omitempty"`
+}
+
+type uddfTripPart struct {
+	DateOfTrip   *uddfDateOfTrip `xml:"dateoftrip,omitempty"`
+	RelatedDives []uddfLink      `xml:"relateddives>link"`
+	Description  *uddfNotes      `xml:"description,omitempty"`
+	Notes        *uddfNotes      `xml:"notes,omitempty"`
+}
+
+type uddfDateOfTrip struct {
+	StartDate string `xml:"startdate,attr"`
+	EndDate   string `xml:"enddate,attr"`
+}
+
+type uddfLink struct {
+	Ref string `xml:"ref,attr"`
+}
+
+type uddfGasDefinitions struct {
+	Mixes []uddfMix `xml:"mix"`
+}
+
+type uddfMix struct {
+	ID   string  `xml:"id,attr"`
+	Name string  `xml:"name"`
+	O2   float64 `xml:"o2"`
+	N2   float64 `xml:"n2"`
+	He   float64 `xml:"he"`
+}
+
+type uddfRepetitionGroup struct {
+	ID    string     `xml:"id,attr"`
+	Dives []uddfDive `xml:"dive"`
+}
+
+type uddfDive struct {
+	ID      string         `xml:"id,attr"`
+	Before  uddfBeforeDive `xml:"informationbeforedive"`
+	Tanks   []uddfTankData `xml:"tankdata"`
+	Samples *uddfSamples   `xml:"samples,omitempty"`
+	After   uddfAfterDive  `xml:"informationafterdive"`
+	Extra   *uddfDiveExtra `xml:"applicationdata>divesite,omitempty"`
+}
+
+type uddfSamples struct {
+	Waypoints []uddfWaypoint `xml:"waypoint"`
+}
+
+// uddfWaypoint is a single sample of a dive's profile. UDDF gives the time in
+// seconds, the temperature in Kelvin and the pressures in Pascals.
+type uddfWaypoint struct {
+	Alarms        []string  `xml:"alarm"`
+	CalculatedPO2 *float64  `xml:"calculatedpo2,omitempty"`
+	Depth         float64   `xml:"depth"`
+	DiveTime      float64   `xml:"divetime"`
+	SwitchMix     *uddfLink `xml:"switchmix,omitempty"`
+	TankPressure  *float64  `xml:"tankpressure,omitempty"`
+	Temperature   *float64  `xml:"temperature,omitempty"`
+}
+
+type uddfBeforeDive struct {
+	Links           []uddfLink           `xml:"link"`
+	DateTime        string               `xml:"datetime"`
+	DiveNumber      int                  `xml:"divenumber,omitempty"`
+	AirTemperature  *float64             `xml:"airtemperature,omitempty"`
+	SurfaceInterval *uddfSurfaceInterval `xml:"surfaceintervalbeforedive,omitempty"`
+	TripMembership  string               `xml:"tripmembership,omitempty"`
+	Price           *uddfPrice           `xml:"price,omitempty"`
+}
+
+type uddfSurfaceInterval struct {
+	PassedTime *float64  `xml:"passedtime,omitempty"`
+	Infinity   *struct{} `xml:"infinity,omitempty"`
+}
+
+type uddfPrice struct {
+	Currency string  `xml:"currency,attr,omitempty"`
+	Value    float64 `xml:",chardata"`
+}
+
+type uddfTankData struct {
+	Links         []uddfLink `xml:"link"`
+	TankVolume    *float64   `xml:"tankvolume,omitempty"`
+	PressureBegin *float64   `xml:"tankpressurebegin,omitempty"`
+	PressureEnd   *float64   `xml:"tankpressureend,omitempty"`
+}
+
+type uddfAfterDive struct {
+	GreatestDepth     float64            `xml:"greatestdepth"`
+	AverageDepth      *float64           `xml:"averagedepth,omitempty"`
+	DiveDuration      float64            `xml:"diveduration"`
+	LowestTemperature *float64           `xml:"lowesttemperature,omitempty"`
+	Visibility        *float64           `xml:"visibility,omitempty"`
+	EquipmentUsed     *uddfEquipmentUsed `xml:"equipmentused,omitempty"`
+	Rating            *uddfRating        `xml:"rating,omitempty"`
+	Notes             *uddfNotes         `xml:"notes,omitempty"`
+}
+
+type uddfEquipmentUsed struct {
+	LeadQuantity *float64   `xml:"leadquantity,omitempty"`
+	Links        []uddfLink `xml:"link"`
+}
+
+// uddfDiveExtra holds the dive fields which UDDF has no element for so that
+// they survive a round trip through the format.
+type uddfDiveExtra struct {
+	Activity          string   `xml:"activity,omitempty"`
+	EntryPoint        string   `xml:"entrypoint,omitempty"`
+	Current           string   `xml:"current,omitempty"`
+	Waves             string   `xml:"waves,omitempty"`
+	BuddyRole         string   `xml:"buddyrole,omitempty"`
+	Certification     string   `xml:"certification,omitempty"`
+	SafetyStop        *float64 `xml:"safetystop,omitempty"`
+	TankConfiguration string   `xml:"tankconfiguration,omitempty"`
+	TankMaterial      string   `xml:"tankmaterial,omitempty"`
+	GasMixNotes       string   `xml:"gasmixnotes,omitempty"`
+	WeightNotes       string   `xml:"weightnotes,omitempty"`
+	EquipmentNotes    string   `xml:"equipmentnotes,omitempty"`
+	Properties        []string `xml:"property"`
+}
+
+// ParseUDDF reads a Universal Dive Data Format (UDDF) 3.x log book from r and
+// returns the dives within it in chronological order.
+func ParseUDDF(r io.Reader) ([]Dive, error) {
+	var doc uddfDocument
+
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode uddf xml: %w", err)
+	}
+
+	if !strings.HasPrefix(doc.Version, "3.") {
+		return nil, fmt.Errorf("unsupported uddf version %q", doc.Version)
+	}
+
+	sites := make(map[string]*Site, len(doc.DiveSite.Sites))
+	for _, s := range doc.DiveSite.Sites {
+		sites[s.ID] = s.toSite()
+	}
+
+	operators := make(map[string]string, len(doc.DiveSite.DiveBases))
+	for _, db := range doc.DiveSite.DiveBases {
+		operators[db.ID] = strings.TrimSpace(db.Name)
+	}
+
+	buddies := make(map[string]string, len(doc.Diver.Buddies))
+	for _, b := range doc.Diver.Buddies {
+		buddies[b.ID] = b.Personal.Name()
+	}
+
+	equipment := map[string]string{}
+	if doc.Diver.Owner.Equipment != nil {
+		for _, e := range doc.Diver.Owner.Equipment.Pieces {
+			equipment[e.ID] = strings.TrimSpace(e.Name)
+		}
+	}
+
+	mixes := map[string]uddfMix{}
+	if doc.GasDefinitions != nil {
+		for _, m := range doc.GasDefinitions.Mixes {
+			mixes[m.ID] = m
+		}
+	}
+
+	trips := map[string]*Trip{}
+	tripsByName := map[string]*Trip{}
+	tripsByDive := map[string]*Trip{}
+	if doc.DiveTrips == nil {
+		doc.DiveTrips = &uddfDiveTrips{}
+	}
+	for _, t := range doc.DiveTrips.Trips {
+		trip := &Trip{Name: strings.TrimSpace(t.Name)}
+		if t.Rating != nil {
+			trip.Rating = &t.Rating.Value
+		}
+
+		for _, part := range t.TripParts {
+			if trip.Description == "" {
+				trip.Description = part.Description.Text()
+			}
+			if trip.Notes == "" {
+				trip.Notes = part.Notes.Text()
+			}
+			if part.DateOfTrip != nil {
+				start, err := time.Parse(time.DateOnly, part.DateOfTrip.StartDate)
+				if err == nil && (trip.StartDate.IsZero() || start.Before(trip.StartDate)) {
+					trip.StartDate = start
+				}
+				end, err := time.Parse(time.DateOnly, part.DateOfTrip.EndDate)
+				if err == nil && end.After(trip.EndDate) {
+					trip.EndDate = end
+				}
+			}
+			for _, link := range part.RelatedDives {
+				tripsByDive[link.Ref] = trip
+			}
+		}
+
+		trips[t.ID] = trip
+		tripsByName[strings.ToLower(trip.Name)] = trip
+	}
+
+	var dives []Dive
+
+	for _, rg := range doc.RepetitionGroup {
+		for _, d := range rg.Dives {
+			dive, err := d.toDive()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, link := range d.Before.Links {
+				if site, ok := sites[link.Ref]; ok {
+					siteCopy := *site
+					dive.Site = &siteCopy
+				} else if operator, ok := operators[link.Ref]; ok {
+					dive.Operator = operator
+				} else if buddy, ok := buddies[link.Ref]; ok {
+					dive.Buddies = append(dive.Buddies, buddy)
+				} else if trip, ok := trips[link.Ref]; ok {
+					dive.Trip = trip
+				}
+			}
+
+			if trip, ok := tripsByDive[d.ID]; ok {
+				dive.Trip = trip
+			} else if dive.Trip == nil && d.Before.TripMembership != "" {
+				name := strings.TrimSpace(d.Before.TripMembership)
+				if trip, ok := tripsByName[strings.ToLower(name)]; ok {
+					dive.Trip = trip
+				} else {
+					dive.Trip = &Trip{Name: name}
+				}
+			}
+
+			for _, tank := range d.Tanks {
+				cylinder := tank.toCylinder()
+				for _, link := range tank.Links {
+					if mix, ok := mixes[link.Ref]; ok {
+						cylinder.Mix = strings.TrimSpace(mix.Name)
+						cylinder.O2 = mix.O2
+						cylinder.He = mix.He
+					}
+				}
+				dive.Cylinders = append(dive.Cylinders, cylinder)
+			}
+
+			if d.Samples != nil {
+				for i, wp := range d.Samples.Waypoints {
+					if wp.SwitchMix == nil {
+						continue
+					}
+					if mix, ok := mixes[wp.SwitchMix.Ref]; ok {
+						event := fmt.Sprintf("gaschange %.0f%%", mix.O2*100)
+						dive.Samples[i].Events = append(dive.Samples[i].Events, event)
+					}
+				}
+			}
+
+			if d.After.EquipmentUsed != nil {
+				for _, link := range d.After.EquipmentUsed.Links {
+					if name, ok := equipment[link.Ref]; ok {
+						dive.Equipment = append(dive.Equipment, name)
+					}
+				}
+			}
+
+			dives = append(dives, dive)
+		}
+	}
+
+	slices.SortStableFunc(dives, func(a, b Dive) int {
+		return a.DateTimeIn.Compare(b.DateTimeIn)
+	})
+
+	return dives, nil
+}
+
+func (s uddfSite) toSite() *Site {
+	site := &Site{
+		Name:      strings.TrimSpace(s.Name),
+		AltName:   strings.TrimSpace(s.AliasName),
+		Location:  strings.TrimSpace(s.Geography.Location),
+		Latitude:  s.Geography.Latitude,
+		Longitude: s.Geography.Longitude,
+		Notes:     s.Notes.Text(),
+	}
+
+	if s.Geography.Address != nil {
+		site.Region = strings.TrimSpace(s.Geography.Address.Province)
+		site.Country = strings.TrimSpace(s.Geography.Address.Country)
+	}
+
+	if s.Geography.Altitude != nil {
+		altitude := int(math.Round(*s.Geography.Altitude))
+		site.Altitude = &altitude
+	}
+
+	if s.SiteData != nil {
+		site.MaxDepth = s.SiteData.MaximumDepth
+	}
+
+	if s.Rating != nil {
+		site.Rating = &s.Rating.Value
+	}
+
+	if s.AppData != nil {
+		site.CountryCode = s.AppData.CountryCode
+		site.TimeZone = s.AppData.TimeZone
+		site.WaterBody = s.AppData.WaterBody
+		site.WaterType = s.AppData.WaterType
+	}
+
+	return site
+}
+
+func (t uddfTankData) toCylinder() Cylinder {
+	cylinder := Cylinder{}
+
+	if t.TankVolume != nil && *t.TankVolume > 0 {
+		cylinder.Volume = ref(*t.TankVolume * 1000)
+	}
+	if t.PressureBegin != nil {
+		cylinder.StartPressure = ref(*t.PressureBegin / pascalsPerBar)
+	}
+	if t.PressureEnd != nil {
+		cylinder.EndPressure = ref(*t.PressureEnd / pascalsPerBar)
+	}
+
+	return cylinder
+}
+
+func (d uddfDive) toDive() (Dive, error) {
+	dateTimeIn, err := parseUDDFDateTime(d.Before.DateTime)
+	if err != nil {
+		msg := "failed to parse date and time of uddf dive %q: %w"
+		return Dive{}, fmt.Errorf(msg, d.ID, err)
+	}
+
+	dive := Dive{
+		Number:     d.Before.DiveNumber,
+		DateTimeIn: dateTimeIn,
+		Duration:   time.Duration(d.After.DiveDuration * float64(time.Second)),
+		MaxDepth:   d.After.GreatestDepth,
+		AvgDepth:   d.After.AverageDepth,
+		Visibility: d.After.Visibility,
+		Notes:      d.After.Notes.Text(),
+	}
+
+	if d.Before.AirTemperature != nil {
+		dive.AirTemp = ref(*d.Before.AirTemperature - kelvinOffset)
+	}
+	if d.After.LowestTemperature != nil {
+		dive.WaterTemp = ref(*d.After.LowestTemperature - kelvinOffset)
+	}
+
+	si := d.Before.SurfaceInterval
+	if si != nil && si.PassedTime != nil {
+		dive.SurfaceInterval = ref(time.Duration(*si.PassedTime * float64(time.Second)))
+	}
+
+	if d.Before.Price != nil {
+		dive.Price = &d.Before.Price.Value
+		dive.Currency = d.Before.Price.Currency
+	}
+
+	if d.After.Rating != nil {
+		dive.Rating = &d.After.Rating.Value
+	}
+
+	if d.After.EquipmentUsed != nil {
+		dive.Weight = d.After.EquipmentUsed.LeadQuantity
+	}
+
+	if x := d.Extra; x != nil {
+		dive.Activity = x.Activity
+		dive.EntryPoint = x.EntryPoint
+		dive.Current = x.Current
+		dive.Waves = x.Waves
+		dive.BuddyRole = x.BuddyRole
+		dive.Certification = x.Certification
+		dive.TankConfiguration = x.TankConfiguration
+		dive.TankMaterial = x.TankMaterial
+		dive.GasMixNotes = x.GasMixNotes
+		dive.WeightNotes = x.WeightNotes
+		dive.EquipmentNotes = x.EquipmentNotes
+		dive.Properties = x.Properties
+
+		if x.SafetyStop != nil {
+			dive.SafetyStop = ref(time.Duration(*x.SafetyStop * float64(time.Second)))
+		}
+	}
+
+	if d.Samples != nil {
+		for _, wp := range d.Samples.Waypoints {
+			dive.Samples = append(dive.Samples, wp.toSample())
+		}
+	}
+
+	return dive, nil
+}
+
+func (wp uddfWaypoint) toSample() Sample {
+	sample := Sample{
+		Time:  time.Duration(wp.DiveTime * float64(time.Second)),
+		Depth: wp.Depth,
+	}
+
+	if wp.Temperature != nil {
+		sample.Temperature = ref(*wp.Temperature - kelvinOffset)
+	}
+	if wp.TankPressure != nil {
+		sample.Pressure = ref(*wp.TankPressure / pascalsPerBar)
+	}
+	if wp.CalculatedPO2 != nil {
+		sample.PPO2 = ref(*wp.CalculatedPO2 / pascalsPerBar)
+	}
+
+	for _, alarm := range wp.Alarms {
+		if alarm = strings.TrimSpace(alarm); alarm != "" {
+			sample.Events = append(sample.Events, alarm)
+		}
+	}
+
+	return sample
+}
+
+func newUDDFWaypoint(sample Sample) uddfWaypoint {
+	wp := uddfWaypoint{
+		Alarms:   sample.Events,
+		Depth:    sample.Depth,
+		DiveTime: sample.Time.Seconds(),
+	}
+
+	if sample.Temperature != nil {
+		wp.Temperature = ref(*sample.Temperature + kelvinOffset)
+	}
+	if sample.Pressure != nil {
+		wp.TankPressure = ref(*sample.Pressure * pascalsPerBar)
+	}
+	if sample.PPO2 != nil {
+		wp.CalculatedPO2 = ref(*sample.PPO2 * pascalsPerBar)
+	}
+
+	return wp
+}
+
+// parseUDDFDateTime parses a UDDF date and time. The UTC offset is optional
+// and is ignored if present as Dive.DateTimeIn holds the local time.
+func parseUDDFDateTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range []string{time.RFC3339, uddfDateTime, "2006-01-02T15:04", time.DateOnly} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return time.Date(
+				t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC,
+			), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date and time %q", value)
+}
+
+// WriteUDDF writes the dives to w as a UDDF log book. The generator names the
+// application that created the file. Dive sites, buddies, operators, trips,
+// gas mixes and equipment are written once each and referenced by the dives.
+func WriteUDDF(w io.Writer, generator string, dives []Dive) error {
+	doc := uddfDocument{
+		Namespace: uddfNamespace,
+		Version:   UDDFVersion,
+		Generator: uddfGenerator{
+			Name:     generator,
+			Type:     "logbook",
+			DateTime: time.Now().UTC().Format(uddfDateTime),
+		},
+		Diver:          uddfDiver{Owner: uddfOwner{ID: "owner"}},
+		DiveTrips:      &uddfDiveTrips{},
+		GasDefinitions: &uddfGasDefinitions{},
+	}
+	equipment := &uddfEquipmentPieces{}
+
+	// ids assigns each distinct value a stable ID with the given prefix in the
+	// order in which they are first seen.
+	ids := map[string]string{}
+	id := func(prefix, key string) (string, bool) {
+		key = prefix + ":" + strings.ToLower(key)
+		if v, ok := ids[key]; ok {
+			return v, false
+		}
+		v := prefix + strconv.Itoa(len(ids)+1)
+		ids[key] = v
+		return v, true
+	}
+
+	rg := uddfRepetitionGroup{ID: "rg1"}
+	tripIndex := map[string]int{}
+
+	for i, dive := range dives {
+		d := uddfDive{
+			ID: "dive" + strconv.Itoa(i+1),
+			Before: uddfBeforeDive{
+				DateTime:   dive.DateTimeIn.Format(uddfDateTime),
+				DiveNumber: dive.Number,
+			},
+			After: uddfAfterDive{
+				GreatestDepth: dive.MaxDepth,
+				AverageDepth:  dive.AvgDepth,
+				DiveDuration:  dive.Duration.Seconds(),
+				Visibility:    dive.Visibility,
+				Notes:         newUDDFNotes(dive.Notes),
+			},
+		}
+
+		if site := dive.Site; site != nil {
+			siteID, isNew := id("site", site.Name+"|"+site.Location)
+			if isNew {
+				doc.DiveSite.Sites = append(doc.DiveSite.Sites, newUDDFSite(siteID, *site))
+			}
+			d.Before.Links = append(d.Before.Links, uddfLink{Ref: siteID})
+		}
+
+		if dive.Operator != "" {
+			opID, isNew := id("operator", dive.Operator)
+			if isNew {
+				doc.DiveSite.DiveBases = append(
+					doc.DiveSite.DiveBases,
+					uddfDiveBase{ID: opID, Name: dive.Operator},
+				)
+			}
+			d.Before.Links = append(d.Before.Links, uddfLink{Ref: opID})
+		}
+
+		for _, buddy := range dive.Buddies {
+			buddyID, isNew := id("buddy", buddy)
+			if isNew {
+				doc.Diver.Buddies = append(doc.Diver.Buddies, uddfPerson{
+					ID:       buddyID,
+					Personal: newUDDFPersonal(buddy),
+				})
+			}
+			d.Before.Links = append(d.Before.Links, uddfLink{Ref: buddyID})
+		}
+
+		if dive.Trip != nil {
+			tripKey := dive.Trip.Name + "|" + dive.Trip.StartDate.Format(time.DateOnly)
+			tripID, isNew := id("trip", tripKey)
+			if isNew {
+				trip := uddfTrip{
+					ID:   tripID,
+					Name: dive.Trip.Name,
+					TripParts: []uddfTripPart{{
+						Description: newUDDFNotes(dive.Trip.Description),
+						Notes:       newUDDFNotes(dive.Trip.Notes),
+					}},
+				}
+				if !dive.Trip.StartDate.IsZero() {
+					trip.TripParts[0].DateOfTrip = &uddfDateOfTrip{
+						StartDate: dive.Trip.StartDate.Format(time.DateOnly),
+						EndDate:   dive.Trip.EndDate.Format(time.DateOnly),
+					}
+				}
+				if dive.Trip.Rating != nil {
+					trip.Rating = &uddfRating{Value: *dive.Trip.Rating}
+				}
+				tripIndex[tripID] = len(doc.DiveTrips.Trips)
+				doc.DiveTrips.Trips = append(doc.DiveTrips.Trips, trip)
+			}
+
+			part := &doc.DiveTrips.Trips[tripIndex[tripID]].TripParts[0]
+			part.RelatedDives = append(part.RelatedDives, uddfLink{Ref: d.ID})
+			d.Before.TripMembership = dive.Trip.Name
+		}
+
+		if dive.AirTemp != nil {
+			d.Before.AirTemperature = ref(*dive.AirTemp + kelvinOffset)
+		}
+		if dive.WaterTemp != nil {
+			d.After.LowestTemperature = ref(*dive.WaterTemp + kelvinOffset)
+		}
+
+		if dive.SurfaceInterval != nil {
+			d.Before.SurfaceInterval = &uddfSurfaceInterval{
+				PassedTime: ref(dive.SurfaceInterval.Seconds()),
+			}
+		} else {
+			d.Before.SurfaceInterval = &uddfSurfaceInterval{Infinity: &struct{}{}}
+		}
+
+		if dive.Price != nil {
+			d.Before.Price = &uddfPrice{Currency: dive.Currency, Value: *dive.Price}
+		}
+
+		if dive.Rating != nil {
+			d.After.Rating = &uddfRating{Value: *dive.Rating}
+		}
+
+		for _, c := range dive.Cylinders {
+			mixName := c.GasMixName()
+			mixID, isNew := id("mix", fmt.Sprintf("%s|%.2f|%.2f", mixName, c.FO2(), c.He))
+			if isNew {
+				doc.GasDefinitions.Mixes = append(doc.GasDefinitions.Mixes, uddfMix{
+					ID:   mixID,
+					Name: mixName,
+					O2:   c.FO2(),
+					N2:   math.Round((1-c.FO2()-c.He)*100) / 100,
+					He:   c.He,
+				})
+			}
+
+			tank := uddfTankData{Links: []uddfLink{{Ref: mixID}}}
+			if c.Volume != nil {
+				tank.TankVolume = ref(*c.Volume / 1000)
+			}
+			if c.StartPressure != nil {
+				tank.PressureBegin = ref(*c.StartPressure * pascalsPerBar)
+			}
+			if c.EndPressure != nil {
+				tank.PressureEnd = ref(*c.EndPressure * pascalsPerBar)
+			}
+			d.Tanks = append(d.Tanks, tank)
+		}
+
+		if len(dive.Samples) > 0 {
+			d.Samples = &uddfSamples{}
+			for _, sample := range dive.Samples {
+				d.Samples.Waypoints = append(d.Samples.Waypoints, newUDDFWaypoint(sample))
+			}
+		}
+
+		if dive.Weight != nil || len(dive.Equipment) > 0 {
+			d.After.EquipmentUsed = &uddfEquipmentUsed{LeadQuantity: dive.Weight}
+			for _, name := range dive.Equipment {
+				eqID, isNew := id("equipment", name)
+				if isNew {
+					equipment.Pieces = append(
+						equipment.Pieces,
+						uddfEquipment{ID: eqID, Name: name},
+					)
+				}
+				d.After.EquipmentUsed.Links = append(d.After.EquipmentUsed.Links, uddfLink{Ref: eqID})
+			}
+		}
+
+		d.Extra = &uddfDiveExtra{
+			Activity:          dive.Activity,
+			EntryPoint:        dive.EntryPoint,
+			Current:           dive.Current,
+			Waves:             dive.Waves,
+			BuddyRole:         dive.BuddyRole,
+			Certification:     dive.Certification,
+			TankConfiguration: dive.TankConfiguration,
+			TankMaterial:      dive.TankMaterial,
+			GasMixNotes:       dive.GasMixNotes,
+			WeightNotes:       dive.WeightNotes,
+			EquipmentNotes:    dive.EquipmentNotes,
+			Properties:        dive.Properties,
+		}
+		if dive.SafetyStop != nil {
+			d.Extra.SafetyStop = ref(dive.SafetyStop.Seconds())
+		}
+
+		rg.Dives = append(rg.Dives, d)
+	}
+
+	if len(rg.Dives) > 0 {
+		doc.RepetitionGroup = []uddfRepetitionGroup{rg}
+	}
+
+	// Leave out any sections that would otherwise be empty.
+	if len(equipment.Pieces) > 0 {
+		doc.Diver.Owner.Equipment = equipment
+	}
+	if len(doc.DiveTrips.Trips) == 0 {
+		doc.DiveTrips = nil
+	}
+	if len(doc.GasDefinitions.Mixes) == 0 {
+		doc.GasDefinitions = nil
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	err = enc.Encode(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode uddf xml: %w", err)
+	}
+
+	return enc.Close()
+}
+
+func newUDDFSite(id string, site Site) uddfSite {
+	s := uddfSite{
+		ID:        id,
+		Name:      site.Name,
+		AliasName: site.AltName,
+		Geography: uddfGeography{
+			Location:  site.Location,
+			Latitude:  site.Latitude,
+			Longitude: site.Longitude,
+		},
+		Notes: newUDDFNotes(site.Notes),
+	}
+
+	extra := uddfSiteExtra{
+		CountryCode: site.CountryCode,
+		TimeZone:    site.TimeZone,
+		WaterBody:   site.WaterBody,
+		WaterType:   site.WaterType,
+	}
+	if extra != (uddfSiteExtra{}) {
+		s.AppData = &extra
+	}
+
+	if site.Region != "" || site.Country != "" {
+		s.Geography.Address = &uddfAddress{Province: site.Region, Country: site.Country}
+	}
+
+	if site.Altitude != nil {
+		s.Geography.Altitude = ref(float64(*site.Altitude))
+	}
+
+	if site.MaxDepth != nil {
+		s.SiteData = &uddfSiteData{MaximumDepth: site.MaxDepth}
+	}
+
+	if site.Rating != nil {
+		s.Rating = &uddfRating{Value: *site.Rating}
+	}
+
+	return s
+}
+
+// newUDDFPersonal splits a full name into a first name and a last name, with
+// everything after the first word being taken as the last name.
+func newUDDFPersonal(name string) uddfPersonal {
+	first, last, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return uddfPersonal{FirstName: first, LastName: strings.TrimSpace(last)}
+}
+
+func newUDDFNotes(text string) *uddfNotes {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+
+	return &uddfNotes{Paras: []string{text}}
+}
+
+func ref[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,130 @@
+package logbook
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestUDDFRoundTrip(t *testing.T) {
+	lat, lon := 9.7185, 99.9756
+	safetyStop := 3 * time.Minute
+	trip := &Trip{
+		Name:      "Koh Tao Liveaboard",
+		StartDate: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		Notes:     "Great trip.",
+	}
+
+	want := []Dive{
+		{
+			Number:     12,
+			Activity:   "Fun Dive",
+			DateTimeIn: time.Date(2024, 3, 2, 9, 15, 0, 0, time.UTC),
+			Duration:   48 * time.Minute,
+			SafetyStop: &safetyStop,
+			MaxDepth:   24.3,
+			AvgDepth:   ref(14.1),
+			WaterTemp:  ref(29.0),
+			AirTemp:    ref(31.0),
+			Visibility: ref(15.0),
+			Current:    "Light",
+			Rating:     ref(8),
+			Site: &Site{
+				Name:        "Sail Rock",
+				Location:    "Koh Tao",
+				Country:     "Thailand",
+				CountryCode: "TH",
+				TimeZone:    "Asia/Bangkok",
+				Latitude:    &lat,
+				Longitude:   &lon,
+				WaterBody:   "Ocean",
+			},
+			Trip:     trip,
+			Operator: "Big Bubbles",
+			Price:    ref(1500.0),
+			Currency: "THB",
+			Buddies:  []string{"John Smith"},
+			Cylinders: []Cylinder{{
+				Mix:           "Nitrox",
+				Volume:        ref(12.0),
+				StartPressure: ref(200.0),
+				EndPressure:   ref(60.0),
+				O2:            0.32,
+			}},
+			TankConfiguration: "Single Tank",
+			Weight:            ref(6.0),
+			Equipment:         []string{"5mm Boots", "Hood"},
+			EntryPoint:        "Boat",
+			Properties:        []string{"Drift Dive"},
+			Notes:             "Whale shark!",
+			Samples: []Sample{
+				{Time: 0, Depth: 0, Temperature: ref(29.0), Pressure: ref(200.0)},
+				{Time: 20 * time.Minute, Depth: 24.3, PPO2: ref(1.1), Events: []string{"ascent"}},
+				{Time: 48 * time.Minute, Depth: 0, Pressure: ref(60.0)},
+			},
+		},
+		{
+			Number:     13,
+			DateTimeIn: time.Date(2024, 3, 2, 14, 0, 0, 0, time.UTC),
+			Duration:   50 * time.Minute,
+			MaxDepth:   18,
+			Site:       &Site{Name: "Chumphon Pinnacle"},
+			Trip:       trip,
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	err := WriteUDDF(buf, "test", want)
+	assert.NilError(t, err)
+
+	got, err := ParseUDDF(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, len(got), len(want))
+
+	d := got[0]
+	assert.Equal(t, d.Number, 12)
+	assert.Equal(t, d.Activity, "Fun Dive")
+	assert.Equal(t, d.DateTimeIn, want[0].DateTimeIn)
+	assert.Equal(t, d.Duration, 48*time.Minute)
+	assert.Equal(t, *d.SafetyStop, safetyStop)
+	assert.Equal(t, d.MaxDepth, 24.3)
+	assert.Equal(t, *d.AvgDepth, 14.1)
+	assert.Equal(t, *d.WaterTemp, 29.0)
+	assert.Equal(t, *d.AirTemp, 31.0)
+	assert.Equal(t, *d.Rating, 8)
+	assert.Equal(t, d.Current, "Light")
+	assert.Equal(t, d.Site.Name, "Sail Rock")
+	assert.Equal(t, d.Site.CountryCode, "TH")
+	assert.Equal(t, d.Site.TimeZone, "Asia/Bangkok")
+	assert.Equal(t, *d.Site.Latitude, lat)
+	assert.Equal(t, d.Trip.Name, trip.Name)
+	assert.Equal(t, d.Trip.StartDate, trip.StartDate)
+	assert.Equal(t, d.Trip.Notes, trip.Notes)
+	assert.Equal(t, d.Operator, "Big Bubbles")
+	assert.Equal(t, *d.Price, 1500.0)
+	assert.Equal(t, d.Currency, "THB")
+	assert.Equal(t, d.Buddy(), "John Smith")
+	assert.Equal(t, d.Cylinder().GasMixName(), "Nitrox")
+	assert.Equal(t, d.Cylinder().FO2(), 0.32)
+	assert.Equal(t, *d.Cylinder().Volume, 12.0)
+	assert.Equal(t, *d.Cylinder().StartPressure, 200.0)
+	assert.Equal(t, d.TankConfiguration, "Single Tank")
+	assert.Equal(t, *d.Weight, 6.0)
+	assert.Equal(t, len(d.Equipment), 2)
+	assert.Equal(t, d.EntryPoint, "Boat")
+	assert.Equal(t, d.Properties[0], "Drift Dive")
+	assert.Equal(t, d.Notes, "Whale shark!")
+	assert.Equal(t, len(d.Samples), 3)
+	assert.Equal(t, d.Samples[1].Time, 20*time.Minute)
+	assert.Equal(t, d.Samples[1].Depth, 24.3)
+	assert.Equal(t, d.Samples[1].Events[0], "ascent")
+	assert.Equal(t, *d.Samples[0].Temperature, 29.0)
+	assert.Equal(t, *d.Samples[2].Pressure, 60.0)
+
+	// Both dives should refer to the same trip.
+	assert.Equal(t, got[1].Trip, d.Trip)
+	assert.Equal(t, got[1].Site.Name, "Chumphon Pinnacle")
+}
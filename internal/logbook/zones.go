@@ -0,0 +1,130 @@
+package logbook
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// zoneTab is a copy of the zone.tab file from the IANA time zone database,
+// which lists the principal location of each time zone along with the ISO 3166
+// code of the country that it is in.
+//
+//go:embed zone.tab
+var zoneTab string
+
+// Zone is a time zone from the IANA time zone database and the position of its
+// principal location, such as the city that it is named after.
+type Zone struct {
+	CountryCode string
+	TimeZone    string
+	Latitude    float64
+	Longitude   float64
+}
+
+// zones returns the parsed contents of zoneTab.
+var zones = sync.OnceValue(func() []Zone {
+	var zs []Zone
+
+	for _, line := range strings.Split(zoneTab, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			continue
+		}
+
+		lat, lon, ok := parseISO6709(fields[1])
+		if !ok {
+			continue
+		}
+
+		zs = append(zs, Zone{
+			CountryCode: fields[0],
+			TimeZone:    fields[2],
+			Latitude:    lat,
+			Longitude:   lon,
+		})
+	}
+
+	return zs
+})
+
+// parseISO6709 parses a position given as signed degrees and minutes, with
+// optional seconds, in the form ±DDMM±DDDMM or ±DDMMSS±DDDMMSS.
+func parseISO6709(s string) (float64, float64, bool) {
+	i := strings.IndexAny(s[1:], "+-") + 1
+	if i == 0 {
+		return 0, 0, false
+	}
+
+	lat, ok := parseISO6709Part(s[:i], 2)
+	if !ok {
+		return 0, 0, false
+	}
+
+	lon, ok := parseISO6709Part(s[i:], 3)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return lat, lon, true
+}
+
+// parseISO6709Part parses a single signed latitude or longitude whose degrees
+// are given with degreeDigits digits.
+func parseISO6709Part(s string, degreeDigits int) (float64, bool) {
+	if len(s) != 1+degreeDigits+2 && len(s) != 1+degreeDigits+4 {
+		return 0, false
+	}
+
+	sign := 1.0
+	if s[0] == '-' {
+		sign = -1.0
+	}
+
+	digits := s[1:]
+	var value float64
+	for i, divisor := range []float64{1, 60, 3600} {
+		start := degreeDigits + (i-1)*2
+		end := start + 2
+		if i == 0 {
+			start, end = 0, degreeDigits
+		}
+		if end > len(digits) {
+			break
+		}
+
+		n, err := strconv.Atoi(digits[start:end])
+		if err != nil {
+			return 0, false
+		}
+		value += float64(n) / divisor
+	}
+
+	return sign * value, true
+}
+
+// NearestZone returns the time zone whose principal location is nearest to the
+// given position. As time zones only have a single location, this is only a
+// rough guide to the time zone and country of the position, especially near
+// borders, but is often enough to suggest them for a new dive site.
+func NearestZone(lat, lon float64) (Zone, bool) {
+	var nearest Zone
+	found := false
+	minDistance := 0.0
+
+	for _, z := range zones() {
+		distance := Distance(lat, lon, z.Latitude, z.Longitude)
+		if !found || distance < minDistance {
+			nearest = z
+			minDistance = distance
+			found = true
+		}
+	}
+
+	return nearest, found
+}
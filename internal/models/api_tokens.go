@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// APITokenScope determines what an API token can be used for.
+type APITokenScope string
+
+const (
+	// APITokenScopeRead tokens can only be used for safe requests, such as
+	// GET, that do not change anything.
+	APITokenScopeRead APITokenScope = "read"
+	// APITokenScopeReadWrite tokens can be used for any request.
+	APITokenScopeReadWrite APITokenScope = "read_write"
+)
+
+func (s APITokenScope) String() string {
+	switch s {
+	case APITokenScopeRead:
+		return "Read Only"
+	case APITokenScopeReadWrite:
+		return "Read & Write"
+	default:
+		return string(s)
+	}
+}
+
+// APIToken is a personal access token that lets scripts use the site on behalf
+// of its owner without logging in. The token itself is only known when it is
+// created, so it is not included.
+type APIToken struct {
+	ID       int
+	Created  time.Time
+	OwnerID  int
+	Name     string
+	Scope    APITokenScope
+	Expires  *time.Time
+	LastUsed *time.Time
+}
+
+// IsExpired returns true if the token has an expiry time that has passed.
+func (t APIToken) IsExpired() bool {
+	return t.Expires != nil && !t.Expires.After(time.Now())
+}
+
+type APITokenModelInterface interface {
+	Authenticate(token string) (APIToken, error)
+
+	Delete(ownerID, id int) error
+
+	Insert(ownerID int, name string, scope APITokenScope, expires *time.Time) (string, error)
+
+	ListAll(ownerID int) ([]APIToken, error)
+}
+
+type APITokenModel struct {
+	DB       *sql.DB
+	Timeouts QueryTimeouts
+}
+
+func apiTokenFromDBRow(rs RowScanner, t *APIToken) error {
+	return rs.Scan(
+		&t.ID,
+		&t.Created,
+		&t.OwnerID,
+		&t.Name,
+		&t.Scope,
+		&t.Expires,
+		&t.LastUsed,
+	)
+}
+
+// Authenticate returns the unexpired token of an active user that matches
+// token and records that it has been used. ErrNoRecord is returned if there is
+// not one.
+func (m *APITokenModel) Authenticate(token string) (APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `
+        update api_tokens tk
+           set last_used_at = now()
+          from users us
+         where tk.token_hash = $1
+           and (tk.expires_at is null or tk.expires_at > now())
+           and us.id = tk.owner_id
+           and us.suspended = false and us.deleted = false
+     returning tk.id, tk.created_at, tk.owner_id, tk.name, tk.scope,
+               tk.expires_at, tk.last_used_at
+    `
+
+	var apiToken APIToken
+	row := m.DB.QueryRowContext(ctx, stmt, hash[:])
+	err := apiTokenFromDBRow(row, &apiToken)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIToken{}, ErrNoRecord
+		}
+		return APIToken{}, err
+	}
+
+	return apiToken, nil
+}
+
+// Delete revokes the owner's token with the given ID.
+func (m *APITokenModel) Delete(ownerID, id int) error {
+	stmt := "delete from api_tokens where owner_id = $1 and id = $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, ownerID, id)
+	if err != nil {
+		return err
+	}
+
+	return checkUpdatedOne(result)
+}
+
+// Insert generates a new token with the given name and scope for the owner
+// and returns it. A nil expires means that the token never expires. Only a hash
+// of the token is stored, so it cannot be retrieved again later.
+func (m *APITokenModel) Insert(
+	ownerID int,
+	name string,
+	scope APITokenScope,
+	expires *time.Time,
+) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	token := rand.Text()
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `
+        insert into api_tokens (owner_id, name, token_hash, scope, expires_at)
+        values ($1, $2, $3, $4, $5)
+    `
+
+	_, err := m.DB.ExecContext(ctx, stmt, ownerID, name, hash[:], scope, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ListAll returns all of the owner's tokens, including any that have expired,
+// with the most recently created first.
+func (m *APITokenModel) ListAll(ownerID int) ([]APIToken, error) {
+	stmt := `
+        select id, created_at, owner_id, name, scope, expires_at, last_used_at
+          from api_tokens
+         where owner_id = $1
+      order by created_at desc, id desc
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []APIToken
+	for rows.Next() {
+		var record APIToken
+		err := apiTokenFromDBRow(rows, &record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
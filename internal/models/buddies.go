@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -82,6 +83,7 @@ func (nb nullableBuddy) ToStruct() *Buddy {
 
 type BuddyModelInterface interface {
 	Exists(id int) (bool, error)
+	ExistsActive(id, ownerID int) (bool, error)
 
 	Insert(
 		ownerID int,
@@ -93,6 +95,20 @@ type BuddyModelInterface interface {
 		notes string,
 	) (int, error)
 
+	Update(
+		id int,
+		ownerID int,
+		version int,
+		name string,
+		emailAddress string,
+		phoneNumber string,
+		agencyID *int,
+		agencyMemberNum string,
+		notes string,
+	) error
+
+	GetOneByID(id, ownerID int) (Buddy, error)
+
 	List(userID int, pager Pager, sort []SortBuddy) ([]Buddy, PageData, error)
 
 	ListAll(userID int, sort []SortBuddy) ([]Buddy, error)
@@ -105,6 +121,7 @@ var buddySelectQuery string = `
                max(dv.date_time_in) last_dive_with
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.buddy_id
            )
     select count(*) over(),
@@ -119,6 +136,7 @@ var buddySelectQuery string = `
  left join agencies ag on bu.agency_id = ag.id
  left join buddy_dive_stats ds on bu.id = ds.buddy_id
      where bu.owner_id = $1
+       and bu.deleted_at is null
 `
 
 func buddyFromDBRow(rs RowScanner, totalRecords *int, bu *Buddy) error {
@@ -163,6 +181,12 @@ func (m *BuddyModel) Exists(id int) (bool, error) {
 	return idExistsInTable(m.DB, id, "buddies", "id")
 }
 
+// ExistsActive checks if the owner has a buddy with the given ID that is not in
+// the trash.
+func (m *BuddyModel) ExistsActive(id, ownerID int) (bool, error) {
+	return ownedIDExistsActiveInTable(m.DB, id, ownerID, "buddies")
+}
+
 func (m *BuddyModel) Insert(
 	ownerID int,
 	name string,
@@ -171,6 +195,35 @@ func (m *BuddyModel) Insert(
 	agencyID *int,
 	agencyMemberNum string,
 	notes string,
+) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	return insertBuddy(
+		ctx,
+		m.DB,
+		ownerID,
+		name,
+		emailAddress,
+		phoneNumber,
+		agencyID,
+		agencyMemberNum,
+		notes,
+	)
+}
+
+// insertBuddy inserts a new buddy using db, which may be a transaction, and
+// returns its ID.
+func insertBuddy(
+	ctx context.Context,
+	db sqlRowQuerier,
+	ownerID int,
+	name string,
+	emailAddress string,
+	phoneNumber string,
+	agencyID *int,
+	agencyMemberNum string,
+	notes string,
 ) (int, error) {
 	stmt := `
         insert into buddies (
@@ -182,10 +235,7 @@ func (m *BuddyModel) Insert(
         returning id
     `
 
-	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
-	defer cancel()
-
-	result := m.DB.QueryRowContext(
+	result := db.QueryRowContext(
 		ctx,
 		stmt,
 		ownerID,
@@ -206,6 +256,83 @@ func (m *BuddyModel) Insert(
 	return id, nil
 }
 
+func (m *BuddyModel) Update(
+	id int,
+	ownerID int,
+	version int,
+	name string,
+	emailAddress string,
+	phoneNumber string,
+	agencyID *int,
+	agencyMemberNum string,
+	notes string,
+) error {
+	stmt := `
+        update buddies
+           set version = version + 1, updated_at = now(), name = $4, email = $5,
+               phone_number = $6, agency_id = $7, agency_member_num = $8,
+               notes = $9
+         where id = $1
+           and owner_id = $2
+           and version = $3
+           and deleted_at is null
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(
+		ctx,
+		stmt,
+		id,
+		ownerID,
+		version,
+		name,
+		emailAddress,
+		phoneNumber,
+		agencyID,
+		agencyMemberNum,
+		notes,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update buddy %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case rowsAffected == 0:
+		return updateConflictOrNoRecord(ctx, m.DB, "buddies", id, ownerID)
+	case rowsAffected > 1:
+		return &ErrUnexpectedRowsAffected{rowsExpected: 1, rowsAffected: int(rowsAffected)}
+	}
+
+	return nil
+}
+
+func (m *BuddyModel) GetOneByID(id, ownerID int) (Buddy, error) {
+	stmt := fmt.Sprintf("%s and bu.id = $2", buddySelectQuery)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	var totalRecords int
+	var buddy Buddy
+	row := m.DB.QueryRowContext(ctx, stmt, ownerID, id)
+	err := buddyFromDBRow(row, &totalRecords, &buddy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Buddy{}, ErrNoRecord
+		}
+		return Buddy{}, err
+	}
+
+	return buddy, nil
+}
+
 func (m *BuddyModel) List(userID int, pager Pager, sort []SortBuddy) ([]Buddy, PageData, error) {
 	limit := pager.limit()
 	offset := pager.offset()
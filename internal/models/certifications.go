@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -38,6 +39,41 @@ func (c Certification) Duration() time.Duration {
 	return c.EndDate.Sub(c.StartDate)
 }
 
+// CardSide is which side of a certification card an image is of.
+type CardSide string
+
+const (
+	CardFront CardSide = "front"
+	CardBack  CardSide = "back"
+)
+
+// CardSides lists the sides of a certification card in the order that they
+// are displayed.
+var CardSides = []CardSide{CardFront, CardBack}
+
+func (s CardSide) IsValid() bool {
+	return s == CardFront || s == CardBack
+}
+
+// Label returns the name of the side for displaying to users.
+func (s CardSide) Label() string {
+	if s == CardBack {
+		return "Back"
+	}
+
+	return "Front"
+}
+
+// CertificationCard is an image of one side of a certification card. The image
+// is kept in a file store under StorageKey rather than in the database.
+type CertificationCard struct {
+	CertificationID int
+	Side            CardSide
+	Created         time.Time
+	StorageKey      string
+	ContentType     string
+}
+
 type nullableCertification struct {
 	ID         *int
 	Created    *time.Time
@@ -82,6 +118,7 @@ func (nc nullableCertification) ToStruct() *Certification {
 
 type CertificationModelInterface interface {
 	Exists(id int) (bool, error)
+	ExistsActive(id, ownerID int) (bool, error)
 
 	Insert(
 		ownerID int,
@@ -96,9 +133,31 @@ type CertificationModelInterface interface {
 		notes string,
 	) (int, error)
 
+	Update(
+		id int,
+		ownerID int,
+		courseID int,
+		startDate time.Time,
+		endDate time.Time,
+		operatorID int,
+		instructorID int,
+		priceAmount *float64,
+		priceCurrencyID *int,
+		rating *int,
+		notes string,
+	) error
+
+	GetOneByID(id, ownerID int) (Certification, error)
+
 	List(userID int, pager Pager, sort []SortCert) ([]Certification, PageData, error)
 
 	ListAll(userID int, sort []SortCert) ([]Certification, error)
+
+	ListCards(id, ownerID int) ([]CertificationCard, error)
+
+	SetCard(id, ownerID int, side CardSide, storageKey, contentType string) error
+
+	DeleteCard(id, ownerID int, side CardSide) error
 }
 
 var certificationSelectQuery string = `
@@ -109,6 +168,7 @@ var certificationSelectQuery string = `
                max(dv.date_time_in) last_dive
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.certification_id
            ),
       operator_dive_stats as (
@@ -118,6 +178,7 @@ var certificationSelectQuery string = `
                max(dv.date_time_in) last_dive
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.operator_id
            ),
       buddy_dive_stats as (
@@ -127,6 +188,7 @@ var certificationSelectQuery string = `
                max(dv.date_time_in) last_dive_with
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.buddy_id
            )
     select count(*) over(),
@@ -168,6 +230,7 @@ var certificationSelectQuery string = `
  left join agencies            ba on bu.agency_id = ba.id
  left join currencies          cu on ce.currency_id = cu.id
      where ce.owner_id = $1
+       and ce.deleted_at is null
 `
 
 func certificationFromDBRow(rs RowScanner, totalRecords *int, ce *Certification) error {
@@ -274,6 +337,12 @@ func (m *CertificationModel) Exists(id int) (bool, error) {
 	return idExistsInTable(m.DB, id, "certifications", "id")
 }
 
+// ExistsActive checks if the owner has a certification with the given ID that is not in
+// the trash.
+func (m *CertificationModel) ExistsActive(id, ownerID int) (bool, error) {
+	return ownedIDExistsActiveInTable(m.DB, id, ownerID, "certifications")
+}
+
 func (m *CertificationModel) Insert(
 	ownerID int,
 	courseID int,
@@ -323,6 +392,74 @@ func (m *CertificationModel) Insert(
 	return id, nil
 }
 
+func (m *CertificationModel) Update(
+	id int,
+	ownerID int,
+	courseID int,
+	startDate time.Time,
+	endDate time.Time,
+	operatorID int,
+	instructorID int,
+	priceAmount *float64,
+	priceCurrencyID *int,
+	rating *int,
+	notes string,
+) error {
+	stmt := `
+        update certifications
+           set updated_at = now(), course_id = $3, start_date = $4,
+               end_date = $5, operator_id = $6, instructor_id = $7, price = $8,
+               currency_id = $9, rating = $10, notes = $11
+         where id = $1
+           and owner_id = $2
+           and deleted_at is null
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(
+		ctx,
+		stmt,
+		id,
+		ownerID,
+		courseID,
+		startDate,
+		endDate,
+		operatorID,
+		instructorID,
+		priceAmount,
+		priceCurrencyID,
+		rating,
+		notes,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update certification %d: %w", id, err)
+	}
+
+	return checkUpdatedOne(result)
+}
+
+func (m *CertificationModel) GetOneByID(id, ownerID int) (Certification, error) {
+	stmt := fmt.Sprintf("%s and ce.id = $2", certificationSelectQuery)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	var totalRecords int
+	var cert Certification
+	row := m.DB.QueryRowContext(ctx, stmt, ownerID, id)
+	err := certificationFromDBRow(row, &totalRecords, &cert)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Certification{}, ErrNoRecord
+		}
+		return Certification{}, err
+	}
+
+	return cert, nil
+}
+
 func (m *CertificationModel) List(
 	userID int,
 	pager Pager,
@@ -398,3 +535,106 @@ func (m *CertificationModel) ListAll(userID int, sort []SortCert) ([]Certificati
 
 	return records, nil
 }
+
+// ListCards returns the images of the user's certification card, front first.
+func (m *CertificationModel) ListCards(id, ownerID int) ([]CertificationCard, error) {
+	stmt := `
+        select cc.certification_id, cc.side, cc.created_at, cc.storage_key,
+               cc.content_type
+          from certification_cards cc
+          join certifications      ce on cc.certification_id = ce.id
+         where ce.id = $1
+           and ce.owner_id = $2
+           and ce.deleted_at is null
+      order by cc.side desc
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := []CertificationCard{}
+	for rows.Next() {
+		var card CertificationCard
+		err := rows.Scan(
+			&card.CertificationID,
+			&card.Side,
+			&card.Created,
+			&card.StorageKey,
+			&card.ContentType,
+		)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// SetCard records that the image of one side of the user's certification card
+// has been stored under storageKey, replacing any previous image of that side.
+// It returns ErrNoRecord if the certification does not exist.
+func (m *CertificationModel) SetCard(
+	id, ownerID int,
+	side CardSide,
+	storageKey, contentType string,
+) error {
+	stmt := `
+        insert into certification_cards (
+            certification_id, side, storage_key, content_type
+        )
+        select ce.id, $3, $4, $5
+          from certifications ce
+         where ce.id = $1
+           and ce.owner_id = $2
+           and ce.deleted_at is null
+        on conflict (certification_id, side) do update
+           set created_at = now(), storage_key = excluded.storage_key,
+               content_type = excluded.content_type
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, ownerID, side, storageKey, contentType)
+	if err != nil {
+		return fmt.Errorf("failed to set %s card of certification %d: %w", side, id, err)
+	}
+
+	return checkUpdatedOne(result)
+}
+
+// DeleteCard removes the image of one side of the user's certification card.
+// It returns ErrNoRecord if there is no such image.
+func (m *CertificationModel) DeleteCard(id, ownerID int, side CardSide) error {
+	stmt := `
+        delete from certification_cards cc
+         using certifications ce
+         where cc.certification_id = ce.id
+           and ce.id = $1
+           and ce.owner_id = $2
+           and ce.deleted_at is null
+           and cc.side = $3
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, ownerID, side)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s card of certification %d: %w", side, id, err)
+	}
+
+	return checkUpdatedOne(result)
+}
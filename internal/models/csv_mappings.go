@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CSVMapping is a user's saved choice of how to read a CSV log book so that
+// files exported from the same source can be imported again without mapping
+// every column by hand. Headers and Fields are parallel slices giving the field
+// that each column heading is mapped onto.
+type CSVMapping struct {
+	ID           int
+	Created      time.Time
+	Updated      time.Time
+	OwnerID      int
+	Name         string
+	Headers      []string
+	Fields       []string
+	DateFormat   string
+	DepthUnit    string
+	TempUnit     string
+	PressureUnit string
+	WeightUnit   string
+	DurationUnit string
+}
+
+// FieldFor returns the field that the column with the given heading is mapped
+// onto, ignoring case and surrounding white space. The empty string is returned
+// if the heading is not part of the mapping.
+func (cm CSVMapping) FieldFor(header string) string {
+	header = strings.TrimSpace(header)
+	for i, h := range cm.Headers {
+		if strings.EqualFold(strings.TrimSpace(h), header) && i < len(cm.Fields) {
+			return cm.Fields[i]
+		}
+	}
+
+	return ""
+}
+
+type CSVMappingModelInterface interface {
+	Delete(ownerID, id int) error
+
+	GetOneByID(ownerID, id int) (CSVMapping, error)
+
+	ListAll(ownerID int) ([]CSVMapping, error)
+
+	Upsert(
+		ownerID int,
+		name string,
+		headers []string,
+		fields []string,
+		dateFormat string,
+		depthUnit string,
+		tempUnit string,
+		pressureUnit string,
+		weightUnit string,
+		durationUnit string,
+	) (int, error)
+}
+
+type CSVMappingModel struct {
+	DB       *sql.DB
+	Timeouts QueryTimeouts
+}
+
+var csvMappingSelectQuery string = `
+    select cm.id, cm.created_at, cm.updated_at, cm.owner_id, cm.name,
+           cm.headers, cm.fields, cm.date_format, cm.depth_unit, cm.temp_unit,
+           cm.pressure_unit, cm.weight_unit, cm.duration_unit
+      from csv_mappings cm
+     where cm.owner_id = $1
+`
+
+func csvMappingFromDBRow(rs RowScanner, cm *CSVMapping) error {
+	return rs.Scan(
+		&cm.ID,
+		&cm.Created,
+		&cm.Updated,
+		&cm.OwnerID,
+		&cm.Name,
+		pq.Array(&cm.Headers),
+		pq.Array(&cm.Fields),
+		&cm.DateFormat,
+		&cm.DepthUnit,
+		&cm.TempUnit,
+		&cm.PressureUnit,
+		&cm.WeightUnit,
+		&cm.DurationUnit,
+	)
+}
+
+func (m *CSVMappingModel) Delete(ownerID, id int) error {
+	stmt := "delete from csv_mappings where owner_id = $1 and id = $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, ownerID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *CSVMappingModel) GetOneByID(ownerID, id int) (CSVMapping, error) {
+	stmt := csvMappingSelectQuery + " and cm.id = $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	var mapping CSVMapping
+	row := m.DB.QueryRowContext(ctx, stmt, ownerID, id)
+	err := csvMappingFromDBRow(row, &mapping)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CSVMapping{}, ErrNoRecord
+		}
+		return CSVMapping{}, err
+	}
+
+	return mapping, nil
+}
+
+func (m *CSVMappingModel) ListAll(ownerID int) ([]CSVMapping, error) {
+	stmt := csvMappingSelectQuery + " order by cm.name, cm.id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []CSVMapping
+	for rows.Next() {
+		var record CSVMapping
+		err := csvMappingFromDBRow(rows, &record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Upsert saves a mapping under the given name, replacing any existing mapping
+// that the owner has already saved with the same name.
+func (m *CSVMappingModel) Upsert(
+	ownerID int,
+	name string,
+	headers []string,
+	fields []string,
+	dateFormat string,
+	depthUnit string,
+	tempUnit string,
+	pressureUnit string,
+	weightUnit string,
+	durationUnit string,
+) (int, error) {
+	stmt := `
+        insert into csv_mappings (
+            owner_id, name, headers, fields, date_format, depth_unit,
+            temp_unit, pressure_unit, weight_unit, duration_unit
+        ) values (
+            $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+        )
+        on conflict (owner_id, name) do update
+           set headers       = excluded.headers,
+               fields        = excluded.fields,
+               date_format   = excluded.date_format,
+               depth_unit    = excluded.depth_unit,
+               temp_unit     = excluded.temp_unit,
+               pressure_unit = excluded.pressure_unit,
+               weight_unit   = excluded.weight_unit,
+               duration_unit = excluded.duration_unit
+        returning id
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	result := m.DB.QueryRowContext(
+		ctx,
+		stmt,
+		ownerID,
+		name,
+		pq.Array(headers),
+		pq.Array(fields),
+		dateFormat,
+		depthUnit,
+		tempUnit,
+		pressureUnit,
+		weightUnit,
+		durationUnit,
+	)
+
+	var id int
+	err := result.Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DiveImport is a batch of dives to import along with the new dive sites,
+// buddies and trips that they refer to. The new records are keyed by a string
+// that is unique within the batch.
+type DiveImport struct {
+	Sites   map[string]DiveSiteFields
+	Buddies map[string]string
+	Trips   map[string]TripFields
+	Dives   []ImportDive
+}
+
+// ImportDive is one of the dives of a DiveImport. If any of the keys are given,
+// then the dive refers to the new dive site, buddy or trip with that key in the
+// batch instead of to the ID in its fields.
+type ImportDive struct {
+	Dive     DiveFields
+	SiteKey  string
+	BuddyKey string
+	TripKey  string
+}
+
+// Import inserts all of the dive sites, buddies, trips and dives of a batch in
+// a single transaction, so a failure part of the way through does not leave
+// half of the batch in the log book. Dives whose numbers have already been
+// logged are skipped, and their indexes in batch.Dives are returned along with
+// the IDs of the dives that were inserted.
+func (m *DiveModel) Import(ownerID int, batch DiveImport) ([]int, []int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Bulk)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	siteIDs := map[string]int{}
+	for key, site := range batch.Sites {
+		siteIDs[key], err = insertDiveSite(ctx, tx, ownerID, site)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to insert dive site %q: %w", site.Name, err)
+		}
+	}
+
+	buddyIDs := map[string]int{}
+	for key, name := range batch.Buddies {
+		buddyIDs[key], err = insertBuddy(ctx, tx, ownerID, name, "", "", nil, "", "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to insert buddy %q: %w", name, err)
+		}
+	}
+
+	tripIDs := map[string]int{}
+	for key, trip := range batch.Trips {
+		tripIDs[key], err = insertTrip(ctx, tx, ownerID, trip)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to insert trip %q: %w", trip.Name, err)
+		}
+	}
+
+	var ids, duplicates []int
+	for i, item := range batch.Dives {
+		dive := item.Dive
+		if item.SiteKey != "" {
+			dive.DiveSiteID = siteIDs[item.SiteKey]
+		}
+		if item.BuddyKey != "" {
+			buddyID := buddyIDs[item.BuddyKey]
+			dive.BuddyID = &buddyID
+		}
+		if item.TripKey != "" {
+			tripID := tripIDs[item.TripKey]
+			dive.TripID = &tripID
+		}
+
+		// A failed statement aborts the whole transaction, so each dive is
+		// inserted after a savepoint that a duplicate number can be rolled
+		// back to.
+		_, err = tx.ExecContext(ctx, "savepoint import_dive")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create savepoint: %w", err)
+		}
+
+		id, err := m.insertTx(ctx, tx, ownerID, dive)
+		if errors.Is(err, ErrDuplicateDiveNumber) {
+			_, err = tx.ExecContext(ctx, "rollback to savepoint import_dive")
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to roll back to savepoint: %w", err)
+			}
+			duplicates = append(duplicates, i)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to insert dive number %d: %w", dive.Number, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return ids, duplicates, nil
+}
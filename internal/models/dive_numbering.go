@@ -0,0 +1,306 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DiveNumbering is one of a user's dives along with the number that it would
+// be given if all of the user's dives were numbered in the order that they
+// were made.
+type DiveNumbering struct {
+	ID           int
+	Number       int
+	NewNumber    int
+	DateTimeIn   time.Time
+	DiveSiteName string
+	Trashed      bool
+}
+
+// DiveNumberRange is an inclusive range of dive numbers.
+type DiveNumberRange struct {
+	From int
+	To   int
+}
+
+// DiveNumberingReport describes the problems with the numbering of a user's
+// dives and the changes that renumbering them would make.
+//
+// Gaps are the ranges of numbers from offset + 1 up to the last number that are
+// not used by any dive outside of the trash. Duplicates are groups of dives
+// that start at exactly the same time, which have most likely been logged more
+// than once as the numbers themselves must be unique. OutOfOrder are the dives
+// that were made before a dive with a lower number than them.
+type DiveNumberingReport struct {
+	Offset     int
+	Changes    []DiveNumbering
+	Gaps       []DiveNumberRange
+	Duplicates [][]DiveNumbering
+	OutOfOrder []DiveNumbering
+}
+
+// IsClean returns true if the dives are already numbered in order without any
+// gaps or duplicates.
+func (r DiveNumberingReport) IsClean() bool {
+	return len(r.Changes) == 0 && len(r.Gaps) == 0 &&
+		len(r.Duplicates) == 0 && len(r.OutOfOrder) == 0
+}
+
+// planDiveNumbering works out the report for the given dives, which must be
+// all of a user's dives including those in the trash, where offset is the
+// number of dives that the user made before they started using the log book.
+//
+// The dives outside of the trash are numbered from offset + 1 in the order of
+// their date_time_in, with their IDs breaking any ties. Dives in the trash keep
+// their numbers unless they are needed, in which case they are moved after the
+// last dive so that they can still be restored.
+func planDiveNumbering(dives []DiveNumbering, offset int) DiveNumberingReport {
+	report := DiveNumberingReport{Offset: offset}
+
+	var active, trashed []DiveNumbering
+	for _, dive := range dives {
+		if dive.Trashed {
+			trashed = append(trashed, dive)
+		} else {
+			active = append(active, dive)
+		}
+	}
+
+	// Check the numbering as it is now, by number.
+	slices.SortFunc(active, func(a, b DiveNumbering) int { return a.Number - b.Number })
+
+	var latest time.Time
+	next := offset + 1
+	for _, dive := range active {
+		if dive.Number > next {
+			report.Gaps = append(report.Gaps, DiveNumberRange{From: next, To: dive.Number - 1})
+		}
+		next = dive.Number + 1
+
+		if dive.DateTimeIn.Before(latest) {
+			report.OutOfOrder = append(report.OutOfOrder, dive)
+		} else {
+			latest = dive.DateTimeIn
+		}
+	}
+
+	// Then by the order that the dives were made in.
+	slices.SortFunc(active, func(a, b DiveNumbering) int {
+		if c := a.DateTimeIn.Compare(b.DateTimeIn); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+
+	for i := 0; i < len(active); {
+		j := i + 1
+		for j < len(active) && active[j].DateTimeIn.Equal(active[i].DateTimeIn) {
+			j++
+		}
+		if j-i > 1 {
+			report.Duplicates = append(report.Duplicates, active[i:j])
+		}
+		i = j
+	}
+
+	for i := range active {
+		active[i].NewNumber = offset + 1 + i
+		if active[i].NewNumber != active[i].Number {
+			report.Changes = append(report.Changes, active[i])
+		}
+	}
+
+	limit := offset + len(active)
+	kept := map[int]bool{}
+	for _, dive := range trashed {
+		if dive.Number > limit {
+			kept[dive.Number] = true
+		}
+	}
+
+	slices.SortFunc(trashed, func(a, b DiveNumbering) int { return a.Number - b.Number })
+	last := limit
+	for _, dive := range trashed {
+		if dive.Number > limit {
+			continue
+		}
+
+		for last++; kept[last]; last++ {
+		}
+		dive.NewNumber = last
+		report.Changes = append(report.Changes, dive)
+	}
+
+	return report
+}
+
+// fetchDiveNumbering returns all of the user's dives, including those in the
+// trash, along with their dive number offset. If lock is true, then the dives
+// are locked until tx ends.
+func (m *DiveModel) fetchDiveNumbering(
+	ctx context.Context,
+	tx *sql.Tx,
+	ownerID int,
+	lock bool,
+) ([]DiveNumbering, int, error) {
+	var offset int
+	err := tx.QueryRowContext(
+		ctx,
+		"select dive_number_offset from users where id = $1",
+		ownerID,
+	).Scan(&offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get dive number offset for user %d: %w", ownerID, err)
+	}
+
+	stmt := `
+        select dv.id, dv.number, dv.date_time_in, ds.name,
+               dv.deleted_at is not null
+          from dives dv
+          join dive_sites ds on ds.id = dv.dive_site_id
+         where dv.owner_id = $1
+    `
+	if lock {
+		stmt += " for update of dv"
+	}
+
+	rows, err := tx.QueryContext(ctx, stmt, ownerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var dives []DiveNumbering
+	for rows.Next() {
+		var dive DiveNumbering
+		err := rows.Scan(
+			&dive.ID,
+			&dive.Number,
+			&dive.DateTimeIn,
+			&dive.DiveSiteName,
+			&dive.Trashed,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		dives = append(dives, dive)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return dives, offset, nil
+}
+
+// NumberingReport checks the numbering of the user's dives and previews the
+// changes that Renumber would make to it.
+func (m *DiveModel) NumberingReport(ownerID int) (DiveNumberingReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Complex)
+	defer cancel()
+
+	// The offset and dives are read in a single transaction so that they are
+	// consistent with each other.
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return DiveNumberingReport{}, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	dives, offset, err := m.fetchDiveNumbering(ctx, tx, ownerID, false)
+	if err != nil {
+		return DiveNumberingReport{}, err
+	}
+
+	return planDiveNumbering(dives, offset), nil
+}
+
+// Renumber numbers the user's dives in the order that they were made, as
+// previewed by NumberingReport, and returns how many were changed. The changes
+// are worked out again within the transaction and if they differ from the
+// expected ones, which are the Changes from the report that the user saw, then
+// ErrUpdateConflict is returned and nothing is changed.
+//
+// As the numbers must be unique for each user at all times, the dives are
+// first moved out of the way to temporary negative numbers.
+func (m *DiveModel) Renumber(ownerID int, expected []DiveNumbering) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Bulk)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	dives, offset, err := m.fetchDiveNumbering(ctx, tx, ownerID, true)
+	if err != nil {
+		return 0, err
+	}
+
+	changes := planDiveNumbering(dives, offset).Changes
+	sameChange := func(a, b DiveNumbering) bool {
+		return a.ID == b.ID && a.NewNumber == b.NewNumber
+	}
+	if !slices.EqualFunc(changes, expected, sameChange) {
+		return 0, ErrUpdateConflict
+	}
+
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int, len(changes))
+	numbers := make([]int, len(changes))
+	for i, change := range changes {
+		ids[i] = change.ID
+		numbers[i] = change.NewNumber
+	}
+
+	stmt := `
+        update dives
+           set number = -number
+         where owner_id = $1
+           and id = any($2)
+    `
+	_, err = tx.ExecContext(ctx, stmt, ownerID, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to give dives temporary numbers: %w", err)
+	}
+
+	stmt = `
+        update dives dv
+           set number = c.number,
+               version = dv.version + 1
+          from unnest($2::bigint[], $3::integer[]) as c(id, number)
+         where dv.id = c.id
+           and dv.owner_id = $1
+    `
+	result, err := tx.ExecContext(ctx, stmt, ownerID, pq.Array(ids), pq.Array(numbers))
+	if err != nil {
+		return 0, fmt.Errorf("failed to renumber dives: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected != int64(len(changes)) {
+		return 0, &ErrUnexpectedRowsAffected{
+			rowsExpected: len(changes),
+			rowsAffected: int(rowsAffected),
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit db transaction to renumber dives: %w", err)
+	}
+
+	return len(changes), nil
+}
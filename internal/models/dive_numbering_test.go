@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestPlanDiveNumbering(t *testing.T) {
+	day := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return day.Add(time.Duration(hours) * time.Hour) }
+
+	// Dive 4 was forgotten and logged after dive 5, dive 6 was logged twice
+	// with the same time and dive 2 is in the trash.
+	dives := []DiveNumbering{
+		{ID: 1, Number: 1, DateTimeIn: at(0)},
+		{ID: 2, Number: 2, DateTimeIn: at(2), Trashed: true},
+		{ID: 3, Number: 3, DateTimeIn: at(4)},
+		{ID: 4, Number: 5, DateTimeIn: at(6)},
+		{ID: 5, Number: 6, DateTimeIn: at(5)},
+		{ID: 6, Number: 8, DateTimeIn: at(8)},
+		{ID: 7, Number: 9, DateTimeIn: at(8)},
+		{ID: 8, Number: 7, DateTimeIn: at(10), Trashed: true},
+	}
+
+	report := planDiveNumbering(dives, 0)
+
+	changes := map[int][2]int{}
+	for _, c := range report.Changes {
+		changes[c.ID] = [2]int{c.Number, c.NewNumber}
+	}
+
+	assert.Equal(t, len(report.Changes), 6)
+	assert.Equal(t, changes[3], [2]int{3, 2})
+	assert.Equal(t, changes[5], [2]int{6, 3})
+	assert.Equal(t, changes[4], [2]int{5, 4})
+	assert.Equal(t, changes[6], [2]int{8, 5})
+	assert.Equal(t, changes[7], [2]int{9, 6})
+	// Trashed dive 2 is needed and moves after the last dive, skipping the
+	// number 7 that is kept by the other trashed dive.
+	assert.Equal(t, changes[2], [2]int{2, 8})
+
+	assert.Equal(t, len(report.Gaps), 3)
+	assert.Equal(t, report.Gaps[0], DiveNumberRange{From: 2, To: 2})
+	assert.Equal(t, report.Gaps[1], DiveNumberRange{From: 4, To: 4})
+	assert.Equal(t, report.Gaps[2], DiveNumberRange{From: 7, To: 7})
+
+	assert.Equal(t, len(report.OutOfOrder), 1)
+	assert.Equal(t, report.OutOfOrder[0].ID, 5)
+
+	assert.Equal(t, len(report.Duplicates), 1)
+	assert.Equal(t, len(report.Duplicates[0]), 2)
+	assert.Equal(t, report.IsClean(), false)
+
+	t.Run("Clean with offset", func(t *testing.T) {
+		report := planDiveNumbering([]DiveNumbering{
+			{ID: 1, Number: 11, DateTimeIn: at(0)},
+			{ID: 2, Number: 12, DateTimeIn: at(2)},
+		}, 10)
+		assert.Equal(t, report.IsClean(), true)
+	})
+}
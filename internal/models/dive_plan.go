@@ -96,6 +96,7 @@ type DivePlanModelInterface interface {
 	Update(
 		id int,
 		ownerID int,
+		version int,
 		name string,
 		notes string,
 		isSoloDive bool,
@@ -138,6 +139,7 @@ var divePlanSelectQuery string = `
       from dive_plans dp
       left join dive_plan_stops ds on dp.id = ds.dive_plan_id
      where dp.owner_id = $1
+       and dp.deleted_at is null
        and (dp.id = $2 or $2::bigint is null)
      group by dp.id, dp.version, dp.created_at, dp.updated_at,
            dp.owner_id, dp.name, dp.notes, dp.is_solo_dive, dp.descent_rate,
@@ -324,6 +326,7 @@ func (m *DivePlanModel) Insert(
 func (m *DivePlanModel) Update(
 	id int,
 	ownerID int,
+	version int,
 	name string,
 	notes string,
 	isSoloDive bool,
@@ -341,13 +344,15 @@ func (m *DivePlanModel) Update(
 ) error {
 	stmt := `
         update dive_plans
-           set version = version + 1, updated_at = now(), name = $3, notes = $4,
-               is_solo_dive = $5, descent_rate = $6, ascent_rate = $7,
-               sac_rate = $8, tank_count = $9, tank_volume = $10,
-               working_pressure = $11, dive_factor = $12, fn2 = $13, fhe = $14,
-               max_ppo2 = $15
+           set version = version + 1, updated_at = now(), name = $4, notes = $5,
+               is_solo_dive = $6, descent_rate = $7, ascent_rate = $8,
+               sac_rate = $9, tank_count = $10, tank_volume = $11,
+               working_pressure = $12, dive_factor = $13, fn2 = $14, fhe = $15,
+               max_ppo2 = $16
          where id = $1
            and owner_id = $2
+           and version = $3
+           and deleted_at is null
     `
 
 	if len(stops) == 0 {
@@ -368,6 +373,7 @@ func (m *DivePlanModel) Update(
 		stmt,
 		id,
 		ownerID,
+		version,
 		name,
 		notes,
 		isSoloDive,
@@ -390,7 +396,7 @@ func (m *DivePlanModel) Update(
 	rowsAffected, err := result.RowsAffected()
 	if err != nil || rowsAffected != 1 {
 		if rowsAffected == 0 {
-			return ErrNoRecord
+			return updateConflictOrNoRecord(ctx, tx, "dive_plans", id, ownerID)
 		} else if rowsAffected > 1 {
 			return &ErrUnexpectedRowsAffected{rowsExpected: 1, rowsAffected: int(rowsAffected)}
 		}
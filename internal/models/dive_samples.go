@@ -0,0 +1,478 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// profileSurfaceDepth is the depth in metres that a diver must be below for a
+// sample to count towards the bottom time of a dive.
+const profileSurfaceDepth = 1.0
+
+// DiveSample is a single point in a dive's profile. Elapsed is the time since
+// the start of the dive, Depth is in metres, Temperature in degrees Celsius,
+// Pressure is the tank pressure in bar and PPO2 is the partial pressure of
+// oxygen in bar. CNS is the diver's oxygen toxicity as a percentage of the CNS
+// limit. StopDepth and StopTime describe the first decompression stop that the
+// diver was required to make and are nil when there was none. Events holds
+// anything the dive computer noted at the time, such as gas switches or ascent
+// warnings.
+type DiveSample struct {
+	Elapsed     time.Duration
+	Depth       float64
+	Temperature *float64
+	Pressure    *float64
+	PPO2        *float64
+	CNS         *float64
+	StopDepth   *float64
+	StopTime    *time.Duration
+	Events      []string
+}
+
+// DecoStop is a period of a dive during which the diver was required to make a
+// decompression stop at Depth metres. Start is the time into the dive that the
+// stop was first required and Duration how long it remained the first stop.
+type DecoStop struct {
+	Depth    float64
+	Start    time.Duration
+	Duration time.Duration
+}
+
+// DiveProfile is the time series of samples recorded for a dive, in order of
+// their Elapsed time. Once a dive has a profile, its MaxDepth, AvgDepth and
+// BottomTime are derived from it rather than entered by hand.
+type DiveProfile []DiveSample
+
+// MaxDepth returns the deepest depth reached in the profile to the nearest
+// 10cm.
+func (p DiveProfile) MaxDepth() float64 {
+	var maxDepth float64
+	for _, s := range p {
+		maxDepth = max(maxDepth, s.Depth)
+	}
+
+	return math.Round(maxDepth*10) / 10
+}
+
+// span returns the indexes of the samples at which the dive started and ended.
+// The dive starts with the last sample at the surface before the diver first
+// descended below profileSurfaceDepth and ends with the first sample at the
+// surface after their final ascent. Either end falls back to the first or last
+// sample if the profile did not record the diver at the surface.
+func (p DiveProfile) span() (int, int) {
+	first, last := -1, -1
+	for i, s := range p {
+		if s.Depth >= profileSurfaceDepth {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	if first < 0 {
+		return 0, 0
+	}
+
+	return max(first-1, 0), min(last+1, len(p)-1)
+}
+
+// BottomTime returns the time from the start of the dive until the diver
+// surfaced at the end of it, to the nearest second.
+func (p DiveProfile) BottomTime() time.Duration {
+	start, end := p.span()
+	if start == end {
+		return 0
+	}
+
+	return (p[end].Elapsed - p[start].Elapsed).Round(time.Second)
+}
+
+// AvgDepth returns the time-weighted average depth over the BottomTime of the
+// dive to the nearest 10cm.
+func (p DiveProfile) AvgDepth() float64 {
+	start, end := p.span()
+	if start == end {
+		return 0
+	}
+
+	var area float64
+	for i := start + 1; i <= end; i++ {
+		dt := (p[i].Elapsed - p[i-1].Elapsed).Seconds()
+		area += dt * (p[i].Depth + p[i-1].Depth) / 2
+	}
+
+	avg := area / (p[end].Elapsed - p[start].Elapsed).Seconds()
+
+	return math.Round(avg*10) / 10
+}
+
+// MaxCNS returns the highest CNS percentage recorded in the profile, or nil if
+// the dive computer did not record it.
+func (p DiveProfile) MaxCNS() *float64 {
+	var maxCNS *float64
+	for _, s := range p {
+		if s.CNS != nil && (maxCNS == nil || *s.CNS > *maxCNS) {
+			maxCNS = s.CNS
+		}
+	}
+
+	return maxCNS
+}
+
+// DecoStops returns the decompression stops that the diver was required to make
+// during the dive, in order. Consecutive samples with the same stop depth are
+// treated as a single stop.
+func (p DiveProfile) DecoStops() []DecoStop {
+	var stops []DecoStop
+	var current *DecoStop
+
+	for _, s := range p {
+		if s.StopDepth == nil {
+			current = nil
+			continue
+		}
+
+		if current == nil || current.Depth != *s.StopDepth {
+			stops = append(stops, DecoStop{Depth: *s.StopDepth, Start: s.Elapsed})
+			current = &stops[len(stops)-1]
+			continue
+		}
+
+		current.Duration = s.Elapsed - current.Start
+	}
+
+	return stops
+}
+
+// ChartData returns the profile's samples as JSON arrays, keyed by the name of
+// each series, for plotting with Chart.js. Times are in seconds and missing
+// values are given as null.
+func (p DiveProfile) ChartData() (map[string]template.JS, error) {
+	var data map[string]template.JS = make(map[string]template.JS)
+
+	times := make([]int, len(p))
+	depths := make([]float64, len(p))
+	temps := make([]*float64, len(p))
+	pressures := make([]*float64, len(p))
+	ppo2s := make([]*float64, len(p))
+	cns := make([]*float64, len(p))
+	stops := make([]*float64, len(p))
+	events := make([]string, len(p))
+
+	for i, s := range p {
+		times[i] = int(s.Elapsed.Seconds())
+		depths[i] = s.Depth
+		temps[i] = s.Temperature
+		pressures[i] = s.Pressure
+		ppo2s[i] = s.PPO2
+		cns[i] = s.CNS
+		stops[i] = s.StopDepth
+		events[i] = strings.Join(s.Events, ", ")
+	}
+
+	series := map[string]any{
+		"times":     times,
+		"depths":    depths,
+		"temps":     temps,
+		"pressures": pressures,
+		"ppo2s":     ppo2s,
+		"cns":       cns,
+		"stops":     stops,
+		"events":    events,
+	}
+
+	for name, values := range series {
+		valuesJSON, err := json.Marshal(values)
+		if err != nil {
+			return data, err
+		}
+		data[name] = template.JS(valuesJSON)
+	}
+
+	return data, nil
+}
+
+// getDiveProfile fetches the samples of the dive with the given ID in order.
+func getDiveProfile(ctx context.Context, db sqlQuerier, diveID int) (DiveProfile, error) {
+	stmt := `
+        select elapsed, depth, temperature, pressure, ppo2, cns, stop_depth,
+               stop_time, events
+          from dive_samples
+         where dive_id = $1
+      order by elapsed
+    `
+
+	rows, err := db.QueryContext(ctx, stmt, diveID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get samples for dive with id %d: %w", diveID, err)
+	}
+	defer rows.Close()
+
+	var profile DiveProfile
+	for rows.Next() {
+		var s DiveSample
+		err := diveSampleFromDBRow(rows, &s)
+		if err != nil {
+			return nil, err
+		}
+		profile = append(profile, s)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// diveSampleFromDBRow scans a row of the dive_samples columns selected by
+// getDiveProfile into s, followed by any extra columns into dest.
+func diveSampleFromDBRow(rs RowScanner, s *DiveSample, dest ...any) error {
+	var elapsed int
+	var stopTime *int
+
+	err := rs.Scan(append([]any{
+		&elapsed,
+		&s.Depth,
+		&s.Temperature,
+		&s.Pressure,
+		&s.PPO2,
+		&s.CNS,
+		&s.StopDepth,
+		&stopTime,
+		pq.Array(&s.Events),
+	}, dest...)...)
+	if err != nil {
+		return err
+	}
+
+	s.Elapsed = time.Duration(elapsed) * time.Second
+	if stopTime != nil {
+		s.StopTime = new(time.Duration)
+		*s.StopTime = time.Duration(*stopTime) * time.Second
+	}
+
+	return nil
+}
+
+// GetProfiles returns the profiles of the owner's dives with the given IDs,
+// keyed by dive ID. Dives that do not have a profile are left out.
+func (m *DiveModel) GetProfiles(ownerID int, diveIDs []int) (map[int]DiveProfile, error) {
+	stmt := `
+        select sa.elapsed, sa.depth, sa.temperature, sa.pressure, sa.ppo2,
+               sa.cns, sa.stop_depth, sa.stop_time, sa.events, sa.dive_id
+          from dive_samples sa
+    inner join dives dv on sa.dive_id = dv.id
+         where dv.owner_id = $1
+           and sa.dive_id = any($2)
+      order by sa.dive_id, sa.elapsed
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Bulk)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, ownerID, pq.Array(diveIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get samples for dives: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := map[int]DiveProfile{}
+	for rows.Next() {
+		var s DiveSample
+		var diveID int
+		err := diveSampleFromDBRow(rows, &s, &diveID)
+		if err != nil {
+			return nil, err
+		}
+		profiles[diveID] = append(profiles[diveID], s)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// updateDiveFromProfile sets the max depth, average depth and bottom time of
+// the dive with the given ID to the values derived from its profile.
+func updateDiveFromProfile(
+	ctx context.Context,
+	db sqlExecer,
+	diveID int,
+	profile DiveProfile,
+) error {
+	stmt := `
+        update dives
+           set max_depth = $2, avg_depth = $3, bottom_time = $4
+         where id = $1
+    `
+
+	_, err := db.ExecContext(
+		ctx,
+		stmt,
+		diveID,
+		profile.MaxDepth(),
+		profile.AvgDepth(),
+		profile.BottomTime().Nanoseconds(),
+	)
+	if err != nil {
+		msg := "failed to update dive with id %d from its profile: %w"
+		return fmt.Errorf(msg, diveID, err)
+	}
+
+	return nil
+}
+
+// replaceDiveProfile deletes any existing samples of the dive with the given ID,
+// inserts those of the profile in their place and then updates the dive from
+// the new profile.
+func replaceDiveProfile(ctx context.Context, tx *sql.Tx, diveID int, profile DiveProfile) error {
+	_, err := tx.ExecContext(ctx, "delete from dive_samples where dive_id = $1", diveID)
+	if err != nil {
+		return fmt.Errorf("failed to delete samples for dive with id %d: %w", diveID, err)
+	}
+
+	// The samples are copied in rather than being inserted one at a time, as a
+	// whole log book of profiles can have tens of thousands of them.
+	copyIn, err := tx.PrepareContext(ctx, pq.CopyIn(
+		"dive_samples",
+		"dive_id", "elapsed", "depth", "temperature", "pressure", "ppo2", "cns",
+		"stop_depth", "stop_time", "events",
+	))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy of samples for dive with id %d: %w", diveID, err)
+	}
+	defer copyIn.Close()
+
+	for _, s := range profile {
+		events := s.Events
+		if events == nil {
+			events = []string{}
+		}
+
+		var stopTime *int
+		if s.StopTime != nil {
+			stopTime = new(int)
+			*stopTime = int(s.StopTime.Seconds())
+		}
+
+		_, err = copyIn.ExecContext(
+			ctx,
+			diveID,
+			int(s.Elapsed.Seconds()),
+			s.Depth,
+			s.Temperature,
+			s.Pressure,
+			s.PPO2,
+			s.CNS,
+			s.StopDepth,
+			stopTime,
+			pq.Array(events),
+		)
+		if err != nil {
+			msg := "failed to copy sample at %s for dive with id %d: %w"
+			return fmt.Errorf(msg, s.Elapsed, diveID, err)
+		}
+	}
+
+	// Executing the statement without any arguments flushes the copied rows.
+	_, err = copyIn.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to copy samples for dive with id %d: %w", diveID, err)
+	}
+
+	return updateDiveFromProfile(ctx, tx, diveID, profile)
+}
+
+// SetProfile replaces the profile of the owner's dive with the given one in a
+// single transaction and updates the dive's max depth, average depth and
+// bottom time to match it.
+func (m *DiveModel) SetProfile(ownerID, diveID int, profile DiveProfile) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Bulk)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt := `
+        update dives
+           set version = version + 1
+         where id = $1
+           and owner_id = $2
+    `
+
+	result, err := tx.ExecContext(ctx, stmt, diveID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	err = replaceDiveProfile(ctx, tx, diveID, profile)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		msg := "failed to commit db transaction to set profile of dive %d: %w"
+		return fmt.Errorf(msg, diveID, err)
+	}
+
+	return nil
+}
+
+// DeleteProfile removes every sample from the owner's dive. The dive's max
+// depth, average depth and bottom time are left as they were so that they can
+// be edited by hand again.
+func (m *DiveModel) DeleteProfile(ownerID, diveID int) error {
+	stmt := `
+        delete from dive_samples ds
+         using dives dv
+         where ds.dive_id = dv.id
+           and dv.id = $1
+           and dv.owner_id = $2
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, diveID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
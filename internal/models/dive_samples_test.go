@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestDiveProfileStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    DiveProfile
+		maxDepth   float64
+		avgDepth   float64
+		bottomTime time.Duration
+	}{
+		{
+			name: "Square profile",
+			profile: DiveProfile{
+				{Elapsed: 0, Depth: 0},
+				{Elapsed: 1 * time.Minute, Depth: 20},
+				{Elapsed: 41 * time.Minute, Depth: 20},
+				{Elapsed: 42 * time.Minute, Depth: 0},
+			},
+			maxDepth:   20,
+			avgDepth:   19.5,
+			bottomTime: 42 * time.Minute,
+		},
+		{
+			name: "Surface samples either side",
+			profile: DiveProfile{
+				{Elapsed: 0, Depth: 0.2},
+				{Elapsed: 30 * time.Second, Depth: 0.3},
+				{Elapsed: 1 * time.Minute, Depth: 10.04},
+				{Elapsed: 11 * time.Minute, Depth: 10},
+				{Elapsed: 12 * time.Minute, Depth: 0},
+				{Elapsed: 15 * time.Minute, Depth: 0},
+			},
+			maxDepth:   10,
+			avgDepth:   9.4,
+			bottomTime: 11*time.Minute + 30*time.Second,
+		},
+		{
+			name:       "Never submerged",
+			profile:    DiveProfile{{Elapsed: 0, Depth: 0}, {Elapsed: time.Minute, Depth: 0.5}},
+			maxDepth:   0.5,
+			avgDepth:   0,
+			bottomTime: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.profile.MaxDepth(), tt.maxDepth)
+			assert.Equal(t, tt.profile.AvgDepth(), tt.avgDepth)
+			assert.Equal(t, tt.profile.BottomTime(), tt.bottomTime)
+		})
+	}
+}
+
+func TestDiveProfileDeco(t *testing.T) {
+	cns := []float64{4, 12, 9}
+	stop6, stop3 := 6.0, 3.0
+
+	profile := DiveProfile{
+		{Elapsed: 0, Depth: 0, CNS: &cns[0]},
+		{Elapsed: 20 * time.Minute, Depth: 45, CNS: &cns[1]},
+		{Elapsed: 40 * time.Minute, Depth: 9, StopDepth: &stop6},
+		{Elapsed: 42 * time.Minute, Depth: 6, StopDepth: &stop6},
+		{Elapsed: 45 * time.Minute, Depth: 6, StopDepth: &stop6},
+		{Elapsed: 46 * time.Minute, Depth: 3, StopDepth: &stop3},
+		{Elapsed: 52 * time.Minute, Depth: 3, StopDepth: &stop3},
+		{Elapsed: 55 * time.Minute, Depth: 0, CNS: &cns[2]},
+	}
+
+	assert.Equal(t, *profile.MaxCNS(), 12.0)
+	assert.Equal(t, DiveProfile{{Elapsed: 0, Depth: 10}}.MaxCNS() == nil, true)
+
+	stops := profile.DecoStops()
+	assert.Equal(t, len(stops), 2)
+	assert.Equal(t, stops[0], DecoStop{Depth: 6, Start: 40 * time.Minute, Duration: 5 * time.Minute})
+	assert.Equal(t, stops[1], DecoStop{Depth: 3, Start: 46 * time.Minute, Duration: 6 * time.Minute})
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -97,7 +98,10 @@ type DiveSiteModelInterface interface {
 
 	ListAll(diverID int) ([]DiveSite, error)
 
+	ListForDiver(diverID int, filter DiveSiteFilter) ([]DiveSite, error)
+
 	Exists(id int) (bool, error)
+	ExistsActive(id int) (bool, error)
 }
 
 var diveSiteSelectQuery string = `
@@ -108,6 +112,7 @@ var diveSiteSelectQuery string = `
                max(dv.date_time_in) last_dive_at
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.dive_site_id
            )
     select count(*) over(), ds.id, ds.version, ds.created_at, ds.updated_at,
@@ -125,6 +130,7 @@ var diveSiteSelectQuery string = `
  left join currencies   cu on co.currency_id = cu.id
  left join water_bodies wb on ds.water_body_id = wb.id
  left join water_types  wt on ds.water_type_id = wt.id
+     where ds.deleted_at is null
 `
 
 func diveSiteFromDBRow(rs RowScanner, totalRecords *int, ds *DiveSite) error {
@@ -175,6 +181,25 @@ type DiveSiteModel struct {
 	Timeouts QueryTimeouts
 }
 
+// DiveSiteFields holds the values of a new dive site. The fields correspond to
+// the arguments of DiveSiteModel.Insert.
+type DiveSiteFields struct {
+	Name        string
+	AltName     string
+	Location    string
+	Region      string
+	CountryID   int
+	TimeZone    TimeZone
+	Latitude    *float64
+	Longitude   *float64
+	WaterBodyID int
+	WaterTypeID int
+	Altitude    int
+	MaxDepth    *float64
+	Notes       string
+	Rating      *int
+}
+
 func (m *DiveSiteModel) Insert(
 	ownerId int,
 	name string,
@@ -191,6 +216,35 @@ func (m *DiveSiteModel) Insert(
 	maxDepth *float64,
 	notes string,
 	rating *int,
+) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
+	defer cancel()
+
+	return insertDiveSite(ctx, m.DB, ownerId, DiveSiteFields{
+		Name:        name,
+		AltName:     altName,
+		Location:    location,
+		Region:      region,
+		CountryID:   countryID,
+		TimeZone:    timeZone,
+		Latitude:    latitude,
+		Longitude:   longitude,
+		WaterBodyID: waterBodyID,
+		WaterTypeID: waterTypeID,
+		Altitude:    altitude,
+		MaxDepth:    maxDepth,
+		Notes:       notes,
+		Rating:      rating,
+	})
+}
+
+// insertDiveSite inserts a new dive site using db, which may be a transaction,
+// and returns its ID.
+func insertDiveSite(
+	ctx context.Context,
+	db sqlRowQuerier,
+	ownerID int,
+	ds DiveSiteFields,
 ) (int, error) {
 	stmt := `
         insert into dive_sites (
@@ -203,27 +257,24 @@ func (m *DiveSiteModel) Insert(
         returning id
     `
 
-	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
-	defer cancel()
-
-	result := m.DB.QueryRowContext(
+	result := db.QueryRowContext(
 		ctx,
 		stmt,
-		ownerId,
-		name,
-		altName,
-		location,
-		region,
-		countryID,
-		timeZone,
-		latitude,
-		longitude,
-		waterBodyID,
-		waterTypeID,
-		altitude,
-		maxDepth,
-		notes,
-		rating,
+		ownerID,
+		ds.Name,
+		ds.AltName,
+		ds.Location,
+		ds.Region,
+		ds.CountryID,
+		ds.TimeZone,
+		ds.Latitude,
+		ds.Longitude,
+		ds.WaterBodyID,
+		ds.WaterTypeID,
+		ds.Altitude,
+		ds.MaxDepth,
+		ds.Notes,
+		ds.Rating,
 	)
 
 	var id int
@@ -262,6 +313,7 @@ func (m *DiveSiteModel) Update(
                max_depth = $14, notes = $15, rating = $16
          where id = $1
            and version = $2
+           and deleted_at is null
      returning version
     `
 
@@ -293,7 +345,7 @@ func (m *DiveSiteModel) Update(
 	err := result.Scan(&newVersion)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			exists, existsErr := m.Exists(id)
+			exists, existsErr := m.ExistsActive(id)
 			if existsErr != nil {
 				return fmt.Errorf("failed to check if dive_site %d exists: %w", id, existsErr)
 			}
@@ -311,7 +363,7 @@ func (m *DiveSiteModel) Update(
 }
 
 func (m *DiveSiteModel) GetOneByID(id, ownerID int) (DiveSite, error) {
-	stmt := fmt.Sprintf("%s where ds.id = $2", diveSiteSelectQuery)
+	stmt := fmt.Sprintf("%s and ds.id = $2", diveSiteSelectQuery)
 	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
 	defer cancel()
 
@@ -405,10 +457,66 @@ func (m *DiveSiteModel) ListAll(diverID int) ([]DiveSite, error) {
 	return records, nil
 }
 
+// DiveSiteFilter restricts a list of dive sites to those matching every one of
+// its non-zero fields.
+type DiveSiteFilter struct {
+	CountryID   int
+	WaterBodyID int
+}
+
+func (f DiveSiteFilter) buildWhereClause() string {
+	clause := strings.Builder{}
+
+	clause.WriteString(" and ($2 = 0 or ds.country_id = $2)")
+	clause.WriteString(" and ($3 = 0 or ds.water_body_id = $3)")
+
+	return clause.String()
+}
+
+// ListForDiver returns the dive sites that the diver either added or has dived
+// at which match the given filter, in the default dive site order.
+func (m *DiveSiteModel) ListForDiver(diverID int, filter DiveSiteFilter) ([]DiveSite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
+	defer cancel()
+
+	where := " and (ds.owner_id = $1 or st.dives_at > 0)" + filter.buildWhereClause()
+	order := buildOrderByClause(SortDiveSiteDefault, SortDiveSiteIDAsc)
+	stmt := fmt.Sprintf("%s %s %s", diveSiteSelectQuery, where, order)
+	rows, err := m.DB.QueryContext(ctx, stmt, diverID, filter.CountryID, filter.WaterBodyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	var records []DiveSite
+	for rows.Next() {
+		var record DiveSite
+		err := diveSiteFromDBRow(rows, &totalRecords, &record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
 func (m *DiveSiteModel) Exists(id int) (bool, error) {
 	return idExistsInTable(m.DB, id, "dive_sites", "id")
 }
 
+// ExistsActive checks if a dive site with the given ID exists and is not in the
+// trash. Dive sites are shared between users, so it may belong to anyone.
+func (m *DiveSiteModel) ExistsActive(id int) (bool, error) {
+	return idExistsActiveInTable(m.DB, id, "dive_sites")
+}
+
 type WaterBodyModel struct {
 	DB       *sql.DB
 	Timeouts QueryTimeouts
@@ -143,7 +143,7 @@ func (m DiveModel) getGeneralStats(
 		return errors.New("nil UserDiveStats struct passed to getGeneralStats")
 	}
 
-	query := "select %s from dives dv where dv.owner_id = $1"
+	query := "select %s from dives dv where dv.owner_id = $1 and dv.deleted_at is null"
 	stmt := fmt.Sprintf(query, aggregateFields)
 
 	row := m.DB.QueryRowContext(ctx, stmt, userID)
@@ -173,6 +173,7 @@ func (m DiveModel) getStatsByMonth(
         select %s, date_trunc('month', dv.date_time_in) as month
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by month
       order by month desc
     `
@@ -218,6 +219,7 @@ func (m DiveModel) getStatsByCountry(
      left join countries  co on ds.country_id = co.id
      left join currencies cu on co.currency_id = cu.id
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by %[2]s
       order by dives desc
          limit 10
@@ -288,6 +290,7 @@ func (m DiveModel) getStatsByDiveSite(
                max(dv.date_time_in) last_dive_at
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.dive_site_id
            )
     select %[1]s, %[2]s
@@ -299,6 +302,7 @@ func (m DiveModel) getStatsByDiveSite(
  left join water_bodies         wb on ds.water_body_id = wb.id
  left join water_types          wt on ds.water_type_id = wt.id
      where dv.owner_id = $1
+       and dv.deleted_at is null
   group by %[2]s
   order by dives desc
      limit 10
@@ -397,6 +401,7 @@ func (m DiveModel) getStatsByBuddy(
                max(dv.date_time_in) last_dive_with
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.buddy_id
            )
     select %[1]s, %[2]s
@@ -406,6 +411,7 @@ inner join buddies          bu on dv.buddy_id = bu.id
  left join agencies         ag on bu.agency_id = ag.id
  left join buddy_dive_stats ds on bu.id = ds.buddy_id
      where dv.owner_id = $1
+       and dv.deleted_at is null
   group by %[2]s
   order by dives desc
      limit 10
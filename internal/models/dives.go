@@ -5,8 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Dive struct {
@@ -51,6 +54,9 @@ type Dive struct {
 	Properties        []DiveProperty
 	Rating            *int
 	Notes             string
+	// Profile is only loaded by GetOneByID, but HasProfile is always set.
+	Profile    DiveProfile
+	HasProfile bool
 }
 
 func (d Dive) DateTimeOut() time.Time {
@@ -111,10 +117,24 @@ func (d Dive) IsTrainingDive() bool {
 }
 
 type DiveModelInterface interface {
+	ExistsAt(ownerID, diveSiteID int, dateTimeIn time.Time) (bool, error)
+
+	ExistsAtTime(ownerID int, dateTimeIn time.Time) (bool, error)
+
 	GetDiveStats(userID int) (DiveStats, error)
 
 	GetOneByID(ownerID, id int) (Dive, error)
 
+	InsertMany(ownerID int, dives []DiveFields) ([]int, error)
+
+	Import(ownerID int, batch DiveImport) ([]int, []int, error)
+
+	DeleteProfile(ownerID, diveID int) error
+
+	GetProfiles(ownerID int, diveIDs []int) (map[int]DiveProfile, error)
+
+	SetProfile(ownerID, diveID int, profile DiveProfile) error
+
 	Insert(
 		ownerID int,
 		number int,
@@ -158,6 +178,7 @@ type DiveModelInterface interface {
 	Update(
 		id int,
 		ownerID int,
+		version int,
 		number int,
 		activity string,
 		diveSiteID int,
@@ -197,6 +218,22 @@ type DiveModelInterface interface {
 	) error
 
 	List(userID int, pager Pager, filter DiveFilter, sort []SortDive) ([]Dive, PageData, error)
+
+	ListAll(userID int, filter DiveFilter, sort []SortDive) ([]Dive, error)
+
+	NumberExists(ownerID, number int) (bool, error)
+
+	StreamAll(userID int, filter DiveFilter, sort []SortDive, fn func(Dive) error) error
+
+	BulkUpdate(
+		ownerID int,
+		dives []DiveVersion,
+		changes DiveBulkChanges,
+		allOrNothing bool,
+	) ([]DiveBulkResult, error)
+
+	NumberingReport(ownerID int) (DiveNumberingReport, error)
+	Renumber(ownerID int, expected []DiveNumbering) (int, error)
 }
 
 var diveSelectQuery string = `
@@ -207,6 +244,7 @@ var diveSelectQuery string = `
                max(dv.date_time_in) last_dive_at
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.dive_site_id
            ),
       operator_dive_stats as (
@@ -216,6 +254,7 @@ var diveSelectQuery string = `
                max(dv.date_time_in) last_dive
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.operator_id
            ),
       trip_dive_stats as (
@@ -225,6 +264,7 @@ var diveSelectQuery string = `
                max(dv.date_time_in) last_dive
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.trip_id
            ),
       cert_dive_stats as (
@@ -234,6 +274,7 @@ var diveSelectQuery string = `
                max(dv.date_time_in) last_dive
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.certification_id
            ),
       buddy_dive_stats as (
@@ -242,6 +283,7 @@ var diveSelectQuery string = `
                max(dv.date_time_in) last_dive_with
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.buddy_id
            )
     select count(*) over(),
@@ -330,7 +372,8 @@ var diveSelectQuery string = `
            gm.id, gm.sort, gm.is_default, gm.name, gm.description,
            dv.fo2, dv.pressure_in, dv.pressure_out, dv.gas_mix_notes,
            ep.id, ep.sort, ep.is_default, ep.name, ep.description,
-           dv.rating, dv.notes
+           dv.rating, dv.notes,
+           exists(select 1 from dive_samples sa where sa.dive_id = dv.id)
       from dives dv
 inner join (
     -- Calculate the surface interval which we take to be the length of time
@@ -345,7 +388,8 @@ inner join (
             lag(date_time_in + make_interval(secs => bottom_time / 10^9), 1) over (
                 partition by owner_id order by date_time_in
         ))) * 10^9)::bigint surface_interval
-      from dives)               si   on dv.id = si.id
+      from dives
+     where deleted_at is null)  si   on dv.id = si.id
  left join dive_sites           ds   on dv.dive_site_id = ds.id
  left join dive_site_dive_stats dsds on ds.id = dsds.dive_site_id
  left join countries            dsco on ds.country_id = dsco.id
@@ -359,6 +403,7 @@ inner join (
  left join currencies           opcu on opco.currency_id = opcu.id
  left join currencies           prcu on dv.currency_id = prcu.id
  left join trips                tr   on dv.trip_id = tr.id
+                                    and tr.deleted_at is null
  left join trip_dive_stats      trds on tr.id = trds.trip_id
  left join operators            trop on tr.operator_id = trop.id
  left join operator_dive_stats  tros on tr.operator_id = tros.operator_id
@@ -367,6 +412,7 @@ inner join (
  left join currencies           trou on troc.currency_id = trou.id
  left join currencies           trcu on tr.currency_id = trcu.id
  left join certifications       ce   on dv.certification_id = ce.id
+                                    and ce.deleted_at is null
  left join cert_dive_stats      ceds on ce.id = ceds.certification_id
  left join agency_courses       ceac on ce.course_id = ceac.id
  left join agencies             ceag on ceac.agency_id = ceag.id
@@ -390,6 +436,7 @@ inner join (
  left join gas_mixes            gm   on dv.gas_mix_id = gm.id
  left join entry_points         ep   on dv.entry_point_id = ep.id
      where dv.owner_id = $1
+       and dv.deleted_at is null
 `
 
 func diveFromDBRow(rs RowScanner, totalRecords *int, dv *Dive) error {
@@ -715,6 +762,7 @@ func diveFromDBRow(rs RowScanner, totalRecords *int, dv *Dive) error {
 
 		&dv.Rating,
 		&dv.Notes,
+		&dv.HasProfile,
 	)
 
 	if err != nil {
@@ -786,16 +834,18 @@ func NewDiveModel(
 // adjustDiveTimeZone takes a time.Time d which can be in any time.Location and
 // adjusts it so that it represents the same time (i.e. without adjusting the
 // clock value), but in the Location of the DiveSite ID given in siteID, then
-// converted to UTC for storing in a database.
+// converted to UTC for storing in a database. The dive site is read using db so
+// that a site created earlier in the same transaction can be used.
 func (m *DiveModel) adjustDiveTimeZone(
 	ctx context.Context,
+	db sqlRowQuerier,
 	d time.Time,
 	siteID int,
 ) (time.Time, error) {
 	var siteTZStr string
 	siteTZQuery := "select timezone from dive_sites where id = $1"
 
-	err := m.DB.QueryRowContext(ctx, siteTZQuery, siteID).Scan(&siteTZStr)
+	err := db.QueryRowContext(ctx, siteTZQuery, siteID).Scan(&siteTZStr)
 	if err != nil {
 		errMsg := "failed to get dive site (id %d) time zone: %w"
 		return time.Time{}, fmt.Errorf(errMsg, siteID, err)
@@ -820,6 +870,76 @@ func (m *DiveModel) adjustDiveTimeZone(
 	return adjustedDate.UTC(), err
 }
 
+// ExistsAt checks whether the owner has already logged a dive at the given dive
+// site starting at the same wall-clock time as dateTimeIn in the dive site's
+// time zone.
+func (m *DiveModel) ExistsAt(ownerID, diveSiteID int, dateTimeIn time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	dateTimeIn, err := m.adjustDiveTimeZone(ctx, m.DB, dateTimeIn, diveSiteID)
+	if err != nil {
+		return false, err
+	}
+
+	stmt := `
+        select exists(
+            select 1
+              from dives
+             where owner_id = $1
+               and dive_site_id = $2
+               and date_time_in = $3
+               and deleted_at is null
+        )
+    `
+
+	var exists bool
+	err = m.DB.QueryRowContext(ctx, stmt, ownerID, diveSiteID, dateTimeIn).Scan(&exists)
+
+	return exists, err
+}
+
+// ExistsAtTime checks whether the owner has already logged a dive at any dive
+// site with the given date and time in. As the dive site is not known, the
+// wall clock of dateTimeIn is compared with the wall clock of each dive in the
+// time zone of its own dive site, to the minute.
+func (m *DiveModel) ExistsAtTime(ownerID int, dateTimeIn time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	stmt := `
+        select exists(
+            select 1
+              from dives dv
+              join dive_sites ds on ds.id = dv.dive_site_id
+             where dv.owner_id = $1
+               and dv.deleted_at is null
+               and date_trunc('minute', dv.date_time_in at time zone ds.timezone)
+                   = date_trunc('minute', $2::timestamp)
+        )
+    `
+
+	var exists bool
+	wallClock := dateTimeIn.Format(time.DateTime)
+	err := m.DB.QueryRowContext(ctx, stmt, ownerID, wallClock).Scan(&exists)
+
+	return exists, err
+}
+
+// NumberExists checks whether the owner has already logged a dive with the
+// given dive number.
+func (m *DiveModel) NumberExists(ownerID, number int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	stmt := "select exists(select 1 from dives where owner_id = $1 and number = $2)"
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, stmt, ownerID, number).Scan(&exists)
+
+	return exists, err
+}
+
 func (m *DiveModel) GetOneByID(ownerID, id int) (Dive, error) {
 	stmt := fmt.Sprintf("%s and dv.id = $2", diveSelectQuery)
 	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
@@ -848,9 +968,58 @@ func (m *DiveModel) GetOneByID(ownerID, id int) (Dive, error) {
 		return Dive{}, err
 	}
 
+	dive.Profile, err = getDiveProfile(ctx, m.DB, id)
+	if err != nil {
+		return Dive{}, err
+	}
+
 	return dive, nil
 }
 
+// DiveFields holds the values of a single dive as given to InsertMany. The
+// fields correspond to the arguments of Insert, apart from Profile which holds
+// any samples to store with the dive. If it is given, then the dive's depths
+// and bottom time are derived from it.
+type DiveFields struct {
+	Number              int
+	Activity            string
+	DiveSiteID          int
+	OperatorID          *int
+	PriceAmount         *float64
+	PriceCurrencyID     *int
+	TripID              *int
+	CertificationID     *int
+	DateTimeIn          time.Time
+	MaxDepth            float64
+	AvgDepth            *float64
+	BottomTime          time.Duration
+	SafetyStop          *time.Duration
+	WaterTemp           *int
+	AirTemp             *int
+	Visibility          *float64
+	CurrentID           *int
+	WavesID             *int
+	BuddyID             *int
+	BuddyRoleID         *int
+	Weight              *float64
+	WeightNotes         string
+	EquipmentIDs        []int
+	EquipmentNotes      string
+	TankConfigurationID int
+	TankMaterialID      int
+	TankVolume          float64
+	GasMixID            int
+	FO2                 float64
+	PressureIn          *int
+	PressureOut         *int
+	GasMixNotes         string
+	EntryPointID        int
+	PropertyIDs         []int
+	Rating              *int
+	Notes               string
+	Profile             DiveProfile
+}
+
 func (m *DiveModel) Insert(
 	ownerID int,
 	number int,
@@ -893,19 +1062,107 @@ func (m *DiveModel) Insert(
 	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Complex)
 	defer cancel()
 
-	// Adjust the dateTimeIn so that it is in the same Location as the
-	// diveSiteID and converted to UTC.
-	dateTimeIn, err := m.adjustDiveTimeZone(ctx, dateTimeIn, diveSiteID)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	diveID, err := m.insertTx(ctx, tx, ownerID, DiveFields{
+		Number:              number,
+		Activity:            activity,
+		DiveSiteID:          diveSiteID,
+		OperatorID:          operatorID,
+		PriceAmount:         priceAmount,
+		PriceCurrencyID:     priceCurrencyID,
+		TripID:              tripID,
+		CertificationID:     certificationID,
+		DateTimeIn:          dateTimeIn,
+		MaxDepth:            maxDepth,
+		AvgDepth:            avgDepth,
+		BottomTime:          bottomTime,
+		SafetyStop:          safetyStop,
+		WaterTemp:           waterTemp,
+		AirTemp:             airTemp,
+		Visibility:          visibility,
+		CurrentID:           currentID,
+		WavesID:             wavesID,
+		BuddyID:             buddyID,
+		BuddyRoleID:         buddyRoleID,
+		Weight:              weight,
+		WeightNotes:         weightNotes,
+		EquipmentIDs:        equipmentIDs,
+		EquipmentNotes:      equipmentNotes,
+		TankConfigurationID: tankConfigurationID,
+		TankMaterialID:      tankMaterialID,
+		TankVolume:          tankVolume,
+		GasMixID:            gasMixID,
+		FO2:                 fo2,
+		PressureIn:          pressureIn,
+		PressureOut:         pressureOut,
+		GasMixNotes:         gasMixNotes,
+		EntryPointID:        entryPointID,
+		PropertyIDs:         propertyIDs,
+		Rating:              rating,
+		Notes:               notes,
+	})
 	if err != nil {
 		return 0, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return diveID, nil
+}
+
+// InsertMany inserts all of the given dives in a single transaction, so either
+// every dive is inserted or none of them are. The IDs of the new dives are
+// returned in the same order as the dives were given.
+func (m *DiveModel) InsertMany(ownerID int, dives []DiveFields) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Bulk)
+	defer cancel()
+
 	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to start db transaction: %w", err)
+		return nil, fmt.Errorf("failed to start db transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	ids := make([]int, 0, len(dives))
+	for _, dive := range dives {
+		id, err := m.insertTx(ctx, tx, ownerID, dive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert dive number %d: %w", dive.Number, err)
+		}
+		ids = append(ids, id)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return ids, nil
+}
+
+// insertTx inserts a single dive along with its equipment and properties as
+// part of the transaction tx.
+func (m *DiveModel) insertTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	ownerID int,
+	d DiveFields,
+) (int, error) {
+	// Adjust the dateTimeIn so that it is in the same Location as the
+	// diveSiteID and converted to UTC.
+	dateTimeIn, err := m.adjustDiveTimeZone(ctx, tx, d.DateTimeIn, d.DiveSiteID)
+	if err != nil {
+		return 0, err
+	}
+
 	stmt := `
         insert into dives (
             owner_id, number, activity, dive_site_id, operator_id, price,
@@ -924,8 +1181,8 @@ func (m *DiveModel) Insert(
     `
 
 	var safetyStopNanos *int64
-	if safetyStop != nil {
-		ss := safetyStop.Nanoseconds()
+	if d.SafetyStop != nil {
+		ss := d.SafetyStop.Nanoseconds()
 		safetyStopNanos = &ss
 	}
 
@@ -933,40 +1190,40 @@ func (m *DiveModel) Insert(
 		ctx,
 		stmt,
 		ownerID,
-		number,
-		activity,
-		diveSiteID,
-		operatorID,
-		priceAmount,
-		priceCurrencyID,
-		tripID,
-		certificationID,
+		d.Number,
+		d.Activity,
+		d.DiveSiteID,
+		d.OperatorID,
+		d.PriceAmount,
+		d.PriceCurrencyID,
+		d.TripID,
+		d.CertificationID,
 		dateTimeIn,
-		maxDepth,
-		avgDepth,
-		bottomTime.Nanoseconds(),
+		d.MaxDepth,
+		d.AvgDepth,
+		d.BottomTime.Nanoseconds(),
 		safetyStopNanos,
-		waterTemp,
-		airTemp,
-		visibility,
-		currentID,
-		wavesID,
-		buddyID,
-		buddyRoleID,
-		weight,
-		weightNotes,
-		equipmentNotes,
-		tankConfigurationID,
-		tankMaterialID,
-		tankVolume,
-		gasMixID,
-		fo2,
-		pressureIn,
-		pressureOut,
-		gasMixNotes,
-		entryPointID,
-		rating,
-		notes,
+		d.WaterTemp,
+		d.AirTemp,
+		d.Visibility,
+		d.CurrentID,
+		d.WavesID,
+		d.BuddyID,
+		d.BuddyRoleID,
+		d.Weight,
+		d.WeightNotes,
+		d.EquipmentNotes,
+		d.TankConfigurationID,
+		d.TankMaterialID,
+		d.TankVolume,
+		d.GasMixID,
+		d.FO2,
+		d.PressureIn,
+		d.PressureOut,
+		d.GasMixNotes,
+		d.EntryPointID,
+		d.Rating,
+		d.Notes,
 	)
 
 	var diveID int
@@ -987,7 +1244,7 @@ func (m *DiveModel) Insert(
 		"dive_id",
 		"equipment_id",
 		diveID,
-		equipmentIDs,
+		d.EquipmentIDs,
 	)
 
 	if err != nil {
@@ -1001,16 +1258,18 @@ func (m *DiveModel) Insert(
 		"dive_id",
 		"property_id",
 		diveID,
-		propertyIDs,
+		d.PropertyIDs,
 	)
 
 	if err != nil {
 		return 0, err
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return 0, fmt.Errorf("failed to commit db transaction: %w", err)
+	if len(d.Profile) > 0 {
+		err = replaceDiveProfile(ctx, tx, diveID, d.Profile)
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	return diveID, nil
@@ -1019,6 +1278,7 @@ func (m *DiveModel) Insert(
 func (m *DiveModel) Update(
 	id int,
 	ownerID int,
+	version int,
 	number int,
 	activity string,
 	diveSiteID int,
@@ -1061,7 +1321,7 @@ func (m *DiveModel) Update(
 
 	// Adjust the dateTimeIn so that it is in the same Location as the
 	// diveSiteID and converted to UTC.
-	dateTimeIn, err := m.adjustDiveTimeZone(ctx, dateTimeIn, diveSiteID)
+	dateTimeIn, err := m.adjustDiveTimeZone(ctx, m.DB, dateTimeIn, diveSiteID)
 	if err != nil {
 		return err
 	}
@@ -1074,20 +1334,22 @@ func (m *DiveModel) Update(
 
 	stmt := `
         update dives
-           set version = version + 1, updated_at = now(), number = $3,
-               activity = $4, dive_site_id = $5, operator_id = $6, price = $7,
-               currency_id = $8, trip_id = $9, certification_id = $10,
-               date_time_in = $11, max_depth = $12, avg_depth = $13,
-               bottom_time = $14, safety_stop = $15, water_temp = $16,
-               air_temp = $17, visibility = $18, current_id = $19,
-               waves_id = $20, buddy_id = $21, buddy_role_id = $22,
-               weight_used = $23, weight_notes = $24, equipment_notes = $25,
-               tank_configuration_id = $26, tank_material_id = $27,
-               tank_volume = $28, gas_mix_id = $29, fo2 = $30,
-               pressure_in = $31, pressure_out = $32, gas_mix_notes = $33,
-               entry_point_id = $34, rating = $35, notes = $36
+           set version = version + 1, updated_at = now(), number = $4,
+               activity = $5, dive_site_id = $6, operator_id = $7, price = $8,
+               currency_id = $9, trip_id = $10, certification_id = $11,
+               date_time_in = $12, max_depth = $13, avg_depth = $14,
+               bottom_time = $15, safety_stop = $16, water_temp = $17,
+               air_temp = $18, visibility = $19, current_id = $20,
+               waves_id = $21, buddy_id = $22, buddy_role_id = $23,
+               weight_used = $24, weight_notes = $25, equipment_notes = $26,
+               tank_configuration_id = $27, tank_material_id = $28,
+               tank_volume = $29, gas_mix_id = $30, fo2 = $31,
+               pressure_in = $32, pressure_out = $33, gas_mix_notes = $34,
+               entry_point_id = $35, rating = $36, notes = $37
          where id = $1
            and owner_id = $2
+           and version = $3
+           and deleted_at is null
     `
 
 	var safetyStopNanos *int64
@@ -1101,6 +1363,7 @@ func (m *DiveModel) Update(
 		stmt,
 		id,
 		ownerID,
+		version,
 		number,
 		activity,
 		diveSiteID,
@@ -1149,7 +1412,7 @@ func (m *DiveModel) Update(
 	rowsAffected, err := result.RowsAffected()
 	if err != nil || rowsAffected != 1 {
 		if rowsAffected == 0 {
-			return ErrNoRecord
+			return updateConflictOrNoRecord(ctx, tx, "dives", id, ownerID)
 		} else if rowsAffected > 1 {
 			return &ErrUnexpectedRowsAffected{rowsExpected: 1, rowsAffected: int(rowsAffected)}
 		}
@@ -1185,6 +1448,20 @@ func (m *DiveModel) Update(
 		return err
 	}
 
+	// The depths and bottom time of a dive with a profile are always derived
+	// from it, regardless of the values given.
+	profile, err := getDiveProfile(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	if len(profile) > 0 {
+		err = updateDiveFromProfile(ctx, tx, id, profile)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		msg := "failed to commit db transaction to update dive %d: %w"
@@ -1194,12 +1471,231 @@ func (m *DiveModel) Update(
 	return nil
 }
 
+// DiveBulkChanges are the changes to make to every dive in a bulk edit. Only
+// the fields whose Set flag is true are changed, so setting SetTrip with a nil
+// TripID takes the dives off their trips whereas leaving SetTrip false leaves
+// their trips alone. EquipmentIDs and PropertyIDs replace the dives' existing
+// equipment and properties.
+type DiveBulkChanges struct {
+	SetTrip       bool
+	TripID        *int
+	SetOperator   bool
+	OperatorID    *int
+	SetBuddy      bool
+	BuddyID       *int
+	BuddyRoleID   *int
+	SetEquipment  bool
+	EquipmentIDs  []int
+	SetProperties bool
+	PropertyIDs   []int
+}
+
+// IsEmpty returns true if none of the fields are to be changed.
+func (c DiveBulkChanges) IsEmpty() bool {
+	return !c.SetTrip && !c.SetOperator && !c.SetBuddy && !c.SetEquipment && !c.SetProperties
+}
+
+// DiveVersion identifies a dive along with the version of it that the user saw
+// when they chose to edit it.
+type DiveVersion struct {
+	ID      int
+	Version int
+}
+
+// DiveBulkResult is the outcome of a bulk edit for a single dive. Err is nil if
+// the dive was updated, otherwise it is typically ErrUpdateConflict if the dive
+// has changed since the user saw it or ErrNoRecord if it no longer exists.
+type DiveBulkResult struct {
+	ID  int
+	Err error
+}
+
+// BulkUpdate makes the same changes to each of the user's dives in a single
+// transaction and returns the outcome for each dive in the same order. Each
+// dive is updated within its own savepoint so that a failure for one of them
+// does not undo the others. If allOrNothing is true though, then the whole
+// transaction is rolled back if any dive fails, in which case none of the dives
+// are updated even if their results have no error. The returned error is only
+// set if the transaction itself fails.
+func (m *DiveModel) BulkUpdate(
+	ownerID int,
+	dives []DiveVersion,
+	changes DiveBulkChanges,
+	allOrNothing bool,
+) ([]DiveBulkResult, error) {
+	// $1, $2 and $3 are the ID, owner ID and version of each dive in turn.
+	sets := []string{"version = version + 1", "updated_at = now()"}
+	changeArgs := []any{}
+	set := func(col string, value any) {
+		changeArgs = append(changeArgs, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", col, len(changeArgs)+3))
+	}
+
+	if changes.SetTrip {
+		set("trip_id", changes.TripID)
+	}
+	if changes.SetOperator {
+		set("operator_id", changes.OperatorID)
+	}
+	if changes.SetBuddy {
+		set("buddy_id", changes.BuddyID)
+		set("buddy_role_id", changes.BuddyRoleID)
+	}
+
+	stmt := fmt.Sprintf(`
+        update dives
+           set %s
+         where id = $1
+           and owner_id = $2
+           and version = $3
+           and deleted_at is null
+    `, strings.Join(sets, ", "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Bulk)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	results := make([]DiveBulkResult, 0, len(dives))
+	failed := false
+
+	for _, dive := range dives {
+		_, err := tx.ExecContext(ctx, "savepoint bulk_update_dive")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create savepoint for dive %d: %w", dive.ID, err)
+		}
+
+		args := append([]any{dive.ID, ownerID, dive.Version}, changeArgs...)
+		err = m.bulkUpdateOne(ctx, tx, ownerID, dive.ID, stmt, args, changes)
+		if err != nil {
+			failed = true
+
+			_, rbErr := tx.ExecContext(ctx, "rollback to savepoint bulk_update_dive")
+			if rbErr != nil {
+				msg := "failed to roll back to savepoint for dive %d: %w"
+				return nil, fmt.Errorf(msg, dive.ID, rbErr)
+			}
+		} else {
+			_, err := tx.ExecContext(ctx, "release savepoint bulk_update_dive")
+			if err != nil {
+				return nil, fmt.Errorf("failed to release savepoint for dive %d: %w", dive.ID, err)
+			}
+		}
+
+		results = append(results, DiveBulkResult{ID: dive.ID, Err: err})
+	}
+
+	if failed && allOrNothing {
+		return results, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction to bulk update dives: %w", err)
+	}
+
+	return results, nil
+}
+
+// bulkUpdateOne applies a bulk edit to a single dive within tx, where stmt and
+// args update the dive's own columns.
+func (m *DiveModel) bulkUpdateOne(
+	ctx context.Context,
+	tx *sql.Tx,
+	ownerID, id int,
+	stmt string,
+	args []any,
+	changes DiveBulkChanges,
+) error {
+	result, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update dive %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case rowsAffected == 0:
+		return updateConflictOrNoRecord(ctx, tx, "dives", id, ownerID)
+	case rowsAffected > 1:
+		return &ErrUnexpectedRowsAffected{rowsExpected: 1, rowsAffected: int(rowsAffected)}
+	}
+
+	if changes.SetEquipment {
+		err = upsertManyToManyIDs(
+			ctx,
+			tx,
+			"dive_equipment",
+			"dive_id",
+			"equipment_id",
+			id,
+			changes.EquipmentIDs,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if changes.SetProperties {
+		err = upsertManyToManyIDs(
+			ctx,
+			tx,
+			"dive_dive_properties",
+			"dive_id",
+			"property_id",
+			id,
+			changes.PropertyIDs,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DiveFilter restricts a list of dives to those matching every one of its
+// non-zero fields. NumberFrom and NumberTo give an inclusive range of dive
+// numbers. DateFrom and DateTo, if set, restrict the dives to those that
+// started on or after the date of DateFrom and before the date of DateTo in the
+// local time of the dive site, so their time and time zone are ignored. The
+// other From and To pairs are also inclusive ranges.
+//
+// CountryID, WaterBodyID and WaterTypeID match the dives' sites. A dive matches
+// PropertyIDs if it has any of them or, if AllProperties is true, all of them,
+// whereas it matches EquipmentIDs if it used any of them. Notes matches dives
+// whose notes contain it, ignoring case.
 type DiveFilter struct {
 	ID              int
 	DiveSiteID      int
 	OperatorID      int
 	CertificationID int
 	TripID          int
+	BuddyID         int
+	NumberFrom      int
+	NumberTo        int
+	DateFrom        *time.Time
+	DateTo          *time.Time
+	MaxDepthFrom    float64
+	MaxDepthTo      float64
+	BottomTimeFrom  time.Duration
+	BottomTimeTo    time.Duration
+	CountryID       int
+	WaterBodyID     int
+	WaterTypeID     int
+	GasMixID        int
+	PropertyIDs     []int
+	AllProperties   bool
+	EquipmentIDs    []int
+	MinRating       int
+	Notes           string
 }
 
 func (df DiveFilter) buildWhereClause() string {
@@ -1210,34 +1706,103 @@ func (df DiveFilter) buildWhereClause() string {
 	clause.WriteString(" and ($4 = 0 or dv.operator_id = $4)")
 	clause.WriteString(" and ($5 = 0 or dv.trip_id = $5)")
 	clause.WriteString(" and ($6 = 0 or dv.certification_id = $6)")
+	clause.WriteString(" and ($7 = 0 or dv.number >= $7)")
+	clause.WriteString(" and ($8 = 0 or dv.number <= $8)")
+	clause.WriteString(" and ($9 = 0 or dv.buddy_id = $9)")
+	// The dates are compared with the local time of each dive at its site.
+	clause.WriteString(`
+        and ($10::date is null or dv.date_time_in >= $10::date::timestamp at time zone ds.timezone)`)
+	clause.WriteString(`
+        and ($11::date is null or dv.date_time_in < $11::date::timestamp at time zone ds.timezone)`)
+	clause.WriteString(" and ($12::numeric = 0 or dv.max_depth >= $12)")
+	clause.WriteString(" and ($13::numeric = 0 or dv.max_depth <= $13)")
+	clause.WriteString(" and ($14::bigint = 0 or dv.bottom_time >= $14)")
+	clause.WriteString(" and ($15::bigint = 0 or dv.bottom_time <= $15)")
+	clause.WriteString(" and ($16 = 0 or ds.country_id = $16)")
+	clause.WriteString(" and ($17 = 0 or ds.water_body_id = $17)")
+	clause.WriteString(" and ($18 = 0 or ds.water_type_id = $18)")
+	clause.WriteString(" and ($19 = 0 or dv.gas_mix_id = $19)")
+	clause.WriteString(`
+        and (coalesce(cardinality($20::integer[]), 0) = 0 or (
+            select count(distinct ddp.property_id)
+              from dive_dive_properties ddp
+             where ddp.dive_id = dv.id
+               and ddp.property_id = any($20)
+        ) >= case when $21::boolean then cardinality($20::integer[]) else 1 end)`)
+	clause.WriteString(`
+        and (coalesce(cardinality($22::integer[]), 0) = 0 or exists (
+            select 1
+              from dive_equipment de
+             where de.dive_id = dv.id
+               and de.equipment_id = any($22)
+        ))`)
+	clause.WriteString(" and ($23 = 0 or dv.rating >= $23)")
+	clause.WriteString(" and ($24::text = '' or strpos(lower(dv.notes), lower($24)) > 0)")
 
 	return clause.String()
 }
 
+// args returns the arguments for the query built with buildWhereClause, which
+// start with the user's ID.
+func (df DiveFilter) args(userID int) []any {
+	return []any{
+		userID,
+		df.ID,
+		df.DiveSiteID,
+		df.OperatorID,
+		df.TripID,
+		df.CertificationID,
+		df.NumberFrom,
+		df.NumberTo,
+		df.BuddyID,
+		dateOnly(df.DateFrom),
+		dateOnly(df.DateTo),
+		df.MaxDepthFrom,
+		df.MaxDepthTo,
+		df.BottomTimeFrom.Nanoseconds(),
+		df.BottomTimeTo.Nanoseconds(),
+		df.CountryID,
+		df.WaterBodyID,
+		df.WaterTypeID,
+		df.GasMixID,
+		pq.Array(df.PropertyIDs),
+		df.AllProperties,
+		pq.Array(df.EquipmentIDs),
+		df.MinRating,
+		df.Notes,
+	}
+}
+
+// dateOnly returns the date of t in the format 2006-01-02, or nil if t is nil.
+func dateOnly(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+
+	return t.Format(time.DateOnly)
+}
+
 func (m *DiveModel) List(
 	userID int,
 	pager Pager,
 	filter DiveFilter,
 	sort []SortDive,
 ) ([]Dive, PageData, error) {
+	args := append(filter.args(userID), pager.limit(), pager.offset())
 	where := filter.buildWhereClause()
 	order := buildOrderByClause(sort, SortDiveIDAsc)
-	stmt := fmt.Sprintf("%s %s %s limit $7 offset $8", diveSelectQuery, where, order)
+	stmt := fmt.Sprintf(
+		"%s %s %s limit $%d offset $%d",
+		diveSelectQuery,
+		where,
+		order,
+		len(args)-1,
+		len(args),
+	)
 	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(
-		ctx,
-		stmt,
-		userID,
-		filter.ID,
-		filter.DiveSiteID,
-		filter.OperatorID,
-		filter.TripID,
-		filter.CertificationID,
-		pager.limit(),
-		pager.offset(),
-	)
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
 	if err != nil {
 		return nil, PageData{}, err
 	}
@@ -1267,3 +1832,181 @@ func (m *DiveModel) List(
 
 	return records, paginationData, nil
 }
+
+// diveStreamBatchSize is the number of dives that StreamAll reads before
+// fetching their equipment and properties.
+const diveStreamBatchSize = 500
+
+// ListAll returns every one of the user's dives that match the filter without
+// any pagination, including each dive's equipment and properties. It is
+// intended for exporting a log book and so uses the Bulk query timeout.
+func (m *DiveModel) ListAll(userID int, filter DiveFilter, sort []SortDive) ([]Dive, error) {
+	records := []Dive{}
+
+	err := m.StreamAll(userID, filter, sort, func(dive Dive) error {
+		records = append(records, dive)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// StreamAll works in the same way as ListAll, but rather than returning the
+// dives, fn is called with each one in turn as it is read from the database
+// so that large log books do not need to be held in memory. If fn returns an
+// error, then streaming stops and that error is returned.
+func (m *DiveModel) StreamAll(
+	userID int,
+	filter DiveFilter,
+	sort []SortDive,
+	fn func(Dive) error,
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Bulk)
+	defer cancel()
+
+	equipment, err := m.equipmentModel.List()
+	if err != nil {
+		return err
+	}
+
+	properties, err := m.propertyModel.List()
+	if err != nil {
+		return err
+	}
+
+	where := filter.buildWhereClause()
+	order := buildOrderByClause(sort, SortDiveIDAsc)
+	stmt := fmt.Sprintf("%s %s %s", diveSelectQuery, where, order)
+
+	rows, err := m.DB.QueryContext(ctx, stmt, filter.args(userID)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// The equipment and properties are fetched for a batch of dives at a time
+	// rather than running two further queries for every dive.
+	batch := make([]Dive, 0, diveStreamBatchSize)
+	flush := func() error {
+		err := m.addDiveLinks(ctx, batch, equipment, properties)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range batch {
+			err := fn(record)
+			if err != nil {
+				return err
+			}
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	var totalRecords int
+	for rows.Next() {
+		var record Dive
+		err := diveFromDBRow(rows, &totalRecords, &record)
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, record)
+		if len(batch) == diveStreamBatchSize {
+			err := flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// addDiveLinks sets the equipment and properties of each of the dives from
+// the full lists of them.
+func (m *DiveModel) addDiveLinks(
+	ctx context.Context,
+	dives []Dive,
+	equipment []Equipment,
+	properties []DiveProperty,
+) error {
+	if len(dives) == 0 {
+		return nil
+	}
+
+	diveIDs := make([]int, len(dives))
+	for i, dive := range dives {
+		diveIDs[i] = dive.ID
+	}
+
+	equipmentIDs, err := m.linkedIDsByDive(ctx, diveIDs, "dive_equipment", "equipment_id")
+	if err != nil {
+		return err
+	}
+
+	propertyIDs, err := m.linkedIDsByDive(ctx, diveIDs, "dive_dive_properties", "property_id")
+	if err != nil {
+		return err
+	}
+
+	for i := range dives {
+		dives[i].Equipment = []Equipment{}
+		for _, item := range equipment {
+			if slices.Contains(equipmentIDs[dives[i].ID], item.ID) {
+				dives[i].Equipment = append(dives[i].Equipment, item)
+			}
+		}
+
+		dives[i].Properties = []DiveProperty{}
+		for _, item := range properties {
+			if slices.Contains(propertyIDs[dives[i].ID], item.ID) {
+				dives[i].Properties = append(dives[i].Properties, item)
+			}
+		}
+	}
+
+	return nil
+}
+
+// linkedIDsByDive returns the IDs from childCol of the given many-to-many
+// intermediateTable for each of the dives, keyed by dive ID. The table and
+// column names must not come from user input.
+func (m *DiveModel) linkedIDsByDive(
+	ctx context.Context,
+	diveIDs []int,
+	intermediateTable, childCol string,
+) (map[int][]int, error) {
+	stmt := fmt.Sprintf(`
+            select it.dive_id, it.%s
+              from %s it
+             where it.dive_id = any($1)
+    `, childCol, intermediateTable)
+
+	rows, err := m.DB.QueryContext(ctx, stmt, pq.Array(diveIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", intermediateTable, err)
+	}
+	defer rows.Close()
+
+	ids := map[int][]int{}
+	for rows.Next() {
+		var diveID, childID int
+		err := rows.Scan(&diveID, &childID)
+		if err != nil {
+			return nil, err
+		}
+		ids[diveID] = append(ids[diveID], childID)
+	}
+
+	return ids, rows.Err()
+}
@@ -7,10 +7,12 @@ import (
 
 var (
 	ErrUpdateConflict      = errors.New("models: conflict during update")
+	ErrDeleteBlocked       = errors.New("models: record is referred to by other records")
 	ErrDuplicateDiveNumber = errors.New("models: duplicate dive number for user")
 	ErrDuplicateEmail      = errors.New("models: duplicate email")
 	ErrInvalidCredentials  = errors.New("models: invalid credentials")
 	ErrNoRecord            = errors.New("models: no matching record found")
+	ErrRestoreBlocked      = errors.New("models: record refers to records in the trash")
 )
 
 type ErrUnexpectedRowsAffected struct {
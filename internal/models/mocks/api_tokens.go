@@ -0,0 +1,67 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+// The API tokens of the mock user with ID 1.
+const (
+	apiTokenRead      = "PZ6RLWQ4YKXH3TBJ5FNAVD2ME7"
+	apiTokenReadWrite = "K3MWQ7TZX5RB2NHJVLY4GFD6AE"
+)
+
+var apiTokenScript = models.APIToken{
+	ID:      1,
+	Created: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+	OwnerID: 1,
+	Name:    "Backup script",
+	Scope:   models.APITokenScopeRead,
+}
+
+var apiTokenSync = models.APIToken{
+	ID:      2,
+	Created: time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC),
+	OwnerID: 1,
+	Name:    "Dive computer sync",
+	Scope:   models.APITokenScopeReadWrite,
+}
+
+type APITokenModel struct{}
+
+func (m *APITokenModel) Authenticate(token string) (models.APIToken, error) {
+	switch token {
+	case apiTokenRead:
+		return apiTokenScript, nil
+	case apiTokenReadWrite:
+		return apiTokenSync, nil
+	default:
+		return models.APIToken{}, models.ErrNoRecord
+	}
+}
+
+func (m *APITokenModel) Delete(ownerID, id int) error {
+	if ownerID == 1 && (id == 1 || id == 2) {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *APITokenModel) Insert(
+	ownerID int,
+	name string,
+	scope models.APITokenScope,
+	expires *time.Time,
+) (string, error) {
+	return apiTokenReadWrite, nil
+}
+
+func (m *APITokenModel) ListAll(ownerID int) ([]models.APIToken, error) {
+	if ownerID == 1 {
+		return []models.APIToken{apiTokenSync, apiTokenScript}, nil
+	}
+
+	return nil, nil
+}
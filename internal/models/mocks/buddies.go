@@ -29,6 +29,10 @@ func (m *BuddyModel) Exists(id int) (bool, error) {
 	return id == 1, nil
 }
 
+func (m *BuddyModel) ExistsActive(id, ownerID int) (bool, error) {
+	return id == 1, nil
+}
+
 func (m *BuddyModel) Insert(
 	ownerID int,
 	name string,
@@ -41,6 +45,36 @@ func (m *BuddyModel) Insert(
 	return 2, nil
 }
 
+func (m *BuddyModel) Update(
+	id int,
+	ownerID int,
+	version int,
+	name string,
+	emailAddress string,
+	phoneNumber string,
+	agencyID *int,
+	agencyMemberNum string,
+	notes string,
+) error {
+	switch {
+	case id == 1 && version == 2:
+		return models.ErrUpdateConflict
+	case id == 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *BuddyModel) GetOneByID(id, ownerID int) (models.Buddy, error) {
+	switch id {
+	case 1:
+		return buddyJohnSmith, nil
+	default:
+		return models.Buddy{}, models.ErrNoRecord
+	}
+}
+
 func (m *BuddyModel) List(
 	userID int,
 	pager models.Pager,
@@ -7,20 +7,31 @@ import (
 )
 
 var certificationBSACOceanDiver = models.Certification{
-	ID:        1,
-	Created:   time.Now(),
-	Updated:   time.Now(),
-	OwnerID:   1,
-	Dives:     1,
-	FirstDive: &diveDate,
-	LastDive:  &diveDate,
-	Course:    agencyCourseBSACOceanDiver,
-	StartDate: time.Date(2020, time.January, 19, 0, 0, 0, 0, &timeZoneBangkok.Location),
-	EndDate:   time.Date(2020, time.January, 22, 0, 0, 0, 0, &timeZoneBangkok.Location),
-	Rating:    &ratingSix,
-	Operator:  operatorBigBubbles,
-	Price:     &price1000AED,
-	Notes:     "First introduction to diving.",
+	ID:         1,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	OwnerID:    1,
+	Dives:      1,
+	FirstDive:  &diveDate,
+	LastDive:   &diveDate,
+	Course:     agencyCourseBSACOceanDiver,
+	StartDate:  time.Date(2020, time.January, 19, 0, 0, 0, 0, &timeZoneBangkok.Location),
+	EndDate:    time.Date(2020, time.January, 22, 0, 0, 0, 0, &timeZoneBangkok.Location),
+	Rating:     &ratingSix,
+	Operator:   operatorBigBubbles,
+	Instructor: buddyJohnSmith,
+	Price:      &price1000AED,
+	Notes:      "First introduction to diving.",
+}
+
+// The mock certification with ID 1 has an image of the front of its card, but
+// not of the back.
+var certificationCardFront = models.CertificationCard{
+	CertificationID: 1,
+	Side:            models.CardFront,
+	Created:         time.Now(),
+	StorageKey:      "certifications/1/1/front",
+	ContentType:     "image/png",
 }
 
 type CertificationModel struct{}
@@ -29,6 +40,10 @@ func (m *CertificationModel) Exists(id int) (bool, error) {
 	return id == 1, nil
 }
 
+func (m *CertificationModel) ExistsActive(id, ownerID int) (bool, error) {
+	return id == 1, nil
+}
+
 func (m *CertificationModel) Insert(
 	ownerID int,
 	courseID int,
@@ -44,6 +59,35 @@ func (m *CertificationModel) Insert(
 	return 2, nil
 }
 
+func (m *CertificationModel) Update(
+	id int,
+	ownerID int,
+	courseID int,
+	startDate time.Time,
+	endDate time.Time,
+	operatorID int,
+	instructorID int,
+	priceAmount *float64,
+	priceCurrencyID *int,
+	rating *int,
+	notes string,
+) error {
+	if id == 1 {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *CertificationModel) GetOneByID(id, ownerID int) (models.Certification, error) {
+	switch id {
+	case 1:
+		return certificationBSACOceanDiver, nil
+	default:
+		return models.Certification{}, models.ErrNoRecord
+	}
+}
+
 func (m *CertificationModel) List(
 	userID int,
 	pager models.Pager,
@@ -65,3 +109,31 @@ func (m *CertificationModel) ListAll(
 ) ([]models.Certification, error) {
 	return []models.Certification{certificationBSACOceanDiver}, nil
 }
+
+func (m *CertificationModel) ListCards(id, ownerID int) ([]models.CertificationCard, error) {
+	if id == 1 {
+		return []models.CertificationCard{certificationCardFront}, nil
+	}
+
+	return []models.CertificationCard{}, nil
+}
+
+func (m *CertificationModel) SetCard(
+	id, ownerID int,
+	side models.CardSide,
+	storageKey, contentType string,
+) error {
+	if id == 1 {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *CertificationModel) DeleteCard(id, ownerID int, side models.CardSide) error {
+	if id == 1 && side == models.CardFront {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
@@ -0,0 +1,64 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+var csvMappingSpreadsheet = models.CSVMapping{
+	ID:           1,
+	Created:      time.Now(),
+	Updated:      time.Now(),
+	OwnerID:      1,
+	Name:         "Spreadsheet",
+	Headers:      []string{"No.", "When", "Where", "Depth (ft)", "Mins"},
+	Fields:       []string{"number", "date_time_in", "dive_site", "max_depth", "bottom_time"},
+	DateFormat:   "2/1/2006",
+	DepthUnit:    "ft",
+	TempUnit:     "c",
+	PressureUnit: "bar",
+	WeightUnit:   "kg",
+	DurationUnit: "min",
+}
+
+type CSVMappingModel struct{}
+
+func (m *CSVMappingModel) Delete(ownerID, id int) error {
+	if ownerID == 1 && id == 1 {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *CSVMappingModel) GetOneByID(ownerID, id int) (models.CSVMapping, error) {
+	if ownerID == 1 && id == 1 {
+		return csvMappingSpreadsheet, nil
+	}
+
+	return models.CSVMapping{}, models.ErrNoRecord
+}
+
+func (m *CSVMappingModel) ListAll(ownerID int) ([]models.CSVMapping, error) {
+	if ownerID == 1 {
+		return []models.CSVMapping{csvMappingSpreadsheet}, nil
+	}
+
+	return nil, nil
+}
+
+func (m *CSVMappingModel) Upsert(
+	ownerID int,
+	name string,
+	headers []string,
+	fields []string,
+	dateFormat string,
+	depthUnit string,
+	tempUnit string,
+	pressureUnit string,
+	weightUnit string,
+	durationUnit string,
+) (int, error) {
+	return 2, nil
+}
@@ -65,6 +65,7 @@ func (m *DivePlanModel) Insert(
 func (m *DivePlanModel) Update(
 	id int,
 	ownerID int,
+	version int,
 	name string,
 	notes string,
 	isSoloDive bool,
@@ -81,6 +82,10 @@ func (m *DivePlanModel) Update(
 	stops []models.DivePlanStopInput,
 ) error {
 	if id == 1 {
+		if version == 2 {
+			return models.ErrUpdateConflict
+		}
+
 		return nil
 	}
 
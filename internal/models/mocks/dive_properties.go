@@ -29,7 +29,7 @@ var divePropDecompression = models.DiveProperty{
 type DivePropertyModel struct{}
 
 func (m *DivePropertyModel) AllExist(ids []int) (bool, error) {
-	for id := range ids {
+	for _, id := range ids {
 		if id < 1 || id > 3 {
 			return false, nil
 		}
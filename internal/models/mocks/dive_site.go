@@ -61,6 +61,33 @@ var diveSiteSailRock = models.DiveSite{
 	Rating:    nil,
 }
 
+var diveSiteChumphonPinnacle = models.DiveSite{
+	ID:          2,
+	Version:     1,
+	Created:     time.Now(),
+	Updated:     time.Now(),
+	OwnerId:     1,
+	DivesAt:     2,
+	FirstDiveAt: &diveDate,
+	LastDiveAt:  &diveDate,
+	Name:        "Chumphon Pinnacle",
+	AltName:     "Hin Pee Wee",
+	Location:    "Koh Tao",
+	Region:      "Surat Thani",
+	Country:     countryThailand,
+	TimeZone:    timeZoneBangkok,
+	Latitude:    &chumphonPinnacleLatitude,
+	Longitude:   &chumphonPinnacleLongitude,
+	WaterBody:   waterBodySea,
+	WaterType:   waterTypeSaltWater,
+	Altitude:    0,
+	MaxDepth:    nil,
+	Notes:       "Granite pinnacle with whale sharks.",
+	Rating:      nil,
+}
+
+var chumphonPinnacleLatitude, chumphonPinnacleLongitude = 10.1656, 99.7806
+
 type DiveSiteModel struct{}
 
 func (m *DiveSiteModel) Insert(
@@ -108,7 +135,21 @@ func (m *DiveSiteModel) List(
 }
 
 func (m *DiveSiteModel) ListAll(diverID int) ([]models.DiveSite, error) {
-	return []models.DiveSite{diveSiteSailRock}, nil
+	return []models.DiveSite{diveSiteSailRock, diveSiteChumphonPinnacle}, nil
+}
+
+func (m *DiveSiteModel) ListForDiver(
+	diverID int,
+	filter models.DiveSiteFilter,
+) ([]models.DiveSite, error) {
+	if filter.CountryID != 0 && filter.CountryID != countryThailand.ID {
+		return nil, nil
+	}
+	if filter.WaterBodyID != 0 && filter.WaterBodyID != waterBodySea.ID {
+		return nil, nil
+	}
+
+	return []models.DiveSite{diveSiteSailRock, diveSiteChumphonPinnacle}, nil
 }
 
 func (m *DiveSiteModel) Exists(id int) (bool, error) {
@@ -120,6 +161,10 @@ func (m *DiveSiteModel) Exists(id int) (bool, error) {
 	}
 }
 
+func (m *DiveSiteModel) ExistsActive(id int) (bool, error) {
+	return m.Exists(id)
+}
+
 func (m *DiveSiteModel) Update(
 	id int,
 	version int,
@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"slices"
 	"time"
 
 	"github.com/m5lapp/divesite-monolith/internal/models"
@@ -25,6 +26,12 @@ var (
 	weight8kg       float64       = 8.0
 	pressureIn210   int           = 210
 	pressureOut65   int           = 65
+
+	sampleTemp28      float64 = 28.0
+	samplePressure210 float64 = 210.0
+	samplePressure65  float64 = 65.0
+	sampleCNS5        float64 = 5.0
+	sampleStop3       float64 = 3.0
 )
 
 var dive1 = models.Dive{
@@ -69,10 +76,27 @@ var dive1 = models.Dive{
 	Properties:        []models.DiveProperty{divePropCavern},
 	Rating:            &ratingSix,
 	Notes:             "Great first dive.",
+	Profile: models.DiveProfile{
+		{Elapsed: 0, Depth: 0, Temperature: &sampleTemp28, Pressure: &samplePressure210},
+		{Elapsed: 20 * time.Second, Depth: 17.6, Events: []string{"gaschange 21%"}},
+		{Elapsed: 40 * time.Second, Depth: 5, StopDepth: &sampleStop3},
+		{Elapsed: 45 * time.Second, Depth: 0, Pressure: &samplePressure65, CNS: &sampleCNS5},
+	},
+	HasProfile: true,
 }
 
 type DiveModel struct{}
 
+func (m *DiveModel) ExistsAt(ownerID, diveSiteID int, dateTimeIn time.Time) (bool, error) {
+	sameTime := dateTimeIn.Format(time.DateTime) == dive1.DateTimeIn.Format(time.DateTime)
+	return ownerID == 1 && diveSiteID == dive1.DiveSite.ID && sameTime, nil
+}
+
+func (m *DiveModel) ExistsAtTime(ownerID int, dateTimeIn time.Time) (bool, error) {
+	sameTime := dateTimeIn.Format(time.DateTime) == dive1.DateTimeIn.Format(time.DateTime)
+	return ownerID == 1 && sameTime, nil
+}
+
 func (m *DiveModel) GetDiveStats(userID int) (models.DiveStats, error) {
 	return models.DiveStats{}, nil
 }
@@ -127,9 +151,51 @@ func (m *DiveModel) Insert(
 	return 2, nil
 }
 
+func (m *DiveModel) InsertMany(ownerID int, dives []models.DiveFields) ([]int, error) {
+	ids := make([]int, len(dives))
+	for i := range dives {
+		ids[i] = i + 2
+	}
+	return ids, nil
+}
+
+func (m *DiveModel) Import(ownerID int, batch models.DiveImport) ([]int, []int, error) {
+	ids := make([]int, len(batch.Dives))
+	for i := range batch.Dives {
+		ids[i] = i + 2
+	}
+	return ids, nil, nil
+}
+
+func (m *DiveModel) DeleteProfile(ownerID, diveID int) error {
+	if ownerID == 1 && diveID == 1 {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *DiveModel) GetProfiles(ownerID int, diveIDs []int) (map[int]models.DiveProfile, error) {
+	profiles := map[int]models.DiveProfile{}
+	if ownerID == 1 && slices.Contains(diveIDs, 1) {
+		profiles[1] = dive1.Profile
+	}
+
+	return profiles, nil
+}
+
+func (m *DiveModel) SetProfile(ownerID, diveID int, profile models.DiveProfile) error {
+	if ownerID == 1 && diveID == 1 {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
 func (m *DiveModel) Update(
 	id int,
 	ownerID int,
+	version int,
 	number int,
 	activity string,
 	diveSiteID int,
@@ -167,7 +233,15 @@ func (m *DiveModel) Update(
 	rating *int,
 	notes string,
 ) error {
-	return nil
+	if id == 1 {
+		if version == 2 {
+			return models.ErrUpdateConflict
+		}
+
+		return nil
+	}
+
+	return models.ErrNoRecord
 }
 
 func (m *DiveModel) List(
@@ -178,8 +252,95 @@ func (m *DiveModel) List(
 ) ([]models.Dive, models.PageData, error) {
 	switch userID {
 	case 1:
+		if filter.MaxDepthFrom > dive1.MaxDepth ||
+			(filter.MaxDepthTo != 0 && filter.MaxDepthTo < dive1.MaxDepth) {
+			return []models.Dive{}, models.PageData{}, nil
+		}
 		return []models.Dive{dive1}, models.PageData{}, nil
 	default:
 		return []models.Dive{}, models.PageData{}, nil
 	}
 }
+
+func (m *DiveModel) ListAll(
+	userID int,
+	filter models.DiveFilter,
+	sort []models.SortDive,
+) ([]models.Dive, error) {
+	switch userID {
+	case 1:
+		// As with the real model, profiles are not loaded with the list.
+		listed := dive1
+		listed.Profile = nil
+		return []models.Dive{listed}, nil
+	default:
+		return []models.Dive{}, nil
+	}
+}
+
+func (m *DiveModel) NumberExists(ownerID, number int) (bool, error) {
+	return ownerID == 1 && number == dive1.Number, nil
+}
+
+func (m *DiveModel) StreamAll(
+	userID int,
+	filter models.DiveFilter,
+	sort []models.SortDive,
+	fn func(models.Dive) error,
+) error {
+	if userID == 1 {
+		return fn(dive1)
+	}
+
+	return nil
+}
+
+// BulkUpdate updates dive 1 unless the version given for it is 2, in which case
+// it conflicts. Any other dives do not exist.
+func (m *DiveModel) BulkUpdate(
+	ownerID int,
+	dives []models.DiveVersion,
+	changes models.DiveBulkChanges,
+	allOrNothing bool,
+) ([]models.DiveBulkResult, error) {
+	results := make([]models.DiveBulkResult, 0, len(dives))
+
+	for _, dive := range dives {
+		result := models.DiveBulkResult{ID: dive.ID}
+		switch {
+		case dive.ID != 1:
+			result.Err = models.ErrNoRecord
+		case dive.Version == 2:
+			result.Err = models.ErrUpdateConflict
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// NumberingReport reports that dive 1 should be dive 2 as there is a dive
+// numbered 1 in the trash that was made after it.
+func (m *DiveModel) NumberingReport(ownerID int) (models.DiveNumberingReport, error) {
+	return models.DiveNumberingReport{
+		Changes: []models.DiveNumbering{
+			{
+				ID:           dive1.ID,
+				Number:       dive1.Number,
+				NewNumber:    2,
+				DateTimeIn:   dive1.DateTimeIn,
+				DiveSiteName: dive1.DiveSite.Name,
+			},
+		},
+		Gaps: []models.DiveNumberRange{{From: 2, To: 4}},
+	}, nil
+}
+
+// Renumber succeeds if the expected changes are the ones from NumberingReport.
+func (m *DiveModel) Renumber(ownerID int, expected []models.DiveNumbering) (int, error) {
+	if len(expected) != 1 || expected[0].ID != dive1.ID || expected[0].NewNumber != 2 {
+		return 0, models.ErrUpdateConflict
+	}
+
+	return 1, nil
+}
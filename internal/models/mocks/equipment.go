@@ -29,7 +29,7 @@ var equipmentBoots7mm = models.Equipment{
 type EquipmentModel struct{}
 
 func (m *EquipmentModel) AllExist(ids []int) (bool, error) {
-	for id := range ids {
+	for _, id := range ids {
 		if id < 1 || id > 3 {
 			return false, nil
 		}
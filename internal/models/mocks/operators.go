@@ -49,6 +49,10 @@ func (m *OperatorModel) Exists(id int) (bool, error) {
 	return id == 1, nil
 }
 
+func (m *OperatorModel) ExistsActive(id int) (bool, error) {
+	return id == 1, nil
+}
+
 func (m *OperatorModel) Insert(
 	ownerID int,
 	operatorTypeID int,
@@ -66,6 +70,37 @@ func (m *OperatorModel) Insert(
 	return 2, nil
 }
 
+func (m *OperatorModel) Update(
+	id int,
+	ownerID int,
+	operatorTypeID int,
+	name string,
+	street string,
+	suburb string,
+	state string,
+	postcode string,
+	countryID int,
+	websiteURL string,
+	emailAddress string,
+	phoneNumber string,
+	comments string,
+) error {
+	if id == 1 {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *OperatorModel) GetOneByID(id, userID int) (models.Operator, error) {
+	switch id {
+	case 1:
+		return operatorBigBubbles, nil
+	default:
+		return models.Operator{}, models.ErrNoRecord
+	}
+}
+
 func (m *OperatorModel) List(
 	userID int,
 	pager models.Pager,
@@ -81,6 +116,22 @@ func (m *OperatorModel) List(
 	return []models.Operator{operatorBigBubbles}, pageData, nil
 }
 
+func (m *OperatorModel) Scorecard(id, userID int) (models.OperatorScorecard, error) {
+	if id != 1 {
+		return models.OperatorScorecard{}, models.ErrNoRecord
+	}
+
+	avgDiveRating := 8.5
+	scorecard := models.OperatorScorecard{
+		Spend: []models.OperatorSpend{
+			{Currency: currencyThaiBaht, Dives: 2400, Trips: 12000, Certifications: 9500},
+		},
+		AvgDiveRating: &avgDiveRating,
+	}
+
+	return scorecard, nil
+}
+
 func (m *OperatorModel) ListAll(userID int, sort []models.SortOperator) ([]models.Operator, error) {
 	return []models.Operator{operatorBigBubbles}, nil
 }
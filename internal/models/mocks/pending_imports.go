@@ -0,0 +1,82 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+type pendingImport struct {
+	ownerID int
+	kind    string
+	data    []byte
+	expires time.Time
+}
+
+// PendingImportModel keeps pending imports in memory so that an import can be
+// previewed and then committed within a test.
+type PendingImportModel struct {
+	mu      sync.Mutex
+	imports map[int]pendingImport
+	lastID  int
+}
+
+func (m *PendingImportModel) Delete(ownerID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pi, ok := m.imports[id]
+	if !ok || pi.ownerID != ownerID {
+		return models.ErrNoRecord
+	}
+
+	delete(m.imports, id)
+	return nil
+}
+
+func (m *PendingImportModel) DeleteExpired() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, pi := range m.imports {
+		if !pi.expires.After(time.Now()) {
+			delete(m.imports, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m *PendingImportModel) Get(ownerID, id int, kind string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pi, ok := m.imports[id]
+	if !ok || pi.ownerID != ownerID || pi.kind != kind || !pi.expires.After(time.Now()) {
+		return nil, models.ErrNoRecord
+	}
+
+	return pi.data, nil
+}
+
+func (m *PendingImportModel) Insert(ownerID int, kind string, data []byte, lifetime time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.imports == nil {
+		m.imports = make(map[int]pendingImport)
+	}
+
+	m.lastID++
+	m.imports[m.lastID] = pendingImport{
+		ownerID: ownerID,
+		kind:    kind,
+		data:    data,
+		expires: time.Now().Add(lifetime),
+	}
+
+	return m.lastID, nil
+}
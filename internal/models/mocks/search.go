@@ -0,0 +1,28 @@
+package mocks
+
+import (
+	"strings"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+type SearchModel struct{}
+
+// Search finds dive 1 if the query contains "boots", which is in its equipment
+// notes, and nothing otherwise.
+func (m *SearchModel) Search(ownerID int, query string, limit int) ([]models.SearchGroup, error) {
+	if ownerID != 1 || !strings.Contains(strings.ToLower(query), "boots") {
+		return nil, nil
+	}
+
+	result := models.SearchResult{
+		Type:  models.SearchDive,
+		ID:    dive1.ID,
+		Title: "Dive 1 at Sail Rock",
+		Snippet: "Wore my new 5mm " + models.SearchHighlightStart + "boots" +
+			models.SearchHighlightStop + " <3",
+		Rank: 0.1,
+	}
+
+	return []models.SearchGroup{{Type: models.SearchDive, Results: []models.SearchResult{result}}}, nil
+}
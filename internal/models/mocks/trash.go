@@ -0,0 +1,129 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/m5lapp/divesite-monolith/internal/models"
+)
+
+var trashDeleted = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// The trash of the mock user with ID 1 contains the dive plan with ID 2 and the
+// trip with ID 2, which cannot be restored as its operator is also in the trash.
+var trashDivePlan = models.TrashItem{
+	Type:    models.TrashDivePlan,
+	ID:      2,
+	OwnerID: 1,
+	Name:    "Wreck plan",
+	Deleted: &trashDeleted,
+}
+
+var trashTrip = models.TrashItem{
+	Type:    models.TrashTrip,
+	ID:      2,
+	OwnerID: 1,
+	Name:    "Liveaboard",
+	Deleted: &trashDeleted,
+}
+
+type TrashModel struct{}
+
+// Blockers returns dive 1 as a blocker for dive site and operator 1.
+func (m *TrashModel) Blockers(
+	ownerID int,
+	itemType models.TrashItemType,
+	id int,
+) (models.TrashBlockers, error) {
+	if id == 1 && (itemType == models.TrashDiveSite || itemType == models.TrashOperator) {
+		blocker := models.TrashItem{
+			Type:    models.TrashDive,
+			ID:      1,
+			OwnerID: 1,
+			Name:    "Dive 1 at Sail Rock",
+		}
+		return models.TrashBlockers{Items: []models.TrashItem{blocker}}, nil
+	}
+
+	return models.TrashBlockers{}, nil
+}
+
+func (m *TrashModel) Delete(ownerID int, itemType models.TrashItemType, id int) error {
+	if id != 1 {
+		return models.ErrNoRecord
+	}
+
+	// Dive site 1 is treated as though its dives have been reassigned.
+	if itemType == models.TrashOperator {
+		return models.ErrDeleteBlocked
+	}
+
+	return nil
+}
+
+func (m *TrashModel) GetOneByID(
+	ownerID int,
+	itemType models.TrashItemType,
+	id int,
+) (models.TrashItem, error) {
+	switch {
+	case id == 1:
+		return models.TrashItem{Type: itemType, ID: 1, OwnerID: 1, Name: "Test " + itemType.Label()}, nil
+	case id == 2 && itemType == models.TrashDivePlan:
+		return trashDivePlan, nil
+	case id == 2 && itemType == models.TrashTrip:
+		return trashTrip, nil
+	default:
+		return models.TrashItem{}, models.ErrNoRecord
+	}
+}
+
+func (m *TrashModel) List(ownerID int) ([]models.TrashItem, error) {
+	if ownerID == 1 {
+		return []models.TrashItem{trashDivePlan, trashTrip}, nil
+	}
+
+	return []models.TrashItem{}, nil
+}
+
+// TrashCardKey is the key of the image of the card of the certification with
+// ID 1, which is returned by Purge when it is purged.
+const TrashCardKey = "certifications/1/1/front"
+
+func (m *TrashModel) Purge(ownerID int, itemType models.TrashItemType, id int) ([]string, error) {
+	if id == 2 && (itemType == models.TrashDivePlan || itemType == models.TrashTrip) {
+		return nil, nil
+	}
+
+	if id == 1 && itemType == models.TrashCertification {
+		return []string{TrashCardKey}, nil
+	}
+
+	return nil, models.ErrNoRecord
+}
+
+func (m *TrashModel) PurgeExpired(deletedBefore time.Time) (int64, []string, error) {
+	return 0, nil, nil
+}
+
+func (m *TrashModel) Reassign(
+	ownerID int,
+	itemType models.TrashItemType,
+	fromID, toID int,
+) (int64, error) {
+	if fromID == 1 && toID == 2 {
+		return 1, nil
+	}
+
+	return 0, models.ErrNoRecord
+}
+
+func (m *TrashModel) Restore(ownerID int, itemType models.TrashItemType, id int) error {
+	switch {
+	case id == 2 && itemType == models.TrashDivePlan:
+		return nil
+	case id == 2 && itemType == models.TrashTrip:
+		return models.ErrRestoreBlocked
+	default:
+		return models.ErrNoRecord
+	}
+}
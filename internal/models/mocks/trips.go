@@ -32,6 +32,10 @@ func (m *TripModel) Exists(id int) (bool, error) {
 	return id == 1, nil
 }
 
+func (m *TripModel) ExistsActive(id, ownerID int) (bool, error) {
+	return id == 1, nil
+}
+
 func (m *TripModel) Insert(
 	ownerID int,
 	name string,
@@ -47,6 +51,35 @@ func (m *TripModel) Insert(
 	return 2, nil
 }
 
+func (m *TripModel) Update(
+	id int,
+	ownerID int,
+	name string,
+	startDate time.Time,
+	endDate time.Time,
+	description string,
+	rating *int,
+	operatorID *int,
+	priceAmount *float64,
+	priceCurrencyID *int,
+	notes string,
+) error {
+	if id == 1 {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *TripModel) GetOneByID(id, ownerID int) (models.Trip, error) {
+	switch id {
+	case 1:
+		return tripLiveaboard, nil
+	default:
+		return models.Trip{}, models.ErrNoRecord
+	}
+}
+
 func (m *TripModel) List(
 	userID int,
 	pager models.Pager,
@@ -65,3 +98,19 @@ func (m *TripModel) List(
 func (m *TripModel) ListAll(userID int, sort []models.SortTrip) ([]models.Trip, error) {
 	return []models.Trip{tripLiveaboard}, nil
 }
+
+func (m *TripModel) AttachDives(id, ownerID int, diveIDs []int) (int64, error) {
+	if id != 1 {
+		return 0, models.ErrNoRecord
+	}
+
+	return int64(len(diveIDs)), nil
+}
+
+func (m *TripModel) DetachDives(id, ownerID int, diveIDs []int) (int64, error) {
+	if id != 1 {
+		return 0, models.ErrNoRecord
+	}
+
+	return int64(len(diveIDs)), nil
+}
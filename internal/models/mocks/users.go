@@ -62,6 +62,7 @@ func (m *UserModel) GetByID(id int) (models.User, error) {
 		DefaultDivingCountryID: 17,
 		DefaultDivingTZ:        bangkokTZ,
 		DarkMode:               false,
+		HasCalendarToken:       true,
 	}
 
 	switch id {
@@ -99,3 +100,30 @@ func (m *UserModel) UpdatePassword(userID int, currentPassword, newPassword stri
 
 	return models.ErrNoRecord
 }
+
+// calendarToken is the calendar feed token of the mock user with ID 1.
+const calendarToken = "NRAPH5JKQ3ZTJBXGH6ZQKWR5WE"
+
+func (m *UserModel) NewCalendarToken(userID int) (string, error) {
+	if userID == 1 {
+		return calendarToken, nil
+	}
+
+	return "", models.ErrNoRecord
+}
+
+func (m *UserModel) RevokeCalendarToken(userID int) error {
+	if userID == 1 {
+		return nil
+	}
+
+	return models.ErrNoRecord
+}
+
+func (m *UserModel) GetByCalendarToken(token string) (models.User, error) {
+	if token == calendarToken {
+		return m.GetByID(1)
+	}
+
+	return models.User{}, models.ErrNoRecord
+}
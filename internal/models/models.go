@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -48,6 +49,30 @@ func (tz TimeZone) String() string {
 	return fmt.Sprint(&tz.Location)
 }
 
+// MarshalJSON implements the encoding/json.Marshaler interface. The TimeZone is
+// represented by its IANA time zone name.
+func (tz TimeZone) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tz.String())
+}
+
+// UnmarshalJSON implements the encoding/json.Unmarshaler interface. It expects
+// an IANA time zone name such as "Europe/London".
+func (tz *TimeZone) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	l, err := time.LoadLocation(s)
+	if err != nil {
+		return err
+	}
+
+	tz.Location = *l
+	return nil
+}
+
 // Scan implements the database/sql.Scanner interface. It takes a values from
 // the database (hopefully a []byte or a string that represents a time.Location)
 // and attempts to store it into the TimeZone struct.
@@ -103,6 +128,97 @@ func idExistsInTable(db *sql.DB, id int, tableName, idColumn string) (bool, erro
 	return exists, err
 }
 
+// idExistsActiveInTable checks if a record with the given ID exists in the
+// given table and is not in the trash. It is intended for validating foreign
+// keys to records that are shared between users, such as dive sites.
+func idExistsActiveInTable(db *sql.DB, id int, tableName string) (bool, error) {
+	stmt := fmt.Sprintf(
+		"select exists(select true from %s where id = $1 and deleted_at is null)",
+		tableName,
+	)
+
+	var exists bool
+	err := db.QueryRow(stmt, id).Scan(&exists)
+	if err != nil {
+		err = fmt.Errorf("failed to check if %s %d exists: %w", tableName, id, err)
+	}
+
+	return exists, err
+}
+
+// ownedIDExistsActiveInTable checks if a record with the given ID exists in the
+// given table, belongs to the owner and is not in the trash. It is intended for
+// validating foreign keys to records that are private to a user, such as
+// buddies.
+func ownedIDExistsActiveInTable(db *sql.DB, id, ownerID int, tableName string) (bool, error) {
+	stmt := fmt.Sprintf(`
+        select exists(
+            select true
+              from %s
+             where id = $1 and owner_id = $2 and deleted_at is null
+        )
+    `, tableName)
+
+	var exists bool
+	err := db.QueryRow(stmt, id, ownerID).Scan(&exists)
+	if err != nil {
+		err = fmt.Errorf("failed to check if %s %d exists: %w", tableName, id, err)
+	}
+
+	return exists, err
+}
+
+// updateConflictOrNoRecord is used after a version-checked update of the
+// owner's record with the given ID in tableName has not affected any rows. It
+// returns ErrUpdateConflict if the record still exists outside of the trash,
+// meaning that its version has changed since it was read, or ErrNoRecord if it
+// does not.
+func updateConflictOrNoRecord(
+	ctx context.Context,
+	db sqlRowQuerier,
+	tableName string,
+	id, ownerID int,
+) error {
+	stmt := fmt.Sprintf(`
+        select exists(
+            select true
+              from %s
+             where id = $1 and owner_id = $2 and deleted_at is null
+        )
+    `, tableName)
+
+	var exists bool
+	err := db.QueryRowContext(ctx, stmt, id, ownerID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if %s %d exists: %w", tableName, id, err)
+	}
+
+	if exists {
+		return ErrUpdateConflict
+	}
+
+	return ErrNoRecord
+}
+
+// checkUpdatedOne checks that the statement that produced result affected
+// exactly one row. It returns ErrNoRecord if no rows were affected, such as
+// when the record does not exist or is owned by another user.
+func checkUpdatedOne(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case rowsAffected == 0:
+		return ErrNoRecord
+	case rowsAffected > 1:
+		return &ErrUnexpectedRowsAffected{rowsExpected: 1, rowsAffected: int(rowsAffected)}
+	}
+
+	return nil
+}
+
 // bindVarList returns a string of `count` comma-separated bind variable
 // placeholders starting at `start` suitable for use in a PostgreSQL query. It
 // returns the empty string if count is less than 1.
@@ -211,6 +327,16 @@ type sqlExecer interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 }
 
+// sqlQuerier is implemented by all three of sql.Conn, sql.DB and sql.Tx.
+type sqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// sqlRowQuerier is implemented by all three of sql.Conn, sql.DB and sql.Tx.
+type sqlRowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type sqlID interface {
 	int | int8 | int32 | int64 | uint | uint8 | uint32 | uint64
 }
@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -62,6 +63,30 @@ func (op Operator) String() string {
 	return fmt.Sprintf("%s, %s, %s", op.Name, op.Suburb, op.Country.ISO2Code)
 }
 
+// OperatorSpend is the total that a user has spent with an operator in a single
+// currency, split by what it was spent on.
+type OperatorSpend struct {
+	Currency       Currency
+	Dives          float64
+	Trips          float64
+	Certifications float64
+}
+
+// Total returns the sum of everything spent in the currency.
+func (os OperatorSpend) Total() float64 {
+	return os.Dives + os.Trips + os.Certifications
+}
+
+// OperatorScorecard summarises a user's history with an operator so that it can
+// be compared with others. The average ratings are nil if nothing of that kind
+// has been rated.
+type OperatorScorecard struct {
+	Spend                  []OperatorSpend
+	AvgDiveRating          *float64
+	AvgTripRating          *float64
+	AvgCertificationRating *float64
+}
+
 // nullableOperator represents an Operator returned from a database that may or
 // may not be null.
 type nullableOperator struct {
@@ -92,15 +117,15 @@ func (no nullableOperator) ToStruct() *Operator {
 
 	return &Operator{
 		ID:           *no.ID,
-		Created:      *no.Updated,
-		Updated:      *no.Created,
+		Created:      *no.Created,
+		Updated:      *no.Updated,
 		OwnerID:      *no.OwnerID,
 		Dives:        *no.Dives,
 		FirstDive:    no.FirstDive,
 		LastDive:     no.LastDive,
 		OperatorType: *no.OperatorType.ToStruct(),
 		Name:         *no.Name,
-		Street:       *no.State,
+		Street:       *no.Street,
 		Suburb:       *no.Suburb,
 		State:        *no.State,
 		Postcode:     *no.Postcode,
@@ -114,6 +139,7 @@ func (no nullableOperator) ToStruct() *Operator {
 
 type OperatorModelInterface interface {
 	Exists(id int) (bool, error)
+	ExistsActive(id int) (bool, error)
 
 	Insert(
 		ownerID int,
@@ -130,8 +156,28 @@ type OperatorModelInterface interface {
 		comments string,
 	) (int, error)
 
+	Update(
+		id int,
+		ownerID int,
+		operatorTypeID int,
+		name string,
+		street string,
+		suburb string,
+		state string,
+		postcode string,
+		countryID int,
+		websiteURL string,
+		emailAddress string,
+		phoneNumber string,
+		comments string,
+	) error
+
+	GetOneByID(id, userID int) (Operator, error)
+
 	List(userID int, Pager Pager, sort []SortOperator) ([]Operator, PageData, error)
 
+	Scorecard(id, userID int) (OperatorScorecard, error)
+
 	ListAll(userID int, sort []SortOperator) ([]Operator, error)
 }
 
@@ -143,6 +189,7 @@ var operatorSelectQuery string = `
                max(dv.date_time_in) last_dive
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.operator_id
            )
     select count(*) over(), op.id, op.created_at, op.updated_at, op.owner_id,
@@ -158,6 +205,7 @@ var operatorSelectQuery string = `
  left join operator_types      ot on op.operator_type_id = ot.id
  left join countries           co on op.country_id = co.id
  left join currencies          cu on co.currency_id = cu.id
+     where op.deleted_at is null
 `
 
 func operatorFromDBRow(rs RowScanner, totalRecords *int, op *Operator) error {
@@ -206,6 +254,12 @@ func (m *OperatorModel) Exists(id int) (bool, error) {
 	return idExistsInTable(m.DB, id, "operators", "id")
 }
 
+// ExistsActive checks if a operator with the given ID exists and is not in the
+// trash. Operators are shared between users, so it may belong to anyone.
+func (m *OperatorModel) ExistsActive(id int) (bool, error) {
+	return idExistsActiveInTable(m.DB, id, "operators")
+}
+
 func (m *OperatorModel) Insert(
 	ownerID int,
 	operatorTypeID int,
@@ -259,6 +313,83 @@ func (m *OperatorModel) Insert(
 	return id, nil
 }
 
+// Update updates the operator with the given ID. Only the user that created an
+// operator can update it.
+func (m *OperatorModel) Update(
+	id int,
+	ownerID int,
+	operatorTypeID int,
+	name string,
+	street string,
+	suburb string,
+	state string,
+	postcode string,
+	countryID int,
+	websiteURL string,
+	emailAddress string,
+	phoneNumber string,
+	comments string,
+) error {
+	stmt := `
+        update operators
+           set updated_at = now(), operator_type_id = $3, name = $4,
+               street = $5, suburb = $6, state = $7, postcode = $8,
+               country_id = $9, website_url = $10, email_address = $11,
+               phone_number = $12, comments = $13
+         where id = $1
+           and owner_id = $2
+           and deleted_at is null
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(
+		ctx,
+		stmt,
+		id,
+		ownerID,
+		operatorTypeID,
+		name,
+		street,
+		suburb,
+		state,
+		postcode,
+		countryID,
+		websiteURL,
+		emailAddress,
+		phoneNumber,
+		comments,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update operator %d: %w", id, err)
+	}
+
+	return checkUpdatedOne(result)
+}
+
+// GetOneByID returns the operator with the given ID along with the dive
+// statistics of the given user with it.
+func (m *OperatorModel) GetOneByID(id, userID int) (Operator, error) {
+	stmt := fmt.Sprintf("%s and op.id = $2", operatorSelectQuery)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	var totalRecords int
+	var operator Operator
+	row := m.DB.QueryRowContext(ctx, stmt, userID, id)
+	err := operatorFromDBRow(row, &totalRecords, &operator)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Operator{}, ErrNoRecord
+		}
+		return Operator{}, err
+	}
+
+	return operator, nil
+}
+
 func (m *OperatorModel) List(
 	userID int,
 	pager Pager,
@@ -335,6 +466,96 @@ func (m *OperatorModel) ListAll(userID int, sort []SortOperator) ([]Operator, er
 	return operators, nil
 }
 
+// Scorecard returns how much the given user has spent with the operator with the
+// given ID in each currency and their average ratings of the dives, trips and
+// certifications done with it. Records in the trash are not included.
+func (m *OperatorModel) Scorecard(id, userID int) (OperatorScorecard, error) {
+	spendStmt := `
+      with spend as (
+        select dv.currency_id, dv.price dives, 0 trips, 0 certifications
+          from dives dv
+         where dv.owner_id = $1 and dv.operator_id = $2
+           and dv.deleted_at is null and dv.price is not null
+     union all
+        select tr.currency_id, 0, tr.price, 0
+          from trips tr
+         where tr.owner_id = $1 and tr.operator_id = $2
+           and tr.deleted_at is null and tr.price is not null
+     union all
+        select ce.currency_id, 0, 0, ce.price
+          from certifications ce
+         where ce.owner_id = $1 and ce.operator_id = $2
+           and ce.deleted_at is null and ce.price is not null
+           )
+    select cu.id, cu.iso_alpha, cu.iso_number, cu.name, cu.exponent,
+           sum(sp.dives), sum(sp.trips), sum(sp.certifications)
+      from spend sp
+      join currencies cu on sp.currency_id = cu.id
+  group by cu.id
+  order by cu.iso_alpha
+    `
+
+	ratingsStmt := `
+    select (select avg(dv.rating)
+              from dives dv
+             where dv.owner_id = $1 and dv.operator_id = $2
+               and dv.deleted_at is null),
+           (select avg(tr.rating)
+              from trips tr
+             where tr.owner_id = $1 and tr.operator_id = $2
+               and tr.deleted_at is null),
+           (select avg(ce.rating)
+              from certifications ce
+             where ce.owner_id = $1 and ce.operator_id = $2
+               and ce.deleted_at is null)
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
+	defer cancel()
+
+	var scorecard OperatorScorecard
+	err := m.DB.QueryRowContext(ctx, ratingsStmt, userID, id).Scan(
+		&scorecard.AvgDiveRating,
+		&scorecard.AvgTripRating,
+		&scorecard.AvgCertificationRating,
+	)
+	if err != nil {
+		return OperatorScorecard{}, fmt.Errorf("failed to get operator %d ratings: %w", id, err)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, spendStmt, userID, id)
+	if err != nil {
+		return OperatorScorecard{}, fmt.Errorf("failed to get operator %d spend: %w", id, err)
+	}
+	defer rows.Close()
+
+	scorecard.Spend = []OperatorSpend{}
+	for rows.Next() {
+		var spend OperatorSpend
+		err := rows.Scan(
+			&spend.Currency.ID,
+			&spend.Currency.ISOAlpha,
+			&spend.Currency.ISONumber,
+			&spend.Currency.Name,
+			&spend.Currency.Exponent,
+			&spend.Dives,
+			&spend.Trips,
+			&spend.Certifications,
+		)
+		if err != nil {
+			return OperatorScorecard{}, err
+		}
+		scorecard.Spend = append(scorecard.Spend, spend)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return OperatorScorecard{}, err
+	}
+
+	return scorecard, nil
+}
+
 type OperatorTypeModel struct {
 	DB       *sql.DB
 	Timeouts QueryTimeouts
@@ -32,11 +32,11 @@ func (lf Pager) offset() int {
 }
 
 type PageData struct {
-	FirstPage    int
-	LastPage     int
-	CurrentPage  int
-	PageSize     int
-	TotalRecords int
+	FirstPage    int `json:"first_page"`
+	LastPage     int `json:"last_page"`
+	CurrentPage  int `json:"current_page"`
+	PageSize     int `json:"page_size"`
+	TotalRecords int `json:"total_records"`
 }
 
 func newPaginationData(totalRecods, page, pageSize int) PageData {
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// The kinds of pending import, which keep a pending import from one importer
+// being read by another.
+const (
+	PendingImportLogBook = "log_book"
+	PendingImportCSV     = "csv"
+)
+
+type PendingImportModelInterface interface {
+	Delete(ownerID, id int) error
+
+	DeleteExpired() (int64, error)
+
+	Get(ownerID, id int, kind string) ([]byte, error)
+
+	Insert(ownerID int, kind string, data []byte, lifetime time.Duration) (int, error)
+}
+
+// PendingImportModel stores the data of an import that has been uploaded but
+// not yet committed, such as a parsed log book, until it either is committed or
+// expires.
+type PendingImportModel struct {
+	DB       *sql.DB
+	Timeouts QueryTimeouts
+}
+
+func (m *PendingImportModel) Delete(ownerID, id int) error {
+	stmt := "delete from pending_imports where owner_id = $1 and id = $2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, ownerID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes every pending import that has passed its expiry time
+// and returns how many were deleted.
+func (m *PendingImportModel) DeleteExpired() (int64, error) {
+	stmt := "delete from pending_imports where expires_at <= now()"
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Get returns the data of the pending import of the given kind with the given
+// ID. ErrNoRecord is returned if it does not exist, belongs to another user or
+// has expired.
+func (m *PendingImportModel) Get(ownerID, id int, kind string) ([]byte, error) {
+	stmt := `
+        select data
+          from pending_imports
+         where owner_id = $1
+           and id = $2
+           and kind = $3
+           and expires_at > now()
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	var data []byte
+	err := m.DB.QueryRowContext(ctx, stmt, ownerID, id, kind).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Insert stores data as a pending import of the given kind that expires after
+// lifetime and returns its ID.
+func (m *PendingImportModel) Insert(ownerID int, kind string, data []byte, lifetime time.Duration) (int, error) {
+	stmt := `
+        insert into pending_imports (owner_id, kind, expires_at, data)
+        values ($1, $2, $3, $4)
+        returning id
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, stmt, ownerID, kind, time.Now().Add(lifetime), data).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SearchResultType is a type of log book record that can be found by a search.
+// Its value is used in URLs.
+type SearchResultType string
+
+const (
+	SearchDive     SearchResultType = "dive"
+	SearchDiveSite SearchResultType = "dive-site"
+	SearchBuddy    SearchResultType = "buddy"
+	SearchOperator SearchResultType = "operator"
+	SearchTrip     SearchResultType = "trip"
+)
+
+// SearchResultTypes are all of the types of record that can be searched, in the
+// order that their results are grouped in.
+var SearchResultTypes = []SearchResultType{
+	SearchDive,
+	SearchDiveSite,
+	SearchBuddy,
+	SearchOperator,
+	SearchTrip,
+}
+
+// Label returns the name of the type of record for displaying to a user.
+func (t SearchResultType) Label() string {
+	switch t {
+	case SearchBuddy:
+		return "Buddies"
+	case SearchDive:
+		return "Dives"
+	case SearchDiveSite:
+		return "Dive Sites"
+	case SearchOperator:
+		return "Operators"
+	case SearchTrip:
+		return "Trips"
+	default:
+		return string(t)
+	}
+}
+
+// SearchHighlightStart and SearchHighlightStop surround each of the matching
+// words in a SearchResult's Snippet. They are control characters so that they
+// cannot be confused with the text itself, which has not been escaped and so
+// must be before it is displayed as HTML.
+const (
+	SearchHighlightStart = "\x02"
+	SearchHighlightStop  = "\x03"
+)
+
+// SearchResult is a record that matched a search, with a snippet of the text
+// that it matched in.
+type SearchResult struct {
+	Type    SearchResultType
+	ID      int
+	Title   string
+	Snippet string
+	Rank    float64
+}
+
+// SearchGroup is the results of a search for one type of record, best first.
+type SearchGroup struct {
+	Type    SearchResultType
+	Results []SearchResult
+}
+
+// searchTable describes how to search one type of record. Each of the SQL
+// expressions refers to the record's table as t and the owner's ID as $1.
+type searchTable struct {
+	from      string
+	titleExpr string
+	// document is the text that is searched. It must match the expression of
+	// the table's GIN index for the search to be indexed.
+	document string
+	scope    string
+}
+
+var searchTables = map[SearchResultType]searchTable{
+	SearchDive: {
+		from:      "dives t join dive_sites ds on ds.id = t.dive_site_id",
+		titleExpr: "'Dive ' || t.number || ' at ' || ds.name",
+		document: `t.notes || ' ' || t.gas_mix_notes || ' ' || t.weight_notes
+                   || ' ' || t.equipment_notes`,
+		scope: "t.owner_id = $1 and t.deleted_at is null",
+	},
+	SearchDiveSite: {
+		from:      "dive_sites t",
+		titleExpr: "t.name",
+		document: `t.name || ' ' || t.alt_name || ' ' || t.location || ' ' || t.region
+                   || ' ' || t.notes`,
+		scope: `t.deleted_at is null and (t.owner_id = $1 or exists (
+                    select 1 from dives dv
+                     where dv.dive_site_id = t.id
+                       and dv.owner_id = $1
+                       and dv.deleted_at is null
+                ))`,
+	},
+	SearchBuddy: {
+		from:      "buddies t",
+		titleExpr: "t.name",
+		document:  "t.name || ' ' || t.notes",
+		scope:     "t.owner_id = $1 and t.deleted_at is null",
+	},
+	SearchOperator: {
+		from:      "operators t",
+		titleExpr: "t.name",
+		document:  "t.name",
+		scope: `t.deleted_at is null and (t.owner_id = $1 or exists (
+                    select 1 from dives dv
+                     where dv.operator_id = t.id
+                       and dv.owner_id = $1
+                       and dv.deleted_at is null
+                ))`,
+	},
+	SearchTrip: {
+		from:      "trips t",
+		titleExpr: "t.name",
+		document:  "t.name || ' ' || t.description",
+		scope:     "t.owner_id = $1 and t.deleted_at is null",
+	},
+}
+
+type SearchModelInterface interface {
+	Search(ownerID int, query string, limit int) ([]SearchGroup, error)
+}
+
+type SearchModel struct {
+	DB       *sql.DB
+	Timeouts QueryTimeouts
+}
+
+// buildSearchQuery returns a statement that searches each of the types of
+// record for the web search query $2, returning up to $4 of the best results
+// for each type with snippets built using the ts_headline options $3.
+func buildSearchQuery() string {
+	var stmt strings.Builder
+
+	for i, resultType := range SearchResultTypes {
+		table := searchTables[resultType]
+		if i > 0 {
+			stmt.WriteString("\n union all\n")
+		}
+
+		fmt.Fprintf(&stmt, `
+        (
+            select '%s', t.id, %s,
+                   ts_headline('simple', %s, websearch_to_tsquery('simple', $2), $3),
+                   ts_rank(to_tsvector('simple', %s), websearch_to_tsquery('simple', $2)) as rank
+              from %s
+             where %s
+               and to_tsvector('simple', %s) @@ websearch_to_tsquery('simple', $2)
+             order by rank desc, t.id
+             limit $4
+        )`,
+			resultType,
+			table.titleExpr,
+			table.document,
+			table.document,
+			table.from,
+			table.scope,
+			table.document,
+		)
+	}
+
+	return stmt.String()
+}
+
+// Search finds the owner's records that match query, which uses the syntax of
+// a web search such as `mola "sail rock" -night`. Up to limit of the best
+// results are returned for each type of record that has any. Records in the
+// trash are not searched.
+func (m *SearchModel) Search(ownerID int, query string, limit int) ([]SearchGroup, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Complex)
+	defer cancel()
+
+	options := fmt.Sprintf(
+		`StartSel="%s", StopSel="%s", MaxFragments=2, MaxWords=20, MinWords=8, FragmentDelimiter=" … "`,
+		SearchHighlightStart,
+		SearchHighlightStop,
+	)
+
+	rows, err := m.DB.QueryContext(ctx, buildSearchQuery(), ownerID, query, options, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := map[SearchResultType][]SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		err := rows.Scan(
+			&result.Type,
+			&result.ID,
+			&result.Title,
+			&result.Snippet,
+			&result.Rank,
+		)
+		if err != nil {
+			return nil, err
+		}
+		results[result.Type] = append(results[result.Type], result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var groups []SearchGroup
+	for _, resultType := range SearchResultTypes {
+		if len(results[resultType]) > 0 {
+			groups = append(groups, SearchGroup{Type: resultType, Results: results[resultType]})
+		}
+	}
+
+	return groups, nil
+}
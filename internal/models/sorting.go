@@ -123,6 +123,21 @@ var (
 	SortDiveDateAsc  = SortDive{sortCol{column: "dv.date_time_in", direction: sortAsc}}
 	SortDiveDateDesc = SortDive{sortCol{column: "dv.date_time_in", direction: sortDesc}}
 
+	SortDiveNumberAsc  = SortDive{sortCol{column: "dv.number", direction: sortAsc}}
+	SortDiveNumberDesc = SortDive{sortCol{column: "dv.number", direction: sortDesc}}
+
+	SortDiveMaxDepthAsc  = SortDive{sortCol{column: "dv.max_depth", direction: sortAsc}}
+	SortDiveMaxDepthDesc = SortDive{sortCol{column: "dv.max_depth", direction: sortDesc}}
+
+	SortDiveBottomTimeAsc  = SortDive{sortCol{column: "dv.bottom_time", direction: sortAsc}}
+	SortDiveBottomTimeDesc = SortDive{sortCol{column: "dv.bottom_time", direction: sortDesc}}
+
+	SortDiveRatingAsc  = SortDive{sortCol{column: "dv.rating", direction: sortAsc}}
+	SortDiveRatingDesc = SortDive{sortCol{column: "dv.rating", direction: sortDesc}}
+
+	SortDiveSiteAsc  = SortDive{sortCol{column: "ds.name", direction: sortAsc}}
+	SortDiveSiteDesc = SortDive{sortCol{column: "ds.name", direction: sortDesc}}
+
 	SortDiveDefault = []SortDive{SortDiveDateDesc, SortDiveIDAsc}
 )
 
@@ -0,0 +1,713 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TrashItemType is a type of log book record that can be moved to the trash.
+// Its value is used in URLs.
+type TrashItemType string
+
+const (
+	TrashBuddy         TrashItemType = "buddy"
+	TrashCertification TrashItemType = "certification"
+	TrashDive          TrashItemType = "dive"
+	TrashDivePlan      TrashItemType = "dive-plan"
+	TrashDiveSite      TrashItemType = "dive-site"
+	TrashOperator      TrashItemType = "operator"
+	TrashTrip          TrashItemType = "trip"
+)
+
+// TrashItemTypes are all of the types of record that can be moved to the
+// trash, in the order that expired ones are purged so that records are always
+// purged before the ones that they refer to.
+var TrashItemTypes = []TrashItemType{
+	TrashDive,
+	TrashDivePlan,
+	TrashCertification,
+	TrashTrip,
+	TrashBuddy,
+	TrashOperator,
+	TrashDiveSite,
+}
+
+// trashTable describes the table that holds a type of record that can be moved
+// to the trash.
+type trashTable struct {
+	name string
+	// nameExpr is a SQL expression that gives a record in the table, aliased
+	// as t, a name that the user will recognise.
+	nameExpr string
+	// shared tables hold records that can be used by any user, not just the
+	// owner.
+	shared    bool
+	versioned bool
+}
+
+var trashTables = map[TrashItemType]trashTable{
+	TrashBuddy: {name: "buddies", nameExpr: "t.name", versioned: true},
+	TrashCertification: {
+		name: "certifications",
+		nameExpr: `(select ac.name from agency_courses ac where ac.id = t.course_id)
+                   || ' (' || to_char(t.start_date, 'YYYY-MM-DD') || ')'`,
+	},
+	TrashDive: {
+		name: "dives",
+		nameExpr: `'Dive ' || t.number || ' at '
+                   || (select ds.name from dive_sites ds where ds.id = t.dive_site_id)`,
+		versioned: true,
+	},
+	TrashDivePlan: {name: "dive_plans", nameExpr: "t.name", versioned: true},
+	TrashDiveSite: {name: "dive_sites", nameExpr: "t.name", shared: true, versioned: true},
+	TrashOperator: {name: "operators", nameExpr: "t.name", shared: true},
+	TrashTrip:     {name: "trips", nameExpr: "t.name"},
+}
+
+// trashReference is a column of a type of record that refers to another record
+// with a foreign key that restricts it from being deleted.
+type trashReference struct {
+	itemType TrashItemType
+	column   string
+}
+
+// trashReferences are the records that stop each type of record from being
+// deleted while they refer to it. Dives that refer to a trip or certification
+// do not stop it being deleted as those references are set to null when it is.
+var trashReferences = map[TrashItemType][]trashReference{
+	TrashBuddy: {
+		{itemType: TrashDive, column: "buddy_id"},
+		{itemType: TrashCertification, column: "instructor_id"},
+	},
+	TrashDiveSite: {
+		{itemType: TrashDive, column: "dive_site_id"},
+	},
+	TrashOperator: {
+		{itemType: TrashDive, column: "operator_id"},
+		{itemType: TrashTrip, column: "operator_id"},
+		{itemType: TrashCertification, column: "operator_id"},
+	},
+}
+
+// trashFile is a table of the files in the file store that belong to a type of
+// record. Its rows are deleted along with the record by the database, but the
+// files themselves have to be deleted from the file store by the caller.
+type trashFile struct {
+	table string
+	// column refers to the record that the file belongs to.
+	column string
+	// keyColumn holds the key of the file in the file store.
+	keyColumn string
+}
+
+var trashFiles = map[TrashItemType][]trashFile{
+	TrashCertification: {
+		{table: "certification_cards", column: "certification_id", keyColumn: "storage_key"},
+	},
+}
+
+// trashFileKeys returns the keys of the files in the file store that belong to
+// the records of itemType, aliased as t, that match the where clause.
+func trashFileKeys(
+	ctx context.Context,
+	db sqlQuerier,
+	itemType TrashItemType,
+	where string,
+	args ...any,
+) ([]string, error) {
+	table := trashTables[itemType]
+
+	var keys []string
+	for _, file := range trashFiles[itemType] {
+		stmt := fmt.Sprintf(
+			"select f.%s from %s f join %s t on t.id = f.%s where %s",
+			file.keyColumn,
+			file.table,
+			table.name,
+			file.column,
+			where,
+		)
+
+		rows, err := db.QueryContext(ctx, stmt, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", file.table, err)
+		}
+
+		for rows.Next() {
+			var key string
+			err = rows.Scan(&key)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// IsValid returns true if t is one of the TrashItemTypes.
+func (t TrashItemType) IsValid() bool {
+	_, ok := trashTables[t]
+	return ok
+}
+
+// CanBeReassigned returns true if the records that stop a record of type t from
+// being deleted can be changed to refer to a different one instead.
+func (t TrashItemType) CanBeReassigned() bool {
+	_, ok := trashReferences[t]
+	return ok
+}
+
+// Label returns the human-readable name of the record type t.
+func (t TrashItemType) Label() string {
+	switch t {
+	case TrashBuddy:
+		return "Buddy"
+	case TrashCertification:
+		return "Certification"
+	case TrashDive:
+		return "Dive"
+	case TrashDivePlan:
+		return "Dive Plan"
+	case TrashDiveSite:
+		return "Dive Site"
+	case TrashOperator:
+		return "Operator"
+	case TrashTrip:
+		return "Trip"
+	default:
+		return string(t)
+	}
+}
+
+// TrashItem is a log book record of any type that either is or could be moved
+// to the trash.
+type TrashItem struct {
+	Type    TrashItemType
+	ID      int
+	OwnerID int
+	Name    string
+	// Deleted is when the record was moved to the trash, or nil if it has not
+	// been.
+	Deleted *time.Time
+}
+
+// PurgeAfter returns the time after which the item will be permanently deleted
+// from the trash if it is kept for retention.
+func (ti TrashItem) PurgeAfter(retention time.Duration) time.Time {
+	if ti.Deleted == nil {
+		return time.Time{}
+	}
+
+	return ti.Deleted.Add(retention)
+}
+
+// TrashBlockers are the records that refer to a record and so stop it from
+// being moved to the trash.
+type TrashBlockers struct {
+	// Items are the blocking records that belong to the user.
+	Items []TrashItem
+	// Others is the number of blocking records that belong to other users and
+	// cannot be shown or reassigned.
+	Others int
+}
+
+// Any returns true if there are any blocking records.
+func (tb TrashBlockers) Any() bool {
+	return len(tb.Items) > 0 || tb.Others > 0
+}
+
+type TrashModelInterface interface {
+	Blockers(ownerID int, itemType TrashItemType, id int) (TrashBlockers, error)
+
+	Delete(ownerID int, itemType TrashItemType, id int) error
+
+	GetOneByID(ownerID int, itemType TrashItemType, id int) (TrashItem, error)
+
+	List(ownerID int) ([]TrashItem, error)
+
+	Purge(ownerID int, itemType TrashItemType, id int) ([]string, error)
+
+	PurgeExpired(deletedBefore time.Time) (int64, []string, error)
+
+	Reassign(ownerID int, itemType TrashItemType, fromID, toID int) (int64, error)
+
+	Restore(ownerID int, itemType TrashItemType, id int) error
+}
+
+type TrashModel struct {
+	DB       *sql.DB
+	Timeouts QueryTimeouts
+}
+
+func getTrashTable(itemType TrashItemType) (trashTable, error) {
+	table, ok := trashTables[itemType]
+	if !ok {
+		return trashTable{}, fmt.Errorf("models: unknown trash item type %q", itemType)
+	}
+
+	return table, nil
+}
+
+func trashItemFromDBRow(rs RowScanner, ti *TrashItem) error {
+	return rs.Scan(&ti.Type, &ti.ID, &ti.OwnerID, &ti.Name, &ti.Deleted)
+}
+
+// trashItemQuery returns a query that selects the TrashItem fields of the
+// records of itemType from table, aliased as t.
+func trashItemQuery(itemType TrashItemType, table trashTable) string {
+	return fmt.Sprintf(
+		"select '%s', t.id, t.owner_id, coalesce(%s, ''), t.deleted_at from %s t",
+		itemType,
+		table.nameExpr,
+		table.name,
+	)
+}
+
+// isForeignKeyViolation returns true if err was caused by a statement that
+// would have broken a foreign key constraint.
+func isForeignKeyViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "violates foreign key constraint")
+}
+
+// Blockers returns the records that are not in the trash and which refer to the
+// record with the given ID, stopping it from being moved to the trash.
+func (m *TrashModel) Blockers(ownerID int, itemType TrashItemType, id int) (TrashBlockers, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	return trashBlockers(ctx, m.DB, ownerID, itemType, id)
+}
+
+func trashBlockers(
+	ctx context.Context,
+	db sqlQuerier,
+	ownerID int,
+	itemType TrashItemType,
+	id int,
+) (TrashBlockers, error) {
+	references := trashReferences[itemType]
+	if len(references) == 0 {
+		return TrashBlockers{}, nil
+	}
+
+	queries := make([]string, 0, len(references))
+	for _, ref := range references {
+		table := trashTables[ref.itemType]
+		query := fmt.Sprintf(
+			"%s where t.%s = $1 and t.deleted_at is null",
+			trashItemQuery(ref.itemType, table),
+			ref.column,
+		)
+		queries = append(queries, query)
+	}
+	stmt := strings.Join(queries, " union all ") + " order by 1, 4, 2"
+
+	rows, err := db.QueryContext(ctx, stmt, id)
+	if err != nil {
+		return TrashBlockers{}, err
+	}
+	defer rows.Close()
+
+	var blockers TrashBlockers
+	for rows.Next() {
+		var item TrashItem
+		err := trashItemFromDBRow(rows, &item)
+		if err != nil {
+			return TrashBlockers{}, err
+		}
+
+		if item.OwnerID == ownerID {
+			blockers.Items = append(blockers.Items, item)
+		} else {
+			blockers.Others++
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return TrashBlockers{}, err
+	}
+
+	return blockers, nil
+}
+
+// Delete moves the owner's record with the given ID to the trash. It returns
+// ErrDeleteBlocked if any records that are not in the trash refer to it.
+func (m *TrashModel) Delete(ownerID int, itemType TrashItemType, id int) error {
+	table, err := getTrashTable(itemType)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt := fmt.Sprintf(`
+        update %s
+           set deleted_at = now()
+         where id = $1
+           and owner_id = $2
+           and deleted_at is null
+    `, table.name)
+
+	result, err := tx.ExecContext(ctx, stmt, id, ownerID)
+	if err != nil {
+		return err
+	}
+
+	err = checkUpdatedOne(result)
+	if err != nil {
+		return err
+	}
+
+	// Check for blocking records in the same transaction so that the record is
+	// only moved to the trash if there are none.
+	blockers, err := trashBlockers(ctx, tx, ownerID, itemType, id)
+	if err != nil {
+		return err
+	}
+
+	if blockers.Any() {
+		return ErrDeleteBlocked
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetOneByID returns the owner's record with the given ID whether or not it is
+// in the trash.
+func (m *TrashModel) GetOneByID(ownerID int, itemType TrashItemType, id int) (TrashItem, error) {
+	table, err := getTrashTable(itemType)
+	if err != nil {
+		return TrashItem{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	stmt := fmt.Sprintf(
+		"%s where t.id = $1 and t.owner_id = $2",
+		trashItemQuery(itemType, table),
+	)
+
+	var item TrashItem
+	row := m.DB.QueryRowContext(ctx, stmt, id, ownerID)
+	err = trashItemFromDBRow(row, &item)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TrashItem{}, ErrNoRecord
+		}
+		return TrashItem{}, err
+	}
+
+	return item, nil
+}
+
+// List returns every record in the owner's trash, most recently deleted first.
+func (m *TrashModel) List(ownerID int) ([]TrashItem, error) {
+	queries := make([]string, 0, len(TrashItemTypes))
+	for _, itemType := range TrashItemTypes {
+		query := fmt.Sprintf(
+			"%s where t.owner_id = $1 and t.deleted_at is not null",
+			trashItemQuery(itemType, trashTables[itemType]),
+		)
+		queries = append(queries, query)
+	}
+	stmt := strings.Join(queries, " union all ") + " order by 5 desc, 1, 2"
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []TrashItem
+	for rows.Next() {
+		var record TrashItem
+		err := trashItemFromDBRow(rows, &record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Purge permanently deletes the owner's record with the given ID from the
+// trash. It returns ErrDeleteBlocked if other records in the trash still refer
+// to it. The keys of any files that belonged to the record are returned so that
+// the caller can delete them from the file store.
+func (m *TrashModel) Purge(ownerID int, itemType TrashItemType, id int) ([]string, error) {
+	table, err := getTrashTable(itemType)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where := "t.id = $1 and t.owner_id = $2 and t.deleted_at is not null"
+
+	files, err := trashFileKeys(ctx, tx, itemType, where, id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := fmt.Sprintf("delete from %s t where %s", table.name, where)
+
+	result, err := tx.ExecContext(ctx, stmt, id, ownerID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrDeleteBlocked
+		}
+		return nil, err
+	}
+
+	err = checkUpdatedOne(result)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return files, nil
+}
+
+// PurgeExpired permanently deletes every record that was moved to the trash
+// before deletedBefore and returns how many were deleted, along with the keys
+// of any files that belonged to them so that the caller can delete them from
+// the file store. Records that are still referred to by other records in the
+// trash are kept until those have been purged too.
+func (m *TrashModel) PurgeExpired(deletedBefore time.Time) (int64, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Bulk)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var purged int64
+	var files []string
+	for _, itemType := range TrashItemTypes {
+		table := trashTables[itemType]
+
+		var where strings.Builder
+		where.WriteString("t.deleted_at < $1")
+		for _, ref := range trashReferences[itemType] {
+			fmt.Fprintf(
+				&where,
+				" and not exists (select 1 from %s r where r.%s = t.id)",
+				trashTables[ref.itemType].name,
+				ref.column,
+			)
+		}
+
+		keys, err := trashFileKeys(ctx, tx, itemType, where.String(), deletedBefore)
+		if err != nil {
+			return 0, nil, err
+		}
+		files = append(files, keys...)
+
+		stmt := fmt.Sprintf("delete from %s t where %s", table.name, where.String())
+
+		result, err := tx.ExecContext(ctx, stmt, deletedBefore)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to purge %s: %w", table.name, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, nil, err
+		}
+		purged += rowsAffected
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return purged, files, nil
+}
+
+// Reassign changes the owner's records that are not in the trash and which
+// refer to the record with ID fromID so that they refer to toID instead. It
+// returns the number of records that were changed, or ErrNoRecord if toID is
+// not a record of the same type that the owner can use.
+func (m *TrashModel) Reassign(ownerID int, itemType TrashItemType, fromID, toID int) (int64, error) {
+	references, ok := trashReferences[itemType]
+	if !ok {
+		return 0, fmt.Errorf("models: records cannot be reassigned from a %s", itemType)
+	}
+
+	if fromID == toID {
+		return 0, ErrNoRecord
+	}
+
+	table := trashTables[itemType]
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existsStmt := fmt.Sprintf(`
+        select exists(
+            select true
+              from %s
+             where id = $1
+               and ($2 or owner_id = $3)
+               and deleted_at is null
+        )
+    `, table.name)
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, existsStmt, toID, table.shared, ownerID).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+
+	if !exists {
+		return 0, ErrNoRecord
+	}
+
+	var reassigned int64
+	for _, ref := range references {
+		refTable := trashTables[ref.itemType]
+
+		version := ""
+		if refTable.versioned {
+			version = "version = version + 1,"
+		}
+
+		stmt := fmt.Sprintf(`
+            update %[1]s
+               set %[2]s updated_at = now(), %[3]s = $1
+             where %[3]s = $2
+               and owner_id = $3
+               and deleted_at is null
+        `, refTable.name, version, ref.column)
+
+		result, err := tx.ExecContext(ctx, stmt, toID, fromID, ownerID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reassign %s: %w", refTable.name, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		reassigned += rowsAffected
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit db transaction: %w", err)
+	}
+
+	return reassigned, nil
+}
+
+// Restore moves the owner's record with the given ID out of the trash. It
+// returns ErrRestoreBlocked if the record refers to any records that are still
+// in the trash, as they must be restored first.
+func (m *TrashModel) Restore(ownerID int, itemType TrashItemType, id int) error {
+	table, err := getTrashTable(itemType)
+	if err != nil {
+		return err
+	}
+
+	// Find the records that this one cannot refer to while they are in the
+	// trash, which are the reverse of the ones that stop them being deleted.
+	var conditions strings.Builder
+	for refType, references := range trashReferences {
+		for _, ref := range references {
+			if ref.itemType != itemType {
+				continue
+			}
+
+			fmt.Fprintf(
+				&conditions,
+				` and not exists (
+                    select 1 from %s r where r.id = t.%s and r.deleted_at is not null
+                )`,
+				trashTables[refType].name,
+				ref.column,
+			)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	stmt := fmt.Sprintf(`
+        update %s t
+           set deleted_at = null
+         where t.id = $1
+           and t.owner_id = $2
+           and t.deleted_at is not null
+    `, table.name)
+
+	result, err := m.DB.ExecContext(ctx, stmt+conditions.String(), id, ownerID)
+	if err != nil {
+		return err
+	}
+
+	err = checkUpdatedOne(result)
+	if errors.Is(err, ErrNoRecord) && conditions.Len() > 0 {
+		item, getErr := m.GetOneByID(ownerID, itemType, id)
+		if getErr == nil && item.Deleted != nil {
+			return ErrRestoreBlocked
+		}
+	}
+
+	return err
+}
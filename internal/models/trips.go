@@ -3,8 +3,11 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Price struct {
@@ -109,6 +112,7 @@ func (nt nullableTrip) ToStruct() *Trip {
 
 type TripModelInterface interface {
 	Exists(id int) (bool, error)
+	ExistsActive(id, ownerID int) (bool, error)
 
 	Insert(
 		ownerID int,
@@ -123,9 +127,29 @@ type TripModelInterface interface {
 		notes string,
 	) (int, error)
 
+	Update(
+		id int,
+		ownerID int,
+		name string,
+		startDate time.Time,
+		endDate time.Time,
+		description string,
+		rating *int,
+		operatorID *int,
+		priceAmount *float64,
+		priceCurrencyID *int,
+		notes string,
+	) error
+
+	GetOneByID(id, ownerID int) (Trip, error)
+
 	List(userID int, pager Pager, sort []SortTrip) ([]Trip, PageData, error)
 
 	ListAll(userID int, sort []SortTrip) ([]Trip, error)
+
+	AttachDives(id, ownerID int, diveIDs []int) (int64, error)
+
+	DetachDives(id, ownerID int, diveIDs []int) (int64, error)
 }
 
 var tripSelectQuery string = `
@@ -136,6 +160,7 @@ var tripSelectQuery string = `
                max(dv.date_time_in) last_dive
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.trip_id
            ),
       operator_dive_stats as (
@@ -145,6 +170,7 @@ var tripSelectQuery string = `
                max(dv.date_time_in) last_dive
           from dives dv
          where dv.owner_id = $1
+           and dv.deleted_at is null
       group by dv.operator_id
            )
     select count(*) over(),
@@ -171,6 +197,7 @@ var tripSelectQuery string = `
  left join currencies          ou on oc.currency_id = ou.id
  left join currencies          cu on tr.currency_id = cu.id
      where tr.owner_id = $1
+       and tr.deleted_at is null
 `
 
 func tripFromDBRow(rs RowScanner, totalRecords *int, tr *Trip) error {
@@ -250,6 +277,26 @@ func (m *TripModel) Exists(id int) (bool, error) {
 	return idExistsInTable(m.DB, id, "trips", "id")
 }
 
+// ExistsActive checks if the owner has a trip with the given ID that is not in
+// the trash.
+func (m *TripModel) ExistsActive(id, ownerID int) (bool, error) {
+	return ownedIDExistsActiveInTable(m.DB, id, ownerID, "trips")
+}
+
+// TripFields holds the values of a new trip. The fields correspond to the
+// arguments of TripModel.Insert.
+type TripFields struct {
+	Name            string
+	StartDate       time.Time
+	EndDate         time.Time
+	Description     string
+	Rating          *int
+	OperatorID      *int
+	PriceAmount     *float64
+	PriceCurrencyID *int
+	Notes           string
+}
+
 func (m *TripModel) Insert(
 	ownerID int,
 	name string,
@@ -262,6 +309,25 @@ func (m *TripModel) Insert(
 	priceCurrencyID *int,
 	notes string,
 ) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	return insertTrip(ctx, m.DB, ownerID, TripFields{
+		Name:            name,
+		StartDate:       startDate,
+		EndDate:         endDate,
+		Description:     description,
+		Rating:          rating,
+		OperatorID:      operatorID,
+		PriceAmount:     priceAmount,
+		PriceCurrencyID: priceCurrencyID,
+		Notes:           notes,
+	})
+}
+
+// insertTrip inserts a new trip using db, which may be a transaction, and
+// returns its ID.
+func insertTrip(ctx context.Context, db sqlRowQuerier, ownerID int, tr TripFields) (int, error) {
 	stmt := `
         insert into trips (
             owner_id, name, start_date, end_date, description, rating,
@@ -272,12 +338,60 @@ func (m *TripModel) Insert(
         returning id
     `
 
+	result := db.QueryRowContext(
+		ctx,
+		stmt,
+		ownerID,
+		tr.Name,
+		tr.StartDate,
+		tr.EndDate,
+		tr.Description,
+		tr.Rating,
+		tr.OperatorID,
+		tr.PriceAmount,
+		tr.PriceCurrencyID,
+		tr.Notes,
+	)
+
+	var id int
+	err := result.Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m *TripModel) Update(
+	id int,
+	ownerID int,
+	name string,
+	startDate time.Time,
+	endDate time.Time,
+	description string,
+	rating *int,
+	operatorID *int,
+	priceAmount *float64,
+	priceCurrencyID *int,
+	notes string,
+) error {
+	stmt := `
+        update trips
+           set updated_at = now(), name = $3, start_date = $4, end_date = $5,
+               description = $6, rating = $7, operator_id = $8, price = $9,
+               currency_id = $10, notes = $11
+         where id = $1
+           and owner_id = $2
+           and deleted_at is null
+    `
+
 	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
 	defer cancel()
 
-	result := m.DB.QueryRowContext(
+	result, err := m.DB.ExecContext(
 		ctx,
 		stmt,
+		id,
 		ownerID,
 		name,
 		startDate,
@@ -289,14 +403,31 @@ func (m *TripModel) Insert(
 		priceCurrencyID,
 		notes,
 	)
+	if err != nil {
+		return fmt.Errorf("failed to update trip %d: %w", id, err)
+	}
 
-	var id int
-	err := result.Scan(&id)
+	return checkUpdatedOne(result)
+}
+
+func (m *TripModel) GetOneByID(id, ownerID int) (Trip, error) {
+	stmt := fmt.Sprintf("%s and tr.id = $2", tripSelectQuery)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Standard)
+	defer cancel()
+
+	var totalRecords int
+	var trip Trip
+	row := m.DB.QueryRowContext(ctx, stmt, ownerID, id)
+	err := tripFromDBRow(row, &totalRecords, &trip)
 	if err != nil {
-		return 0, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return Trip{}, ErrNoRecord
+		}
+		return Trip{}, err
 	}
 
-	return id, nil
+	return trip, nil
 }
 
 func (m *TripModel) List(userID int, pager Pager, sort []SortTrip) ([]Trip, PageData, error) {
@@ -370,3 +501,85 @@ func (m *TripModel) ListAll(userID int, sort []SortTrip) ([]Trip, error) {
 
 	return records, nil
 }
+
+// AttachDives adds the user's dives with the given IDs to the trip, taking them
+// off any other trip that they were part of. It returns the number of dives
+// that were changed, or ErrNoRecord if the trip does not exist.
+func (m *TripModel) AttachDives(id, ownerID int, diveIDs []int) (int64, error) {
+	stmt := `
+        update dives
+           set version = version + 1, updated_at = now(), trip_id = $1
+         where owner_id = $2
+           and id = any($3)
+           and trip_id is distinct from $1
+           and deleted_at is null
+    `
+
+	return m.updateDives(id, ownerID, diveIDs, stmt)
+}
+
+// DetachDives removes the user's dives with the given IDs from the trip. Any
+// of the dives that are not part of the trip are left alone. It returns the
+// number of dives that were changed, or ErrNoRecord if the trip does not exist.
+func (m *TripModel) DetachDives(id, ownerID int, diveIDs []int) (int64, error) {
+	stmt := `
+        update dives
+           set version = version + 1, updated_at = now(), trip_id = null
+         where owner_id = $2
+           and id = any($3)
+           and trip_id = $1
+           and deleted_at is null
+    `
+
+	return m.updateDives(id, ownerID, diveIDs, stmt)
+}
+
+// updateDives runs stmt, which changes the trip that the dives in diveIDs are
+// part of, in the same transaction as checking that the trip exists. The trip
+// ID, owner ID and dive IDs are bound to $1, $2 and $3 respectively.
+func (m *TripModel) updateDives(id, ownerID int, diveIDs []int, stmt string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Moderate)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start db transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existsStmt := `
+        select exists(
+            select true
+              from trips
+             where id = $1 and owner_id = $2 and deleted_at is null
+        )
+    `
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, existsStmt, id, ownerID).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if trip %d exists: %w", id, err)
+	}
+
+	if !exists {
+		return 0, ErrNoRecord
+	}
+
+	result, err := tx.ExecContext(ctx, stmt, id, ownerID, pq.Array(diveIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update the dives of trip %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		msg := "failed to commit db transaction to update the dives of trip %d: %w"
+		return 0, fmt.Errorf(msg, id, err)
+	}
+
+	return rowsAffected, nil
+}
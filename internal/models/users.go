@@ -2,6 +2,8 @@ package models
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"time"
@@ -28,6 +30,7 @@ type User struct {
 	DefaultDivingCountryID int
 	DefaultDivingTZ        TimeZone
 	DarkMode               bool
+	HasCalendarToken       bool
 }
 
 var AnonymousUser = &User{}
@@ -36,6 +39,14 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// NextDiveNumber returns the number to suggest for the user's next dive. Dives
+// in the trash keep their numbers and log books can have gaps, so it follows on
+// from the highest number that has been used if that is more than the total
+// number of dives, which includes the user's dive number offset.
+func (u *User) NextDiveNumber() int {
+	return max(u.MaxDiveNumber, u.TotalDives) + 1
+}
+
 type UserModelInterface interface {
 	Insert(
 		name, email, password string,
@@ -61,6 +72,12 @@ type UserModelInterface interface {
 	) error
 
 	UpdatePassword(userID int, currentPassword, newPassword string) error
+
+	NewCalendarToken(userID int) (string, error)
+
+	RevokeCalendarToken(userID int) error
+
+	GetByCalendarToken(token string) (User, error)
 }
 
 type UserModel struct {
@@ -153,7 +170,9 @@ func (m *UserModel) GetByID(id int) (User, error) {
 
 	stmt := `
         with user_dives as (
-          select count(dv.id) dives_logged,
+          -- Dives in the trash still hold on to their numbers, so they are
+          -- included in the maximum but not in the count.
+          select count(dv.id) filter (where dv.deleted_at is null) dives_logged,
                  coalesce(max(dv.number), 0) max_dive_number
             from dives dv
            where owner_id = $1
@@ -164,7 +183,8 @@ func (m *UserModel) GetByID(id int) (User, error) {
                ud.dives_logged,
                ud.dives_logged + us.dive_number_offset total_dives,
                ud.max_dive_number,
-               us.default_diving_country_id, us.default_diving_tz
+               us.default_diving_country_id, us.default_diving_tz,
+               us.calendar_token_hash is not null has_calendar_token
           from users us
     cross join user_dives ud
          where us.id = $1
@@ -184,10 +204,11 @@ func (m *UserModel) GetByID(id int) (User, error) {
 		&user.DivingSince,
 		&user.DiveNumberOffset,
 		&user.DivesLogged,
-		&user.MaxDiveNumber,
 		&user.TotalDives,
+		&user.MaxDiveNumber,
 		&user.DefaultDivingCountryID,
 		&user.DefaultDivingTZ,
+		&user.HasCalendarToken,
 	)
 
 	if err != nil {
@@ -312,3 +333,84 @@ func (m UserModel) Update(
 
 	return nil
 }
+
+// NewCalendarToken generates a new secret token for the user's calendar feed,
+// replacing any existing one, and returns it. Only a hash of the token is
+// stored, so it cannot be retrieved again later.
+func (m *UserModel) NewCalendarToken(userID int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	token := rand.Text()
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `update users set calendar_token_hash = $2 where id = $1`
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected != 1 {
+		if rowsAffected == 0 {
+			return "", ErrNoRecord
+		} else if rowsAffected > 1 {
+			return "", &ErrUnexpectedRowsAffected{rowsExpected: 1, rowsAffected: int(rowsAffected)}
+		}
+
+		return "", err
+	}
+
+	return token, nil
+}
+
+// RevokeCalendarToken removes the user's calendar feed token so that the feed
+// can no longer be fetched.
+func (m *UserModel) RevokeCalendarToken(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	stmt := `update users set calendar_token_hash = null where id = $1`
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// GetByCalendarToken returns the active user whose calendar feed token is
+// token, or ErrNoRecord if there is not one.
+func (m *UserModel) GetByCalendarToken(token string) (User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeouts.Quick)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(token))
+
+	var id int
+
+	stmt := `select id from users
+              where calendar_token_hash = $1
+                and suspended = false and deleted = false`
+	err := m.DB.QueryRowContext(ctx, stmt, hash[:]).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, err
+		}
+	}
+
+	return m.GetByID(id)
+}
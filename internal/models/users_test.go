@@ -45,3 +45,22 @@ func TestUserModelExists(t *testing.T) {
 		})
 	}
 }
+
+func TestUserNextDiveNumber(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		want int
+	}{
+		{"No dives", User{}, 1},
+		{"Dive number offset", User{TotalDives: 100, DiveNumberOffset: 100}, 101},
+		{"Gap in numbers", User{TotalDives: 3, MaxDiveNumber: 7}, 8},
+		{"Dive in trash", User{DivesLogged: 1, TotalDives: 1, MaxDiveNumber: 2}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.user.NextDiveNumber(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,353 @@
+// Package pdf writes simple PDF documents made up of text, lines and boxes
+// without any external dependencies. Only the standard Helvetica fonts are
+// supported, so that no font files need to be embedded, and text is encoded
+// using WinAnsiEncoding with any characters outside of it replaced by a
+// question mark.
+//
+// Positions are given in points from the top left corner of the page, with y
+// increasing down the page, and text is positioned by its baseline.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The dimensions in points of an A4 page.
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Font is one of the standard PDF fonts that every PDF reader provides.
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = map[Font]string{
+	Helvetica:     "Helvetica",
+	HelveticaBold: "Helvetica-Bold",
+}
+
+// fontWidths holds the widths in thousandths of an em of the printable ASCII
+// characters from space to tilde for each font.
+var fontWidths = map[Font][95]int{
+	Helvetica: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	HelveticaBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// defaultWidth is used for the width of any character outside of printable
+// ASCII.
+const defaultWidth = 556
+
+// winAnsi maps the characters of WinAnsiEncoding that differ from Latin-1 onto
+// their byte values.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// encode converts s into WinAnsiEncoding.
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			b = append(b, ' ')
+		case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+			b = append(b, byte(r))
+		case winAnsi[r] != 0:
+			b = append(b, winAnsi[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// TextWidth returns the width in points of s when set in the given font and
+// size.
+func TextWidth(font Font, size float64, s string) float64 {
+	widths := fontWidths[font]
+
+	var total int
+	for _, c := range encode(s) {
+		if c >= 0x20 && c < 0x7F {
+			total += widths[c-0x20]
+		} else {
+			total += defaultWidth
+		}
+	}
+
+	return float64(total) * size / 1000
+}
+
+// WrapText splits s into lines that are no wider than width when set in the
+// given font and size, breaking between words where possible. Line breaks in
+// s are kept.
+func WrapText(font Font, size, width float64, s string) []string {
+	var lines []string
+
+	for _, para := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.FieldsFunc(para, unicode.IsSpace) {
+			candidate := strings.TrimSpace(line + " " + word)
+			if TextWidth(font, size, candidate) <= width {
+				line = candidate
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, line)
+			}
+
+			// Break words that are too long to fit on a line by themselves.
+			line = ""
+			for _, r := range word {
+				if TextWidth(font, size, line+string(r)) > width && line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// Truncate shortens s with an ellipsis so that it is no wider than width when
+// set in the given font and size.
+func Truncate(font Font, size, width float64, s string) string {
+	if TextWidth(font, size, s) <= width {
+		return s
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 && TextWidth(font, size, string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+
+	return strings.TrimSpace(string(runes)) + "…"
+}
+
+// Page is a single page of a Document.
+type Page struct {
+	width   float64
+	height  float64
+	content bytes.Buffer
+}
+
+// y converts a distance from the top of the page into the PDF coordinate
+// space, which starts at the bottom of the page.
+func (p *Page) y(y float64) float64 {
+	return p.height - y
+}
+
+// Text draws s with its baseline starting at the given position.
+func (p *Page) Text(x, y float64, font Font, size float64, s string) {
+	var escaped bytes.Buffer
+	for _, c := range encode(s) {
+		if c == '(' || c == ')' || c == '\\' {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteByte(c)
+	}
+
+	fmt.Fprintf(
+		&p.content,
+		"BT /F%d %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		font+1, size, x, p.y(y), escaped.Bytes(),
+	)
+}
+
+// TextRight draws s so that it ends at x.
+func (p *Page) TextRight(x, y float64, font Font, size float64, s string) {
+	p.Text(x-TextWidth(font, size, s), y, font, size, s)
+}
+
+// TextCentre draws s so that it is centred on x.
+func (p *Page) TextCentre(x, y float64, font Font, size float64, s string) {
+	p.Text(x-TextWidth(font, size, s)/2, y, font, size, s)
+}
+
+// Line draws a line of the given width between the two points.
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(
+		&p.content,
+		"%.2f w %.2f %.2f m %.2f %.2f l S\n",
+		width, x1, p.y(y1), x2, p.y(y2),
+	)
+}
+
+// Rect draws the outline of a rectangle whose top left corner is at x, y.
+func (p *Page) Rect(x, y, w, h, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f %.2f %.2f re S\n", width, x, p.y(y+h), w, h)
+}
+
+// FillRect fills a rectangle whose top left corner is at x, y with a shade of
+// grey between 0 for black and 1 for white.
+func (p *Page) FillRect(x, y, w, h, grey float64) {
+	fmt.Fprintf(
+		&p.content,
+		"q %.3f g %.2f %.2f %.2f %.2f re f Q\n",
+		grey, x, p.y(y+h), w, h,
+	)
+}
+
+// Document is a PDF document under construction.
+type Document struct {
+	Title   string
+	Author  string
+	Creator string
+	Created time.Time
+	pages   []*Page
+}
+
+// AddPage adds a new blank A4 page to the end of the document and returns it.
+func (d *Document) AddPage() *Page {
+	page := &Page{width: A4Width, height: A4Height}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// PageCount returns the number of pages in the document.
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// pdfString encodes s as a PDF literal string.
+func pdfString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+	return "(" + r.Replace(string(encode(s))) + ")"
+}
+
+// WriteTo writes the document to w as a complete PDF file.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	// Objects 1 to 5 are the catalogue, page tree, fonts and document info,
+	// followed by a page object and a content stream for each page.
+	var offsets []int64
+	object := func(body string) {
+		offsets = append(offsets, cw.n)
+		fmt.Fprintf(cw, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	fmt.Fprint(cw, "%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf(
+		"<< /Type /Pages /Kids [%s] /Count %d >>",
+		strings.Join(kids, " "), len(d.pages),
+	))
+	for _, font := range []Font{Helvetica, HelveticaBold} {
+		object(fmt.Sprintf(
+			"<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>",
+			fontNames[font],
+		))
+	}
+
+	created := d.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	_, offset := created.Zone()
+	object(fmt.Sprintf(
+		"<< /Title %s /Author %s /Creator %s /Producer %s /CreationDate (D:%s%+03d'%02d') >>",
+		pdfString(d.Title),
+		pdfString(d.Author),
+		pdfString(d.Creator),
+		pdfString(d.Creator),
+		created.Format("20060102150405"),
+		offset/3600,
+		abs(offset%3600/60),
+	))
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+				"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			page.width, page.height, 7+i*2,
+		))
+		object(fmt.Sprintf(
+			"<< /Length %d >>\nstream\n%sendstream",
+			page.content.Len(), page.content.String(),
+		))
+	}
+
+	xref := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(
+		cw,
+		"trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, xref,
+	)
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+
+	return cw.n, cw.w.Flush()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// countingWriter keeps track of the number of bytes written so far so that the
+// offset of each object can be recorded in the cross-reference table. The
+// first error is kept and all further writes are ignored.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+
+	return n, err
+}
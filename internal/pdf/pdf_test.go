@@ -0,0 +1,76 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestDocumentWriteTo(t *testing.T) {
+	doc := &Document{Title: "Log Book", Author: "Alice (Diver)", Creator: "DiveSite"}
+
+	page := doc.AddPage()
+	page.Text(40, 60, HelveticaBold, 18, "Dive #1 (Sail Rock)")
+	page.Line(40, 70, 200, 70, 1)
+	page = doc.AddPage()
+	page.Rect(40, 40, 100, 50, 0.5)
+	page.Text(40, 120, Helvetica, 10, "28°C – café")
+
+	var buf bytes.Buffer
+	n, err := doc.WriteTo(&buf)
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(buf.Len()))
+
+	out := buf.String()
+	assert.Equal(t, strings.HasPrefix(out, "%PDF-1.4\n"), true)
+	assert.Equal(t, strings.HasSuffix(out, "%%EOF\n"), true)
+	assert.StringContains(t, out, "/Count 2")
+	assert.StringContains(t, out, `(Dive #1 \(Sail Rock\)) Tj`)
+	assert.StringContains(t, out, "(28\xB0C \x96 caf\xE9) Tj")
+	assert.StringContains(t, out, `/Author (Alice \(Diver\))`)
+
+	// Every object in the cross-reference table must start at its offset.
+	xref := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(out, -1)
+	assert.Equal(t, len(xref), 9)
+	for i, m := range xref {
+		offset, _ := strconv.Atoi(m[1])
+		assert.Equal(t, strings.HasPrefix(out[offset:], fmt.Sprintf("%d 0 obj", i+1)), true)
+	}
+
+	startXref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(out)
+	offset, _ := strconv.Atoi(startXref[1])
+	assert.Equal(t, strings.HasPrefix(out[offset:], "xref\n"), true)
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width float64
+		want  []string
+	}{
+		{"Fits", "Great dive", 100, []string{"Great dive"}},
+		{"Wraps", "Saw a whale shark on the safety stop", 100, []string{
+			"Saw a whale shark on", "the safety stop",
+		}},
+		{"Keeps line breaks", "One\n\nTwo", 100, []string{"One", "", "Two"}},
+		{"Breaks long words", "Aaaaaaaaaaaa", 30, []string{"Aaaaa", "aaaaa", "aa"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := WrapText(Helvetica, 10, tt.width, tt.text)
+			assert.Equal(t, strings.Join(got, "|"), strings.Join(tt.want, "|"))
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, Truncate(Helvetica, 10, 100, "Sail Rock"), "Sail Rock")
+	assert.Equal(t, Truncate(Helvetica, 10, 40, "Chumphon Pinnacle"), "Chump…")
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/m5lapp/divesite-monolith/internal/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	assert.NilError(t, err)
+
+	const key = "certifications/1/2/front"
+
+	t.Run("Get missing file", func(t *testing.T) {
+		_, err := store.Get(key)
+		assert.Equal(t, errors.Is(err, ErrNotFound), true)
+	})
+
+	t.Run("Put and Get", func(t *testing.T) {
+		assert.NilError(t, store.Put(key, strings.NewReader("first")))
+		assert.NilError(t, store.Put(key, strings.NewReader("second")))
+
+		f, err := store.Get(key)
+		assert.NilError(t, err)
+		defer f.Close()
+
+		content, err := io.ReadAll(f)
+		assert.NilError(t, err)
+		assert.Equal(t, string(content), "second")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.NilError(t, store.Delete(key))
+		assert.NilError(t, store.Delete(key))
+
+		_, err := store.Get(key)
+		assert.Equal(t, errors.Is(err, ErrNotFound), true)
+	})
+
+	t.Run("Invalid keys", func(t *testing.T) {
+		for _, key := range []string{"", ".", "../escape", "/absolute", "a/../../b"} {
+			err := store.Put(key, strings.NewReader("x"))
+			assert.Equal(t, errors.Is(err, ErrInvalidKey), true)
+		}
+	})
+}
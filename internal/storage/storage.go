@@ -0,0 +1,40 @@
+// Package storage keeps files that users upload, such as the images of their
+// certification cards, outside of the database. Files are addressed by keys
+// that look like slash-separated relative paths, for example
+// "certifications/1/2/front".
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// ErrNotFound is returned when there is no file stored under a key.
+var ErrNotFound = errors.New("storage: file not found")
+
+// ErrInvalidKey is returned when a key is not a clean, relative,
+// slash-separated path.
+var ErrInvalidKey = errors.New("storage: invalid key")
+
+// Store is somewhere that files can be saved to and read back from by key. It
+// is implemented by LocalStore, but others such as an object store could be
+// added without the rest of the application needing to change.
+type Store interface {
+	// Put saves everything read from r under key, replacing any file that was
+	// already stored there.
+	Put(key string, r io.Reader) error
+
+	// Get returns the file stored under key, which the caller must close.
+	Get(key string) (io.ReadCloser, error)
+
+	// Delete removes the file stored under key. It is not an error if there is
+	// no file stored there.
+	Delete(key string) error
+}
+
+// validKey reports whether key can safely be used as a file name within a
+// store without escaping it.
+func validKey(key string) bool {
+	return key != "." && fs.ValidPath(key)
+}
@@ -0,0 +1,3 @@
+drop index if exists csv_mappings_owner_id_idx;
+
+drop table if exists csv_mappings;
@@ -0,0 +1,23 @@
+create table if not exists csv_mappings (
+    id            bigint       primary key generated always as identity,
+    created_at    timestamp(6) with time zone not null default now(),
+    updated_at    timestamp(6) with time zone not null default now(),
+    owner_id      bigint       not null references users(id) on delete cascade,
+    name          varchar(256) not null,
+    headers       text[]       not null,
+    fields        text[]       not null,
+    date_format   varchar(16)  not null,
+    depth_unit    varchar(8)   not null,
+    temp_unit     varchar(8)   not null,
+    pressure_unit varchar(8)   not null,
+    weight_unit   varchar(8)   not null,
+    duration_unit varchar(8)   not null,
+    unique(owner_id, name),
+    check (cardinality(headers) = cardinality(fields))
+);
+
+create trigger update_updated_at_timestamp
+before update on csv_mappings
+for each row execute function update_updated_at_timestamp();
+
+create index if not exists csv_mappings_owner_id_idx on csv_mappings (owner_id);
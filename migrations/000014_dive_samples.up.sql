@@ -0,0 +1,12 @@
+create table if not exists dive_samples (
+    dive_id     bigint        not null references dives(id) on delete cascade,
+    elapsed     integer       not null,
+    depth       numeric(5, 2) not null,
+    temperature numeric(4, 1)     null,
+    pressure    numeric(5, 1)     null,
+    ppo2        numeric(4, 2)     null,
+    events      text[]        not null default '{}',
+    primary key(dive_id, elapsed),
+    check (elapsed >= 0),
+    check (depth >= 0)
+);
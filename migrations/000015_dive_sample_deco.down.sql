@@ -0,0 +1,6 @@
+alter table dive_samples
+    drop constraint if exists dive_samples_stop_check,
+    drop constraint if exists dive_samples_cns_check,
+    drop column if exists stop_time,
+    drop column if exists stop_depth,
+    drop column if exists cns;
@@ -0,0 +1,6 @@
+alter table dive_samples
+    add column if not exists cns        numeric(4, 1) null,
+    add column if not exists stop_depth numeric(5, 2) null,
+    add column if not exists stop_time  integer       null,
+    add constraint dive_samples_cns_check check (cns >= 0),
+    add constraint dive_samples_stop_check check (stop_depth > 0 and stop_time >= 0);
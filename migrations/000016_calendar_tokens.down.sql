@@ -0,0 +1 @@
+alter table users drop column if exists calendar_token_hash;
@@ -0,0 +1,3 @@
+-- Only a SHA-256 hash of each user's calendar feed token is stored so that the
+-- feed URLs cannot be recovered from the database.
+alter table users add column if not exists calendar_token_hash bytea unique;
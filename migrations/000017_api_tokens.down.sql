@@ -0,0 +1,3 @@
+drop index if exists api_tokens_owner_id_idx;
+
+drop table if exists api_tokens;
@@ -0,0 +1,14 @@
+-- Personal API access tokens. As with calendar tokens, only a SHA-256 hash of
+-- each token is stored so that they cannot be recovered from the database.
+create table if not exists api_tokens (
+    id           bigint       primary key generated always as identity,
+    created_at   timestamp(6) with time zone not null default now(),
+    owner_id     bigint       not null references users(id) on delete cascade,
+    name         varchar(256) not null,
+    token_hash   bytea        not null unique,
+    scope        varchar(16)  not null check (scope in ('read', 'read_write')),
+    expires_at   timestamp(6) with time zone,
+    last_used_at timestamp(6) with time zone
+);
+
+create index if not exists api_tokens_owner_id_idx on api_tokens (owner_id);
@@ -0,0 +1,24 @@
+drop index if exists dive_plans_trash_idx;
+drop index if exists certifications_trash_idx;
+drop index if exists trips_trash_idx;
+drop index if exists operators_trash_idx;
+drop index if exists buddies_trash_idx;
+drop index if exists dive_sites_trash_idx;
+drop index if exists dives_trash_idx;
+
+-- Anything still in the trash would reappear, so remove it first.
+delete from dives          where deleted_at is not null;
+delete from dive_plans     where deleted_at is not null;
+delete from certifications where deleted_at is not null;
+delete from trips          where deleted_at is not null;
+delete from buddies        where deleted_at is not null;
+delete from operators      where deleted_at is not null;
+delete from dive_sites     where deleted_at is not null;
+
+alter table dive_plans     drop column if exists deleted_at;
+alter table certifications drop column if exists deleted_at;
+alter table trips          drop column if exists deleted_at;
+alter table operators      drop column if exists deleted_at;
+alter table buddies        drop column if exists deleted_at;
+alter table dive_sites     drop column if exists deleted_at;
+alter table dives          drop column if exists deleted_at;
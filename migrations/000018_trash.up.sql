@@ -0,0 +1,24 @@
+-- Records in the log book are moved to their owner's trash by setting
+-- deleted_at, from where they can be restored until they are purged.
+alter table dives          add column if not exists deleted_at timestamp(6) with time zone;
+alter table dive_sites     add column if not exists deleted_at timestamp(6) with time zone;
+alter table buddies        add column if not exists deleted_at timestamp(6) with time zone;
+alter table operators      add column if not exists deleted_at timestamp(6) with time zone;
+alter table trips          add column if not exists deleted_at timestamp(6) with time zone;
+alter table certifications add column if not exists deleted_at timestamp(6) with time zone;
+alter table dive_plans     add column if not exists deleted_at timestamp(6) with time zone;
+
+create index if not exists dives_trash_idx
+    on dives (owner_id, deleted_at) where deleted_at is not null;
+create index if not exists dive_sites_trash_idx
+    on dive_sites (owner_id, deleted_at) where deleted_at is not null;
+create index if not exists buddies_trash_idx
+    on buddies (owner_id, deleted_at) where deleted_at is not null;
+create index if not exists operators_trash_idx
+    on operators (owner_id, deleted_at) where deleted_at is not null;
+create index if not exists trips_trash_idx
+    on trips (owner_id, deleted_at) where deleted_at is not null;
+create index if not exists certifications_trash_idx
+    on certifications (owner_id, deleted_at) where deleted_at is not null;
+create index if not exists dive_plans_trash_idx
+    on dive_plans (owner_id, deleted_at) where deleted_at is not null;
@@ -0,0 +1 @@
+drop table if exists certification_cards;
@@ -0,0 +1,10 @@
+-- Images of the front and back of certification cards. The images themselves
+-- are kept in the file store under storage_key rather than in the database.
+create table if not exists certification_cards (
+    certification_id bigint       not null references certifications(id) on delete cascade,
+    side             varchar(8)   not null check (side in ('front', 'back')),
+    created_at       timestamp(6) with time zone not null default now(),
+    storage_key      varchar(512) not null,
+    content_type     varchar(64)  not null,
+    primary key (certification_id, side)
+);
@@ -0,0 +1,8 @@
+drop index if exists operators_search_idx;
+drop index if exists trips_search_idx;
+drop index if exists buddies_search_idx;
+drop index if exists dive_sites_search_idx;
+drop index if exists dives_search_idx;
+
+-- The corrected dive_site_name_idx is kept rather than being recreated on the
+-- wrong table, as 000003_dive_sites drops it by name either way.
@@ -0,0 +1,25 @@
+-- The dive site name index was created on the countries table by mistake, so
+-- searches by dive site name were never indexed.
+drop index if exists dive_site_name_idx;
+
+create index if not exists dive_site_name_idx
+    on dive_sites using gin (to_tsvector('simple', name));
+
+-- Indexes for the full-text search of the log book. Each expression must match
+-- the document that is searched for the table in internal/models/search.go.
+create index if not exists dives_search_idx
+    on dives using gin (to_tsvector('simple',
+        notes || ' ' || gas_mix_notes || ' ' || weight_notes || ' ' || equipment_notes));
+
+create index if not exists dive_sites_search_idx
+    on dive_sites using gin (to_tsvector('simple',
+        name || ' ' || alt_name || ' ' || location || ' ' || region || ' ' || notes));
+
+create index if not exists buddies_search_idx
+    on buddies using gin (to_tsvector('simple', name || ' ' || notes));
+
+create index if not exists trips_search_idx
+    on trips using gin (to_tsvector('simple', name || ' ' || description));
+
+create index if not exists operators_search_idx
+    on operators using gin (to_tsvector('simple', name));
@@ -0,0 +1,13 @@
+-- Log book files that have been uploaded and parsed but not yet committed, so
+-- that they do not have to be kept in the user's session between the preview
+-- and the import. Rows that pass expires_at are purged periodically.
+create table if not exists pending_imports (
+    id         bigserial    primary key,
+    owner_id   bigint       not null references users(id) on delete cascade,
+    kind       varchar(16)  not null,
+    created_at timestamp(6) with time zone not null default now(),
+    expires_at timestamp(6) with time zone not null,
+    data       bytea        not null
+);
+
+create index if not exists pending_imports_expires_at_idx on pending_imports (expires_at);
@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"html/template"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -28,8 +29,17 @@ func renderGomponent(component g.Node) (template.HTML, error) {
 	return template.HTML(htmlBuilder.String()), err
 }
 
+// pageField returns a link to the page linkPage. Any query string on link, such
+// as the filters for the list, is kept with the page and page_size set on it.
 func pageField(text, link string, linkPage, pageSize int, active, disabled bool) g.Node {
 	urlPath := fmt.Sprintf("%s?page=%d&page_size=%d", link, linkPage, pageSize)
+	if u, err := url.Parse(link); err == nil {
+		qs := u.Query()
+		qs.Set("page", strconv.Itoa(linkPage))
+		qs.Set("page_size", strconv.Itoa(pageSize))
+		u.RawQuery = qs.Encode()
+		urlPath = u.String()
+	}
 
 	return Li(
 		c.Classes{"page-item": true, "active": active, "disabled": disabled},
@@ -37,6 +47,9 @@ func pageField(text, link string, linkPage, pageSize int, active, disabled bool)
 	)
 }
 
+// PageControls returns the pagination controls for a list at path, which may
+// include a query string with the list's filters so that they are kept when
+// moving between pages.
 func PageControls(path string, pd models.PageData) (template.HTML, error) {
 	isCurr := func(page int) bool { return pd.CurrentPage == page }
 
@@ -64,6 +77,36 @@ func PageControls(path string, pd models.PageData) (template.HTML, error) {
 	return renderGomponent(component)
 }
 
+// SortLink returns a link for the header of the column key in the list at
+// path, which may include a query string with the list's filters. The link
+// sorts the list by key, or reverses the sort if the list is already sorted by
+// key first, which current is shown by an arrow. Both sort and current use the
+// syntax of the "sort" query string value, such as "-max_depth,date".
+func SortLink(text, path, key, current string) (template.HTML, error) {
+	primary, _, _ := strings.Cut(current, ",")
+	title := "Sort by " + text
+
+	sort := key
+	switch primary {
+	case key:
+		sort = "-" + key
+		text += " ▲"
+	case "-" + key:
+		text += " ▼"
+	}
+
+	link := path
+	if u, err := url.Parse(path); err == nil {
+		qs := u.Query()
+		qs.Set("sort", sort)
+		qs.Del("page")
+		u.RawQuery = qs.Encode()
+		link = u.String()
+	}
+
+	return renderGomponent(A(Href(link), Title(title), g.Text(text)))
+}
+
 func id(name string) string {
 	return "id_" + name
 }